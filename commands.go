@@ -0,0 +1,658 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains subcommands of the command line interface
+// (export, list-tables, describe, count, diff, check and config). Each subcommand
+// has its own flags, help text and exit codes. When the first argument is a
+// flag (or when no argument is given), the legacy form with mutually
+// exclusive boolean flags is used, so existing deployments keep working.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/commands.html
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Messages
+const (
+	unknownCommand         = "unknown command: %s"
+	wrongNumberOfArguments = "wrong number of arguments for command %s"
+	unexpectedArguments    = "unexpected arguments: %s"
+	conflictingFlags       = "conflicting flags: %s"
+	unknownSchemaFormat    = "unknown schema format: %s"
+)
+
+// Formats of schema printed by describe command
+const (
+	schemaFormatText = "text"
+	schemaFormatJSON = "json"
+	schemaFormatSQL  = "sql"
+)
+
+// helpCommand is name of command that prints help for other commands
+const helpCommand = "help"
+
+// commandRunner is a function that performs one subcommand. Positional
+// arguments given on command line are passed in args. Values measured by
+// export are recorded into runMetrics.
+type commandRunner func(configuration *ConfigStruct, cliFlags CliFlags,
+	args []string, output io.Writer, operationLogger *zerolog.Logger, runMetrics *RunMetrics) (int, error)
+
+// Command represents one subcommand of command line interface
+type Command struct {
+	// Name is used on command line to select the subcommand
+	Name string
+
+	// Arguments describes positional arguments in help text
+	Arguments string
+
+	// Description is printed in help text
+	Description string
+
+	// MinArgs and MaxArgs limit number of positional arguments, negative
+	// MaxArgs means no limit
+	MinArgs int
+	MaxArgs int
+
+	// ExitCodes lists exit codes the subcommand can return
+	ExitCodes []int
+
+	defineFlags func(flags *flag.FlagSet, cliFlags *CliFlags)
+	run         commandRunner
+}
+
+// exitStatusDescriptions contains description of all exit codes
+var exitStatusDescriptions = map[int]string{
+	ExitStatusOK:                 "success",
+	ExitStatusLoggingError:       "logging initialization error",
+	ExitStatusStorageError:       "storage (database) error",
+	ExitStatusS3Error:            "S3/Minio error",
+	ExitStatusConfigurationError: "wrong configuration or command line flags",
+	ExitStatusIOError:            "I/O error",
+	ExitStatusPartialSuccess:     "some tables were not exported",
+	ExitStatusIncomplete:         "stopped by signal or deadline",
+	ExitStatusPreflightFailed:    "some check failed",
+	ExitStatusSchemaDrift:        "schema of tables differs from previous export",
+}
+
+// commands contains all subcommands in order they are printed in help
+var commands = []Command{
+	{
+		Name:        "export",
+		Description: "Export all tables into S3 or into files in output directory.",
+		MaxArgs:     0,
+		ExitCodes: []int{ExitStatusOK, ExitStatusStorageError, ExitStatusS3Error,
+			ExitStatusConfigurationError, ExitStatusIOError,
+			ExitStatusPartialSuccess, ExitStatusIncomplete, ExitStatusSchemaDrift},
+		defineFlags: defineExportFlags,
+		run:         runExport,
+	},
+	{
+		Name:        "list-tables",
+		Description: "Print names of all tables in database, one table per line.",
+		MaxArgs:     0,
+		ExitCodes:   []int{ExitStatusOK, ExitStatusStorageError},
+		defineFlags: defineIgnoredTablesFlag,
+		run:         runListTables,
+	},
+	{
+		Name:        "describe",
+		Arguments:   "<table>",
+		Description: "Print schema of given table: columns, keys, indexes and number of rows.",
+		MinArgs:     1,
+		MaxArgs:     1,
+		ExitCodes: []int{ExitStatusOK, ExitStatusStorageError,
+			ExitStatusConfigurationError, ExitStatusIOError},
+		defineFlags: defineDescribeFlags,
+		run:         runDescribe,
+	},
+	{
+		Name:        "count",
+		Arguments:   "[table...]",
+		Description: "Print number of records that would be exported from given tables (all tables by default).",
+		MaxArgs:     -1,
+		ExitCodes:   []int{ExitStatusOK, ExitStatusStorageError},
+		defineFlags: defineIgnoredTablesFlag,
+		run:         runCount,
+	},
+	{
+		Name:        "diff",
+		Arguments:   "<old> <new>",
+		Description: "Compare tables stored by two exports (directories or s3://bucket/prefix) and store added, removed and changed rows.",
+		MinArgs:     2,
+		MaxArgs:     2,
+		ExitCodes: []int{ExitStatusOK, ExitStatusS3Error,
+			ExitStatusConfigurationError, ExitStatusIOError, ExitStatusIncomplete},
+		defineFlags: defineDiffFlags,
+		run:         runDiff,
+	},
+	{
+		Name:        "check",
+		Description: "Check access to database, organization IDs file and S3 and print checklist.",
+		MaxArgs:     0,
+		ExitCodes:   []int{ExitStatusOK, ExitStatusS3Error, ExitStatusIOError, ExitStatusPreflightFailed},
+		defineFlags: defineCheckFlags,
+		run:         runCheck,
+	},
+	{
+		Name:        "config",
+		Description: "Print actual configuration (secrets are omitted).",
+		MaxArgs:     0,
+		ExitCodes:   []int{ExitStatusOK},
+		run:         runConfig,
+	},
+}
+
+// legacyCommand is used when no subcommand is given on command line
+var legacyCommand = Command{
+	MaxArgs: 0,
+	run: func(configuration *ConfigStruct, cliFlags CliFlags, _ []string,
+		_ io.Writer, operationLogger *zerolog.Logger, runMetrics *RunMetrics) (int, error) {
+		return doSelectedOperation(configuration, cliFlags, operationLogger, runMetrics)
+	},
+}
+
+// defineExportFlags function defines flags that control export.
+func defineExportFlags(flags *flag.FlagSet, cliFlags *CliFlags) {
+	flags.BoolVar(&cliFlags.PrintSummaryTable, "summary", false, "print summary table after export")
+	flags.StringVar(&cliFlags.Output, "output", "S3", "output to: file, S3")
+	flags.StringVar(&cliFlags.OutputDir, "output-dir", "", "directory where files are written for file output (overrides [file] output_dir)")
+	flags.BoolVar(&cliFlags.Force, "force", false, "overwrite files of previous export for file output")
+	flags.BoolVar(&cliFlags.ExportMetadata, "metadata", false, "export metadata")
+	flags.BoolVar(&cliFlags.ExportDisabledRules, "disabled-by-more-users", false, "export report about rules disabled by users")
+	flags.BoolVar(&cliFlags.ExportRuleHitsSummary, "rule-hits-summary", false, "export analytics about rule hits into _rule_hits_summary.csv and .json")
+	flags.BoolVar(&cliFlags.ExportFeedbackSummary, "feedback-summary", false, "export aggregated user feedback and ratings into _feedback_summary")
+	flags.StringVar(&cliFlags.FeedbackFormat, "feedback-format", feedbackFormatCSV, "format of feedback summary: csv, json")
+	flags.BoolVar(&cliFlags.FeedbackWithDisabledRules, "feedback-with-disabled-rules", false, "join feedback summary with rules disabled by users")
+	flags.BoolVar(&cliFlags.FlattenReports, "flatten-reports", false, "export rule results parsed from reports as normalized rows")
+	flags.BoolVar(&cliFlags.ExportLog, "export-log", false, "export log")
+	flags.BoolVar(&cliFlags.ExportSchema, "schema", false, "export schema of tables into _schema.json")
+	flags.BoolVar(&cliFlags.ExportSchemaSQL, "schema-sql", false, "export schema of tables also as DDL script into _schema.sql")
+	flags.BoolVar(&cliFlags.ExportProfile, "profile", false, "compute column profiles of exported tables into _profile.json")
+	flags.IntVar(&cliFlags.Limit, "limit", -1, "limit number of exported records")
+	defineIgnoredTablesFlag(flags, cliFlags)
+	flags.Float64Var(&cliFlags.SamplePercent, "sample-percent", 0, "export given percentage of randomly selected rows from each table")
+	flags.IntVar(&cliFlags.SamplePerOrg, "sample-per-org", 0, "export at most given number of rows per organization")
+	flags.IntVar(&cliFlags.SampleOrgs, "sample-orgs", 0, "export the same randomly selected organizations from all tables")
+	flags.Int64Var(&cliFlags.SampleSeed, "sample-seed", 0, "seed used for sampling (random seed is generated when not set)")
+	flags.BoolVar(&cliFlags.PartitionByOrg, "partition-by-org", false, "export each organization into its own org_id=N directory")
+	flags.BoolVar(&cliFlags.ContinueOnError, "continue-on-error", false, "export remaining tables when export of a table fails")
+	flags.BoolVar(&cliFlags.AcceptSchemaDrift, "accept-schema-drift", false, "accept schema drift detected by fail policy and store actual columns")
+	flags.DurationVar(&cliFlags.Deadline, "deadline", 0, "stop export gracefully after given duration (for example 50m)")
+	flags.BoolVar(&cliFlags.DryRun, "dry-run", false, "print what would be exported without writing anything")
+}
+
+// defineIgnoredTablesFlag function defines flag with list of ignored tables.
+func defineIgnoredTablesFlag(flags *flag.FlagSet, cliFlags *CliFlags) {
+	flags.StringVar(&cliFlags.IgnoredTables, "ignore-tables", "", "comma-separated list of tables that will be ignored")
+}
+
+// defineDescribeFlags function defines flags of describe command.
+func defineDescribeFlags(flags *flag.FlagSet, cliFlags *CliFlags) {
+	flags.StringVar(&cliFlags.SchemaFormat, "format", schemaFormatText, "format of schema: text, json, sql")
+}
+
+// defineDiffFlags function defines flags of diff command.
+func defineDiffFlags(flags *flag.FlagSet, cliFlags *CliFlags) {
+	flags.StringVar(&cliFlags.DiffFormat, "format", diffFormatCSV, "format of differences: csv, json")
+	flags.StringVar(&cliFlags.DiffOutputDir, "output-dir", ".", "directory where differences of tables are stored")
+	flags.DurationVar(&cliFlags.Deadline, "deadline", 0, "stop comparing after given duration (for example 5m)")
+	defineIgnoredTablesFlag(flags, cliFlags)
+}
+
+// defineCheckFlags function defines flags of check command.
+func defineCheckFlags(flags *flag.FlagSet, cliFlags *CliFlags) {
+	flags.StringVar(&cliFlags.Output, "output", "S3", "output to check: file, S3")
+	flags.BoolVar(&cliFlags.CheckS3Connection, "s3-only", false, "check S3 connection and bucket only")
+	defineIgnoredTablesFlag(flags, cliFlags)
+}
+
+// defineLegacyFlags function defines flags used when no subcommand is given.
+func defineLegacyFlags(flags *flag.FlagSet, cliFlags *CliFlags) {
+	flags.BoolVar(&cliFlags.ShowVersion, "version", false, "show version")
+	flags.BoolVar(&cliFlags.ShowAuthors, "authors", false, "show authors")
+	flags.BoolVar(&cliFlags.ShowConfiguration, "show-configuration", false, "show configuration")
+	flags.BoolVar(&cliFlags.CheckS3Connection, "check-s3-connection", false, "check S3 connection and exit")
+	flags.BoolVar(&cliFlags.Preflight, "preflight", false, "check database, organization IDs file and S3 access and exit")
+	defineExportFlags(flags, cliFlags)
+}
+
+// selectedOperations function returns legacy flags that select operation
+// other than export. Dry run is included, because it can't be combined with
+// other operations.
+func selectedOperations(cliFlags CliFlags) []string {
+	var operations []string
+	for _, operation := range []struct {
+		name     string
+		selected bool
+	}{
+		{"-version", cliFlags.ShowVersion},
+		{"-authors", cliFlags.ShowAuthors},
+		{"-show-configuration", cliFlags.ShowConfiguration},
+		{"-check-s3-connection", cliFlags.CheckS3Connection},
+		{"-preflight", cliFlags.Preflight},
+		{"-dry-run", cliFlags.DryRun},
+	} {
+		if operation.selected {
+			operations = append(operations, operation.name)
+		}
+	}
+	return operations
+}
+
+// checkConflictingFlags function returns error when more than one operation
+// is selected by legacy flags.
+func checkConflictingFlags(cliFlags CliFlags) error {
+	operations := selectedOperations(cliFlags)
+	if len(operations) > 1 {
+		return fmt.Errorf(conflictingFlags, strings.Join(operations, ", "))
+	}
+	return nil
+}
+
+// findCommand function returns subcommand with given name or nil when such
+// subcommand does not exist.
+func findCommand(name string) *Command {
+	for i := range commands {
+		if commands[i].Name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+// programName function returns name of the executable used in help text.
+func programName() string {
+	return filepath.Base(os.Args[0])
+}
+
+// parseCommandLine function selects subcommand and parses its flags and
+// arguments. Legacy flags are parsed when the first argument is not a
+// subcommand. flag.ErrHelp is returned when help has been printed.
+func parseCommandLine(args []string, output io.Writer) (*Command, CliFlags, []string, error) {
+	var cliFlags CliFlags
+
+	// legacy form: flags only, export is the default operation
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		flags := flag.NewFlagSet(programName(), flag.ContinueOnError)
+		flags.SetOutput(output)
+		defineLegacyFlags(flags, &cliFlags)
+		flags.Usage = func() {
+			printUsage(output, flags)
+		}
+
+		err := flags.Parse(args)
+		if err != nil {
+			return nil, cliFlags, nil, err
+		}
+		if flags.NArg() > 0 {
+			return nil, cliFlags, nil, fmt.Errorf(unexpectedArguments, strings.Join(flags.Args(), " "))
+		}
+		return &legacyCommand, cliFlags, nil, nil
+	}
+
+	if args[0] == helpCommand {
+		return nil, cliFlags, nil, printHelp(output, args[1:])
+	}
+
+	command := findCommand(args[0])
+	if command == nil {
+		printUsage(output, nil)
+		return nil, cliFlags, nil, fmt.Errorf(unknownCommand, args[0])
+	}
+
+	flags := newCommandFlagSet(command, &cliFlags, output)
+	err := flags.Parse(args[1:])
+	if err != nil {
+		return nil, cliFlags, nil, err
+	}
+
+	arguments := flags.Args()
+	if len(arguments) < command.MinArgs ||
+		(command.MaxArgs >= 0 && len(arguments) > command.MaxArgs) {
+		flags.Usage()
+		return nil, cliFlags, nil, fmt.Errorf(wrongNumberOfArguments, command.Name)
+	}
+
+	return command, cliFlags, arguments, nil
+}
+
+// newCommandFlagSet function constructs set of flags for given subcommand.
+func newCommandFlagSet(command *Command, cliFlags *CliFlags, output io.Writer) *flag.FlagSet {
+	flags := flag.NewFlagSet(command.Name, flag.ContinueOnError)
+	flags.SetOutput(output)
+	if command.defineFlags != nil {
+		command.defineFlags(flags, cliFlags)
+	}
+	flags.Usage = func() {
+		printCommandUsage(output, command, flags)
+	}
+	return flags
+}
+
+// printHelp function prints help for command given as argument or list of
+// all commands. flag.ErrHelp is returned, so the program exits with success.
+func printHelp(output io.Writer, args []string) error {
+	if len(args) == 0 {
+		printUsage(output, nil)
+		return flag.ErrHelp
+	}
+
+	command := findCommand(args[0])
+	if command == nil {
+		printUsage(output, nil)
+		return fmt.Errorf(unknownCommand, args[0])
+	}
+
+	var cliFlags CliFlags
+	newCommandFlagSet(command, &cliFlags, output).Usage()
+	return flag.ErrHelp
+}
+
+// printUsage function prints list of all subcommands. Legacy flags are
+// printed too when they are given.
+func printUsage(output io.Writer, legacyFlags *flag.FlagSet) {
+	fmt.Fprintf(output, "Usage: %s <command> [flags] [arguments]\n\nCommands:\n", programName())
+
+	writer := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+	for _, command := range commands {
+		fmt.Fprintf(writer, "  %s\t%s\n", command.Name, command.Description)
+	}
+	fmt.Fprintf(writer, "  %s\t%s\n", helpCommand, "Print help for given command.")
+	_ = writer.Flush()
+
+	fmt.Fprintf(output, "\nUse \"%s help <command>\" for more information about a command.\n", programName())
+
+	if legacyFlags != nil {
+		fmt.Fprintf(output, "\nWhen no command is given, export is performed and the following flags are accepted:\n")
+		legacyFlags.PrintDefaults()
+	}
+}
+
+// printCommandUsage function prints help text for given subcommand.
+func printCommandUsage(output io.Writer, command *Command, flags *flag.FlagSet) {
+	usage := fmt.Sprintf("Usage: %s %s [flags]", programName(), command.Name)
+	if command.Arguments != "" {
+		usage += " " + command.Arguments
+	}
+	fmt.Fprintf(output, "%s\n\n%s\n", usage, command.Description)
+
+	hasFlags := false
+	flags.VisitAll(func(*flag.Flag) {
+		hasFlags = true
+	})
+	if hasFlags {
+		fmt.Fprintf(output, "\nFlags:\n")
+		flags.PrintDefaults()
+	}
+
+	fmt.Fprintf(output, "\nExit codes:\n")
+	for _, exitCode := range command.ExitCodes {
+		fmt.Fprintf(output, "  %d  %s\n", exitCode, exitStatusDescriptions[exitCode])
+	}
+}
+
+// runExport function performs export subcommand.
+func runExport(configuration *ConfigStruct, cliFlags CliFlags, _ []string,
+	_ io.Writer, operationLogger *zerolog.Logger, runMetrics *RunMetrics) (int, error) {
+	return performDataExport(configuration, cliFlags, operationLogger, runMetrics)
+}
+
+// runListTables function performs list-tables subcommand.
+func runListTables(configuration *ConfigStruct, cliFlags CliFlags, _ []string,
+	output io.Writer, _ *zerolog.Logger, _ *RunMetrics) (int, error) {
+	return withStorage(configuration, func(ctx context.Context, storage *DBStorage) (int, error) {
+		tableNames, err := storage.ReadListOfTables(ctx)
+		if err != nil {
+			return ExitStatusStorageError, err
+		}
+
+		ignoredTables := constructIgnoredTablesMap(cliFlags.IgnoredTables)
+		for _, tableName := range tableNames {
+			if _, found := ignoredTables[string(tableName)]; found {
+				continue
+			}
+			fmt.Fprintln(output, tableName)
+		}
+		return ExitStatusOK, nil
+	})
+}
+
+// runDescribe function performs describe subcommand.
+func runDescribe(configuration *ConfigStruct, cliFlags CliFlags, args []string,
+	output io.Writer, _ *zerolog.Logger, _ *RunMetrics) (int, error) {
+	tableName := TableName(args[0])
+
+	return withStorage(configuration, func(ctx context.Context, storage *DBStorage) (int, error) {
+		tableSchema, err := storage.ReadTableSchema(ctx, tableName)
+		if err != nil {
+			return ExitStatusStorageError, err
+		}
+
+		schema := &Schema{
+			Database: storage.dbSystem(),
+			Tables:   []TableSchema{tableSchema},
+		}
+
+		switch cliFlags.SchemaFormat {
+		case schemaFormatText:
+			err = PrintTableSchema(output, tableSchema)
+		case schemaFormatJSON:
+			err = SchemaToJSON(output, schema)
+		case schemaFormatSQL:
+			err = SchemaToSQL(output, schema)
+		default:
+			return ExitStatusConfigurationError, fmt.Errorf(unknownSchemaFormat, cliFlags.SchemaFormat)
+		}
+		if err != nil {
+			return ExitStatusIOError, err
+		}
+		return ExitStatusOK, nil
+	})
+}
+
+// runCount function performs count subcommand.
+func runCount(configuration *ConfigStruct, cliFlags CliFlags, args []string,
+	output io.Writer, _ *zerolog.Logger, _ *RunMetrics) (int, error) {
+	return withStorage(configuration, func(ctx context.Context, storage *DBStorage) (int, error) {
+		var tableNames []TableName
+		for _, arg := range args {
+			tableNames = append(tableNames, TableName(arg))
+		}
+
+		if len(tableNames) == 0 {
+			var err error
+			tableNames, err = storage.ReadListOfTables(ctx)
+			if err != nil {
+				return ExitStatusStorageError, err
+			}
+		}
+
+		// the same subset of data as in export is counted
+		if storage.config.EnableOrgIDFiltering {
+			var err error
+			storage.subset, err = storage.BuildSubsetPlan(ctx)
+			if err != nil {
+				return ExitStatusStorageError, err
+			}
+		}
+
+		ignoredTables := constructIgnoredTablesMap(cliFlags.IgnoredTables)
+		writer := tabwriter.NewWriter(output, 0, 0, 2, ' ', tabwriter.AlignRight)
+		fmt.Fprintln(writer, "Table\tRecords\t")
+
+		total := 0
+		for _, tableName := range tableNames {
+			if _, found := ignoredTables[string(tableName)]; found {
+				continue
+			}
+			count, err := storage.ReadRecordsCount(ctx, tableName)
+			if err != nil {
+				return ExitStatusStorageError, err
+			}
+			total += count
+			fmt.Fprintf(writer, "%s\t%d\t\n", tableName, count)
+		}
+		fmt.Fprintf(writer, "TOTAL\t%d\t\n", total)
+
+		return ExitStatusOK, writer.Flush()
+	})
+}
+
+// runDiff function performs diff subcommand. Primary keys of tables that
+// are not stored in _schema.json are read from database when it is
+// available. Comparison is stopped by SIGTERM, SIGINT or when deadline is
+// reached.
+func runDiff(configuration *ConfigStruct, cliFlags CliFlags, args []string,
+	output io.Writer, _ *zerolog.Logger, _ *RunMetrics) (int, error) {
+	if cliFlags.DiffFormat != diffFormatCSV && cliFlags.DiffFormat != diffFormatJSON {
+		return ExitStatusConfigurationError, fmt.Errorf(unknownDiffFormat, cliFlags.DiffFormat)
+	}
+
+	interruption := NewInterruption(cliFlags.Deadline)
+	defer interruption.Close()
+
+	ctx := interruption.Context()
+	locations := make([]*exportLocation, len(args))
+	for i, arg := range args {
+		if strings.HasPrefix(arg, s3LocationPrefix) {
+			if _, _, err := parseS3Location(arg); err != nil {
+				return ExitStatusConfigurationError, err
+			}
+		}
+
+		location, err := openExportLocation(ctx, configuration, arg)
+		if err != nil {
+			log.Err(err).Msg(operationFailedMessage)
+			return ExitStatusS3Error, err
+		}
+		locations[i] = location
+	}
+
+	readKey, closeDatabase := databaseKeyReader(ctx, configuration)
+	defer closeDatabase()
+
+	diffs, err := DiffExports(locations[0], locations[1],
+		constructIgnoredTablesMap(cliFlags.IgnoredTables), readKey)
+	if interruption.Stopped() {
+		err = interruption.Reason()
+		log.Err(err).Msg(operationFailedMessage)
+		return ExitStatusIncomplete, err
+	}
+	if err != nil {
+		log.Err(err).Msg(operationFailedMessage)
+		return ExitStatusIOError, err
+	}
+
+	err = storeTableDiffs(ctx, cliFlags.DiffOutputDir, cliFlags.DiffFormat, diffs)
+	if err != nil {
+		log.Err(err).Msg(operationFailedMessage)
+		return ExitStatusIOError, err
+	}
+
+	return ExitStatusOK, PrintDiffCounts(output, diffs)
+}
+
+// databaseKeyReader function returns key reader that reads primary keys of
+// tables from database together with function that closes the database. The
+// database is opened when the first key is read, so it is not needed when all
+// keys are stored in exports. Database is optional for diff, so connection
+// to it is not retried.
+func databaseKeyReader(ctx context.Context, configuration *ConfigStruct) (keyReader, func()) {
+	var storage *DBStorage
+	var openErr error
+	opened := false
+
+	readKey := func(tableName TableName) ([]string, error) {
+		if !opened {
+			opened = true
+			storageConfiguration := GetStorageConfiguration(configuration)
+			storage, openErr = NewStorage(ctx, &storageConfiguration, RetryPolicy{})
+		}
+		if openErr != nil {
+			return nil, openErr
+		}
+		return storage.ReadPrimaryKey(ctx, tableName)
+	}
+
+	closeDatabase := func() {
+		if storage != nil {
+			nopLogger := zerolog.Nop()
+			_ = closeStorage(storage, &nopLogger)
+		}
+	}
+	return readKey, closeDatabase
+}
+
+// runCheck function performs check subcommand.
+func runCheck(configuration *ConfigStruct, cliFlags CliFlags, _ []string,
+	output io.Writer, _ *zerolog.Logger, _ *RunMetrics) (int, error) {
+	if cliFlags.CheckS3Connection {
+		return checkS3Connection(configuration)
+	}
+	return runPreflight(configuration, cliFlags, output)
+}
+
+// runConfig function performs config subcommand.
+func runConfig(configuration *ConfigStruct, _ CliFlags, _ []string,
+	_ io.Writer, _ *zerolog.Logger, _ *RunMetrics) (int, error) {
+	showConfiguration(configuration)
+	return ExitStatusOK, nil
+}
+
+// withStorage function opens connection to storage, calls given function and
+// closes the connection. Context passed to the function is used for all
+// queries.
+func withStorage(configuration *ConfigStruct, function func(ctx context.Context, storage *DBStorage) (int, error)) (exitStatus int, err error) {
+	ctx := context.Background()
+	storageConfiguration := GetStorageConfiguration(configuration)
+	storage, err := NewStorage(ctx, &storageConfiguration,
+		NewRetryPolicy(GetRetryConfiguration(configuration)))
+	if err != nil {
+		log.Err(err).Msg(operationFailedMessage)
+		return ExitStatusStorageError, err
+	}
+
+	defer func() {
+		nopLogger := zerolog.Nop()
+		closeErr := closeStorage(storage, &nopLogger)
+		if closeErr != nil && err == nil {
+			exitStatus, err = ExitStatusStorageError, closeErr
+		}
+	}()
+
+	exitStatus, err = function(ctx, storage)
+	if err != nil {
+		log.Err(err).Msg(operationFailedMessage)
+	}
+	return exitStatus, err
+}
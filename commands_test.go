@@ -0,0 +1,347 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/commands_test.html
+
+import (
+	"bytes"
+	"flag"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// TestParseCommandLineLegacyFlags checks that flags given without subcommand
+// are parsed as before
+func TestParseCommandLineLegacyFlags(t *testing.T) {
+	output := new(bytes.Buffer)
+
+	command, cliFlags, args, err := main.ParseCommandLine([]string{
+		"-output", "file", "-summary", "-limit", "10", "-deadline", "5m"}, output)
+	assert.NoError(t, err)
+	assert.NotNil(t, command)
+	assert.Empty(t, command.Name)
+	assert.Empty(t, args)
+
+	assert.Equal(t, "file", cliFlags.Output)
+	assert.True(t, cliFlags.PrintSummaryTable)
+	assert.Equal(t, 10, cliFlags.Limit)
+	assert.Equal(t, 5*time.Minute, cliFlags.Deadline)
+}
+
+// TestParseCommandLineNoArguments checks that export with default flags is
+// selected when no argument is given
+func TestParseCommandLineNoArguments(t *testing.T) {
+	command, cliFlags, args, err := main.ParseCommandLine(nil, new(bytes.Buffer))
+	assert.NoError(t, err)
+	assert.Empty(t, command.Name)
+	assert.Empty(t, args)
+
+	assert.Equal(t, "S3", cliFlags.Output)
+	assert.Equal(t, -1, cliFlags.Limit)
+}
+
+// TestParseCommandLineLegacyUnexpectedArguments checks that positional
+// arguments are refused in legacy form
+func TestParseCommandLineLegacyUnexpectedArguments(t *testing.T) {
+	_, _, _, err := main.ParseCommandLine([]string{"-summary", "foo"}, new(bytes.Buffer))
+	assert.EqualError(t, err, "unexpected arguments: foo")
+}
+
+// TestParseCommandLineExport checks parsing of export subcommand
+func TestParseCommandLineExport(t *testing.T) {
+	command, cliFlags, args, err := main.ParseCommandLine([]string{
+		"export", "-output", "file", "-ignore-tables", "a,b", "-partition-by-org"},
+		new(bytes.Buffer))
+	assert.NoError(t, err)
+	assert.Equal(t, "export", command.Name)
+	assert.Empty(t, args)
+
+	assert.Equal(t, "file", cliFlags.Output)
+	assert.Equal(t, "a,b", cliFlags.IgnoredTables)
+	assert.True(t, cliFlags.PartitionByOrg)
+}
+
+// TestParseCommandLineOwnFlags checks that each subcommand accepts only its
+// own flags
+func TestParseCommandLineOwnFlags(t *testing.T) {
+	output := new(bytes.Buffer)
+
+	_, _, _, err := main.ParseCommandLine([]string{"list-tables", "-summary"}, output)
+	assert.Error(t, err)
+	assert.Contains(t, output.String(), "flag provided but not defined: -summary")
+
+	_, cliFlags, _, err := main.ParseCommandLine([]string{"check", "-s3-only"}, output)
+	assert.NoError(t, err)
+	assert.True(t, cliFlags.CheckS3Connection)
+}
+
+// TestParseCommandLineArguments checks handling of positional arguments
+func TestParseCommandLineArguments(t *testing.T) {
+	command, _, args, err := main.ParseCommandLine([]string{"describe", "good"}, new(bytes.Buffer))
+	assert.NoError(t, err)
+	assert.Equal(t, "describe", command.Name)
+	assert.Equal(t, []string{"good"}, args)
+
+	command, _, args, err = main.ParseCommandLine([]string{
+		"count", "-ignore-tables", "c", "a", "b"}, new(bytes.Buffer))
+	assert.NoError(t, err)
+	assert.Equal(t, "count", command.Name)
+	assert.Equal(t, []string{"a", "b"}, args)
+
+	command, cliFlags, args, err := main.ParseCommandLine([]string{
+		"diff", "-format", "json", "old", "s3://bucket/new"}, new(bytes.Buffer))
+	assert.NoError(t, err)
+	assert.Equal(t, "diff", command.Name)
+	assert.Equal(t, "json", cliFlags.DiffFormat)
+	assert.Equal(t, ".", cliFlags.DiffOutputDir)
+	assert.Equal(t, []string{"old", "s3://bucket/new"}, args)
+}
+
+// TestParseCommandLineWrongNumberOfArguments checks that wrong number of
+// positional arguments is refused
+func TestParseCommandLineWrongNumberOfArguments(t *testing.T) {
+	for _, args := range [][]string{
+		{"describe"},
+		{"describe", "a", "b"},
+		{"diff", "a"},
+		{"list-tables", "a"},
+		{"config", "a"},
+	} {
+		output := new(bytes.Buffer)
+		_, _, _, err := main.ParseCommandLine(args, output)
+		assert.EqualError(t, err, "wrong number of arguments for command "+args[0])
+		assert.Contains(t, output.String(), "Usage:")
+	}
+}
+
+// TestParseCommandLineUnknownCommand checks that unknown subcommand is
+// refused and list of subcommands is printed
+func TestParseCommandLineUnknownCommand(t *testing.T) {
+	output := new(bytes.Buffer)
+
+	_, _, _, err := main.ParseCommandLine([]string{"foo"}, output)
+	assert.EqualError(t, err, "unknown command: foo")
+	for _, name := range []string{"export", "list-tables", "describe", "count", "diff", "check", "config"} {
+		assert.Contains(t, output.String(), name)
+	}
+}
+
+// TestParseCommandLineHelp checks help for all subcommands and for one
+// subcommand
+func TestParseCommandLineHelp(t *testing.T) {
+	output := new(bytes.Buffer)
+	_, _, _, err := main.ParseCommandLine([]string{"help"}, output)
+	assert.ErrorIs(t, err, flag.ErrHelp)
+	assert.Contains(t, output.String(), "Commands:")
+
+	output = new(bytes.Buffer)
+	_, _, _, err = main.ParseCommandLine([]string{"help", "describe"}, output)
+	assert.ErrorIs(t, err, flag.ErrHelp)
+	assert.Contains(t, output.String(), "describe [flags] <table>")
+	assert.Contains(t, output.String(), "Exit codes:")
+	assert.Contains(t, output.String(), "2  storage (database) error")
+
+	output = new(bytes.Buffer)
+	_, _, _, err = main.ParseCommandLine([]string{"count", "-h"}, output)
+	assert.ErrorIs(t, err, flag.ErrHelp)
+	assert.Contains(t, output.String(), "-ignore-tables")
+
+	_, _, _, err = main.ParseCommandLine([]string{"help", "foo"}, new(bytes.Buffer))
+	assert.EqualError(t, err, "unknown command: foo")
+}
+
+// TestCheckConflictingFlags checks that more operations can't be selected by
+// legacy flags
+func TestCheckConflictingFlags(t *testing.T) {
+	assert.NoError(t, main.CheckConflictingFlags(main.CliFlags{}))
+	assert.NoError(t, main.CheckConflictingFlags(main.CliFlags{Preflight: true}))
+
+	err := main.CheckConflictingFlags(main.CliFlags{ShowVersion: true, DryRun: true})
+	assert.EqualError(t, err, "conflicting flags: -version, -dry-run")
+}
+
+// TestDoSelectedOperationConflictingFlags checks that conflicting legacy
+// flags are refused before any operation is performed
+func TestDoSelectedOperationConflictingFlags(t *testing.T) {
+	configuration := main.ConfigStruct{}
+	cliFlags := main.CliFlags{
+		ShowAuthors:       true,
+		CheckS3Connection: true,
+	}
+
+	code, err := main.DoSelectedOperation(&configuration, cliFlags, &log.Logger, nil)
+	assert.Equal(t, main.ExitStatusConfigurationError, code)
+	assert.Error(t, err)
+}
+
+// TestRunListTables checks the list-tables subcommand
+func TestRunListTables(t *testing.T) {
+	configuration := prepareFailingDatabase(t, t.TempDir())
+
+	output := new(bytes.Buffer)
+	code, err := main.RunListTables(&configuration, main.CliFlags{}, nil, output, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.Equal(t, "bad\ngood\n", output.String())
+
+	output = new(bytes.Buffer)
+	code, err = main.RunListTables(&configuration, main.CliFlags{IgnoredTables: "bad"}, nil, output, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.Equal(t, "good\n", output.String())
+}
+
+// TestRunListTablesStorageError checks the list-tables subcommand when
+// database is not configured
+func TestRunListTablesStorageError(t *testing.T) {
+	configuration := main.ConfigStruct{}
+
+	code, err := main.RunListTables(&configuration, main.CliFlags{}, nil, new(bytes.Buffer), &log.Logger, nil)
+	assert.Error(t, err)
+	assert.Equal(t, main.ExitStatusStorageError, code)
+}
+
+// TestRunDescribe checks the describe subcommand
+func TestRunDescribe(t *testing.T) {
+	configuration := prepareFailingDatabase(t, t.TempDir())
+
+	output := new(bytes.Buffer)
+	cliFlags := main.CliFlags{SchemaFormat: "text"}
+	code, err := main.RunDescribe(&configuration, cliFlags, []string{"good"}, output, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Len(t, lines, 8)
+	assert.Equal(t, "Table: good", lines[0])
+	assert.Equal(t, "Rows:  2", lines[1])
+	assert.Equal(t, []string{"Column", "Type", "Nullable", "Default"}, strings.Fields(lines[3]))
+	assert.Equal(t, []string{"id", "INTEGER", "true"}, strings.Fields(lines[4]))
+	assert.Equal(t, []string{"value", "TEXT", "true"}, strings.Fields(lines[5]))
+	assert.Equal(t, "Primary key: id", lines[7])
+
+	code, err = main.RunDescribe(&configuration, cliFlags, []string{"bad"}, new(bytes.Buffer), &log.Logger, nil)
+	assert.Error(t, err)
+	assert.Equal(t, main.ExitStatusStorageError, code)
+}
+
+// TestRunDescribeFormats checks the describe subcommand with JSON and SQL
+// output
+func TestRunDescribeFormats(t *testing.T) {
+	configuration := prepareFailingDatabase(t, t.TempDir())
+
+	output := new(bytes.Buffer)
+	cliFlags := main.CliFlags{SchemaFormat: "json"}
+	code, err := main.RunDescribe(&configuration, cliFlags, []string{"good"}, output, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.Contains(t, output.String(), `"row_count": 2`)
+
+	output = new(bytes.Buffer)
+	cliFlags = main.CliFlags{SchemaFormat: "sql"}
+	code, err = main.RunDescribe(&configuration, cliFlags, []string{"good"}, output, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.Contains(t, output.String(), `CREATE TABLE "good" (`)
+
+	cliFlags = main.CliFlags{SchemaFormat: "xml"}
+	code, err = main.RunDescribe(&configuration, cliFlags, []string{"good"}, new(bytes.Buffer), &log.Logger, nil)
+	assert.EqualError(t, err, "unknown schema format: xml")
+	assert.Equal(t, main.ExitStatusConfigurationError, code)
+}
+
+// TestRunCount checks the count subcommand
+func TestRunCount(t *testing.T) {
+	configuration := prepareFailingDatabase(t, t.TempDir())
+
+	output := new(bytes.Buffer)
+	code, err := main.RunCount(&configuration, main.CliFlags{}, []string{"good"}, output, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, []string{"good", "2"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"TOTAL", "2"}, strings.Fields(lines[2]))
+
+	// all tables are counted by default, the broken view fails
+	code, err = main.RunCount(&configuration, main.CliFlags{}, nil, new(bytes.Buffer), &log.Logger, nil)
+	assert.Error(t, err)
+	assert.Equal(t, main.ExitStatusStorageError, code)
+
+	code, err = main.RunCount(&configuration, main.CliFlags{IgnoredTables: "bad"}, nil, new(bytes.Buffer), &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+}
+
+// TestRunCountSubset checks that count subcommand counts the same subset of
+// data as export when organizations are filtered
+func TestRunCountSubset(t *testing.T) {
+	configuration := prepareSQLiteDatabase(t, t.TempDir(),
+		"CREATE TABLE report (org_id INTEGER, cluster TEXT PRIMARY KEY)",
+		"CREATE TABLE note (id INTEGER PRIMARY KEY, cluster TEXT REFERENCES report(cluster))",
+		"INSERT INTO report VALUES (1, 'c1'), (2, 'c2')",
+		"INSERT INTO note VALUES (1, 'c1'), (2, 'c2'), (3, 'c2')")
+	configuration.Storage.EnableOrgIDFiltering = true
+	configuration.Storage.OrganizationIDsCSVFile = "tests/db_exporter_organization_ids.csv"
+
+	output := new(bytes.Buffer)
+	code, err := main.RunCount(&configuration, main.CliFlags{}, []string{"note"}, output, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Equal(t, []string{"note", "1"}, strings.Fields(lines[1]))
+}
+
+// TestRunCheck checks the check subcommand
+func TestRunCheck(t *testing.T) {
+	configuration := prepareFailingDatabase(t, t.TempDir())
+
+	output := new(bytes.Buffer)
+	cliFlags := main.CliFlags{Output: "file", IgnoredTables: "bad"}
+	code, err := main.RunCheck(&configuration, cliFlags, nil, output, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.Contains(t, output.String(), "[PASS] read table good")
+
+	// S3 is not configured
+	cliFlags = main.CliFlags{CheckS3Connection: true}
+	code, err = main.RunCheck(&configuration, cliFlags, nil, new(bytes.Buffer), &log.Logger, nil)
+	assert.Error(t, err)
+	assert.Equal(t, main.ExitStatusS3Error, code)
+}
+
+// TestRunConfig checks the config subcommand
+func TestRunConfig(t *testing.T) {
+	configuration := main.ConfigStruct{}
+
+	code, err := main.RunConfig(&configuration, main.CliFlags{}, nil, new(bytes.Buffer), &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+}
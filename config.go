@@ -76,6 +76,24 @@ package main
 // INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__S3__PREFIX
 // INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__LOGGING__DEBUG
 // INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__LOGGING__LOG_DEVEL
+// INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__RETRY__MAX_ATTEMPTS
+// INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__RETRY__BASE_DELAY
+// INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__RETRY__MAX_DELAY
+// INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__RETRY__JITTER
+// INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__METRICS__PUSH_GATEWAY_URL
+// INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__METRICS__JOB_NAME
+// INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__METRICS__TIMEOUT
+// INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__TRACING__EXPORTER
+// INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__TRACING__ENDPOINT
+// INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__TRACING__FILE
+// INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__TRACING__SERVICE_NAME
+// INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__OPERATION_LOG__FILE
+// INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__OPERATION_LOG__OBJECT
+// INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__SCHEMA_DRIFT__POLICY
+// INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__DISABLED_RULES__MIN_COUNT
+// INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__DISABLED_RULES__WINDOW
+// INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__FILE__OUTPUT_DIR
+// INSIGHTS_RESULTS_AGGREGATOR_EXPORTER__FILE__PER_RUN_DIRECTORY
 
 import (
 	"bytes"
@@ -105,6 +123,16 @@ type ConfigStruct struct {
 	S3      S3Configuration      `mapstructure:"s3"      toml:"s3"`
 	Logging LoggingConfiguration `mapstructure:"logging" toml:"logging"`
 	Sentry  SentryConfiguration  `mapstructure:"sentry"  toml:"sentry"`
+	Retry   RetryConfiguration   `mapstructure:"retry"   toml:"retry"`
+	Metrics MetricsConfiguration `mapstructure:"metrics" toml:"metrics"`
+	Tracing TracingConfiguration `mapstructure:"tracing" toml:"tracing"`
+
+	OperationLog OperationLogConfiguration `mapstructure:"operation_log" toml:"operation_log"`
+	SchemaDrift  SchemaDriftConfiguration  `mapstructure:"schema_drift" toml:"schema_drift"`
+
+	DisabledRules DisabledRulesConfiguration `mapstructure:"disabled_rules" toml:"disabled_rules"`
+	Queries       []QueryConfiguration       `mapstructure:"queries"        toml:"queries"`
+	File          FileConfiguration          `mapstructure:"file"           toml:"file"`
 }
 
 // LoggingConfiguration represents configuration for logging in general
@@ -142,6 +170,16 @@ type StorageConfiguration struct {
 	EnableOrgIDFiltering   bool     `mapstructure:"enable_org_id_filtering"   toml:"enable_org_id_filtering"`
 	OrganizationIDsCSVFile string   `mapstructure:"organization_ids_csv_file" toml:"organization_ids_csv_file"`
 	OrganizationsToExport  []string `mapstructure:"organizations_to_export" toml:"organizations_to_export"`
+
+	// TableOrdering overrides columns used to order exported rows. Keys
+	// are table names, values are comma-separated lists of columns. Tables
+	// not mentioned there are ordered by their primary key.
+	TableOrdering map[string]string `mapstructure:"table_ordering" toml:"table_ordering"`
+
+	// Relationships between tables that are followed when data for
+	// selected organizations are exported, in addition to foreign keys.
+	// Each relationship is specified as "table.column->parent.column".
+	Relationships []string `mapstructure:"relationships" toml:"relationships"`
 }
 
 // S3Configuration represents configuration of S3/Minio data storage
@@ -259,6 +297,49 @@ func GetSentryConfiguration(config *ConfigStruct) SentryConfiguration {
 	return config.Sentry
 }
 
+// GetRetryConfiguration function returns configuration of retries
+func GetRetryConfiguration(config *ConfigStruct) RetryConfiguration {
+	return config.Retry
+}
+
+// GetMetricsConfiguration function returns configuration of Pushgateway
+func GetMetricsConfiguration(config *ConfigStruct) MetricsConfiguration {
+	return config.Metrics
+}
+
+// GetTracingConfiguration function returns configuration of tracing
+func GetTracingConfiguration(config *ConfigStruct) TracingConfiguration {
+	return config.Tracing
+}
+
+// GetOperationLogConfiguration function returns configuration of operation
+// log
+func GetOperationLogConfiguration(config *ConfigStruct) OperationLogConfiguration {
+	return config.OperationLog
+}
+
+// GetSchemaDriftConfiguration function returns configuration of schema
+// drift detection
+func GetSchemaDriftConfiguration(config *ConfigStruct) SchemaDriftConfiguration {
+	return config.SchemaDrift
+}
+
+// GetDisabledRulesConfiguration function returns configuration of disabled
+// rules report
+func GetDisabledRulesConfiguration(config *ConfigStruct) DisabledRulesConfiguration {
+	return config.DisabledRules
+}
+
+// GetQueriesConfiguration function returns user-defined queries
+func GetQueriesConfiguration(config *ConfigStruct) []QueryConfiguration {
+	return config.Queries
+}
+
+// GetFileConfiguration function returns configuration of file output
+func GetFileConfiguration(config *ConfigStruct) FileConfiguration {
+	return config.File
+}
+
 // GetS3Configuration function returns S3/Minio configuration
 func GetS3Configuration(config *ConfigStruct) S3Configuration {
 	return config.S3
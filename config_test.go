@@ -25,6 +25,7 @@ package main_test
 import (
 	"os"
 	"strings"
+	"time"
 
 	"testing"
 
@@ -130,6 +131,123 @@ func TestLoadStorageConfiguration(t *testing.T) {
 	assert.Equal(t, "./tests/db_exporter_organization_ids.csv", storageCfg.OrganizationIDsCSVFile)
 }
 
+// TestLoadRetryConfiguration tests loading the retry configuration sub-tree
+func TestLoadRetryConfiguration(t *testing.T) {
+	os.Clearenv()
+
+	envVar := "INSIGHTS_RESULTS_AGGREGATOR_EXPORTER_CONFIG_FILE"
+	mustSetEnv(t, envVar, "tests/config2")
+	config, err := main.LoadConfiguration(envVar, "")
+	assert.Nil(t, err, "Failed loading configuration file from env var!")
+
+	retryCfg := main.GetRetryConfiguration(&config)
+
+	assert.Equal(t, 5, retryCfg.MaxAttempts)
+	assert.Equal(t, 500*time.Millisecond, retryCfg.BaseDelay)
+	assert.Equal(t, 30*time.Second, retryCfg.MaxDelay)
+	assert.Equal(t, 0.2, retryCfg.Jitter)
+}
+
+// TestLoadMetricsConfiguration tests loading the Pushgateway configuration
+func TestLoadMetricsConfiguration(t *testing.T) {
+	os.Clearenv()
+
+	envVar := "INSIGHTS_RESULTS_AGGREGATOR_EXPORTER_CONFIG_FILE"
+	mustSetEnv(t, envVar, "tests/config2")
+	config, err := main.LoadConfiguration(envVar, "")
+	assert.Nil(t, err, "Failed loading configuration file from env var!")
+
+	metricsCfg := main.GetMetricsConfiguration(&config)
+
+	assert.Equal(t, "http://localhost:9091", metricsCfg.PushGatewayURL)
+	assert.Equal(t, "test_job", metricsCfg.JobName)
+	assert.Equal(t, 5*time.Second, metricsCfg.Timeout)
+}
+
+// TestLoadTracingConfiguration tests loading the tracing configuration
+func TestLoadTracingConfiguration(t *testing.T) {
+	os.Clearenv()
+
+	envVar := "INSIGHTS_RESULTS_AGGREGATOR_EXPORTER_CONFIG_FILE"
+	mustSetEnv(t, envVar, "tests/config2")
+	config, err := main.LoadConfiguration(envVar, "")
+	assert.Nil(t, err, "Failed loading configuration file from env var!")
+
+	tracingCfg := main.GetTracingConfiguration(&config)
+
+	assert.Equal(t, "otlp", tracingCfg.Exporter)
+	assert.Equal(t, "http://localhost:4318", tracingCfg.Endpoint)
+	assert.Equal(t, "spans.json", tracingCfg.File)
+	assert.Equal(t, "test_service", tracingCfg.ServiceName)
+}
+
+// TestLoadSchemaDriftConfiguration tests loading the schema drift
+// configuration
+func TestLoadSchemaDriftConfiguration(t *testing.T) {
+	os.Clearenv()
+
+	envVar := "INSIGHTS_RESULTS_AGGREGATOR_EXPORTER_CONFIG_FILE"
+	mustSetEnv(t, envVar, "tests/config2")
+	config, err := main.LoadConfiguration(envVar, "")
+	assert.Nil(t, err, "Failed loading configuration file from env var!")
+
+	driftCfg := main.GetSchemaDriftConfiguration(&config)
+
+	assert.Equal(t, "warn", driftCfg.Policy)
+	assert.True(t, driftCfg.Enabled())
+}
+
+// TestLoadDisabledRulesConfiguration tests loading the configuration of
+// disabled rules report
+func TestLoadDisabledRulesConfiguration(t *testing.T) {
+	os.Clearenv()
+
+	envVar := "INSIGHTS_RESULTS_AGGREGATOR_EXPORTER_CONFIG_FILE"
+	mustSetEnv(t, envVar, "tests/config2")
+	config, err := main.LoadConfiguration(envVar, "")
+	assert.Nil(t, err, "Failed loading configuration file from env var!")
+
+	disabledRulesCfg := main.GetDisabledRulesConfiguration(&config)
+
+	assert.Equal(t, 5, disabledRulesCfg.MinCount)
+	assert.Equal(t, 168*time.Hour, disabledRulesCfg.Window)
+}
+
+// TestLoadQueriesConfiguration tests loading the user-defined queries
+func TestLoadQueriesConfiguration(t *testing.T) {
+	os.Clearenv()
+
+	envVar := "INSIGHTS_RESULTS_AGGREGATOR_EXPORTER_CONFIG_FILE"
+	mustSetEnv(t, envVar, "tests/config2")
+	config, err := main.LoadConfiguration(envVar, "")
+	assert.Nil(t, err, "Failed loading configuration file from env var!")
+
+	queries := main.GetQueriesConfiguration(&config)
+
+	assert.Len(t, queries, 2)
+	assert.Equal(t, "rules_per_org", queries[0].Name)
+	assert.Empty(t, queries[0].Format)
+	assert.Equal(t, "recent_ratings", queries[1].Name)
+	assert.Equal(t, []string{"now"}, queries[1].Parameters)
+	assert.Equal(t, "json", queries[1].Format)
+	assert.Equal(t, 30*time.Second, queries[1].Timeout)
+}
+
+// TestLoadFileConfiguration tests loading the file output configuration
+func TestLoadFileConfiguration(t *testing.T) {
+	os.Clearenv()
+
+	envVar := "INSIGHTS_RESULTS_AGGREGATOR_EXPORTER_CONFIG_FILE"
+	mustSetEnv(t, envVar, "tests/config2")
+	config, err := main.LoadConfiguration(envVar, "")
+	assert.Nil(t, err, "Failed loading configuration file from env var!")
+
+	fileCfg := main.GetFileConfiguration(&config)
+
+	assert.Equal(t, "exports", fileCfg.OutputDirectory)
+	assert.True(t, fileCfg.PerRunDirectory)
+}
+
 // TestGetOrganizationsToExportNonExistentFile tests loading the org_ids for selective export with non-existent file
 func TestGetOrganizationsToExportNonExistentFile(t *testing.T) {
 	os.Clearenv()
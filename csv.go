@@ -23,6 +23,7 @@ package main
 // https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/csv.html
 
 import (
+	"context"
 	"encoding/csv"
 	"errors"
 	"fmt"
@@ -35,7 +36,8 @@ import (
 const bufferIsNil = "Buffer is nil"
 
 // DisabledRulesToCSV function exports list of disabled rules + number of users
-// who disabled rules to CSV file.
+// who disabled rules to CSV file. Previous count and trend are empty for
+// rules not reported by previous export.
 func DisabledRulesToCSV(buffer io.Writer, disabledRulesInfo []DisabledRuleInfo) error {
 	if buffer == nil {
 		err := errors.New(bufferIsNil)
@@ -44,7 +46,12 @@ func DisabledRulesToCSV(buffer io.Writer, disabledRulesInfo []DisabledRuleInfo)
 
 	writer := csv.NewWriter(buffer)
 
-	var data = [][]string{{"Rule", "Count"}}
+	var data = [][]string{{
+		disabledRuleColumn, disabledCountColumn, disabledErrorKeyColumn,
+		"Organizations", "First disabled at", "Last disabled at",
+		"Count in window", "Empty justifications share",
+		"Cluster toggles", "Cluster feedbacks",
+		"Previous count", "Trend"}}
 
 	err := writer.WriteAll(data)
 	if err != nil {
@@ -52,9 +59,31 @@ func DisabledRulesToCSV(buffer io.Writer, disabledRulesInfo []DisabledRuleInfo)
 	}
 
 	for _, disabledRuleInfo := range disabledRulesInfo {
+		emptyJustificationsShare := 0.0
+		if disabledRuleInfo.Count > 0 {
+			emptyJustificationsShare = float64(disabledRuleInfo.EmptyJustifications) /
+				float64(disabledRuleInfo.Count)
+		}
+
+		var previousCount, trend string
+		if disabledRuleInfo.PreviousCount != nil {
+			previousCount = strconv.Itoa(*disabledRuleInfo.PreviousCount)
+			trend = fmt.Sprintf("%+d", disabledRuleInfo.Count-*disabledRuleInfo.PreviousCount)
+		}
+
 		err := writer.Write([]string{
 			disabledRuleInfo.Rule,
-			strconv.Itoa(disabledRuleInfo.Count)})
+			strconv.Itoa(disabledRuleInfo.Count),
+			disabledRuleInfo.ErrorKey,
+			strconv.Itoa(disabledRuleInfo.Orgs),
+			disabledRuleInfo.FirstDisabledAt,
+			disabledRuleInfo.LastDisabledAt,
+			strconv.Itoa(disabledRuleInfo.CountInWindow),
+			strconv.FormatFloat(emptyJustificationsShare, 'f', 2, 64),
+			strconv.Itoa(disabledRuleInfo.ClusterToggles),
+			strconv.Itoa(disabledRuleInfo.Feedbacks),
+			previousCount,
+			trend})
 		if err != nil {
 			return err
 		}
@@ -71,8 +100,35 @@ func DisabledRulesToCSV(buffer io.Writer, disabledRulesInfo []DisabledRuleInfo)
 	return nil
 }
 
+// SamplingToCSV function exports sampling parameters, including the seed, into
+// CSV file so the sample can be reproduced later.
+func SamplingToCSV(buffer io.Writer, sampling Sampling) error {
+	if buffer == nil {
+		err := errors.New(bufferIsNil)
+		return err
+	}
+
+	writer := csv.NewWriter(buffer)
+
+	var data = [][]string{
+		{"Parameter", "Value"},
+		{"percent", strconv.FormatFloat(sampling.Percent, 'g', -1, 64)},
+		{"rows per organization", strconv.Itoa(sampling.PerOrg)},
+		{"organizations", strconv.Itoa(sampling.Orgs)},
+		{"seed", strconv.FormatInt(sampling.Seed, 10)},
+	}
+
+	err := writer.WriteAll(data)
+	if err != nil {
+		return err
+	}
+
+	// check for any error during export to CSV
+	return writer.Error()
+}
+
 // TableMetadataToCSV function exports list of table names into CSV file.
-func TableMetadataToCSV(buffer io.Writer, tableNames []TableName, storage DBStorage) error {
+func TableMetadataToCSV(ctx context.Context, buffer io.Writer, tableNames []TableName, storage DBStorage) error {
 	if buffer == nil {
 		err := errors.New(bufferIsNil)
 		return err
@@ -87,7 +143,7 @@ func TableMetadataToCSV(buffer io.Writer, tableNames []TableName, storage DBStor
 	}
 
 	for _, tableName := range tableNames {
-		cnt, err := storage.ReadRecordsCount(tableName)
+		cnt, err := storage.ReadRecordsCount(ctx, tableName)
 		if err != nil {
 			log.Error().Err(err).Msg(readListOfRecordsFailed)
 			return err
@@ -143,3 +199,34 @@ func LoadOrgIDsFromCSV(r io.Reader) ([]string, error) {
 
 	return orgIDs, nil
 }
+
+// PartitionsToCSV function exports number of records exported into each
+// partition to CSV file.
+func PartitionsToCSV(buffer io.Writer, counts []PartitionCount) error {
+	if buffer == nil {
+		err := errors.New(bufferIsNil)
+		return err
+	}
+
+	writer := csv.NewWriter(buffer)
+
+	err := writer.Write([]string{orgIDColumn, tableNameMsg, "Records"})
+	if err != nil {
+		return err
+	}
+
+	for _, count := range counts {
+		err := writer.Write([]string{
+			count.OrgID,
+			string(count.TableName),
+			strconv.Itoa(count.Count)})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	// check for any error during export to CSV
+	return writer.Error()
+}
@@ -24,6 +24,7 @@ package main_test
 
 import (
 	"bytes"
+	"context"
 	"testing"
 
 	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
@@ -54,7 +55,7 @@ func TestDisabledRulesToCSVEmptyListOfRules(t *testing.T) {
 	assert.Nil(t, err, "Error is not expected")
 
 	content := buffer.String()
-	expected := "Rule,Count\n"
+	expected := "Rule,Count,Error key,Organizations,First disabled at,Last disabled at,Count in window,Empty justifications share,Cluster toggles,Cluster feedbacks,Previous count,Trend\n"
 	assert.Equal(t, expected, content)
 }
 
@@ -66,25 +67,28 @@ func TestDisabledRulesToCSV(t *testing.T) {
 
 	// empty list
 	disabledRules := []main.DisabledRuleInfo{
-		{"first", 1},
-		{"second", 2},
-		{"third", 3},
+		{Rule: "first", Count: 1},
+		{Rule: "second", Count: 2},
+		{Rule: "third", Count: 3},
 	}
 
 	err := main.DisabledRulesToCSV(buffer, disabledRules)
 	assert.Nil(t, err, "Error is not expected")
 
 	content := buffer.String()
-	expected := "Rule,Count\nfirst,1\nsecond,2\nthird,3\n"
+	expected := "Rule,Count,Error key,Organizations,First disabled at,Last disabled at,Count in window,Empty justifications share,Cluster toggles,Cluster feedbacks,Previous count,Trend\n" +
+		"first,1,,0,,,0,0.00,0,0,,\n" +
+		"second,2,,0,,,0,0.00,0,0,,\n" +
+		"third,3,,0,,,0,0.00,0,0,,\n"
 	assert.Equal(t, expected, content)
 }
 
 // mustCreateStorage helper function creates dummy storage
 func mustCreateStorage(t *testing.T) *main.DBStorage {
-	storage, err := main.NewStorage(&main.StorageConfiguration{
+	storage, err := main.NewStorage(context.Background(), &main.StorageConfiguration{
 		Driver:        "sqlite3",
 		LogSQLQueries: true,
-	})
+	}, main.RetryPolicy{})
 	assert.NoError(t, err, "Storage constructor")
 	return storage
 }
@@ -98,7 +102,7 @@ func TestTableMetadataToCSVNilBuffer(t *testing.T) {
 	// empty list
 	tableNames := []main.TableName{}
 
-	err := main.TableMetadataToCSV(nil, tableNames, *storage)
+	err := main.TableMetadataToCSV(context.Background(), nil, tableNames, *storage)
 	assert.Error(t, err, "Buffer is nil")
 }
 
@@ -114,7 +118,7 @@ func TestTableMetadataToCSVEmptyListOfRules(t *testing.T) {
 	// empty list
 	tableNames := []main.TableName{}
 
-	err := main.TableMetadataToCSV(buffer, tableNames, *storage)
+	err := main.TableMetadataToCSV(context.Background(), buffer, tableNames, *storage)
 	assert.NoError(t, err, "Error not expected")
 
 	content := buffer.String()
@@ -138,6 +142,56 @@ func TestTableMetadataToCSV(t *testing.T) {
 		main.TableName("third"),
 	}
 
-	err := main.TableMetadataToCSV(buffer, tableNames, *storage)
+	err := main.TableMetadataToCSV(context.Background(), buffer, tableNames, *storage)
 	assert.Error(t, err, "Storage error is not expected")
 }
+
+// TestSamplingToCSVNilBuffer check how nil buffer is handled by SamplingToCSV
+// function
+func TestSamplingToCSVNilBuffer(t *testing.T) {
+	err := main.SamplingToCSV(nil, main.Sampling{})
+	assert.Error(t, err, "Buffer is nil")
+}
+
+// TestSamplingToCSV check exporting sampling parameters into CSV
+func TestSamplingToCSV(t *testing.T) {
+	// buffer
+	buffer := new(bytes.Buffer)
+
+	sampling := main.Sampling{
+		Percent: 2.5,
+		PerOrg:  10,
+		Orgs:    0,
+		Seed:    1234,
+	}
+
+	err := main.SamplingToCSV(buffer, sampling)
+	assert.Nil(t, err, "Error is not expected")
+
+	expected := "Parameter,Value\npercent,2.5\nrows per organization,10\norganizations,0\nseed,1234\n"
+	assert.Equal(t, expected, buffer.String())
+}
+
+// TestPartitionsToCSVNilBuffer check how nil buffer is handled by
+// PartitionsToCSV function
+func TestPartitionsToCSVNilBuffer(t *testing.T) {
+	err := main.PartitionsToCSV(nil, nil)
+	assert.Error(t, err, "Buffer is nil")
+}
+
+// TestPartitionsToCSV check exporting partitions info into CSV
+func TestPartitionsToCSV(t *testing.T) {
+	// buffer
+	buffer := new(bytes.Buffer)
+
+	counts := []main.PartitionCount{
+		{OrgID: "1", TableName: "report", Count: 10},
+		{OrgID: "2", TableName: "report", Count: 0},
+	}
+
+	err := main.PartitionsToCSV(buffer, counts)
+	assert.Nil(t, err, "Error is not expected")
+
+	expected := "org_id,Table name,Records\n1,report,10\n2,report,0\n"
+	assert.Equal(t, expected, buffer.String())
+}
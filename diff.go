@@ -0,0 +1,581 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains comparison of two exports. Tables stored by
+// StoreTable are read from two local directories or S3 prefixes, rows are
+// matched by primary key and added, removed and changed rows are reported for
+// each table.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/diff.html
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog/log"
+)
+
+// Messages
+const (
+	invalidS3Location    = "invalid S3 location %s, expected s3://bucket/prefix"
+	unknownDiffFormat    = "unknown format of differences: %s"
+	readExportedTable    = "Unable to read exported table %s: %w"
+	keyColumnsNotFound   = "Primary key of table not found, whole rows are compared"
+	writeTableDiffToCSV  = "Write differences of table to CSV"
+	writeTableDiffToJSON = "Write differences of table to JSON"
+)
+
+// Formats of differences
+const (
+	diffFormatCSV  = "csv"
+	diffFormatJSON = "json"
+)
+
+// Kinds of change stored in CSV file with differences
+const (
+	changeAdded       = "added"
+	changeRemoved     = "removed"
+	changeChangedFrom = "changed_from"
+	changeChangedTo   = "changed_to"
+)
+
+// s3LocationPrefix is used to select export stored in S3
+const s3LocationPrefix = "s3://"
+
+// diffFileSuffix is appended to table name to construct name of file with
+// differences
+const diffFileSuffix = "_diff"
+
+// ExportedTableContent represents content of table read from export
+type ExportedTableContent struct {
+	Columns []string
+	Rows    [][]string
+}
+
+// RowChange represents row that exists in both exports with different
+// values
+type RowChange struct {
+	Key     map[string]string `json:"key"`
+	Old     map[string]string `json:"old"`
+	New     map[string]string `json:"new"`
+	Columns []string          `json:"changed_columns"`
+}
+
+// TableDiff represents differences of one table between two exports
+type TableDiff struct {
+	Table   TableName           `json:"table"`
+	Key     []string            `json:"key"`
+	Columns []string            `json:"columns"`
+	Added   []map[string]string `json:"added"`
+	Removed []map[string]string `json:"removed"`
+	Changed []RowChange         `json:"changed"`
+}
+
+// exportLocation represents export stored in local directory or in S3
+type exportLocation struct {
+	// list returns names of all files stored in location
+	list func() ([]string, error)
+
+	// read returns content of file stored in location
+	read contentLoader
+}
+
+// keyReader is function that returns primary key of given table
+type keyReader func(tableName TableName) ([]string, error)
+
+// openExportLocation function opens export stored in local directory or in
+// S3 when location is in s3://bucket/prefix form.
+func openExportLocation(ctx context.Context, configuration *ConfigStruct,
+	location string) (*exportLocation, error) {
+	if !strings.HasPrefix(location, s3LocationPrefix) {
+		return openDirectoryLocation(location), nil
+	}
+
+	bucket, prefix, err := parseS3Location(location)
+	if err != nil {
+		return nil, err
+	}
+
+	minioClient, err := NewS3Connection(configuration)
+	if err != nil {
+		return nil, err
+	}
+
+	return &exportLocation{
+		list: func() ([]string, error) {
+			return listObjectsInS3(ctx, minioClient, bucket, prefix)
+		},
+		read: func(name string) ([]byte, bool, error) {
+			return readObjectFromS3(ctx, minioClient, bucket, setObjectPrefix(prefix, name))
+		},
+	}, nil
+}
+
+// parseS3Location function returns bucket and prefix from location in
+// s3://bucket/prefix form.
+func parseS3Location(location string) (string, string, error) {
+	bucket, prefix, _ := strings.Cut(strings.TrimPrefix(location, s3LocationPrefix), "/")
+	if bucket == "" {
+		return "", "", fmt.Errorf(invalidS3Location, location)
+	}
+	return bucket, strings.TrimSuffix(prefix, "/"), nil
+}
+
+// openDirectoryLocation function opens export stored in local directory.
+func openDirectoryLocation(directory string) *exportLocation {
+	return &exportLocation{
+		list: func() ([]string, error) {
+			entries, err := os.ReadDir(directory)
+			if err != nil {
+				return nil, err
+			}
+
+			var names []string
+			for _, entry := range entries {
+				if !entry.IsDir() {
+					names = append(names, entry.Name())
+				}
+			}
+			return names, nil
+		},
+		read: func(name string) ([]byte, bool, error) {
+			return readFile(filepath.Join(directory, name))
+		},
+	}
+}
+
+// listObjectsInS3 function returns names of all objects stored directly
+// under given prefix. Prefix is not part of returned names.
+func listObjectsInS3(ctx context.Context, minioClient *minio.Client,
+	bucketName, prefix string) ([]string, error) {
+	objectPrefix := setObjectPrefix(prefix, "")
+
+	var names []string
+	for object := range minioClient.ListObjects(ctx, bucketName, minio.ListObjectsOptions{
+		Prefix: objectPrefix,
+	}) {
+		if object.Err != nil {
+			return nil, object.Err
+		}
+		name := strings.TrimPrefix(object.Key, objectPrefix)
+		if name != "" && !strings.HasSuffix(name, "/") {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// exportedTableNames function returns names of all tables stored in export.
+// Files with metadata (their names start with underscore) are skipped.
+func exportedTableNames(location *exportLocation) (map[TableName]struct{}, error) {
+	names, err := location.list()
+	if err != nil {
+		return nil, err
+	}
+
+	tableNames := make(map[TableName]struct{})
+	for _, name := range names {
+		if strings.HasPrefix(name, "_") || !strings.HasSuffix(name, CSVFileExtension) {
+			continue
+		}
+		tableNames[TableName(strings.TrimSuffix(name, CSVFileExtension))] = struct{}{}
+	}
+	return tableNames, nil
+}
+
+// readExportedSchema function reads primary keys of tables from _schema.json
+// stored in export, if any.
+func readExportedSchema(location *exportLocation) (map[TableName][]string, error) {
+	content, found, err := location.read(schemaInfo)
+	if err != nil || !found {
+		return nil, err
+	}
+
+	schema := Schema{}
+	err = json.Unmarshal(content, &schema)
+	if err != nil {
+		return nil, err
+	}
+
+	keys := make(map[TableName][]string, len(schema.Tables))
+	for _, table := range schema.Tables {
+		keys[table.Name] = table.PrimaryKey
+	}
+	return keys, nil
+}
+
+// ReadExportedTable function parses table stored in CSV format.
+func ReadExportedTable(content []byte) (*ExportedTableContent, error) {
+	records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	table := &ExportedTableContent{}
+	if len(records) > 0 {
+		table.Columns = records[0]
+		table.Rows = records[1:]
+	}
+	return table, nil
+}
+
+// readTableFromLocation function reads table from export. Empty table is
+// returned when table is not part of export.
+func readTableFromLocation(location *exportLocation, tableName TableName) (*ExportedTableContent, error) {
+	content, found, err := location.read(string(tableName) + CSVFileExtension)
+	if err != nil {
+		return nil, fmt.Errorf(readExportedTable, tableName, err)
+	}
+	if !found {
+		return &ExportedTableContent{}, nil
+	}
+
+	table, err := ReadExportedTable(content)
+	if err != nil {
+		return nil, fmt.Errorf(readExportedTable, tableName, err)
+	}
+	return table, nil
+}
+
+// DiffExports function compares all tables stored in two exports. Primary
+// keys of tables are read from _schema.json stored in exports or by given
+// key reader.
+func DiffExports(oldLocation, newLocation *exportLocation,
+	ignoredTables IgnoredTables, readKey keyReader) ([]*TableDiff, error) {
+	oldTables, err := exportedTableNames(oldLocation)
+	if err != nil {
+		return nil, err
+	}
+	newTables, err := exportedTableNames(newLocation)
+	if err != nil {
+		return nil, err
+	}
+
+	// primary keys stored with newer export take precedence
+	keys := make(map[TableName][]string)
+	for _, location := range []*exportLocation{oldLocation, newLocation} {
+		schemaKeys, err := readExportedSchema(location)
+		if err != nil {
+			return nil, err
+		}
+		for tableName, key := range schemaKeys {
+			keys[tableName] = key
+		}
+	}
+
+	for tableName := range oldTables {
+		newTables[tableName] = struct{}{}
+	}
+	tableNames := make([]TableName, 0, len(newTables))
+	for tableName := range newTables {
+		if _, found := ignoredTables[string(tableName)]; !found {
+			tableNames = append(tableNames, tableName)
+		}
+	}
+	sort.Slice(tableNames, func(i, j int) bool {
+		return tableNames[i] < tableNames[j]
+	})
+
+	diffs := make([]*TableDiff, 0, len(tableNames))
+	for _, tableName := range tableNames {
+		oldTable, err := readTableFromLocation(oldLocation, tableName)
+		if err != nil {
+			return nil, err
+		}
+		newTable, err := readTableFromLocation(newLocation, tableName)
+		if err != nil {
+			return nil, err
+		}
+
+		key, found := keys[tableName]
+		if !found && readKey != nil {
+			key, err = readKey(tableName)
+			if err != nil {
+				log.Warn().Err(err).Str(tableNameMsg, string(tableName)).Msg(keyColumnsNotFound)
+				key = nil
+			}
+		}
+
+		diffs = append(diffs, DiffTable(tableName, key, oldTable, newTable))
+	}
+	return diffs, nil
+}
+
+// DiffTable function compares rows of table from two exports. Rows are
+// matched by given key columns. Whole rows are compared when key is empty
+// or when any key column is missing in any export.
+func DiffTable(tableName TableName, key []string, oldTable, newTable *ExportedTableContent) *TableDiff {
+	columns := mergeColumns(newTable.Columns, oldTable.Columns)
+	if !containsColumns(oldTable, key) || !containsColumns(newTable, key) {
+		if len(key) > 0 {
+			log.Warn().Str(tableNameMsg, string(tableName)).Strs("key", key).Msg(keyColumnsNotFound)
+		}
+		key = nil
+	}
+
+	diff := &TableDiff{
+		Table:   tableName,
+		Key:     key,
+		Columns: columns,
+		Added:   []map[string]string{},
+		Removed: []map[string]string{},
+		Changed: []RowChange{},
+	}
+
+	oldRows := indexRows(oldTable, key, columns)
+	newRows := indexRows(newTable, key, columns)
+
+	// rows with the same key are matched in order, so duplicate rows of
+	// tables without primary key are not collapsed
+	matched := make(map[string]int)
+	for _, row := range newRows.rows {
+		rowKey := rowKey(row, key, columns)
+		candidates := oldRows.byKey[rowKey]
+		if matched[rowKey] >= len(candidates) {
+			diff.Added = append(diff.Added, row)
+			continue
+		}
+		oldRow := candidates[matched[rowKey]]
+		matched[rowKey]++
+
+		var changedColumns []string
+		for _, column := range columns {
+			if oldRow[column] != row[column] {
+				changedColumns = append(changedColumns, column)
+			}
+		}
+		if len(changedColumns) > 0 {
+			keyValues := make(map[string]string, len(key))
+			for _, column := range key {
+				keyValues[column] = row[column]
+			}
+			diff.Changed = append(diff.Changed, RowChange{
+				Key:     keyValues,
+				Old:     oldRow,
+				New:     row,
+				Columns: changedColumns,
+			})
+		}
+	}
+
+	// old rows that were not matched by any new row have been removed
+	seen := make(map[string]int)
+	for _, row := range oldRows.rows {
+		rowKey := rowKey(row, key, columns)
+		seen[rowKey]++
+		if seen[rowKey] > matched[rowKey] {
+			diff.Removed = append(diff.Removed, row)
+		}
+	}
+
+	return diff
+}
+
+// indexedRows represents rows of table in original order together with
+// index by key. More rows share the same key when the table contains
+// duplicate rows.
+type indexedRows struct {
+	rows  []map[string]string
+	byKey map[string][]map[string]string
+}
+
+// indexRows function converts rows of table into maps and indexes them by
+// key.
+func indexRows(table *ExportedTableContent, key, columns []string) indexedRows {
+	indexed := indexedRows{
+		rows:  make([]map[string]string, 0, len(table.Rows)),
+		byKey: make(map[string][]map[string]string, len(table.Rows)),
+	}
+
+	for _, record := range table.Rows {
+		row := make(map[string]string, len(columns))
+		for i, column := range table.Columns {
+			if i < len(record) {
+				row[column] = record[i]
+			}
+		}
+		indexed.rows = append(indexed.rows, row)
+		rowKey := rowKey(row, key, columns)
+		indexed.byKey[rowKey] = append(indexed.byKey[rowKey], row)
+	}
+	return indexed
+}
+
+// rowKey function constructs value used to match rows from two exports.
+func rowKey(row map[string]string, key, columns []string) string {
+	if len(key) == 0 {
+		key = columns
+	}
+
+	values := make([]string, len(key))
+	for i, column := range key {
+		values[i] = row[column]
+	}
+	return strings.Join(values, "\x00")
+}
+
+// mergeColumns function returns columns of newer export followed by columns
+// that exist in older export only.
+func mergeColumns(newColumns, oldColumns []string) []string {
+	columns := append([]string{}, newColumns...)
+	for _, column := range oldColumns {
+		if !slices.Contains(columns, column) {
+			columns = append(columns, column)
+		}
+	}
+	return columns
+}
+
+// containsColumns function checks whether table contains all given columns.
+// Table that is not part of export contains any columns.
+func containsColumns(table *ExportedTableContent, columns []string) bool {
+	if len(table.Columns) == 0 {
+		return true
+	}
+	for _, column := range columns {
+		if !slices.Contains(table.Columns, column) {
+			return false
+		}
+	}
+	return true
+}
+
+// TableDiffToCSV function writes differences of table in CSV format. The
+// first column contains kind of change, the last column contains names of
+// changed columns. Changed rows are written twice, with old and new values.
+func TableDiffToCSV(writer io.Writer, diff *TableDiff) error {
+	if writer == nil {
+		err := errors.New(bufferIsNil)
+		log.Error().Err(err).Msg(writeTableDiffToCSV)
+		return err
+	}
+
+	csvWriter := csv.NewWriter(writer)
+
+	header := append([]string{"change"}, diff.Columns...)
+	header = append(header, "changed_columns")
+	err := csvWriter.Write(header)
+	if err != nil {
+		return err
+	}
+
+	writeRow := func(change string, row map[string]string, changedColumns []string) error {
+		record := []string{change}
+		for _, column := range diff.Columns {
+			record = append(record, row[column])
+		}
+		record = append(record, strings.Join(changedColumns, ","))
+		return csvWriter.Write(record)
+	}
+
+	for _, row := range diff.Added {
+		if err := writeRow(changeAdded, row, nil); err != nil {
+			return err
+		}
+	}
+	for _, row := range diff.Removed {
+		if err := writeRow(changeRemoved, row, nil); err != nil {
+			return err
+		}
+	}
+	for _, change := range diff.Changed {
+		if err := writeRow(changeChangedFrom, change.Old, change.Columns); err != nil {
+			return err
+		}
+		if err := writeRow(changeChangedTo, change.New, change.Columns); err != nil {
+			return err
+		}
+	}
+
+	csvWriter.Flush()
+	return csvWriter.Error()
+}
+
+// TableDiffToJSON function writes differences of table in JSON format.
+func TableDiffToJSON(writer io.Writer, diff *TableDiff) error {
+	if writer == nil {
+		err := errors.New(bufferIsNil)
+		log.Error().Err(err).Msg(writeTableDiffToJSON)
+		return err
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(diff)
+}
+
+// PrintDiffCounts function prints number of added, removed and changed rows
+// of all compared tables.
+func PrintDiffCounts(output io.Writer, diffs []*TableDiff) error {
+	writer := tabwriter.NewWriter(output, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintln(writer, "Table\tAdded\tRemoved\tChanged\t")
+
+	var added, removed, changed int
+	for _, diff := range diffs {
+		added += len(diff.Added)
+		removed += len(diff.Removed)
+		changed += len(diff.Changed)
+		fmt.Fprintf(writer, "%s\t%d\t%d\t%d\t\n", diff.Table,
+			len(diff.Added), len(diff.Removed), len(diff.Changed))
+	}
+	fmt.Fprintf(writer, "TOTAL\t%d\t%d\t%d\t\n", added, removed, changed)
+
+	return writer.Flush()
+}
+
+// storeTableDiffs function stores differences of all tables into given
+// directory, one file per table. Files from previous comparison are
+// overwritten.
+func storeTableDiffs(ctx context.Context, directory, format string, diffs []*TableDiff) error {
+	sink := newFileSink(directory, true)
+
+	contentType := contentTypeCSV
+	if format == diffFormatJSON {
+		contentType = contentTypeJSON
+	}
+
+	for _, diff := range diffs {
+		err := storeIntoSink(ctx, sink, string(diff.Table)+diffFileSuffix+"."+format, contentType,
+			func(writer io.Writer) error {
+				if format == diffFormatJSON {
+					return TableDiffToJSON(writer, diff)
+				}
+				return TableDiffToCSV(writer, diff)
+			})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
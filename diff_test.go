@@ -0,0 +1,409 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/diff_test.html
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+const (
+	oldRuleDisable = "org_id,rule_id,justification\n" +
+		"1,rule.a,first\n" +
+		"1,rule.b,second\n" +
+		"2,rule.a,third\n"
+	newRuleDisable = "org_id,rule_id,justification\n" +
+		"1,rule.a,first\n" +
+		"2,rule.a,changed\n" +
+		"3,rule.c,new\n"
+)
+
+// mustReadExportedTable helper function parses table in CSV format
+func mustReadExportedTable(t *testing.T, content string) *main.ExportedTableContent {
+	table, err := main.ReadExportedTable([]byte(content))
+	assert.NoError(t, err)
+	return table
+}
+
+// mustWriteFiles helper function writes given files into directory
+func mustWriteFiles(t *testing.T, directory string, files map[string]string) {
+	assert.NoError(t, os.MkdirAll(directory, 0o750))
+	for name, content := range files {
+		assert.NoError(t, os.WriteFile(filepath.Join(directory, name), []byte(content), 0o600))
+	}
+}
+
+// TestDiffTable checks that rows are matched by primary key
+func TestDiffTable(t *testing.T) {
+	diff := main.DiffTable("rule_disable", []string{"org_id", "rule_id"},
+		mustReadExportedTable(t, oldRuleDisable),
+		mustReadExportedTable(t, newRuleDisable))
+
+	assert.Equal(t, main.TableName("rule_disable"), diff.Table)
+	assert.Equal(t, []string{"org_id", "rule_id", "justification"}, diff.Columns)
+	assert.Equal(t, []map[string]string{
+		{"org_id": "3", "rule_id": "rule.c", "justification": "new"},
+	}, diff.Added)
+	assert.Equal(t, []map[string]string{
+		{"org_id": "1", "rule_id": "rule.b", "justification": "second"},
+	}, diff.Removed)
+	assert.Equal(t, []main.RowChange{
+		{
+			Key:     map[string]string{"org_id": "2", "rule_id": "rule.a"},
+			Old:     map[string]string{"org_id": "2", "rule_id": "rule.a", "justification": "third"},
+			New:     map[string]string{"org_id": "2", "rule_id": "rule.a", "justification": "changed"},
+			Columns: []string{"justification"},
+		},
+	}, diff.Changed)
+}
+
+// TestDiffTableWithoutKey checks that whole rows are compared when primary
+// key is not known or is not part of exported columns
+func TestDiffTableWithoutKey(t *testing.T) {
+	for _, key := range [][]string{nil, {"id"}} {
+		diff := main.DiffTable("rule_disable", key,
+			mustReadExportedTable(t, oldRuleDisable),
+			mustReadExportedTable(t, newRuleDisable))
+
+		assert.Empty(t, diff.Key)
+		assert.Len(t, diff.Added, 2)
+		assert.Len(t, diff.Removed, 2)
+		assert.Empty(t, diff.Changed)
+	}
+}
+
+// TestDiffTableDuplicateRows checks that duplicate rows of table without
+// primary key are counted
+func TestDiffTableDuplicateRows(t *testing.T) {
+	diff := main.DiffTable("t", nil,
+		mustReadExportedTable(t, "id,value\n1,a\n1,a\n1,a\n2,b\n"),
+		mustReadExportedTable(t, "id,value\n1,a\n2,b\n2,b\n"))
+
+	assert.Equal(t, []map[string]string{{"id": "2", "value": "b"}}, diff.Added)
+	assert.Equal(t, []map[string]string{
+		{"id": "1", "value": "a"},
+		{"id": "1", "value": "a"},
+	}, diff.Removed)
+	assert.Empty(t, diff.Changed)
+}
+
+// TestDiffTableAddedColumn checks that column added between exports is
+// reported as changed
+func TestDiffTableAddedColumn(t *testing.T) {
+	diff := main.DiffTable("t", []string{"id"},
+		mustReadExportedTable(t, "id,value\n1,a\n"),
+		mustReadExportedTable(t, "id,created,value\n1,2024,a\n"))
+
+	assert.Equal(t, []string{"id", "created", "value"}, diff.Columns)
+	assert.Len(t, diff.Changed, 1)
+	assert.Equal(t, []string{"created"}, diff.Changed[0].Columns)
+}
+
+// TestDiffTableMissingTable checks that all rows are added when table is
+// not part of older export
+func TestDiffTableMissingTable(t *testing.T) {
+	diff := main.DiffTable("t", []string{"id"},
+		mustReadExportedTable(t, ""),
+		mustReadExportedTable(t, "id,value\n1,a\n2,b\n"))
+
+	assert.Equal(t, []string{"id"}, diff.Key)
+	assert.Len(t, diff.Added, 2)
+	assert.Empty(t, diff.Removed)
+}
+
+// TestTableDiffToCSV checks conversion of differences into CSV
+func TestTableDiffToCSV(t *testing.T) {
+	diff := main.DiffTable("rule_disable", []string{"org_id", "rule_id"},
+		mustReadExportedTable(t, oldRuleDisable),
+		mustReadExportedTable(t, newRuleDisable))
+
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, main.TableDiffToCSV(buffer, diff))
+
+	expected := "change,org_id,rule_id,justification,changed_columns\n" +
+		"added,3,rule.c,new,\n" +
+		"removed,1,rule.b,second,\n" +
+		"changed_from,2,rule.a,third,justification\n" +
+		"changed_to,2,rule.a,changed,justification\n"
+	assert.Equal(t, expected, buffer.String())
+
+	assert.Error(t, main.TableDiffToCSV(nil, diff))
+}
+
+// TestTableDiffToJSON checks conversion of differences into JSON
+func TestTableDiffToJSON(t *testing.T) {
+	diff := main.DiffTable("t", []string{"id"},
+		mustReadExportedTable(t, "id\n1\n"),
+		mustReadExportedTable(t, "id\n1\n"))
+
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, main.TableDiffToJSON(buffer, diff))
+	assert.JSONEq(t, `{"table": "t", "key": ["id"], "columns": ["id"],
+		"added": [], "removed": [], "changed": []}`, buffer.String())
+
+	assert.Error(t, main.TableDiffToJSON(nil, diff))
+}
+
+// TestPrintDiffCounts checks printing of number of changed rows
+func TestPrintDiffCounts(t *testing.T) {
+	diff := main.DiffTable("rule_disable", []string{"org_id", "rule_id"},
+		mustReadExportedTable(t, oldRuleDisable),
+		mustReadExportedTable(t, newRuleDisable))
+
+	output := new(bytes.Buffer)
+	assert.NoError(t, main.PrintDiffCounts(output, []*main.TableDiff{diff}))
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, []string{"Table", "Added", "Removed", "Changed"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"rule_disable", "1", "1", "1"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"TOTAL", "1", "1", "1"}, strings.Fields(lines[2]))
+}
+
+// TestRunDiff checks the diff subcommand with two local directories
+func TestRunDiff(t *testing.T) {
+	directory := t.TempDir()
+	oldDirectory := filepath.Join(directory, "monday")
+	newDirectory := filepath.Join(directory, "tuesday")
+	outputDirectory := filepath.Join(directory, "diff")
+
+	mustWriteFiles(t, oldDirectory, map[string]string{
+		"rule_disable.csv": oldRuleDisable,
+		"removed.csv":      "id\n1\n",
+		"_tables.csv":      "table\nrule_disable\n",
+	})
+	mustWriteFiles(t, newDirectory, map[string]string{
+		"rule_disable.csv": newRuleDisable,
+		"ignored.csv":      "id\n1\n",
+		"_schema.json": `{"tables": [{"name": "rule_disable",
+			"primary_key": ["org_id", "rule_id"]}]}`,
+	})
+
+	cliFlags := main.CliFlags{
+		DiffFormat:    "json",
+		DiffOutputDir: outputDirectory,
+		IgnoredTables: "ignored",
+	}
+	output := new(bytes.Buffer)
+	code, err := main.RunDiff(&main.ConfigStruct{}, cliFlags,
+		[]string{oldDirectory, newDirectory}, output, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.Equal(t, []string{"removed", "0", "1", "0"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"rule_disable", "1", "1", "1"}, strings.Fields(lines[2]))
+	assert.Equal(t, []string{"TOTAL", "1", "2", "1"}, strings.Fields(lines[3]))
+
+	content, err := os.ReadFile(filepath.Join(outputDirectory, "rule_disable_diff.json"))
+	assert.NoError(t, err)
+	var diff main.TableDiff
+	assert.NoError(t, json.Unmarshal(content, &diff))
+	assert.Equal(t, []string{"org_id", "rule_id"}, diff.Key)
+	assert.Len(t, diff.Changed, 1)
+
+	assert.FileExists(t, filepath.Join(outputDirectory, "removed_diff.json"))
+	assert.NoFileExists(t, filepath.Join(outputDirectory, "ignored_diff.json"))
+
+	// differences stored by previous comparison are overwritten
+	code, err = main.RunDiff(&main.ConfigStruct{}, cliFlags,
+		[]string{oldDirectory, newDirectory}, new(bytes.Buffer), &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+}
+
+// TestRunDiffOutputNotWritable checks that error is reported when
+// differences can't be stored
+func TestRunDiffOutputNotWritable(t *testing.T) {
+	directory := t.TempDir()
+	oldDirectory := filepath.Join(directory, "monday")
+	newDirectory := filepath.Join(directory, "tuesday")
+	mustWriteFiles(t, oldDirectory, map[string]string{"t.csv": "id\n1\n"})
+	mustWriteFiles(t, newDirectory, map[string]string{"t.csv": "id\n2\n"})
+
+	// output directory can't be created, because file with the same name
+	// exists
+	outputDirectory := filepath.Join(directory, "diff")
+	assert.NoError(t, os.WriteFile(outputDirectory, []byte{}, 0o600))
+
+	cliFlags := main.CliFlags{
+		DiffFormat:    "csv",
+		DiffOutputDir: outputDirectory,
+	}
+	code, err := main.RunDiff(&main.ConfigStruct{}, cliFlags,
+		[]string{oldDirectory, newDirectory}, new(bytes.Buffer), &log.Logger, nil)
+	assert.Error(t, err)
+	assert.Equal(t, main.ExitStatusIOError, code)
+}
+
+// TestRunDiffKeyFromDatabase checks that primary key is read from database
+// when exports do not contain schema
+func TestRunDiffKeyFromDatabase(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+
+	mustWriteFiles(t, filepath.Join(directory, "old"), map[string]string{
+		"good.csv": "id,value\n1,a\n2,b\n",
+	})
+	mustWriteFiles(t, filepath.Join(directory, "new"), map[string]string{
+		"good.csv": "id,value\n1,a\n2,c\n",
+	})
+
+	cliFlags := main.CliFlags{
+		DiffFormat:    "csv",
+		DiffOutputDir: directory,
+	}
+	code, err := main.RunDiff(&configuration, cliFlags,
+		[]string{filepath.Join(directory, "old"), filepath.Join(directory, "new")},
+		new(bytes.Buffer), &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	content, err := os.ReadFile(filepath.Join(directory, "good_diff.csv"))
+	assert.NoError(t, err)
+	assert.Equal(t, "change,id,value,changed_columns\n"+
+		"changed_from,2,b,value\n"+
+		"changed_to,2,c,value\n", string(content))
+}
+
+// TestRunDiffS3 checks the diff subcommand with two S3 prefixes
+func TestRunDiffS3(t *testing.T) {
+	configuration := main.ConfigStruct{}
+	mockS3(t, &configuration, "bucket")
+
+	minioClient, err := main.NewS3Connection(&configuration)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	for object, content := range map[string]string{
+		"monday/rule_disable.csv":  oldRuleDisable,
+		"tuesday/rule_disable.csv": newRuleDisable,
+		"tuesday/_summary.json":    "{}",
+	} {
+		_, err := minioClient.PutObject(ctx, "bucket", object, strings.NewReader(content),
+			int64(len(content)), minio.PutObjectOptions{})
+		assert.NoError(t, err)
+	}
+
+	outputDirectory := t.TempDir()
+	cliFlags := main.CliFlags{
+		DiffFormat:    "csv",
+		DiffOutputDir: outputDirectory,
+	}
+	output := new(bytes.Buffer)
+	code, err := main.RunDiff(&configuration, cliFlags,
+		[]string{"s3://bucket/monday", "s3://bucket/tuesday/"}, output, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	// primary key is not known, so changed row is removed and added
+	lines := strings.Split(strings.TrimSpace(output.String()), "\n")
+	assert.Len(t, lines, 3)
+	assert.Equal(t, []string{"rule_disable", "2", "2", "0"}, strings.Fields(lines[1]))
+	assert.FileExists(t, filepath.Join(outputDirectory, "rule_disable_diff.csv"))
+}
+
+// TestRunDiffErrors checks errors reported by the diff subcommand
+func TestRunDiffErrors(t *testing.T) {
+	directory := t.TempDir()
+
+	code, err := main.RunDiff(&main.ConfigStruct{}, main.CliFlags{DiffFormat: "xml"},
+		[]string{directory, directory}, new(bytes.Buffer), &log.Logger, nil)
+	assert.EqualError(t, err, "unknown format of differences: xml")
+	assert.Equal(t, main.ExitStatusConfigurationError, code)
+
+	code, err = main.RunDiff(&main.ConfigStruct{}, main.CliFlags{DiffFormat: "csv"},
+		[]string{"s3://", directory}, new(bytes.Buffer), &log.Logger, nil)
+	assert.EqualError(t, err, "invalid S3 location s3://, expected s3://bucket/prefix")
+	assert.Equal(t, main.ExitStatusConfigurationError, code)
+
+	code, err = main.RunDiff(&main.ConfigStruct{}, main.CliFlags{DiffFormat: "csv"},
+		[]string{filepath.Join(directory, "missing"), directory}, new(bytes.Buffer), &log.Logger, nil)
+	assert.Error(t, err)
+	assert.Equal(t, main.ExitStatusIOError, code)
+}
+
+// TestRunDiffDatabaseNotOpened checks that database is not opened when
+// primary keys of all tables are stored in exports
+func TestRunDiffDatabaseNotOpened(t *testing.T) {
+	directory := t.TempDir()
+	configuration := main.ConfigStruct{
+		Storage: main.StorageConfiguration{
+			Driver:           "sqlite3",
+			SQLiteDataSource: filepath.Join(directory, "test.db"),
+		},
+	}
+
+	mustWriteFiles(t, filepath.Join(directory, "old"), map[string]string{
+		"good.csv": "id,value\n1,a\n",
+	})
+	mustWriteFiles(t, filepath.Join(directory, "new"), map[string]string{
+		"good.csv":     "id,value\n1,b\n",
+		"_schema.json": `{"tables": [{"name": "good", "primary_key": ["id"]}]}`,
+	})
+
+	cliFlags := main.CliFlags{
+		DiffFormat:    "csv",
+		DiffOutputDir: directory,
+	}
+	code, err := main.RunDiff(&configuration, cliFlags,
+		[]string{filepath.Join(directory, "old"), filepath.Join(directory, "new")},
+		new(bytes.Buffer), &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	// SQLite creates database file when connection is established
+	assert.NoFileExists(t, filepath.Join(directory, "test.db"))
+}
+
+// TestRunDiffDeadline checks that comparison stopped by deadline is reported
+// as incomplete
+func TestRunDiffDeadline(t *testing.T) {
+	directory := t.TempDir()
+	mustWriteFiles(t, filepath.Join(directory, "old"), map[string]string{"t.csv": "id\n1\n"})
+	mustWriteFiles(t, filepath.Join(directory, "new"), map[string]string{"t.csv": "id\n2\n"})
+
+	cliFlags := main.CliFlags{
+		DiffFormat:    "csv",
+		DiffOutputDir: directory,
+		Deadline:      time.Nanosecond,
+	}
+	code, err := main.RunDiff(&main.ConfigStruct{}, cliFlags,
+		[]string{filepath.Join(directory, "old"), filepath.Join(directory, "new")},
+		new(bytes.Buffer), &log.Logger, nil)
+	assert.EqualError(t, err, "deadline reached")
+	assert.Equal(t, main.ExitStatusIncomplete, code)
+	assert.NoFileExists(t, filepath.Join(directory, "t_diff.csv"))
+}
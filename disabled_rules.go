@@ -0,0 +1,269 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains the report about disabled rules exported with
+// -disabled-by-more-users flag. Rules disabled by users are counted per
+// (rule_id, error_key) together with number of organizations, first and
+// last disable dates, number of disables in configured time window, share of
+// empty justifications and number of rules disabled for single clusters.
+// Trend is computed against report stored by previous export.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/disabled_rules.html
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"slices"
+	"strconv"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// default values used when disabled rules report is not configured
+const (
+	defaultDisabledRulesMinCount = 2
+	defaultDisabledRulesWindow   = 30 * 24 * time.Hour
+)
+
+// Messages
+const (
+	readPreviousDisabledRules = "Unable to read disabled rules stored by previous export, trend is not computed"
+	clusterDisablesNotFound   = "Table with rules disabled for single clusters not found, rules are not counted"
+)
+
+// Tables with disabled rules, rules disabled for single clusters are stored
+// in the last two
+const (
+	ruleDisableTable                TableName = "rule_disable"
+	clusterRuleToggleTable          TableName = "cluster_rule_toggle"
+	clusterRuleDisableFeedbackTable TableName = "cluster_user_rule_disable_feedback"
+)
+
+// SQL queries used to read rules disabled for single clusters, filter by
+// organizations is added into WHERE clause
+const (
+	selectRuleCounts     = "SELECT rule_id, error_key, count(*) FROM %s"
+	clusterRuleDisabled  = "disabled = 1"
+	groupByRuleAndErrKey = " GROUP BY rule_id, error_key"
+)
+
+// Columns of CSV file with disabled rules
+const (
+	disabledRuleColumn     = "Rule"
+	disabledErrorKeyColumn = "Error key"
+	disabledCountColumn    = "Count"
+)
+
+// DisabledRulesConfiguration represents configuration of disabled rules
+// report
+type DisabledRulesConfiguration struct {
+	// MinCount is minimal number of users that disabled rule to be
+	// reported. Zero means the default value (2).
+	MinCount int `mapstructure:"min_count" toml:"min_count"`
+
+	// Window is length of time window in which disables are counted. Zero
+	// means the default value (30 days).
+	Window time.Duration `mapstructure:"window" toml:"window"`
+}
+
+// minCount method returns minimal count of disables with default applied.
+func (configuration DisabledRulesConfiguration) minCount() int {
+	if configuration.MinCount <= 0 {
+		return defaultDisabledRulesMinCount
+	}
+	return configuration.MinCount
+}
+
+// windowStart method returns start of time window relative to given time.
+func (configuration DisabledRulesConfiguration) windowStart(now time.Time) time.Time {
+	window := configuration.Window
+	if window <= 0 {
+		window = defaultDisabledRulesWindow
+	}
+	return now.Add(-window)
+}
+
+// DisabledRuleKey identifies rule together with its error key
+type DisabledRuleKey struct {
+	Rule     string
+	ErrorKey string
+}
+
+// readRuleCounts method reads number of records for each rule and error key
+// from given table. Only records of exported organizations that fulfill
+// given condition are counted.
+func (storage DBStorage) readRuleCounts(ctx context.Context, tableName TableName, condition string) (map[DisabledRuleKey]int, error) {
+	counts := make(map[DisabledRuleKey]int)
+
+	// it is not possible to use parameter for table name
+	// #nosec G201
+	query := fmt.Sprintf(selectRuleCounts, tableName)
+	storage.applySelectiveExport(&query, tableName)
+	if condition != "" {
+		appendCondition(&query, condition)
+	}
+	query += groupByRuleAndErrKey
+
+	rows, err := storage.query(ctx, tableName, "read rule counts", query)
+	if err != nil {
+		return counts, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Error().Err(err).Msg(unableToCloseDBRowsHandle)
+		}
+	}()
+
+	for rows.Next() {
+		var key DisabledRuleKey
+		var count int
+
+		err := rows.Scan(&key.Rule, &key.ErrorKey, &count)
+		if err != nil {
+			return counts, err
+		}
+		counts[key] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// readClusterDisables method adds number of rules disabled for single
+// clusters into given disabled rules. Tables that don't exist in database
+// are skipped.
+func (storage DBStorage) readClusterDisables(ctx context.Context, disabledRulesInfo []DisabledRuleInfo) error {
+	tableNames, err := storage.ReadListOfTables(ctx)
+	if err != nil {
+		return err
+	}
+
+	toggles := make(map[DisabledRuleKey]int)
+	if slices.Contains(tableNames, clusterRuleToggleTable) {
+		toggles, err = storage.readRuleCounts(ctx, clusterRuleToggleTable, clusterRuleDisabled)
+		if err != nil {
+			return err
+		}
+	} else {
+		log.Warn().Str(tableNameMsg, string(clusterRuleToggleTable)).Msg(clusterDisablesNotFound)
+	}
+
+	feedbacks := make(map[DisabledRuleKey]int)
+	if slices.Contains(tableNames, clusterRuleDisableFeedbackTable) {
+		feedbacks, err = storage.readRuleCounts(ctx, clusterRuleDisableFeedbackTable, "")
+		if err != nil {
+			return err
+		}
+	} else {
+		log.Warn().Str(tableNameMsg, string(clusterRuleDisableFeedbackTable)).Msg(clusterDisablesNotFound)
+	}
+
+	for i := range disabledRulesInfo {
+		key := DisabledRuleKey{disabledRulesInfo[i].Rule, disabledRulesInfo[i].ErrorKey}
+		disabledRulesInfo[i].ClusterToggles = toggles[key]
+		disabledRulesInfo[i].Feedbacks = feedbacks[key]
+	}
+	return nil
+}
+
+// ReadPreviousDisabledRules function reads counts of disabled rules from
+// report stored by previous export. Reports without error key column count
+// all error keys of rule together, so they can't be compared and nothing is
+// read from them.
+func ReadPreviousDisabledRules(content []byte) (map[DisabledRuleKey]int, error) {
+	records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	counts := make(map[DisabledRuleKey]int)
+	if len(records) == 0 {
+		return counts, nil
+	}
+
+	columns := make(map[string]int)
+	for i, column := range records[0] {
+		columns[column] = i
+	}
+
+	ruleIndex, foundRule := columns[disabledRuleColumn]
+	countIndex, foundCount := columns[disabledCountColumn]
+	errorKeyIndex, foundErrorKey := columns[disabledErrorKeyColumn]
+	if !foundRule || !foundCount || !foundErrorKey {
+		return counts, nil
+	}
+
+	for _, record := range records[1:] {
+		count, err := strconv.Atoi(record[countIndex])
+		if err != nil {
+			return nil, err
+		}
+
+		counts[DisabledRuleKey{record[ruleIndex], record[errorKeyIndex]}] = count
+	}
+	return counts, nil
+}
+
+// applyDisabledRulesTrend function sets counts from previous report to
+// given disabled rules. Rules are matched by rule name and error key.
+func applyDisabledRulesTrend(disabledRulesInfo []DisabledRuleInfo, previous map[DisabledRuleKey]int) {
+	for i := range disabledRulesInfo {
+		info := &disabledRulesInfo[i]
+
+		count, found := previous[DisabledRuleKey{info.Rule, info.ErrorKey}]
+		if found {
+			info.PreviousCount = &count
+		}
+	}
+}
+
+// readDisabledRulesReport method reads report about disabled rules and
+// computes trend against report stored by previous export. Trend is not
+// computed when previous report can't be read.
+func (storage DBStorage) readDisabledRulesReport(ctx context.Context, configuration *ConfigStruct,
+	load contentLoader) ([]DisabledRuleInfo, error) {
+	reportConfiguration := GetDisabledRulesConfiguration(configuration)
+
+	disabledRulesInfo, err := storage.ReadDisabledRules(ctx, reportConfiguration.minCount(),
+		reportConfiguration.windowStart(time.Now()))
+	if err != nil {
+		return disabledRulesInfo, err
+	}
+
+	content, found, err := load(disabledRules)
+	if err == nil && found {
+		var previous map[DisabledRuleKey]int
+		previous, err = ReadPreviousDisabledRules(content)
+		if err == nil {
+			applyDisabledRulesTrend(disabledRulesInfo, previous)
+		}
+	}
+	if err != nil {
+		log.Warn().Err(err).Msg(readPreviousDisabledRules)
+	}
+
+	return disabledRulesInfo, nil
+}
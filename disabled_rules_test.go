@@ -0,0 +1,217 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/disabled_rules_test.html
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// prepareDisabledRulesDatabase helper function creates SQLite database with
+// tables containing disabled rules
+func prepareDisabledRulesDatabase(t *testing.T, directory string) main.ConfigStruct {
+	recent := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	statements := []string{
+		`CREATE TABLE rule_disable (org_id INTEGER, user_id VARCHAR, rule_id VARCHAR,
+			error_key VARCHAR, justification VARCHAR, created_at TIMESTAMP, updated_at TIMESTAMP)`,
+		`CREATE TABLE cluster_rule_toggle (cluster_id VARCHAR, rule_id VARCHAR, user_id VARCHAR,
+			disabled SMALLINT, disabled_at TIMESTAMP, enabled_at TIMESTAMP, updated_at TIMESTAMP,
+			error_key VARCHAR)`,
+		`CREATE TABLE cluster_user_rule_disable_feedback (cluster_id VARCHAR, user_id VARCHAR,
+			rule_id VARCHAR, message VARCHAR, added_at TIMESTAMP, updated_at TIMESTAMP,
+			error_key VARCHAR)`,
+		`INSERT INTO rule_disable VALUES
+			(1, '1', 'rule.a', 'KEY_A', 'not needed', '2021-09-20T00:00:00Z', NULL),
+			(1, '2', 'rule.a', 'KEY_A', '', '` + recent + `', NULL),
+			(2, '3', 'rule.a', 'KEY_A', NULL, '2021-09-27T00:00:00Z', NULL),
+			(2, '3', 'rule.a', 'OTHER_KEY', 'x', '2021-09-27T00:00:00Z', NULL),
+			(3, '4', 'rule.b', 'KEY_B', 'x', '2021-09-27T00:00:00Z', NULL),
+			(3, '5', 'rule.b', 'KEY_B', 'y', '2021-09-28T00:00:00Z', NULL)`,
+		`INSERT INTO cluster_rule_toggle VALUES
+			('c1', 'rule.a', '1', 1, '2021-09-20T00:00:00Z', NULL, NULL, 'KEY_A'),
+			('c2', 'rule.a', '1', 0, '2021-09-20T00:00:00Z', NULL, NULL, 'KEY_A'),
+			('c3', 'rule.b', '1', 1, '2021-09-20T00:00:00Z', NULL, NULL, 'KEY_B')`,
+		`INSERT INTO cluster_user_rule_disable_feedback VALUES
+			('c1', '1', 'rule.a', 'msg', '2021-09-20T00:00:00Z', NULL, 'KEY_A')`,
+	}
+	return prepareSQLiteDatabase(t, directory, statements...)
+}
+
+// readDisabledRulesReport helper function reads records from report about
+// disabled rules
+func readDisabledRulesReport(t *testing.T, fileName string) [][]string {
+	content, err := os.ReadFile(fileName)
+	assert.NoError(t, err)
+
+	records, err := csv.NewReader(bytes.NewReader(content)).ReadAll()
+	assert.NoError(t, err)
+	return records
+}
+
+// TestReadPreviousDisabledRules checks reading of report stored by previous
+// export
+func TestReadPreviousDisabledRules(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, main.DisabledRulesToCSV(buffer, []main.DisabledRuleInfo{
+		{Rule: "rule.a", ErrorKey: "KEY_A", Count: 3},
+		{Rule: "rule.b", ErrorKey: "KEY_B", Count: 2},
+	}))
+
+	counts, err := main.ReadPreviousDisabledRules(buffer.Bytes())
+	assert.NoError(t, err)
+	assert.Equal(t, map[main.DisabledRuleKey]int{
+		{Rule: "rule.a", ErrorKey: "KEY_A"}: 3,
+		{Rule: "rule.b", ErrorKey: "KEY_B"}: 2,
+	}, counts)
+
+	// report in format used before error keys were exported can't be
+	// compared
+	counts, err = main.ReadPreviousDisabledRules([]byte("Rule,Count\nrule.a,5\n"))
+	assert.NoError(t, err)
+	assert.Empty(t, counts)
+
+	// unknown format
+	counts, err = main.ReadPreviousDisabledRules([]byte("a,b\n1,2\n"))
+	assert.NoError(t, err)
+	assert.Empty(t, counts)
+
+	_, err = main.ReadPreviousDisabledRules([]byte("Rule,Count,Error key\nrule.a,many,KEY_A\n"))
+	assert.Error(t, err)
+}
+
+// TestDisabledRulesToCSVWithTrend checks that share of empty justifications
+// and trend are exported
+func TestDisabledRulesToCSVWithTrend(t *testing.T) {
+	previous := 5
+
+	buffer := new(bytes.Buffer)
+	err := main.DisabledRulesToCSV(buffer, []main.DisabledRuleInfo{
+		{
+			Rule: "rule.a", ErrorKey: "KEY_A", Count: 4, Orgs: 2,
+			FirstDisabledAt: "2021-09-20T00:00:00Z", LastDisabledAt: "2021-09-27T00:00:00Z",
+			CountInWindow: 1, EmptyJustifications: 1, ClusterToggles: 3, Feedbacks: 2,
+			PreviousCount: &previous,
+		},
+	})
+	assert.NoError(t, err)
+
+	lines := strings.Split(buffer.String(), "\n")
+	assert.Equal(t, "rule.a,4,KEY_A,2,2021-09-20T00:00:00Z,2021-09-27T00:00:00Z,1,0.25,3,2,5,-1", lines[1])
+}
+
+// TestPerformDataExportDisabledRules checks export of disabled rules report
+// including trend against previous export
+func TestPerformDataExportDisabledRules(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareDisabledRulesDatabase(t, directory)
+	configuration.DisabledRules.Window = 24 * time.Hour
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:              "file",
+		Limit:               NoLimits,
+		ExportDisabledRules: true,
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	records := readDisabledRulesReport(t, filepath.Join(directory, "_disabled_rules.csv"))
+	assert.Len(t, records, 3)
+	assert.Equal(t, []string{"rule.a", "3", "KEY_A", "2"}, records[1][:4])
+	assert.Equal(t, "2021-09-20T00:00:00Z", records[1][4])
+	assert.Equal(t, []string{"1", "0.67", "1", "1", "", ""}, records[1][6:])
+	assert.Equal(t, []string{"rule.b", "2", "KEY_B", "1"}, records[2][:4])
+	assert.Equal(t, []string{"0", "0.00", "1", "0", "", ""}, records[2][6:])
+
+	alterDatabase(t, &configuration,
+		"INSERT INTO rule_disable VALUES (4, '6', 'rule.a', 'OTHER_KEY', 'x', '2021-09-29T00:00:00Z', NULL)",
+		"DELETE FROM rule_disable WHERE user_id = '5'")
+
+	// threshold is configurable, report of previous export is overwritten
+	configuration.DisabledRules.MinCount = 1
+	cliFlags.Force = true
+	code, err = main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	records = readDisabledRulesReport(t, filepath.Join(directory, "_disabled_rules.csv"))
+	assert.Len(t, records, 4)
+	assert.Equal(t, []string{"rule.a", "3", "KEY_A"}, records[1][:3])
+	assert.Equal(t, []string{"3", "+0"}, records[1][10:])
+	assert.Equal(t, []string{"rule.a", "2", "OTHER_KEY"}, records[2][:3])
+	assert.Equal(t, []string{"", ""}, records[2][10:])
+	assert.Equal(t, []string{"rule.b", "1", "KEY_B"}, records[3][:3])
+	assert.Equal(t, []string{"2", "-1"}, records[3][10:])
+}
+
+// TestReadDisabledRulesClusterDisablesFiltered checks that disabled rules and
+// rules disabled for single clusters are counted for exported organizations
+// only and that missing table is skipped
+func TestReadDisabledRulesClusterDisablesFiltered(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t,
+		`CREATE TABLE rule_disable (org_id INTEGER, user_id VARCHAR, rule_id VARCHAR,
+			error_key VARCHAR, justification VARCHAR, created_at TIMESTAMP, updated_at TIMESTAMP)`,
+		`CREATE TABLE cluster_user_rule_disable_feedback (org_id INTEGER, cluster_id VARCHAR,
+			user_id VARCHAR, rule_id VARCHAR, message VARCHAR, added_at TIMESTAMP,
+			updated_at TIMESTAMP, error_key VARCHAR)`,
+		`INSERT INTO rule_disable VALUES
+			(1, '1', 'rule.a', 'KEY_A', 'x', '2021-09-20T00:00:00Z', NULL),
+			(1, '2', 'rule.a', 'KEY_A', 'y', '2021-09-20T00:00:00Z', NULL),
+			(2, '3', 'rule.a', 'KEY_A', 'z', '2021-09-20T00:00:00Z', NULL),
+			(2, '4', 'rule.b', 'KEY_B', 'z', '2021-09-20T00:00:00Z', NULL),
+			(2, '5', 'rule.b', 'KEY_B', 'z', '2021-09-20T00:00:00Z', NULL)`,
+		`INSERT INTO cluster_user_rule_disable_feedback VALUES
+			(1, 'c1', '1', 'rule.a', 'msg', '2021-09-20T00:00:00Z', NULL, 'KEY_A'),
+			(2, 'c2', '3', 'rule.a', 'msg', '2021-09-20T00:00:00Z', NULL, 'KEY_A'),
+			(2, 'c3', '3', 'rule.a', 'msg', '2021-09-20T00:00:00Z', NULL, 'KEY_A')`)
+
+	config := testConfig
+	config.EnableOrgIDFiltering = true
+	config.OrganizationsToExport = []string{"1"}
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	disabledRules, err := storage.ReadDisabledRules(context.Background(), 2, time.Now())
+	assert.NoError(t, err)
+	assert.Len(t, disabledRules, 1)
+	assert.Equal(t, 2, disabledRules[0].Count)
+	assert.Equal(t, 1, disabledRules[0].Orgs)
+
+	// cluster_rule_toggle table does not exist
+	assert.Equal(t, 0, disabledRules[0].ClusterToggles)
+	assert.Equal(t, 1, disabledRules[0].Feedbacks)
+
+	checkConnectionClose(t, connection)
+}
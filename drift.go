@@ -0,0 +1,424 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains detection of schema drift between consecutive
+// exports. Columns of all exported tables are stored into _columns.json with
+// each run. Before any data is exported, columns read from database are
+// compared with columns stored by previous run and added, removed,
+// reordered and retyped columns together with new and dropped tables are
+// reported into _schema_drift.json. Configured policy decides whether drift
+// is ignored, only reported or whether the run fails.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/drift.html
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Messages
+const (
+	schemaDriftDetected      = "Schema drift detected"
+	schemaDriftFailed        = "schema drift detected: %s"
+	schemaDriftAccepted      = "Schema drift accepted, columns are updated"
+	noPreviousColumns        = "No columns stored by previous run, schema drift is not checked"
+	unknownDriftPolicy       = "unknown schema drift policy: %s"
+	readPreviousColumns      = "Unable to read columns stored by previous run"
+	storeColumnsFailed       = "Store columns of tables failed"
+	unreadableColumnsSkipped = "Unable to read columns of table, schema drift is not checked for it"
+	checkingSchemaDrift      = "Checking schema drift"
+	writeColumnsToJSON       = "Write columns of tables to JSON"
+	writeSchemaDriftToJSON   = "Write schema drift to JSON"
+)
+
+// Schema drift policies
+const (
+	driftPolicyIgnore = "ignore"
+	driftPolicyWarn   = "warn"
+	driftPolicyFail   = "fail"
+)
+
+// SchemaDriftConfiguration represents configuration of schema drift
+// detection
+type SchemaDriftConfiguration struct {
+	// Policy is one of "ignore" (default), "warn" and "fail". Columns are
+	// not stored and drift is not checked with "ignore" policy. Drift is
+	// reported with "warn" policy. The run fails before any data is
+	// exported with "fail" policy.
+	Policy string `mapstructure:"policy" toml:"policy"`
+}
+
+// Enabled method returns true when schema drift needs to be checked.
+func (configuration SchemaDriftConfiguration) Enabled() bool {
+	return configuration.Policy != "" && configuration.Policy != driftPolicyIgnore
+}
+
+// ColumnSnapshot represents column of table stored with export
+type ColumnSnapshot struct {
+	Name string `json:"name"`
+	Type string `json:"type"`
+}
+
+// ColumnsSnapshot represents columns of all exported tables
+type ColumnsSnapshot struct {
+	Tables map[TableName][]ColumnSnapshot `json:"tables"`
+}
+
+// ColumnTypeChange represents column with changed type
+type ColumnTypeChange struct {
+	Column  string `json:"column"`
+	OldType string `json:"old_type"`
+	NewType string `json:"new_type"`
+}
+
+// TableDrift represents changes of columns of one table
+type TableDrift struct {
+	Table            TableName          `json:"table"`
+	AddedColumns     []string           `json:"added_columns,omitempty"`
+	RemovedColumns   []string           `json:"removed_columns,omitempty"`
+	ReorderedColumns []string           `json:"reordered_columns,omitempty"`
+	RetypedColumns   []ColumnTypeChange `json:"retyped_columns,omitempty"`
+}
+
+// SchemaDrift represents all changes of schema between two exports
+type SchemaDrift struct {
+	AddedTables   []TableName  `json:"added_tables,omitempty"`
+	DroppedTables []TableName  `json:"dropped_tables,omitempty"`
+	Tables        []TableDrift `json:"tables,omitempty"`
+}
+
+// Empty method returns true when schema has not changed.
+func (drift *SchemaDrift) Empty() bool {
+	return len(drift.AddedTables) == 0 && len(drift.DroppedTables) == 0 &&
+		len(drift.Tables) == 0
+}
+
+// String method returns short description of schema drift.
+func (drift *SchemaDrift) String() string {
+	var changes []string
+	if len(drift.AddedTables) > 0 {
+		changes = append(changes, fmt.Sprintf("%d new tables", len(drift.AddedTables)))
+	}
+	if len(drift.DroppedTables) > 0 {
+		changes = append(changes, fmt.Sprintf("%d dropped tables", len(drift.DroppedTables)))
+	}
+	if len(drift.Tables) > 0 {
+		changes = append(changes, fmt.Sprintf("%d changed tables", len(drift.Tables)))
+	}
+	return strings.Join(changes, ", ")
+}
+
+// ReadColumnsSnapshot method reads columns of all given tables that are not
+// ignored. Tables whose columns can't be read are returned separately.
+func (storage DBStorage) ReadColumnsSnapshot(ctx context.Context, tableNames []TableName,
+	ignoredTables IgnoredTables) (*ColumnsSnapshot, []TableName) {
+	snapshot := &ColumnsSnapshot{
+		Tables: make(map[TableName][]ColumnSnapshot),
+	}
+	var unreadable []TableName
+
+	for _, tableName := range tableNames {
+		if _, found := ignoredTables[string(tableName)]; found {
+			continue
+		}
+
+		columnTypes, err := storage.RetrieveColumnTypes(ctx, tableName)
+		if err != nil {
+			log.Warn().Err(err).Str(tableNameMsg, string(tableName)).Msg(unreadableColumnsSkipped)
+			unreadable = append(unreadable, tableName)
+			continue
+		}
+
+		columns := make([]ColumnSnapshot, 0, len(columnTypes))
+		for _, columnType := range columnTypes {
+			columns = append(columns, ColumnSnapshot{
+				Name: columnType.Name(),
+				Type: columnType.DatabaseTypeName(),
+			})
+		}
+		snapshot.Tables[tableName] = columns
+	}
+
+	return snapshot, unreadable
+}
+
+// CompareColumns function compares columns stored by previous run with
+// actual columns.
+func CompareColumns(previous, current *ColumnsSnapshot) *SchemaDrift {
+	drift := &SchemaDrift{}
+
+	for _, tableName := range sortedTableNames(current.Tables) {
+		previousColumns, found := previous.Tables[tableName]
+		if !found {
+			drift.AddedTables = append(drift.AddedTables, tableName)
+			continue
+		}
+
+		tableDrift := compareTableColumns(tableName, previousColumns, current.Tables[tableName])
+		if tableDrift != nil {
+			drift.Tables = append(drift.Tables, *tableDrift)
+		}
+	}
+
+	for _, tableName := range sortedTableNames(previous.Tables) {
+		if _, found := current.Tables[tableName]; !found {
+			drift.DroppedTables = append(drift.DroppedTables, tableName)
+		}
+	}
+
+	return drift
+}
+
+// compareTableColumns function compares columns of one table. Nil is
+// returned when columns have not changed.
+func compareTableColumns(tableName TableName, previous, current []ColumnSnapshot) *TableDrift {
+	drift := TableDrift{Table: tableName}
+
+	previousTypes := make(map[string]string, len(previous))
+	for _, column := range previous {
+		previousTypes[column.Name] = column.Type
+	}
+	currentTypes := make(map[string]string, len(current))
+	for _, column := range current {
+		currentTypes[column.Name] = column.Type
+	}
+
+	// order of columns present in both runs
+	var previousOrder, currentOrder []string
+
+	for _, column := range current {
+		previousType, found := previousTypes[column.Name]
+		if !found {
+			drift.AddedColumns = append(drift.AddedColumns, column.Name)
+			continue
+		}
+		currentOrder = append(currentOrder, column.Name)
+		if previousType != column.Type {
+			drift.RetypedColumns = append(drift.RetypedColumns, ColumnTypeChange{
+				Column:  column.Name,
+				OldType: previousType,
+				NewType: column.Type,
+			})
+		}
+	}
+
+	for _, column := range previous {
+		if _, found := currentTypes[column.Name]; !found {
+			drift.RemovedColumns = append(drift.RemovedColumns, column.Name)
+			continue
+		}
+		previousOrder = append(previousOrder, column.Name)
+	}
+
+	for i := range currentOrder {
+		if currentOrder[i] != previousOrder[i] {
+			drift.ReorderedColumns = append(drift.ReorderedColumns, currentOrder[i])
+		}
+	}
+
+	if len(drift.AddedColumns) == 0 && len(drift.RemovedColumns) == 0 &&
+		len(drift.ReorderedColumns) == 0 && len(drift.RetypedColumns) == 0 {
+		return nil
+	}
+	return &drift
+}
+
+// sortedTableNames function returns names of tables in alphabetical order.
+func sortedTableNames(tables map[TableName][]ColumnSnapshot) []TableName {
+	tableNames := make([]TableName, 0, len(tables))
+	for tableName := range tables {
+		tableNames = append(tableNames, tableName)
+	}
+	sort.Slice(tableNames, func(i, j int) bool {
+		return tableNames[i] < tableNames[j]
+	})
+	return tableNames
+}
+
+// logSchemaDrift function logs all changes of schema.
+func logSchemaDrift(drift *SchemaDrift, operationLogger *zerolog.Logger) {
+	for _, logger := range []*zerolog.Logger{&log.Logger, operationLogger} {
+		for _, tableName := range drift.AddedTables {
+			logger.Warn().Str(tableNameMsg, string(tableName)).Msg("New table")
+		}
+		for _, tableName := range drift.DroppedTables {
+			logger.Warn().Str(tableNameMsg, string(tableName)).Msg("Dropped table")
+		}
+		for _, table := range drift.Tables {
+			logger.Warn().
+				Str(tableNameMsg, string(table.Table)).
+				Strs("added", table.AddedColumns).
+				Strs("removed", table.RemovedColumns).
+				Strs("reordered", table.ReorderedColumns).
+				Int("retyped", len(table.RetypedColumns)).
+				Msg("Columns of table changed")
+			for _, change := range table.RetypedColumns {
+				logger.Warn().
+					Str(tableNameMsg, string(table.Table)).
+					Str("column", change.Column).
+					Str("old type", change.OldType).
+					Str("new type", change.NewType).
+					Msg("Type of column changed")
+			}
+		}
+	}
+}
+
+// ColumnsSnapshotToJSON function writes columns of tables into given
+// writer.
+func ColumnsSnapshotToJSON(writer io.Writer, snapshot *ColumnsSnapshot) error {
+	if writer == nil {
+		err := errors.New(bufferIsNil)
+		log.Error().Err(err).Msg(writeColumnsToJSON)
+		return err
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(snapshot)
+}
+
+// SchemaDriftToJSON function writes report about schema drift into given
+// writer.
+func SchemaDriftToJSON(writer io.Writer, drift *SchemaDrift) error {
+	if writer == nil {
+		err := errors.New(bufferIsNil)
+		log.Error().Err(err).Msg(writeSchemaDriftToJSON)
+		return err
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(drift)
+}
+
+// contentLoader is function that reads content stored under given name.
+// False is returned when nothing has been stored.
+type contentLoader func(name string) ([]byte, bool, error)
+
+// contentStorer is function that stores content written by given function
+// under given name.
+type contentStorer func(name string, write func(writer io.Writer) error) error
+
+// checkSchemaDrift function compares columns of tables with columns stored
+// by previous run according to configured policy. Actual columns are stored
+// for the next run unless the run fails on drift. Drift that has been
+// accepted explicitly does not fail the run.
+func checkSchemaDrift(ctx context.Context, configuration *ConfigStruct, storage *DBStorage,
+	tableNames []TableName, ignoredTables IgnoredTables, accept bool,
+	load contentLoader, store contentStorer,
+	operationLogger *zerolog.Logger) (int, error) {
+	driftConfiguration := GetSchemaDriftConfiguration(configuration)
+	if !driftConfiguration.Enabled() {
+		return ExitStatusOK, nil
+	}
+
+	policy := driftConfiguration.Policy
+	if policy != driftPolicyWarn && policy != driftPolicyFail {
+		err := fmt.Errorf(unknownDriftPolicy, policy)
+		log.Err(err).Msg(operationFailedMessage)
+		operationLogger.Err(err).Msg(operationFailedMessage)
+		return ExitStatusConfigurationError, err
+	}
+
+	operationLogger.Info().Str("policy", policy).Msg(checkingSchemaDrift)
+
+	current, unreadable := storage.ReadColumnsSnapshot(ctx, tableNames, ignoredTables)
+
+	content, found, err := load(columnsInfo)
+	if err != nil {
+		log.Err(err).Msg(readPreviousColumns)
+		operationLogger.Err(err).Msg(readPreviousColumns)
+		return ExitStatusIOError, err
+	}
+
+	if !found {
+		log.Info().Msg(noPreviousColumns)
+		operationLogger.Info().Msg(noPreviousColumns)
+	} else {
+		previous := &ColumnsSnapshot{}
+		err = json.Unmarshal(content, previous)
+		if err != nil {
+			log.Err(err).Msg(readPreviousColumns)
+			operationLogger.Err(err).Msg(readPreviousColumns)
+			return ExitStatusIOError, err
+		}
+
+		// columns of tables that can't be read now are kept, so they are
+		// not reported as dropped
+		for _, tableName := range unreadable {
+			if columns, found := previous.Tables[tableName]; found {
+				current.Tables[tableName] = columns
+			}
+		}
+
+		drift := CompareColumns(previous, current)
+		if !drift.Empty() {
+			logSchemaDrift(drift, operationLogger)
+
+			err = store(driftInfo, func(writer io.Writer) error {
+				return SchemaDriftToJSON(writer, drift)
+			})
+			if err != nil {
+				log.Err(err).Msg(storeColumnsFailed)
+				operationLogger.Err(err).Msg(storeColumnsFailed)
+				return ExitStatusIOError, err
+			}
+
+			if accept {
+				log.Warn().Str("drift", drift.String()).Msg(schemaDriftAccepted)
+				operationLogger.Warn().Str("drift", drift.String()).Msg(schemaDriftAccepted)
+				policy = driftPolicyWarn
+			}
+
+			// columns are not stored, so the next run is compared with
+			// the last accepted schema too
+			if policy == driftPolicyFail {
+				err = fmt.Errorf(schemaDriftFailed, drift)
+				log.Err(err).Msg(schemaDriftDetected)
+				operationLogger.Err(err).Msg(schemaDriftDetected)
+				return ExitStatusSchemaDrift, err
+			}
+			log.Warn().Str("drift", drift.String()).Msg(schemaDriftDetected)
+			operationLogger.Warn().Str("drift", drift.String()).Msg(schemaDriftDetected)
+		}
+	}
+
+	err = store(columnsInfo, func(writer io.Writer) error {
+		return ColumnsSnapshotToJSON(writer, current)
+	})
+	if err != nil {
+		log.Err(err).Msg(storeColumnsFailed)
+		operationLogger.Err(err).Msg(storeColumnsFailed)
+		return ExitStatusIOError, err
+	}
+
+	return ExitStatusOK, nil
+}
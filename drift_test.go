@@ -0,0 +1,390 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/drift_test.html
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// alterDatabase helper function performs given statements in database used
+// by test configuration
+func alterDatabase(t *testing.T, configuration *main.ConfigStruct, statements ...string) {
+	connection, err := sql.Open("sqlite3", configuration.Storage.SQLiteDataSource)
+	assert.NoError(t, err)
+
+	for _, statement := range statements {
+		_, err := connection.Exec(statement)
+		assert.NoError(t, err)
+	}
+	checkConnectionClose(t, connection)
+}
+
+// readSchemaDrift helper function reads schema drift report from file
+func readSchemaDrift(t *testing.T, fileName string) main.SchemaDrift {
+	content, err := os.ReadFile(fileName)
+	assert.NoError(t, err)
+
+	var drift main.SchemaDrift
+	assert.NoError(t, json.Unmarshal(content, &drift))
+	return drift
+}
+
+// TestCompareColumns checks detection of all kinds of schema changes
+func TestCompareColumns(t *testing.T) {
+	previous := &main.ColumnsSnapshot{
+		Tables: map[main.TableName][]main.ColumnSnapshot{
+			"report": {
+				{Name: "org_id", Type: "INT4"},
+				{Name: "cluster", Type: "VARCHAR"},
+				{Name: "report", Type: "TEXT"},
+				{Name: "count", Type: "INT4"},
+				{Name: "removed", Type: "TEXT"},
+			},
+			"same":    {{Name: "id", Type: "INT4"}},
+			"dropped": {{Name: "id", Type: "INT4"}},
+		},
+	}
+	current := &main.ColumnsSnapshot{
+		Tables: map[main.TableName][]main.ColumnSnapshot{
+			"report": {
+				{Name: "added", Type: "TEXT"},
+				{Name: "cluster", Type: "VARCHAR"},
+				{Name: "org_id", Type: "INT4"},
+				{Name: "report", Type: "TEXT"},
+				{Name: "count", Type: "INT8"},
+			},
+			"same": {{Name: "id", Type: "INT4"}},
+			"new":  {{Name: "id", Type: "INT4"}},
+		},
+	}
+
+	drift := main.CompareColumns(previous, current)
+	assert.False(t, drift.Empty())
+	assert.Equal(t, []main.TableName{"new"}, drift.AddedTables)
+	assert.Equal(t, []main.TableName{"dropped"}, drift.DroppedTables)
+	assert.Equal(t, []main.TableDrift{
+		{
+			Table:            "report",
+			AddedColumns:     []string{"added"},
+			RemovedColumns:   []string{"removed"},
+			ReorderedColumns: []string{"cluster", "org_id"},
+			RetypedColumns: []main.ColumnTypeChange{
+				{Column: "count", OldType: "INT4", NewType: "INT8"},
+			},
+		},
+	}, drift.Tables)
+	assert.Equal(t, "1 new tables, 1 dropped tables, 1 changed tables", drift.String())
+}
+
+// TestCompareColumnsNoDrift checks that columns added to the end or removed
+// from the middle of table are not reported as reordered
+func TestCompareColumnsNoDrift(t *testing.T) {
+	previous := &main.ColumnsSnapshot{
+		Tables: map[main.TableName][]main.ColumnSnapshot{
+			"t": {{Name: "a", Type: "INT4"}, {Name: "b", Type: "INT4"}},
+		},
+	}
+
+	drift := main.CompareColumns(previous, previous)
+	assert.True(t, drift.Empty())
+
+	current := &main.ColumnsSnapshot{
+		Tables: map[main.TableName][]main.ColumnSnapshot{
+			"t": {{Name: "b", Type: "INT4"}, {Name: "c", Type: "INT4"}},
+		},
+	}
+	drift = main.CompareColumns(previous, current)
+	assert.Equal(t, []main.TableDrift{
+		{Table: "t", AddedColumns: []string{"c"}, RemovedColumns: []string{"a"}},
+	}, drift.Tables)
+}
+
+// TestReadColumnsSnapshot checks reading of columns of tables
+func TestReadColumnsSnapshot(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+
+	storage, err := main.NewStorage(context.Background(), &configuration.Storage, main.RetryPolicy{})
+	assert.NoError(t, err)
+
+	snapshot, unreadable := storage.ReadColumnsSnapshot(context.Background(),
+		[]main.TableName{"good", "bad", "ignored"},
+		main.IgnoredTables{"ignored": struct{}{}})
+
+	assert.Equal(t, map[main.TableName][]main.ColumnSnapshot{
+		"good": {{Name: "id", Type: "INTEGER"}, {Name: "value", Type: "TEXT"}},
+	}, snapshot.Tables)
+	assert.Equal(t, []main.TableName{"bad"}, unreadable)
+
+	assert.NoError(t, storage.Close())
+}
+
+// TestSchemaDriftToJSON checks conversion of schema drift report into JSON
+func TestSchemaDriftToJSON(t *testing.T) {
+	buffer := new(bytes.Buffer)
+	err := main.SchemaDriftToJSON(buffer, &main.SchemaDrift{
+		AddedTables: []main.TableName{"t"},
+	})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"added_tables": ["t"]}`, buffer.String())
+
+	assert.Error(t, main.SchemaDriftToJSON(nil, &main.SchemaDrift{}))
+	assert.Error(t, main.ColumnsSnapshotToJSON(nil, &main.ColumnsSnapshot{}))
+}
+
+// TestPerformDataExportSchemaDriftWarn checks that drift is reported and
+// export continues with "warn" policy
+func TestPerformDataExportSchemaDriftWarn(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	configuration.SchemaDrift.Policy = "warn"
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:        "file",
+		Limit:         NoLimits,
+		IgnoredTables: "bad",
+	}
+
+	// first run just stores columns
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.FileExists(t, filepath.Join(directory, "_columns.json"))
+	assert.NoFileExists(t, filepath.Join(directory, "_schema_drift.json"))
+
+	alterDatabase(t, &configuration,
+		"ALTER TABLE good ADD COLUMN created TIMESTAMP",
+		"CREATE TABLE other (id INTEGER)")
+
+	// files of previous export are overwritten
+	cliFlags.Force = true
+	code, err = main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	drift := readSchemaDrift(t, filepath.Join(directory, "_schema_drift.json"))
+	assert.Equal(t, []main.TableName{"other"}, drift.AddedTables)
+	assert.Equal(t, []main.TableDrift{
+		{Table: "good", AddedColumns: []string{"created"}},
+	}, drift.Tables)
+	assert.FileExists(t, filepath.Join(directory, "other.csv"))
+}
+
+// TestPerformDataExportSchemaDriftPerRunDirectory checks that columns stored
+// by previous run are found when each run writes into its own directory
+func TestPerformDataExportSchemaDriftPerRunDirectory(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	configuration.SchemaDrift.Policy = "warn"
+	configuration.File.PerRunDirectory = true
+	exports := filepath.Join(directory, "exports")
+
+	cliFlags := main.CliFlags{
+		Output:        "file",
+		Limit:         NoLimits,
+		IgnoredTables: "bad",
+		OutputDir:     filepath.Join(exports, "20260101T020000Z-00000001"),
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	// run without columns (for example failed one) is skipped
+	assert.NoError(t, os.MkdirAll(filepath.Join(exports, "20260101T030000Z-00000002"), 0o750))
+
+	alterDatabase(t, &configuration, "ALTER TABLE good ADD COLUMN created TIMESTAMP")
+
+	cliFlags.OutputDir = filepath.Join(exports, "20260102T020000Z-00000003")
+	code, err = main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	drift := readSchemaDrift(t, filepath.Join(cliFlags.OutputDir, "_schema_drift.json"))
+	assert.Equal(t, []main.TableDrift{
+		{Table: "good", AddedColumns: []string{"created"}},
+	}, drift.Tables)
+	assert.FileExists(t, filepath.Join(cliFlags.OutputDir, "_columns.json"))
+}
+
+// TestPerformDataExportSchemaDriftFail checks that the run fails before any
+// data is exported with "fail" policy
+func TestPerformDataExportSchemaDriftFail(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	configuration.SchemaDrift.Policy = "fail"
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:        "file",
+		Limit:         NoLimits,
+		IgnoredTables: "bad",
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	columns, err := os.ReadFile(filepath.Join(directory, "_columns.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, os.Remove(filepath.Join(directory, "good.csv")))
+
+	alterDatabase(t, &configuration,
+		"DROP TABLE good",
+		"CREATE TABLE good (id INTEGER PRIMARY KEY, value TEXT, created TIMESTAMP)")
+
+	code, err = main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.Error(t, err)
+	assert.Equal(t, main.ExitStatusSchemaDrift, code)
+
+	drift := readSchemaDrift(t, filepath.Join(directory, "_schema_drift.json"))
+	assert.Equal(t, []main.TableDrift{
+		{Table: "good", AddedColumns: []string{"created"}},
+	}, drift.Tables)
+
+	// nothing is exported and stored columns are kept
+	assert.NoFileExists(t, filepath.Join(directory, "good.csv"))
+	stored, err := os.ReadFile(filepath.Join(directory, "_columns.json"))
+	assert.NoError(t, err)
+	assert.Equal(t, columns, stored)
+}
+
+// TestPerformDataExportSchemaDriftAccept checks that drift can be accepted
+// explicitly with "fail" policy
+func TestPerformDataExportSchemaDriftAccept(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	configuration.SchemaDrift.Policy = "fail"
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:        "file",
+		Limit:         NoLimits,
+		IgnoredTables: "bad",
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	columns, err := os.ReadFile(filepath.Join(directory, "_columns.json"))
+	assert.NoError(t, err)
+
+	alterDatabase(t, &configuration,
+		"DROP TABLE good",
+		"CREATE TABLE good (id INTEGER PRIMARY KEY, value TEXT, created TIMESTAMP)")
+
+	// drift is accepted, so data are exported and columns are updated
+	cliFlags.AcceptSchemaDrift = true
+	cliFlags.Force = true
+	code, err = main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	drift := readSchemaDrift(t, filepath.Join(directory, "_schema_drift.json"))
+	assert.Equal(t, []main.TableDrift{
+		{Table: "good", AddedColumns: []string{"created"}},
+	}, drift.Tables)
+
+	assert.FileExists(t, filepath.Join(directory, "good.csv"))
+	stored, err := os.ReadFile(filepath.Join(directory, "_columns.json"))
+	assert.NoError(t, err)
+	assert.NotEqual(t, columns, stored)
+
+	// the following run is compared with accepted schema
+	cliFlags.AcceptSchemaDrift = false
+	code, err = main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+}
+
+// TestPerformDataExportSchemaDriftUnknownPolicy checks that unknown policy
+// is refused
+func TestPerformDataExportSchemaDriftUnknownPolicy(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	configuration.SchemaDrift.Policy = "panic"
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:        "file",
+		Limit:         NoLimits,
+		IgnoredTables: "bad",
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.EqualError(t, err, "unknown schema drift policy: panic")
+	assert.Equal(t, main.ExitStatusConfigurationError, code)
+	assert.NoFileExists(t, filepath.Join(directory, "good.csv"))
+}
+
+// TestPerformDataExportSchemaDriftS3 checks that columns are stored into
+// and read from S3
+func TestPerformDataExportSchemaDriftS3(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	configuration.SchemaDrift.Policy = "fail"
+	requests := mockS3(t, &configuration, "bucket")
+
+	cliFlags := main.CliFlags{
+		Output:        "S3",
+		Limit:         NoLimits,
+		IgnoredTables: "bad",
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.Contains(t, requests(), "GET /bucket/prefix/_columns.json")
+	assert.Contains(t, requests(), "PUT /bucket/prefix/_columns.json")
+
+	// unchanged schema
+	code, err = main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.NotContains(t, requests(), "PUT /bucket/prefix/_schema_drift.json")
+
+	alterDatabase(t, &configuration, "ALTER TABLE good ADD COLUMN created TIMESTAMP")
+
+	before := len(requests())
+	code, err = main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.Error(t, err)
+	assert.Equal(t, main.ExitStatusSchemaDrift, code)
+
+	uploaded := requests()[before:]
+	assert.Contains(t, uploaded, "PUT /bucket/prefix/_schema_drift.json")
+	assert.NotContains(t, uploaded, "PUT /bucket/prefix/good.csv")
+	assert.NotContains(t, uploaded, "PUT /bucket/prefix/_columns.json")
+}
@@ -0,0 +1,345 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains dry run selected by -dry-run flag. Dry run
+// resolves list of exported tables exactly as export does, prints SQL
+// statement used to read each table, estimated number of rows and files or
+// objects that would be written. No file is created and nothing is uploaded
+// into S3.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/dryrun.html
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Messages
+const (
+	planningExport     = "Planning export (dry run)"
+	planTableFailed    = "Unable to plan export of table"
+	dryRunFailed       = "dry run failed for %d tables"
+	s3TargetFormat     = "s3://%s/%s"
+	estimateRowsFailed = "Unable to estimate number of rows"
+)
+
+// Methods used to estimate number of rows
+const (
+	estimateByExplain = "estimate"
+	estimateByCount   = "count"
+)
+
+// SQL statements used to estimate number of rows
+const (
+	explainStatement = "EXPLAIN (FORMAT JSON) %s"
+	countStatement   = "SELECT COUNT(*) FROM (%s) AS planned"
+)
+
+// TablePlan represents planned export of one table (or of one partition of
+// table).
+type TablePlan struct {
+	TableName     TableName
+	Prefix        string
+	Statement     string
+	EstimatedRows int
+	Estimation    string
+	Target        string
+	Error         string
+}
+
+// ExportPlan represents everything that would be done by export.
+type ExportPlan struct {
+	Tables []TablePlan
+	Files  []string
+}
+
+// explainOutput represents part of EXPLAIN output in JSON format
+type explainOutput []struct {
+	Plan struct {
+		PlanRows float64 `json:"Plan Rows"`
+	} `json:"Plan"`
+}
+
+// EstimateRowCount method estimates number of rows returned by given SQL
+// statement. Planner estimate is used for PostgreSQL, so no table is
+// scanned. Other databases count the rows. Method used for estimation is
+// returned together with the number of rows.
+func (storage DBStorage) EstimateRowCount(ctx context.Context, sqlStatement string) (int, string, error) {
+	if storage.dbDriverType == DBDriverPostgres {
+		var output string
+		err := storage.queryRow(ctx, "", "estimate row count",
+			fmt.Sprintf(explainStatement, sqlStatement), nil, &output)
+		if err != nil {
+			return -1, estimateByExplain, err
+		}
+
+		var plans explainOutput
+		err = json.Unmarshal([]byte(output), &plans)
+		if err != nil {
+			return -1, estimateByExplain, err
+		}
+		if len(plans) == 0 {
+			return -1, estimateByExplain, errors.New("empty query plan")
+		}
+		return int(plans[0].Plan.PlanRows), estimateByExplain, nil
+	}
+
+	var count int
+	err := storage.queryRow(ctx, "", "estimate row count",
+		fmt.Sprintf(countStatement, sqlStatement), nil, &count)
+	if err != nil {
+		return -1, estimateByCount, err
+	}
+	return count, estimateByCount, nil
+}
+
+// planTable method constructs plan for export of one table into given
+// target.
+func (storage DBStorage) planTable(ctx context.Context, tableName TableName, prefix, target string, limit int) TablePlan {
+	plan := TablePlan{
+		TableName:     tableName,
+		Prefix:        prefix,
+		Target:        target,
+		EstimatedRows: -1,
+	}
+
+	statement, err := storage.selectStatement(ctx, tableName, limit)
+	if err != nil {
+		log.Error().Err(err).Str(tableNameMsg, string(tableName)).Msg(planTableFailed)
+		plan.Error = err.Error()
+		return plan
+	}
+	plan.Statement = statement
+
+	plan.EstimatedRows, plan.Estimation, err = storage.EstimateRowCount(ctx, statement)
+	if err != nil {
+		log.Error().Err(err).Str(tableNameMsg, string(tableName)).Msg(estimateRowsFailed)
+		plan.Error = err.Error()
+	}
+	return plan
+}
+
+// planDataExport function constructs plan of export with actual
+// configuration and command line flags and prints it into given output.
+func planDataExport(ctx context.Context, configuration *ConfigStruct, storage *DBStorage,
+	cliFlags CliFlags, ignoredTables IgnoredTables, output io.Writer) (int, error) {
+	log.Info().Msg(planningExport)
+
+	s3Configuration := GetS3Configuration(configuration)
+	var basePrefix string
+	var target func(prefix, name string) string
+
+	switch cliFlags.Output {
+	case s3Output:
+		basePrefix = s3Configuration.Prefix
+		target = func(prefix, name string) string {
+			return fmt.Sprintf(s3TargetFormat, s3Configuration.Bucket, setObjectPrefix(prefix, name))
+		}
+	case fileOutput:
+		target = func(prefix, name string) string {
+			return filepath.Join(cliFlags.OutputDir, prefix, name)
+		}
+	default:
+		err := fmt.Errorf(unknownOutputType, cliFlags.Output)
+		log.Err(err).Msg(operationFailedMessage)
+		return ExitStatusConfigurationError, err
+	}
+
+	tableNames, err := storage.ReadListOfTables(ctx)
+	if err != nil {
+		log.Err(err).Msg(operationFailedMessage)
+		return ExitStatusStorageError, err
+	}
+
+	plan := &ExportPlan{}
+
+	// the same functions that drive export are used, tables are planned
+	// instead of stored
+	planTable := func(storage DBStorage, prefix string, tableName TableName) error {
+		plan.Tables = append(plan.Tables, storage.planTable(ctx, tableName, prefix,
+			target(prefix, string(tableName)+CSVFileExtension), cliFlags.Limit))
+		return nil
+	}
+
+	nopLogger := zerolog.Nop()
+	if cliFlags.PartitionByOrg {
+		_, err = storePartitionedTables(ctx, *storage, tableNames, ignoredTables,
+			basePrefix, false, planTable, &nopLogger)
+	} else {
+		err = storeTables(*storage, tableNames, ignoredTables, basePrefix,
+			planTable, &nopLogger)
+	}
+	if err != nil {
+		log.Err(err).Msg(operationFailedMessage)
+		return ExitStatusStorageError, err
+	}
+
+	plan.Files = plannedFiles(configuration, cliFlags, storage.sampling, basePrefix, target)
+
+	err = PrintExportPlan(output, plan)
+	if err != nil {
+		return ExitStatusIOError, err
+	}
+
+	failed := 0
+	for _, tablePlan := range plan.Tables {
+		if tablePlan.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return ExitStatusStorageError, fmt.Errorf(dryRunFailed, failed)
+	}
+	return ExitStatusOK, nil
+}
+
+// plannedFiles function returns list of files or objects that would be
+// written by export in addition to exported tables.
+func plannedFiles(configuration *ConfigStruct, cliFlags CliFlags,
+	sampling Sampling, basePrefix string, target func(prefix, name string) string) []string {
+	var files []string
+
+	if GetSchemaDriftConfiguration(configuration).Enabled() {
+		files = append(files, target(basePrefix, columnsInfo))
+	}
+	if cliFlags.ExportMetadata {
+		files = append(files, target(basePrefix, listOfTables), target(basePrefix, metadataTable))
+	}
+	if cliFlags.ExportSchema || cliFlags.ExportSchemaSQL {
+		files = append(files, target(basePrefix, schemaInfo))
+	}
+	if cliFlags.ExportSchemaSQL {
+		files = append(files, target(basePrefix, schemaDDL))
+	}
+	if cliFlags.ExportDisabledRules {
+		// disabled rules are always stored without prefix
+		files = append(files, target("", disabledRules))
+	}
+	if cliFlags.ExportRuleHitsSummary {
+		// rule hits summary is stored without prefix as disabled rules
+		files = append(files, target("", ruleHitsCSV), target("", ruleHitsJSON))
+	}
+	if cliFlags.ExportFeedbackSummary {
+		fileName, err := feedbackFileName(cliFlags.FeedbackFormat)
+		if err == nil {
+			files = append(files, target("", fileName))
+		}
+	}
+	if cliFlags.FlattenReports {
+		files = append(files, target(basePrefix, flattenedRules), target(basePrefix, flattenedInfo),
+			target(basePrefix, flattenedPasses), target(basePrefix, flattenedSkips),
+			target(basePrefix, flattenedSummary))
+	}
+	if sampling.Enabled() {
+		files = append(files, target(basePrefix, samplingInfo))
+	}
+	for _, query := range GetQueriesConfiguration(configuration) {
+		files = append(files, target(basePrefix, query.fileName()))
+	}
+	if cliFlags.PartitionByOrg {
+		files = append(files, target(basePrefix, partitionsInfo))
+	}
+	if cliFlags.PrintSummaryTable {
+		files = append(files, target(basePrefix, summaryInfo))
+	}
+	if cliFlags.ExportProfile {
+		files = append(files, target(basePrefix, profileInfo))
+	}
+	if cliFlags.ExportLog {
+		switch cliFlags.Output {
+		case s3Output:
+			files = append(files, target("", operationLogObject(configuration)))
+		default:
+			fileName := GetOperationLogConfiguration(configuration).File
+			if fileName == "" {
+				fileName = logFile
+			}
+			files = append(files, fileName)
+		}
+	}
+	return files
+}
+
+// PrintExportPlan function prints plan of export in human readable form.
+func PrintExportPlan(output io.Writer, plan *ExportPlan) error {
+	if output == nil {
+		err := errors.New(bufferIsNil)
+		return err
+	}
+
+	totalRows := 0
+	for _, tablePlan := range plan.Tables {
+		lines := []string{
+			fmt.Sprintf("Table:  %s", tablePlan.TableName),
+			fmt.Sprintf("Target: %s", tablePlan.Target),
+		}
+		if tablePlan.Statement != "" {
+			lines = append(lines, fmt.Sprintf("SQL:    %s", tablePlan.Statement))
+		}
+		if tablePlan.EstimatedRows >= 0 {
+			totalRows += tablePlan.EstimatedRows
+			lines = append(lines, fmt.Sprintf("Rows:   %d (%s)",
+				tablePlan.EstimatedRows, tablePlan.Estimation))
+		}
+		if tablePlan.Error != "" {
+			lines = append(lines, fmt.Sprintf("Error:  %s", tablePlan.Error))
+		}
+
+		for _, line := range lines {
+			_, err := fmt.Fprintln(output, line)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintln(output)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(plan.Files) > 0 {
+		_, err := fmt.Fprintln(output, "Other files:")
+		if err != nil {
+			return err
+		}
+		for _, file := range plan.Files {
+			_, err := fmt.Fprintf(output, "  %s\n", file)
+			if err != nil {
+				return err
+			}
+		}
+		_, err = fmt.Fprintln(output)
+		if err != nil {
+			return err
+		}
+	}
+
+	_, err := fmt.Fprintf(output, "Total: %d tables, %d rows\n", len(plan.Tables), totalRows)
+	return err
+}
@@ -0,0 +1,286 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/dryrun_test.html
+
+import (
+	"bytes"
+	"context"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+	"github.com/tisnik/go-capture"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// reportTableStatements contains statements that prepare table with data
+// for two organizations
+var reportTableStatements = []string{
+	"CREATE TABLE report (org_id INTEGER, cluster TEXT, report TEXT, PRIMARY KEY (org_id, cluster))",
+	"INSERT INTO report VALUES (1, 'c1', 'r'), (1, 'c2', 'r'), (2, 'c3', 'r')",
+}
+
+// TestEstimateRowCountSQLite checks that rows are counted on SQLite
+func TestEstimateRowCountSQLite(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, reportTableStatements...)
+
+	config := testConfig
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	rows, estimation, err := storage.EstimateRowCount(context.Background(), "SELECT * FROM report WHERE org_id IN ('1') ORDER BY org_id, cluster")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, rows)
+	assert.Equal(t, "count", estimation)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestEstimateRowCountPostgres checks that planner estimate is used on
+// PostgreSQL
+func TestEstimateRowCountPostgres(t *testing.T) {
+	connection, mock := mustCreateMockConnection(t)
+
+	rows := sqlmock.NewRows([]string{"QUERY PLAN"}).
+		AddRow(`[{"Plan": {"Node Type": "Seq Scan", "Plan Rows": 1234}}]`)
+	mock.ExpectQuery("EXPLAIN \\(FORMAT JSON\\) SELECT \\* FROM report LIMIT 10").
+		WillReturnRows(rows)
+	mock.ExpectClose()
+
+	config := testConfig
+	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &config)
+
+	count, estimation, err := storage.EstimateRowCount(context.Background(), "SELECT * FROM report LIMIT 10")
+	assert.NoError(t, err)
+	assert.Equal(t, 1234, count)
+	assert.Equal(t, "estimate", estimation)
+
+	checkConnectionClose(t, connection)
+	checkAllExpectations(t, mock)
+}
+
+// TestEstimateRowCountPostgresWrongPlan checks that unexpected EXPLAIN
+// output is reported
+func TestEstimateRowCountPostgresWrongPlan(t *testing.T) {
+	connection, mock := mustCreateMockConnection(t)
+
+	mock.ExpectQuery("EXPLAIN").WillReturnRows(
+		sqlmock.NewRows([]string{"QUERY PLAN"}).AddRow(`[]`))
+	mock.ExpectClose()
+
+	config := testConfig
+	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &config)
+
+	_, _, err := storage.EstimateRowCount(context.Background(), "SELECT * FROM report")
+	assert.Error(t, err)
+
+	checkConnectionClose(t, connection)
+	checkAllExpectations(t, mock)
+}
+
+// TestPrintExportPlanNilBuffer check how nil output is handled by
+// PrintExportPlan function
+func TestPrintExportPlanNilBuffer(t *testing.T) {
+	err := main.PrintExportPlan(nil, &main.ExportPlan{})
+	assert.Error(t, err, "Buffer is nil")
+}
+
+// TestPrintExportPlan checks printing of export plan
+func TestPrintExportPlan(t *testing.T) {
+	plan := &main.ExportPlan{
+		Tables: []main.TablePlan{
+			{
+				TableName:     "report",
+				Statement:     "SELECT * FROM report ORDER BY id",
+				EstimatedRows: 10,
+				Estimation:    "count",
+				Target:        "s3://bucket/prefix/report.csv",
+			},
+			{
+				TableName:     "bad",
+				EstimatedRows: -1,
+				Target:        "s3://bucket/prefix/bad.csv",
+				Error:         "no such table",
+			},
+		},
+		Files: []string{"s3://bucket/prefix/_summary.json"},
+	}
+
+	buffer := new(bytes.Buffer)
+	err := main.PrintExportPlan(buffer, plan)
+	assert.NoError(t, err)
+
+	expected := `Table:  report
+Target: s3://bucket/prefix/report.csv
+SQL:    SELECT * FROM report ORDER BY id
+Rows:   10 (count)
+
+Table:  bad
+Target: s3://bucket/prefix/bad.csv
+Error:  no such table
+
+Other files:
+  s3://bucket/prefix/_summary.json
+
+Total: 2 tables, 10 rows
+`
+	assert.Equal(t, expected, buffer.String())
+}
+
+// TestPlanDataExportSelectiveExport checks that filter by organizations
+// and limit are part of planned SQL statement
+func TestPlanDataExportSelectiveExport(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, reportTableStatements...)
+
+	config := testConfig
+	config.EnableOrgIDFiltering = true
+	config.OrganizationsToExport = []string{"1"}
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	configuration := main.ConfigStruct{
+		S3: main.S3Configuration{Bucket: "bucket", Prefix: "prefix"},
+	}
+	cliFlags := main.CliFlags{
+		Output:            "S3",
+		Limit:             1,
+		ExportMetadata:    true,
+		PrintSummaryTable: true,
+		DryRun:            true,
+	}
+
+	buffer := new(bytes.Buffer)
+	code, err := main.PlanDataExport(context.Background(), &configuration, storage, cliFlags,
+		main.IgnoredTables{}, buffer)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.NoError(t, err)
+
+	expected := `Table:  report
+Target: s3://bucket/prefix/report.csv
+SQL:    SELECT * FROM report WHERE org_id IN ('1') ORDER BY org_id, cluster LIMIT 1
+Rows:   1 (count)
+
+Other files:
+  s3://bucket/prefix/_tables.csv
+  s3://bucket/prefix/_metadata.csv
+  s3://bucket/prefix/_summary.json
+
+Total: 1 tables, 1 rows
+`
+	assert.Equal(t, expected, buffer.String())
+
+	checkConnectionClose(t, connection)
+}
+
+// TestPlanDataExportPartitions checks that each partition is planned
+// separately
+func TestPlanDataExportPartitions(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, reportTableStatements...)
+
+	config := testConfig
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	cliFlags := main.CliFlags{
+		Output:         "file",
+		Limit:          NoLimits,
+		PartitionByOrg: true,
+		DryRun:         true,
+	}
+
+	buffer := new(bytes.Buffer)
+	code, err := main.PlanDataExport(context.Background(), &main.ConfigStruct{}, storage, cliFlags,
+		main.IgnoredTables{}, buffer)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.NoError(t, err)
+
+	output := buffer.String()
+	assert.Contains(t, output, "Target: org_id=1/report.csv\n")
+	assert.Contains(t, output, "Target: org_id=2/report.csv\n")
+	assert.Contains(t, output, "Rows:   2 (count)\n")
+	assert.Contains(t, output, "Rows:   1 (count)\n")
+	assert.Contains(t, output, "  _partitions.csv\n")
+	assert.Contains(t, output, "Total: 2 tables, 3 rows\n")
+
+	checkConnectionClose(t, connection)
+}
+
+// TestPlanDataExportUnknownOutput checks that unknown output is reported
+func TestPlanDataExportUnknownOutput(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, reportTableStatements...)
+
+	config := testConfig
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	code, err := main.PlanDataExport(context.Background(), &main.ConfigStruct{}, storage,
+		main.CliFlags{Output: "foo"}, main.IgnoredTables{}, new(bytes.Buffer))
+	assert.Equal(t, main.ExitStatusConfigurationError, code)
+	assert.EqualError(t, err, "Unknown output type: foo")
+
+	checkConnectionClose(t, connection)
+}
+
+// TestPerformDataExportDryRun checks that dry run writes no files, pushes
+// no metrics and reports tables that can't be read
+func TestPerformDataExportDryRun(t *testing.T) {
+	server, requests := mockPushGateway(t, http.StatusOK)
+
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	configuration.Metrics.PushGatewayURL = server.URL
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:            "file",
+		Limit:             NoLimits,
+		ExportMetadata:    true,
+		PrintSummaryTable: true,
+		DryRun:            true,
+	}
+
+	var code int
+	var err error
+	runMetrics := main.RunMetrics{}
+	output, captureErr := capture.StandardOutput(func() {
+		code, err = main.PerformDataExport(&configuration, cliFlags, &log.Logger, &runMetrics)
+	})
+	assert.NoError(t, captureErr)
+
+	assert.Equal(t, main.ExitStatusStorageError, code)
+	assert.EqualError(t, err, "dry run failed for 1 tables")
+
+	assert.Contains(t, output, "Table:  good\nTarget: good.csv\nSQL:    SELECT * FROM good ORDER BY id\nRows:   2 (count)\n")
+	assert.Contains(t, output, "Table:  bad\nTarget: bad.csv\nError:  no such table: main.removed\n")
+
+	// only the database exists in the directory
+	entries, err := os.ReadDir(directory)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "test.db", entries[0].Name())
+
+	err = main.PushRunMetrics(&configuration, &runMetrics, time.Now(), code)
+	assert.NoError(t, err)
+	assert.Empty(t, requests())
+}
@@ -37,17 +37,111 @@ var (
 	ShowConfiguration         = showConfiguration
 	DoSelectedOperation       = doSelectedOperation
 	PrintTables               = printTables
-	ParseFlags                = parseFlags
 	CheckS3Connection         = checkS3Connection
 	PerformDataExport         = performDataExport
 	ConstructIgnoredTablesMap = constructIgnoredTablesMap
 	SetObjectPrefix           = setObjectPrefix
 
 	// exported functions from the s3.go source file
-	S3BucketExists  = s3BucketExists
-	StoreTableNames = storeTableNames
+	S3BucketExists          = s3BucketExists
+	NewS3Sink               = newS3Sink
+	StoreOperationLogIntoS3 = storeOperationLogIntoS3
 
-	// exported functions from the file.go source file
-	StoreTableNamesIntoFile    = storeTableNamesIntoFile
-	StoreDisabledRulesIntoFile = storeDisabledRulesIntoFile
+	// exported functions and methods from the file.go source file
+	NewFileSink                      = newFileSink
+	FileSinkCheckExisting            = (*fileSink).checkExisting
+	FileConfigurationOutputDirectory = FileConfiguration.outputDirectory
+
+	// exported functions from the sink.go source file
+	StoreTableNames    = storeTableNames
+	StoreDisabledRules = storeDisabledRules
+	StoreSampling      = storeSampling
+	StorePartitions    = storePartitions
+	StoreFailures      = storeFailures
+	StoreIncomplete    = storeIncomplete
+	StoreSummary       = storeSummary
+
+	// exported functions and methods from the sampling.go source file
+	NewSampling         = newSampling
+	ChooseOrgIDs        = chooseOrgIDs
+	SampleOrganizations = DBStorage.sampleOrganizations
+
+	// exported functions and methods from the subset.go source file
+	ParseRelationship = parseRelationship
+	ReadRelationships = DBStorage.readRelationships
+
+	// exported functions from the retry.go source file
+	IsRetryable = isRetryable
+
+	// exported functions and methods from the interrupt.go source file
+	HandleSignal = (*Interruption).handleSignal
+
+	// exported functions from the metrics.go source file
+	NewRegistry    = newRegistry
+	PushMetrics    = pushMetrics
+	PushRunMetrics = pushRunMetrics
+
+	// exported functions from the tracing.go source file
+	InitTracing = initTracing
+
+	// exported functions from the operation_log.go source file
+	NewRunID           = newRunID
+	RunStatus          = runStatus
+	OperationLogObject = operationLogObject
+	FinishOperationLog = finishOperationLog
+
+	// exported functions from the preflight.go source file
+	RunPreflight = runPreflight
+
+	// exported functions from the dryrun.go source file
+	PlanDataExport = planDataExport
+
+	// exported functions from the commands.go source file
+	ParseCommandLine      = parseCommandLine
+	CheckConflictingFlags = checkConflictingFlags
+	RunListTables         = runListTables
+	RunDescribe           = runDescribe
+	RunCount              = runCount
+	RunDiff               = runDiff
+	RunCheck              = runCheck
+	RunConfig             = runConfig
+
+	// exported functions and methods from the profile.go source file
+	NewColumnProfiler     = newColumnProfiler
+	ColumnProfilerObserve = (*columnProfiler).observe
+	ColumnProfilerProfile = (*columnProfiler).profile
+	NewHyperLogLog        = newHyperLogLog
+	HyperLogLogAdd        = (*hyperLogLog).add
+	HyperLogLogEstimate   = (*hyperLogLog).estimate
+
+	// exported functions from the partition.go source file
+	PartitionPrefix        = partitionPrefix
+	StorePartitionedTables = storePartitionedTables
+
+	// exported functions from the queries.go source file
+	ValidateQueries = validateQueries
+	CheckQueryNames = checkQueryNames
+
+	// exported methods from the storage.go source file
+	ReadTableWithProfile = DBStorage.readTableWithProfile
 )
+
+// SetSampling function sets sampling parameters used by given storage
+func SetSampling(storage *DBStorage, sampling Sampling) {
+	storage.sampling = sampling
+}
+
+// SetSubset function sets subset plan used by given storage
+func SetSubset(storage *DBStorage, subset map[TableName]string) {
+	storage.subset = subset
+}
+
+// SetProfiles function sets column profiles computed by given storage
+func SetProfiles(storage *DBStorage, profiles *ExportProfiles) {
+	storage.profiles = profiles
+}
+
+// SetRetryPolicy function sets retry policy used by given storage
+func SetRetryPolicy(storage *DBStorage, policy RetryPolicy) {
+	storage.retryPolicy = policy
+}
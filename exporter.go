@@ -23,14 +23,18 @@ package main
 // https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/exporter.html
 
 import (
-	"bytes"
+	"context"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"os"
 	"strings"
+	"time"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Messages
@@ -41,6 +45,8 @@ const (
 	listOfTablesMsg        = "List of tables"
 	tableNameMsg           = "Table name"
 	contentTypeCSV         = "text/csv"
+	contentTypeJSON        = "application/json"
+	contentTypeSQL         = "application/sql"
 	tableIsIgnored         = "Table is ignored, skipping export"
 )
 
@@ -68,6 +74,22 @@ const (
 	// ExitStatusIOError is returned in case of any I/O error (export data
 	// into file failed etc.)
 	ExitStatusIOError
+
+	// ExitStatusPartialSuccess is returned in continue-on-error mode when
+	// export of some tables failed, but other tables were exported
+	ExitStatusPartialSuccess
+
+	// ExitStatusIncomplete is returned when export has been stopped by
+	// signal or by reaching deadline before all tables were exported
+	ExitStatusIncomplete
+
+	// ExitStatusPreflightFailed is returned when any preflight check
+	// selected by -preflight flag fails
+	ExitStatusPreflightFailed
+
+	// ExitStatusSchemaDrift is returned when schema of tables differs from
+	// schema stored by previous export and schema drift policy is "fail"
+	ExitStatusSchemaDrift
 )
 
 const (
@@ -77,23 +99,36 @@ const (
 
 // output files or objects containing metadata
 const (
-	listOfTables  = "_tables.csv"
-	metadataTable = "_metadata.csv"
-	disabledRules = "_disabled_rules.csv"
-	logFile       = "_logs.txt"
+	listOfTables   = "_tables.csv"
+	metadataTable  = "_metadata.csv"
+	disabledRules  = "_disabled_rules.csv"
+	ruleHitsCSV    = "_rule_hits_summary.csv"
+	ruleHitsJSON   = "_rule_hits_summary.json"
+	samplingInfo   = "_sampling.csv"
+	partitionsInfo = "_partitions.csv"
+	failuresInfo   = "_failures.json"
+	incompleteInfo = "_incomplete.json"
+	summaryInfo    = "_summary.json"
+	schemaInfo     = "_schema.json"
+	schemaDDL      = "_schema.sql"
+	profileInfo    = "_profile.json"
+	columnsInfo    = "_columns.json"
+	driftInfo      = "_schema_drift.json"
+	logFile        = "_logs.txt"
 )
 
 // messages
 const (
-	readDisabledRulesInfoFailed      = "Read disabled rules info failed"
-	storeDisabledRulesIntoFileFailed = "Store disabled rules into file failed"
-	readingListOfTables              = "Reading list of tables"
-	exportingDisabledRules           = "Exporting disabled rules"
-	closingConnectionToStorage       = "Closing connection to storage"
-	exportingTables                  = "Exporting tables"
-	exportingTable                   = "Exporting table"
-	exportingMetadata                = "Exporting metadata"
-	unknownOutputType                = "Unknown output type: %s"
+	readDisabledRulesInfoFailed = "Read disabled rules info failed"
+	storeDisabledRulesFailed    = "Store disabled rules failed"
+	storeSamplingInfoFailed     = "Store sampling parameters failed"
+	readingListOfTables         = "Reading list of tables"
+	exportingDisabledRules      = "Exporting disabled rules"
+	closingConnectionToStorage  = "Closing connection to storage"
+	exportingTables             = "Exporting tables"
+	exportingTable              = "Exporting table"
+	exportingMetadata           = "Exporting metadata"
+	unknownOutputType           = "Unknown output type: %s"
 )
 
 // flags
@@ -118,7 +153,8 @@ func showConfiguration(config *ConfigStruct) {
 	log.Info().
 		Str("Driver", storageConfig.Driver).
 		Str("DB Name", storageConfig.PGDBName).
-		Str("Username", storageConfig.PGUsername). // password is omitted on purpose
+		Str("Username", storageConfig.PGUsername).
+		Str("Password", redactSecret(storageConfig.PGPassword)).
 		Str("Host", storageConfig.PGHost).
 		Int("DB Port", storageConfig.PGPort).
 		Bool("LogSQLQueries", storageConfig.LogSQLQueries).
@@ -136,11 +172,28 @@ func showConfiguration(config *ConfigStruct) {
 		Str("URL", s3Configuration.EndpointURL).
 		Uint("S3 Port", s3Configuration.EndpointPort).
 		Str("AccessKeyID", s3Configuration.AccessKeyID).
-		Str("SecretAccessKey", s3Configuration.SecretAccessKey).
+		Str("SecretAccessKey", redactSecret(s3Configuration.SecretAccessKey)).
 		Bool("Use SSL", s3Configuration.UseSSL).
 		Str("Bucket name", s3Configuration.Bucket).
 		Str("Bucket prefix", s3Configuration.Prefix).
 		Msg("S3 configuration")
+
+	retryConfiguration := GetRetryConfiguration(config)
+	log.Info().
+		Int("Max attempts", retryConfiguration.MaxAttempts).
+		Dur("Base delay", retryConfiguration.BaseDelay).
+		Dur("Max delay", retryConfiguration.MaxDelay).
+		Float64("Jitter", retryConfiguration.Jitter).
+		Msg("Retry configuration")
+}
+
+// redactSecret function masks secret so it is not written into logs. Empty
+// secret is kept, so it is visible that the secret is not configured.
+func redactSecret(secret string) string {
+	if secret == "" {
+		return ""
+	}
+	return "***"
 }
 
 // constructIgnoredTablesMap helper function splits list of tables by comma and
@@ -164,54 +217,219 @@ func constructIgnoredTablesMap(input string) IgnoredTables {
 	return m
 }
 
-// performDataExport function exports all data into selected output
-func performDataExport(configuration *ConfigStruct, cliFlags CliFlags, operationLogger *zerolog.Logger) (int, error) {
+// performDataExport function exports all data into selected output. Values
+// measured during export are recorded into runMetrics (when given), so they
+// can be pushed once the final exit status of the run is known.
+func performDataExport(configuration *ConfigStruct, cliFlags CliFlags, operationLogger *zerolog.Logger,
+	runMetrics *RunMetrics) (exitStatus int, err error) {
+	summary := NewExportSummary()
+
+	// dry run does not push any metrics
+	if runMetrics == nil || cliFlags.DryRun {
+		runMetrics = &RunMetrics{}
+	}
+	runMetrics.Summary = summary
+
+	// spans are flushed after the export span is ended; dry run does not
+	// write them anywhere
+	tracingConfiguration := GetTracingConfiguration(configuration)
+	if cliFlags.DryRun {
+		tracingConfiguration = TracingConfiguration{}
+	}
+	shutdownTracing, err := initTracing(tracingConfiguration)
+	if err != nil {
+		log.Err(err).Msg(tracingInitFailed)
+		operationLogger.Err(err).Msg(tracingInitFailed)
+		return ExitStatusConfigurationError, err
+	}
+	defer shutdownTracing()
+
+	// export is stopped gracefully on SIGTERM, SIGINT or when deadline is
+	// reached
+	interruption := NewInterruption(cliFlags.Deadline)
+	defer interruption.Close()
+
+	ctx, span := startSpan(interruption.Context(), exportSpan,
+		attribute.String(outputAttribute, cliFlags.Output))
+	defer func() {
+		span.SetAttributes(attribute.Int(exitStatusAttribute, exitStatus))
+		endSpan(span, err)
+	}()
+
+	sampling, err := newSampling(cliFlags)
+	if err != nil {
+		log.Err(err).Msg(operationFailedMessage)
+		operationLogger.Err(err).Msg("Wrong sampling parameters")
+		return ExitStatusConfigurationError, err
+	}
+
+	if cliFlags.ExportFeedbackSummary {
+		_, err = feedbackFileName(cliFlags.FeedbackFormat)
+		if err != nil {
+			log.Err(err).Msg(operationFailedMessage)
+			operationLogger.Err(err).Msg("Wrong feedback summary format")
+			return ExitStatusConfigurationError, err
+		}
+	}
+
+	err = validateQueries(GetQueriesConfiguration(configuration))
+	if err != nil {
+		log.Err(err).Msg(operationFailedMessage)
+		operationLogger.Err(err).Msg("Wrong user-defined query")
+		return ExitStatusConfigurationError, err
+	}
+
 	operationLogger.Info().Msg("Retrieving connection to storage")
 
 	// prepare the storage
 	storageConfiguration := GetStorageConfiguration(configuration)
-	storage, err := NewStorage(&storageConfiguration)
+	storage, err := NewStorage(ctx, &storageConfiguration,
+		NewRetryPolicy(GetRetryConfiguration(configuration)))
 	if err != nil {
 		log.Err(err).Msg(operationFailedMessage)
 		operationLogger.Err(err).Msg("Unable to retrieve connection to storage")
 		return ExitStatusStorageError, err
 	}
 
+	// connection to storage needs to be closed on all paths, even when
+	// export failed
+	defer func() {
+		closeErr := closeStorage(storage, operationLogger)
+		if closeErr != nil && err == nil {
+			exitStatus, err = ExitStatusStorageError, closeErr
+		}
+	}()
+
 	ignoredTablesMap := constructIgnoredTablesMap(cliFlags.IgnoredTables)
 
+	runMetrics.RetryStats = storage.retryStats
+
+	// column profiles are computed from exported rows on demand, because
+	// they cost CPU
+	if cliFlags.ExportProfile {
+		storage.profiles = NewExportProfiles()
+	}
+
+	// sampling is used instead of (or together with) plain LIMIT
+	storage.sampling = sampling
+	if sampling.Enabled() {
+		log.Info().Int64("seed", sampling.Seed).Msg(samplingSeedMsg)
+		operationLogger.Info().Int64("seed", sampling.Seed).Msg(samplingSeedMsg)
+
+		if sampling.Orgs > 0 {
+			sampled, err := storage.sampleOrganizations(ctx)
+			if err != nil {
+				log.Err(err).Msg(operationFailedMessage)
+				operationLogger.Err(err).Msg("Unable to sample organizations")
+				return ExitStatusStorageError, err
+			}
+
+			// only sampled organizations are exported from all tables
+			storage.config.EnableOrgIDFiltering = true
+			storage.config.OrganizationsToExport = sampled
+		}
+	}
+
+	// follow relationships between tables when only selected
+	// organizations are exported
+	if storage.config.EnableOrgIDFiltering {
+		operationLogger.Info().Msg("Constructing subset of data")
+		storage.subset, err = storage.BuildSubsetPlan(ctx)
+		if err != nil {
+			log.Err(err).Msg(operationFailedMessage)
+			operationLogger.Err(err).Msg("Unable to construct subset of data")
+			return ExitStatusStorageError, err
+		}
+	}
+
+	// only plan is printed in dry run, nothing is written
+	if cliFlags.DryRun {
+		return planDataExport(ctx, configuration, storage, cliFlags,
+			ignoredTablesMap, os.Stdout)
+	}
+
+	// the same export is performed for all outputs, only sink differs
+	var sink Sink
+	basePrefix := ""
+
 	switch cliFlags.Output {
 	case s3Output:
-		return performDataExportToS3(configuration, storage,
-			cliFlags.ExportMetadata, cliFlags.ExportDisabledRules,
-			operationLogger, cliFlags.Limit, ignoredTablesMap)
+		operationLogger.Info().Msg("Exporting to S3")
+
+		minioClient, s3Err := NewS3Connection(configuration)
+		if s3Err != nil {
+			return ExitStatusS3Error, s3Err
+		}
+
+		s3config := GetS3Configuration(configuration)
+		log.Info().Str("bucket name", s3config.Bucket).Msg("S3 bucket to write to")
+
+		sink = newS3Sink(minioClient, s3config.Bucket,
+			NewRetryPolicy(GetRetryConfiguration(configuration)))
+		basePrefix = s3config.Prefix
 	case fileOutput:
-		return performDataExportToFiles(configuration, storage,
-			cliFlags.ExportMetadata, cliFlags.ExportDisabledRules,
-			operationLogger, cliFlags.Limit, ignoredTablesMap)
+		operationLogger.Info().Msg("Exporting to file")
+
+		files := newFileSink(cliFlags.OutputDir, cliFlags.Force)
+		if GetFileConfiguration(configuration).PerRunDirectory {
+			// files stored by previous export are used to detect
+			// schema drift and trend of disabled rules
+			err := files.readPreviousRuns()
+			if err != nil {
+				operationLogger.Err(err).Msg("Unable to find previous runs")
+				return ExitStatusIOError, err
+			}
+		}
+		sink = files
 	default:
 		err := fmt.Errorf(unknownOutputType, cliFlags.Output)
 		operationLogger.Err(err).Msg("Wrong output type selected")
 		return ExitStatusConfigurationError, err
 	}
-}
 
-// performDataExportToS3 exports all tables and metadata info configured S3
-// bucket
-func performDataExportToS3(configuration *ConfigStruct,
-	storage *DBStorage, exportMetadata bool,
-	exportDisabledRules bool,
-	operationLogger *zerolog.Logger, limit int,
-	ignoredTables IgnoredTables) (int, error) {
-	operationLogger.Info().Msg("Exporting to S3")
+	exitStatus, err = performDataExportToSink(ctx, sink, basePrefix,
+		configuration, storage, cliFlags, interruption, summary,
+		operationLogger, ignoredTablesMap)
 
-	operationLogger.Info().Msg(readingListOfTables)
+	// summary is emitted when export fails too
+	if cliFlags.PrintSummaryTable {
+		exitStatus, err = emitSummary(ctx, sink, basePrefix, summary,
+			exitStatus, err, operationLogger)
+	}
+	return exitStatus, err
+}
+
+// emitSummary function prints summary and stores it next to exported tables.
+// Failure to store summary is returned only when the export itself
+// succeeded, otherwise the original failure is kept.
+func emitSummary(ctx context.Context, sink Sink, basePrefix string,
+	summary *ExportSummary, exitStatus int, exportErr error,
+	operationLogger *zerolog.Logger) (int, error) {
+	printSummary(summary)
 
-	minioClient, context, err := NewS3Connection(configuration)
+	// summary needs to be stored even when export has been cancelled
+	err := storeSummary(context.WithoutCancel(ctx), sink, setObjectPrefix(basePrefix, summaryInfo), summary)
 	if err != nil {
-		return ExitStatusS3Error, err
+		log.Err(err).Msg(storeSummaryFailed)
+		operationLogger.Err(err).Msg(storeSummaryFailed)
+		if exportErr == nil && exitStatus == ExitStatusOK {
+			return ExitStatusIOError, err
+		}
 	}
+	return exitStatus, exportErr
+}
 
-	tableNames, err := storage.ReadListOfTables()
+// performDataExportToSink exports all tables, metadata info and selected
+// reports into given sink. Objects that belong to export are stored under
+// given base prefix.
+func performDataExportToSink(ctx context.Context, sink Sink, basePrefix string,
+	configuration *ConfigStruct, storage *DBStorage, cliFlags CliFlags,
+	interruption *Interruption, summary *ExportSummary,
+	operationLogger *zerolog.Logger,
+	ignoredTables IgnoredTables) (int, error) {
+	operationLogger.Info().Msg(readingListOfTables)
+
+	tableNames, err := storage.ReadListOfTables(ctx)
 	if err != nil {
 		log.Err(err).Msg(operationFailedMessage)
 		operationLogger.Err(err).Msg(operationFailedMessage)
@@ -220,43 +438,95 @@ func performDataExportToS3(configuration *ConfigStruct,
 
 	log.Info().Int("tables count", len(tableNames)).Msg(listOfTablesMsg)
 
+	err = checkQueryNames(GetQueriesConfiguration(configuration), tableNames, ignoredTables)
+	if err != nil {
+		log.Err(err).Msg(operationFailedMessage)
+		operationLogger.Err(err).Msg("Wrong user-defined query")
+		return ExitStatusConfigurationError, err
+	}
+
+	// export into directory that holds previous export fails before
+	// anything is written
+	if checker, ok := sink.(existingChecker); ok {
+		err = checker.checkExisting(exportObjectNames(basePrefix, tableNames, ignoredTables,
+			GetQueriesConfiguration(configuration)))
+		if err != nil {
+			log.Err(err).Msg(operationFailedMessage)
+			operationLogger.Err(err).Msg(operationFailedMessage)
+			return ExitStatusIOError, err
+		}
+	}
+
 	// log into terminal
 	printTables(tableNames)
 
-	s3config := GetS3Configuration(configuration)
-	bucket, bucketPrefix := s3config.Bucket, s3config.Prefix
-	log.Info().Str("bucket name", bucket).Msg("S3 bucket to write to")
-	listOfTablesObject := setObjectPrefix(bucketPrefix, listOfTables)
-	metadataTableObject := setObjectPrefix(bucketPrefix, metadataTable)
+	// schema drift is checked before any data is written
+	exitStatus, err := checkSchemaDrift(ctx, configuration, storage, tableNames, ignoredTables,
+		cliFlags.AcceptSchemaDrift,
+		func(name string) ([]byte, bool, error) {
+			return sink.Read(ctx, setObjectPrefix(basePrefix, name))
+		},
+		func(name string, write func(io.Writer) error) error {
+			return storeIntoSink(ctx, sink, setObjectPrefix(basePrefix, name),
+				contentTypeJSON, write)
+		},
+		operationLogger)
+	if err != nil {
+		return exitStatus, err
+	}
 
-	if exportMetadata {
+	if cliFlags.ExportMetadata {
 		operationLogger.Info().Msg(exportingMetadata)
 
-		// export list of all tables into S3
-		err = storeTableNames(context, minioClient,
-			bucket, listOfTablesObject, tableNames)
+		// export list of all tables
+		err = storeTableNames(ctx, sink, setObjectPrefix(basePrefix, listOfTables), tableNames)
 		if err != nil {
-			const msg = "Store table list to S3 failed"
+			const msg = "Store table list failed"
 			log.Err(err).Msg(msg)
 			operationLogger.Err(err).Msg(msg)
 			return ExitStatusStorageError, err
 		}
 
-		// export tables metadata into S3
-		err = storage.StoreTableMetadataIntoS3(context, minioClient,
-			bucket, metadataTableObject, tableNames)
+		// export tables metadata
+		err = storage.StoreTableMetadata(ctx, sink, setObjectPrefix(basePrefix, metadataTable), tableNames)
 		if err != nil {
-			const msg = "Store tables metadata to S3 failed"
+			const msg = "Store tables metadata failed"
 			log.Err(err).Msg(msg)
+			operationLogger.Err(err).Msg(msg)
+			return ExitStatusStorageError, err
+		}
+	}
+
+	if cliFlags.ExportSchema || cliFlags.ExportSchemaSQL {
+		operationLogger.Info().Msg(exportingSchema)
+
+		schema, err := storage.ReadSchema(ctx, tableNames, ignoredTables)
+		if err != nil {
+			log.Err(err).Msg(readSchemaFailed)
+			operationLogger.Err(err).Msg(readSchemaFailed)
 			return ExitStatusStorageError, err
 		}
+
+		err = storeSchema(ctx, sink, setObjectPrefix(basePrefix, schemaInfo), schema)
+		if err == nil && cliFlags.ExportSchemaSQL {
+			err = storeSchemaDDL(ctx, sink, setObjectPrefix(basePrefix, schemaDDL), schema)
+		}
+		if err != nil {
+			log.Err(err).Msg(storeSchemaFailed)
+			operationLogger.Err(err).Msg(storeSchemaFailed)
+			return ExitStatusIOError, err
+		}
 	}
 
-	if exportDisabledRules {
+	if cliFlags.ExportDisabledRules {
 		operationLogger.Info().Msg(exportingDisabledRules)
 
-		// export rules disabled by more users into CSV file
-		disabledRulesInfo, err := storage.ReadDisabledRules()
+		// export rules disabled by more users into CSV file, report
+		// stored by previous export is used to compute trend
+		disabledRulesInfo, err := storage.readDisabledRulesReport(ctx, configuration,
+			func(name string) ([]byte, bool, error) {
+				return sink.Read(ctx, name)
+			})
 		if err != nil {
 			log.Err(err).Msg(readDisabledRulesInfoFailed)
 			operationLogger.Err(err).Msg(readDisabledRulesInfoFailed)
@@ -264,120 +534,217 @@ func performDataExportToS3(configuration *ConfigStruct,
 		}
 
 		// export list of disabled rules
-		err = storeDisabledRulesIntoS3(context, minioClient, bucket,
-			disabledRules, disabledRulesInfo)
+		err = storeDisabledRules(ctx, sink, disabledRules, disabledRulesInfo)
 		if err != nil {
-			log.Err(err).Msg(storeDisabledRulesIntoFileFailed)
-			operationLogger.Err(err).Msg(storeDisabledRulesIntoFileFailed)
+			log.Err(err).Msg(storeDisabledRulesFailed)
+			operationLogger.Err(err).Msg(storeDisabledRulesFailed)
 			return ExitStatusIOError, err
 		}
 	}
 
-	operationLogger.Info().Msg(exportingTables)
+	if cliFlags.ExportRuleHitsSummary {
+		operationLogger.Info().Msg(exportingRuleHitsSummary)
 
-	// read content of all tables and perform export
-	for _, tableName := range tableNames {
-		// ignore table if specified by user
-		if _, found := ignoredTables[string(tableName)]; found {
-			operationLogger.Info().
-				Str(tableNameMsg, string(tableName)).
-				Msg(tableIsIgnored)
-			continue
-		}
-		operationLogger.Info().
-			Str(tableNameMsg, string(tableName)).
-			Msg(exportingTable)
-		err = storage.StoreTable(context, minioClient, bucket, bucketPrefix, tableName, limit)
+		// analytics derived from rule_hit and report tables
+		summary, err := storage.ReadRuleHitsSummary(ctx)
 		if err != nil {
-			const msg = "Store table into S3 failed"
-			log.Err(err).Str(tableNameMsg, string(tableName)).
-				Msg(msg)
-			operationLogger.Err(err).Str(tableNameMsg, string(tableName)).
-				Msg(msg)
+			log.Err(err).Msg(readRuleHitsSummaryFailed)
+			operationLogger.Err(err).Msg(readRuleHitsSummaryFailed)
 			return ExitStatusStorageError, err
 		}
+
+		err = storeRuleHitsSummary(ctx, sink, ruleHitsCSV, ruleHitsJSON, summary)
+		if err != nil {
+			log.Err(err).Msg(storeRuleHitsSummaryFailed)
+			operationLogger.Err(err).Msg(storeRuleHitsSummaryFailed)
+			return ExitStatusIOError, err
+		}
 	}
 
-	operationLogger.Info().Msg(closingConnectionToStorage)
+	if cliFlags.ExportFeedbackSummary {
+		operationLogger.Info().Msg(exportingFeedbackSummary)
 
-	// we have finished, let's close the connection to database
-	err = storage.Close()
-	if err != nil {
-		log.Err(err).Msg(operationFailedMessage)
-		operationLogger.Err(err).Msg(operationFailedMessage)
-		return ExitStatusStorageError, err
-	}
+		// aggregated ratings and votes, optionally joined with disabled
+		// rules
+		summary, err := storage.ReadFeedbackSummary(ctx, configuration,
+			cliFlags.FeedbackWithDisabledRules)
+		if err != nil {
+			log.Err(err).Msg(readFeedbackSummaryFailed)
+			operationLogger.Err(err).Msg(readFeedbackSummaryFailed)
+			return ExitStatusStorageError, err
+		}
 
-	// default exit value + no error
-	return ExitStatusOK, nil
-}
+		// format has been checked already
+		fileName, _ := feedbackFileName(cliFlags.FeedbackFormat)
+		err = storeFeedbackSummary(ctx, sink, fileName, cliFlags.FeedbackFormat, summary)
+		if err != nil {
+			log.Err(err).Msg(storeFeedbackSummaryFailed)
+			operationLogger.Err(err).Msg(storeFeedbackSummaryFailed)
+			return ExitStatusIOError, err
+		}
+	}
 
-// performDataExportToFiles exports all tables and metadata info files
-func performDataExportToFiles(_ *ConfigStruct,
-	storage *DBStorage, exportMetadata bool,
-	exportDisabledRules bool,
-	operationLogger *zerolog.Logger, limit int,
-	ignoredTables IgnoredTables) (int, error) {
-	operationLogger.Info().Msg("Exporting to file")
+	if cliFlags.FlattenReports {
+		operationLogger.Info().Msg(flatteningReports)
 
-	operationLogger.Info().Msg(readingListOfTables)
+		// rule results parsed from reports, streamed next to tables
+		flattening, err := storage.FlattenReports(ctx, sink, basePrefix)
+		if err != nil {
+			log.Err(err).Msg(flattenReportsFailed)
+			operationLogger.Err(err).Msg(flattenReportsFailed)
+			return ExitStatusStorageError, err
+		}
+		operationLogger.Info().
+			Int(unparsableReportCount, flattening.Unparsable).
+			Msg(flatteningReports)
 
-	tableNames, err := storage.ReadListOfTables()
-	if err != nil {
-		log.Err(err).Msg(operationFailedMessage)
-		operationLogger.Err(err).Msg(operationFailedMessage)
-		return ExitStatusStorageError, err
+		// summary is stored last so it marks complete set of flattened objects
+		err = storeFlatteningSummary(ctx, sink, setObjectPrefix(basePrefix, flattenedSummary), flattening)
+		if err != nil {
+			log.Err(err).Msg(storeFlattenedFailed)
+			operationLogger.Err(err).Msg(storeFlattenedFailed)
+			return ExitStatusIOError, err
+		}
 	}
 
-	log.Info().Int("count", len(tableNames)).Msg(listOfTablesMsg)
+	if storage.sampling.Enabled() {
+		// record sampling parameters so the sample can be reproduced
+		err = storeSampling(ctx, sink, setObjectPrefix(basePrefix, samplingInfo), storage.sampling)
+		if err != nil {
+			log.Err(err).Msg(storeSamplingInfoFailed)
+			operationLogger.Err(err).Msg(storeSamplingInfoFailed)
+			return ExitStatusIOError, err
+		}
+	}
 
-	// log into terminal
-	printTables(tableNames)
+	operationLogger.Info().Msg(exportingTables)
 
-	if exportMetadata {
-		operationLogger.Info().Msg(exportingMetadata)
+	failures := NewExportFailures(cliFlags.ContinueOnError)
+	exported := make([]ExportedTable, 0)
 
-		// export list of all tables into CSV file
-		err = storeTableNamesIntoFile(listOfTables, tableNames)
+	storeTable := func(storage DBStorage, prefix string, tableName TableName) error {
+		if interruption.Stopped() {
+			return errExportStopped
+		}
+		tableContext, span := startTableSpan(ctx, prefix, tableName)
+		started := time.Now()
+		err := storage.StoreTable(tableContext, sink, prefix, tableName, cliFlags.Limit)
+		summary.Add(tableName, prefix, storage.Stats(prefix, tableName),
+			time.Since(started), err)
+		endTableSpan(span, storage.Stats(prefix, tableName), err)
 		if err != nil {
-			const msg = "Store table list to file failed"
+			const msg = "Store table failed"
+			log.Err(err).Str(tableNameMsg, string(tableName)).Msg(msg)
+			operationLogger.Err(err).Str(tableNameMsg, string(tableName)).Msg(msg)
+		} else {
+			exported = append(exported, ExportedTable{tableName, prefix})
+		}
+		logTableRetries(storage, tableName, operationLogger)
+		return failures.Record(tableName, prefix, err)
+	}
+
+	if cliFlags.PartitionByOrg {
+		counts, err := storePartitionedTables(ctx, *storage, tableNames,
+			ignoredTables, basePrefix, cliFlags.ExportMetadata,
+			storeTable, operationLogger)
+		if err != nil && !interruption.Stopped() {
+			const msg = "Store partitioned tables failed"
 			log.Err(err).Msg(msg)
 			operationLogger.Err(err).Msg(msg)
 			return ExitStatusStorageError, err
 		}
 
-		// export tables metadata into CSV file
-		err = storage.StoreTableMetadataIntoFile(metadataTable, tableNames)
-		if err != nil {
-			const msg = "Store tables metadata to file failed"
-			log.Err(err).Msg(msg)
-			operationLogger.Err(err).Msg(msg)
+		if cliFlags.ExportMetadata && !interruption.Stopped() {
+			err = storePartitions(ctx, sink, setObjectPrefix(basePrefix, partitionsInfo), counts)
+			if err != nil {
+				log.Err(err).Msg(storePartitionsFailed)
+				operationLogger.Err(err).Msg(storePartitionsFailed)
+				return ExitStatusIOError, err
+			}
+		}
+	} else {
+		err = storeTables(*storage, tableNames, ignoredTables,
+			basePrefix, storeTable, operationLogger)
+		if err != nil && !interruption.Stopped() {
 			return ExitStatusStorageError, err
 		}
 	}
 
-	if exportDisabledRules {
-		operationLogger.Info().Msg(exportingDisabledRules)
+	// results of user-defined queries are stored next to tables
+	storeQuery := func(storage DBStorage, prefix string, query QueryConfiguration) error {
+		if interruption.Stopped() {
+			return errExportStopped
+		}
+		name := TableName(query.Name)
+		queryContext, span := startTableSpan(ctx, prefix, name)
+		started := time.Now()
+		err := storage.StoreQuery(queryContext, sink, prefix, query)
+		summary.Add(name, prefix, storage.Stats(prefix, name),
+			time.Since(started), err)
+		endTableSpan(span, storage.Stats(prefix, name), err)
+		if err != nil {
+			const msg = "Store query result failed"
+			log.Err(err).Str(queryNameMsg, query.Name).Msg(msg)
+			operationLogger.Err(err).Str(queryNameMsg, query.Name).Msg(msg)
+		} else {
+			exported = append(exported, ExportedTable{name, prefix})
+		}
+		logTableRetries(storage, name, operationLogger)
+		return failures.Record(name, prefix, err)
+	}
+
+	err = storeQueries(*storage, GetQueriesConfiguration(configuration), basePrefix,
+		storeQuery, operationLogger)
+	if err != nil && !interruption.Stopped() {
+		return ExitStatusStorageError, err
+	}
+
+	// reports need to be stored even when export has been cancelled
+	reportContext := context.WithoutCancel(ctx)
 
-		// export rules disabled by more users into CSV file
-		disabledRulesInfo, err := storage.ReadDisabledRules()
+	if storage.profiles != nil {
+		err = storeProfiles(reportContext, sink, setObjectPrefix(basePrefix, profileInfo), storage.profiles)
 		if err != nil {
-			log.Err(err).Msg(readDisabledRulesInfoFailed)
-			operationLogger.Err(err).Msg(readDisabledRulesInfoFailed)
-			return ExitStatusStorageError, err
+			log.Err(err).Msg(storeProfileFailed)
+			operationLogger.Err(err).Msg(storeProfileFailed)
+			return ExitStatusIOError, err
 		}
+	}
 
-		// export list of disabled rules
-		err = storeDisabledRulesIntoFile(disabledRules, disabledRulesInfo)
+	if failures.Any() {
+		err = storeFailures(reportContext, sink, setObjectPrefix(basePrefix, failuresInfo),
+			failures.Failures())
 		if err != nil {
-			log.Err(err).Msg(storeDisabledRulesIntoFileFailed)
-			operationLogger.Err(err).Msg(storeDisabledRulesIntoFileFailed)
+			log.Err(err).Msg(storeFailuresFailed)
+			operationLogger.Err(err).Msg(storeFailuresFailed)
 			return ExitStatusIOError, err
 		}
 	}
 
-	operationLogger.Info().Msg(exportingTables)
+	if interruption.Stopped() {
+		err = storeIncomplete(reportContext, sink, setObjectPrefix(basePrefix, incompleteInfo),
+			newIncompleteRun(interruption, exported))
+		if err != nil {
+			log.Err(err).Msg(storeIncompleteFailed)
+			operationLogger.Err(err).Msg(storeIncompleteFailed)
+			return ExitStatusIOError, err
+		}
+		return incomplete(interruption, operationLogger)
+	}
 
+	if failures.Any() {
+		return partialSuccess(failures, exported, operationLogger)
+	}
+
+	// default exit value + no error
+	return ExitStatusOK, nil
+}
+
+// storeTables function stores all tables that are not ignored under given
+// prefix (directory or prefix of S3 object).
+func storeTables(storage DBStorage, tableNames []TableName,
+	ignoredTables IgnoredTables, prefix string, storeTable tableStorer,
+	operationLogger *zerolog.Logger) error {
 	// read content of all tables and perform export
 	for _, tableName := range tableNames {
 		// ignore table if specified by user
@@ -390,29 +757,59 @@ func performDataExportToFiles(_ *ConfigStruct,
 		operationLogger.Info().
 			Str(tableNameMsg, string(tableName)).
 			Msg(exportingTable)
-		err = storage.StoreTableIntoFile(tableName, limit)
+		err := storeTable(storage, prefix, tableName)
 		if err != nil {
-			const msg = "Store table into file failed"
-			log.Err(err).Str(tableNameMsg, string(tableName)).
-				Msg(msg)
-			operationLogger.Err(err).Str(tableNameMsg, string(tableName)).
-				Msg(msg)
-			return ExitStatusStorageError, err
+			return err
 		}
 	}
+	return nil
+}
+
+// logTableRetries function records number of retries performed for given
+// table into operation log.
+func logTableRetries(storage DBStorage, tableName TableName, operationLogger *zerolog.Logger) {
+	operationLogger.Info().
+		Str(tableNameMsg, string(tableName)).
+		Int(retriesMsg, storage.Retries(tableName)).
+		Msg("Table export finished")
+}
+
+// partialSuccess function reports tables that were not exported in
+// continue-on-error mode. Export where no table was exported is reported as
+// failed, so it can be distinguished from partial degradation.
+func partialSuccess(failures *ExportFailures, exported []ExportedTable,
+	operationLogger *zerolog.Logger) (int, error) {
+	if len(exported) == 0 {
+		err := errors.New(nothingExported)
+		log.Err(err).Int("failed tables", len(failures.Failures())).Msg(operationFailedMessage)
+		operationLogger.Err(err).Int("failed tables", len(failures.Failures())).Msg(operationFailedMessage)
+		return ExitStatusStorageError, err
+	}
+
+	log.Warn().Int("failed tables", len(failures.Failures())).Msg(exportPartiallyDone)
+	operationLogger.Warn().Int("failed tables", len(failures.Failures())).Msg(exportPartiallyDone)
+	return ExitStatusPartialSuccess, nil
+}
 
+// printSummary function prints summary table into standard output.
+func printSummary(summary *ExportSummary) {
+	err := PrintSummaryTable(os.Stdout, summary)
+	if err != nil {
+		log.Err(err).Msg(printSummaryFailed)
+	}
+}
+
+// closeStorage function closes connection to storage.
+func closeStorage(storage *DBStorage, operationLogger *zerolog.Logger) error {
 	operationLogger.Info().Msg(closingConnectionToStorage)
 
 	// we have finished, let's close the connection to database
-	err = storage.Close()
+	err := storage.Close()
 	if err != nil {
 		log.Err(err).Msg(operationFailedMessage)
 		operationLogger.Err(err).Msg(operationFailedMessage)
-		return ExitStatusStorageError, err
 	}
-
-	// default exit value + no error
-	return ExitStatusOK, nil
+	return err
 }
 
 func printTables(tableNames []TableName) {
@@ -424,44 +821,40 @@ func printTables(tableNames []TableName) {
 // checkS3Connection checks if connection to S3 is possible
 func checkS3Connection(configuration *ConfigStruct) (int, error) {
 	log.Info().Msg("Checking connection to S3")
-	minioClient, context, err := NewS3Connection(configuration)
+	minioClient, err := NewS3Connection(configuration)
 	if err != nil {
 		return ExitStatusS3Error, err
 	}
 
-	exists, err := s3BucketExists(context, minioClient, GetS3Configuration(configuration).Bucket)
+	ctx := context.Background()
+
+	exists, err := s3BucketExists(ctx, minioClient, GetS3Configuration(configuration).Bucket)
 	if err != nil {
 		return ExitStatusS3Error, err
 	}
 
 	if !exists {
-		log.Error().Msg("Can not find expected bucket")
-	} else {
-		log.Info().Msg("Bucket has been found")
+		err := fmt.Errorf(bucketNotFound, GetS3Configuration(configuration).Bucket)
+		log.Error().Err(err).Msg("Can not find expected bucket")
+		return ExitStatusS3Error, err
 	}
+	log.Info().Msg("Bucket has been found")
 
 	log.Info().Msg("Connection to S3 seems to be ok")
 	return ExitStatusOK, nil
 }
 
-func storeOpertionLogIntoS3(configuration *ConfigStruct,
-	buffer bytes.Buffer) error {
-	minioClient, context, err := NewS3Connection(configuration)
-	if err != nil {
-		return err
-	}
-
-	s3config := GetS3Configuration(configuration)
-	bucketName, bucketPrefix := s3config.Bucket, s3config.Prefix
-	logFileObject := setObjectPrefix(bucketPrefix, logFile)
-	return storeBufferToS3(context, minioClient, bucketName, logFileObject, buffer)
-}
-
 // doSelectedOperation function perform operation selected on command line.
 // When no operation is specified, the Notification writer service is started
 // instead.
 func doSelectedOperation(configuration *ConfigStruct, cliFlags CliFlags,
-	operationLogger *zerolog.Logger) (int, error) {
+	operationLogger *zerolog.Logger, runMetrics *RunMetrics) (int, error) {
+	err := checkConflictingFlags(cliFlags)
+	if err != nil {
+		log.Err(err).Msg(operationFailedMessage)
+		return ExitStatusConfigurationError, err
+	}
+
 	switch {
 	case cliFlags.ShowVersion:
 		showVersion()
@@ -474,33 +867,15 @@ func doSelectedOperation(configuration *ConfigStruct, cliFlags CliFlags,
 		return ExitStatusOK, nil
 	case cliFlags.CheckS3Connection:
 		return checkS3Connection(configuration)
+	case cliFlags.Preflight:
+		return runPreflight(configuration, cliFlags, os.Stdout)
 	default:
 		// default operation - data export
-		return performDataExport(configuration, cliFlags, operationLogger)
+		return performDataExport(configuration, cliFlags, operationLogger, runMetrics)
 	}
 	// this can not happen: return ExitStatusOK, nil
 }
 
-func parseFlags() (cliFlags CliFlags) {
-	// define and parse all command line options
-	flag.BoolVar(&cliFlags.ShowVersion, "version", false, "show version")
-	flag.BoolVar(&cliFlags.ShowAuthors, "authors", false, "show authors")
-	flag.BoolVar(&cliFlags.ShowConfiguration, "show-configuration", false, "show configuration")
-	flag.BoolVar(&cliFlags.PrintSummaryTable, "summary", false, "print summary table after export")
-	flag.StringVar(&cliFlags.Output, "output", "S3", "output to: file, S3")
-	flag.BoolVar(&cliFlags.ExportMetadata, "metadata", false, "export metadata")
-	flag.BoolVar(&cliFlags.ExportDisabledRules, "disabled-by-more-users", false, "export rules disabled by more users")
-	flag.BoolVar(&cliFlags.CheckS3Connection, "check-s3-connection", false, "check S3 connection and exit")
-	flag.BoolVar(&cliFlags.ExportLog, "export-log", false, "export log")
-	flag.IntVar(&cliFlags.Limit, "limit", -1, "limit number of exported records")
-	flag.StringVar(&cliFlags.IgnoredTables, "ignore-tables", "", "comma-separated list of tables that will be ignored")
-
-	// parse all command line flags
-	flag.Parse()
-
-	return
-}
-
 // DummyWriter satisfies Writer interface, but with noop write
 type DummyWriter struct{}
 
@@ -509,30 +884,31 @@ func (w DummyWriter) Write(_ []byte) (n int, err error) {
 	return 0, nil
 }
 
-// createOperationLog function constructs operation log instance
-func createOperationLog(cliFlags CliFlags, buffer *bytes.Buffer) (zerolog.Logger, error) {
-	dummyLogger := zerolog.New(DummyWriter{}).With().Logger()
-
-	if cliFlags.ExportLog {
-		switch cliFlags.Output {
-		case s3Output:
-			memoryLogger := zerolog.New(buffer).With().Logger()
-			memoryLogger.Info().Msg("Memory logger initialized")
-			return memoryLogger, nil
-		case fileOutput:
-			logFile, err := os.Create(logFile)
-			if err != nil {
-				return dummyLogger, err
-			}
-			fileLogger := zerolog.New(logFile).With().Logger()
-			fileLogger.Info().Msg("File logger initialized")
-			return fileLogger, nil
-		default:
-			return dummyLogger, fmt.Errorf(unknownOutputType, cliFlags.Output)
-		}
+// exportObjectNames function returns names of objects the export might
+// store, except objects of partitions that are not known in advance.
+func exportObjectNames(prefix string, tableNames []TableName, ignoredTables IgnoredTables,
+	queries []QueryConfiguration) []string {
+	names := []string{
+		listOfTables, metadataTable, disabledRules, ruleHitsCSV, ruleHitsJSON,
+		samplingInfo, partitionsInfo, failuresInfo, incompleteInfo, summaryInfo,
+		schemaInfo, schemaDDL, profileInfo, columnsInfo, driftInfo,
+		feedbackSummary + "." + feedbackFormatCSV,
+		feedbackSummary + "." + feedbackFormatJSON,
+		flattenedRules, flattenedInfo, flattenedPasses, flattenedSkips, flattenedSummary,
+	}
+	for i, name := range names {
+		names[i] = setObjectPrefix(prefix, name)
 	}
 
-	return dummyLogger, nil
+	for _, tableName := range tableNames {
+		if _, found := ignoredTables[string(tableName)]; !found {
+			names = append(names, setObjectPrefix(prefix, string(tableName))+CSVFileExtension)
+		}
+	}
+	for _, query := range queries {
+		names = append(names, setObjectPrefix(prefix, query.fileName()))
+	}
+	return names
 }
 
 func setObjectPrefix(prefix, object string) string {
@@ -543,8 +919,15 @@ func setObjectPrefix(prefix, object string) string {
 }
 
 func mainWithStatusCode() int {
-	// parse all command line flags
-	cliFlags := parseFlags()
+	// select subcommand and parse its flags and arguments
+	command, cliFlags, args, err := parseCommandLine(os.Args[1:], os.Stderr)
+	if errors.Is(err, flag.ErrHelp) {
+		return ExitStatusOK
+	}
+	if err != nil {
+		log.Err(err).Msg("Parse command line")
+		return ExitStatusConfigurationError
+	}
 
 	// config has exactly the same structure as *.toml file
 	config, err := LoadConfiguration(configFileEnvVariableName, defaultConfigFileName)
@@ -560,30 +943,39 @@ func mainWithStatusCode() int {
 
 	defer loggingCloser()
 
-	var buffer bytes.Buffer
-	operationLogger, err := createOperationLog(cliFlags, &buffer)
+	// all files of the run are written into the same output directory
+	runID := newRunID()
+	cliFlags.OutputDir = GetFileConfiguration(&config).outputDirectory(cliFlags.OutputDir, runID)
+
+	operationLog, err := NewOperationLog(cliFlags, GetOperationLogConfiguration(&config), runID)
 	if err != nil {
 		log.Err(err).Msg("Create operation log")
 		return ExitStatusIOError
 	}
+	log.Info().Str(runIDMsg, operationLog.RunID).Msg("Run started")
 
 	// perform selected operation
-	exitStatus, err := doSelectedOperation(&config, cliFlags, &operationLogger)
+	started := time.Now()
+	runMetrics := &RunMetrics{}
+	exitStatus, err := command.run(&config, cliFlags, args, os.Stdout, &operationLog.Logger, runMetrics)
 	if err != nil {
 		log.Err(err).Msg("Do selected operation")
-		return exitStatus
 	}
 
-	if cliFlags.ExportLog && cliFlags.Output == s3Output {
-		err := storeOpertionLogIntoS3(&config, buffer)
-		if err != nil {
-			log.Err(err).Msg("Storing log into S3 failed")
-			return ExitStatusS3Error
-		}
+	// operation log is stored even when the operation failed
+	logStatus, logErr := finishOperationLog(&config, cliFlags, operationLog, exitStatus, err)
+	if err == nil && logErr != nil {
+		exitStatus = logStatus
 	}
 
-	log.Debug().Msg("Finished")
-	return ExitStatusOK
+	// metrics are pushed at the end of every export, successful or not,
+	// with the final exit status of the run
+	_ = pushRunMetrics(&config, runMetrics, started, exitStatus)
+
+	if err == nil && logErr == nil {
+		log.Debug().Msg("Finished")
+	}
+	return exitStatus
 }
 
 func main() {
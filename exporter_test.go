@@ -27,6 +27,7 @@ package main_test
 
 import (
 	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/rs/zerolog"
@@ -114,7 +115,7 @@ func TestDoSelectedOperationShowVersion(t *testing.T) {
 
 	// try to call the tested function and capture its output
 	output, err := capture.StandardOutput(func() {
-		code, err := main.DoSelectedOperation(&configuration, cliFlags, &log.Logger)
+		code, err := main.DoSelectedOperation(&configuration, cliFlags, &log.Logger, nil)
 		assert.Equal(t, code, main.ExitStatusOK)
 		assert.Nil(t, err)
 	})
@@ -138,7 +139,7 @@ func TestDoSelectedOperationShowAuthors(t *testing.T) {
 
 	// try to call the tested function and capture its output
 	output, err := capture.StandardOutput(func() {
-		code, err := main.DoSelectedOperation(&configuration, cliFlags, &log.Logger)
+		code, err := main.DoSelectedOperation(&configuration, cliFlags, &log.Logger, nil)
 		assert.Equal(t, code, main.ExitStatusOK)
 		assert.Nil(t, err)
 	})
@@ -164,7 +165,7 @@ func TestDoSelectedOperationShowConfiguration(t *testing.T) {
 	// try to call the tested function and capture its output
 	output, err := capture.ErrorOutput(func() {
 		log.Logger = log.Output(zerolog.New(os.Stderr))
-		code, err := main.DoSelectedOperation(&configuration, cliFlags, &log.Logger)
+		code, err := main.DoSelectedOperation(&configuration, cliFlags, &log.Logger, nil)
 		assert.Equal(t, code, main.ExitStatusOK)
 		assert.Nil(t, err)
 	})
@@ -177,6 +178,28 @@ func TestDoSelectedOperationShowConfiguration(t *testing.T) {
 	assert.Contains(t, output, expectedConfigurationMessage3)
 }
 
+// TestShowConfigurationRedactsSecrets checks that password and secret
+// access key are not written into logs
+func TestShowConfigurationRedactsSecrets(t *testing.T) {
+	configuration := main.ConfigStruct{
+		Storage: main.StorageConfiguration{PGPassword: "super-secret-pg-password"},
+		S3:      main.S3Configuration{SecretAccessKey: "super-secret-access-key"},
+	}
+
+	origLogger := log.Logger
+	t.Cleanup(func() { log.Logger = origLogger })
+
+	output, err := capture.ErrorOutput(func() {
+		log.Logger = log.Output(zerolog.New(os.Stderr))
+		main.ShowConfiguration(&configuration)
+	})
+	checkCapture(t, err)
+
+	assert.NotContains(t, output, "super-secret-pg-password")
+	assert.NotContains(t, output, "super-secret-access-key")
+	assert.Contains(t, output, "***")
+}
+
 // TestDoSelectedOperationCheckS3Connection checks the function
 // checkS3Connection called via doSelectedOperation function
 func TestDoSelectedOperationCheckS3Connection(t *testing.T) {
@@ -189,7 +212,7 @@ func TestDoSelectedOperationCheckS3Connection(t *testing.T) {
 		CheckS3Connection: true,
 	}
 
-	code, err := main.DoSelectedOperation(&configuration, cliFlags, &log.Logger)
+	code, err := main.DoSelectedOperation(&configuration, cliFlags, &log.Logger, nil)
 	assert.Equal(t, code, main.ExitStatusS3Error)
 	assert.Error(t, err)
 }
@@ -215,12 +238,6 @@ func TestPrintTables(t *testing.T) {
 	assert.Contains(t, output, "\\\"table\\\":\\\"third\\\"")
 }
 
-// TestParseFlags is dummy test for parseFlags function
-func TestParseFlags(t *testing.T) {
-	flags := main.ParseFlags()
-	assert.NotNil(t, flags)
-}
-
 // TestPerformDataExportViaDoSelectedOperation checks the function
 // performDataExport.
 func TestPerformDataExportViaDoSelectedOperation(t *testing.T) {
@@ -237,7 +254,7 @@ func TestPerformDataExportViaDoSelectedOperation(t *testing.T) {
 	}
 
 	// the call should fail
-	code, err := main.DoSelectedOperation(&configuration, cliFlags, &log.Logger)
+	code, err := main.DoSelectedOperation(&configuration, cliFlags, &log.Logger, nil)
 	assert.Equal(t, code, main.ExitStatusStorageError)
 	assert.Error(t, err)
 }
@@ -269,7 +286,7 @@ func TestPerformDataExportNoStorage(t *testing.T) {
 	}
 
 	// the call should fail
-	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger)
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
 	assert.Equal(t, code, main.ExitStatusStorageError)
 	assert.Error(t, err)
 }
@@ -280,18 +297,21 @@ func TestPerformDataExportConfigError(t *testing.T) {
 	// but DB connection is specified
 	configuration := main.ConfigStruct{
 		main.StorageConfiguration{
-			Driver:        "postgres",
-			PGUsername:    "user",
-			PGPassword:    "password",
-			PGHost:        "nowhere",
-			PGPort:        1234,
-			PGDBName:      "test",
-			PGParams:      "",
-			LogSQLQueries: true,
+			Driver:           "sqlite3",
+			SQLiteDataSource: ":memory:",
+			LogSQLQueries:    true,
 		},
 		main.S3Configuration{},
 		main.LoggingConfiguration{},
 		main.SentryConfiguration{},
+		main.RetryConfiguration{},
+		main.MetricsConfiguration{},
+		main.TracingConfiguration{},
+		main.OperationLogConfiguration{},
+		main.SchemaDriftConfiguration{},
+		main.DisabledRulesConfiguration{},
+		nil,
+		main.FileConfiguration{},
 	}
 
 	// default operation is export data
@@ -303,7 +323,7 @@ func TestPerformDataExportConfigError(t *testing.T) {
 	}
 
 	// the call should fail, but now because of improper configuration
-	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger)
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
 	assert.Equal(t, code, main.ExitStatusConfigurationError)
 	assert.Error(t, err)
 }
@@ -314,18 +334,21 @@ func TestPerformDataExportToS3(t *testing.T) {
 	// but DB connection is specified
 	configuration := main.ConfigStruct{
 		main.StorageConfiguration{
-			Driver:        "postgres",
-			PGUsername:    "user",
-			PGPassword:    "password",
-			PGHost:        "nowhere",
-			PGPort:        1234,
-			PGDBName:      "test",
-			PGParams:      "",
-			LogSQLQueries: true,
+			Driver:           "sqlite3",
+			SQLiteDataSource: ":memory:",
+			LogSQLQueries:    true,
 		},
 		main.S3Configuration{},
 		main.LoggingConfiguration{},
 		main.SentryConfiguration{},
+		main.RetryConfiguration{},
+		main.MetricsConfiguration{},
+		main.TracingConfiguration{},
+		main.OperationLogConfiguration{},
+		main.SchemaDriftConfiguration{},
+		main.DisabledRulesConfiguration{},
+		nil,
+		main.FileConfiguration{},
 	}
 
 	// default operation is export data
@@ -338,7 +361,7 @@ func TestPerformDataExportToS3(t *testing.T) {
 	}
 
 	// the call should fail due to inaccessible S3/Minio
-	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger)
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
 	assert.Equal(t, code, main.ExitStatusS3Error)
 	assert.Error(t, err)
 }
@@ -361,6 +384,14 @@ func TestPerformDataExportToFile(t *testing.T) {
 		main.S3Configuration{},
 		main.LoggingConfiguration{},
 		main.SentryConfiguration{},
+		main.RetryConfiguration{},
+		main.MetricsConfiguration{},
+		main.TracingConfiguration{},
+		main.OperationLogConfiguration{},
+		main.SchemaDriftConfiguration{},
+		main.DisabledRulesConfiguration{},
+		nil,
+		main.FileConfiguration{},
 	}
 
 	// default operation is export data
@@ -373,11 +404,40 @@ func TestPerformDataExportToFile(t *testing.T) {
 	}
 
 	// the call should fail due to inaccessible storage (DB)
-	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger)
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
 	assert.Equal(t, code, main.ExitStatusStorageError)
 	assert.Error(t, err)
 }
 
+// TestPerformDataExportExistingFiles checks that export into directory that
+// holds previous export fails before anything is written
+func TestPerformDataExportExistingFiles(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareSQLiteDatabase(t, directory,
+		"CREATE TABLE first (id INTEGER PRIMARY KEY)",
+		"CREATE TABLE second (id INTEGER PRIMARY KEY)")
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output: "file",
+		Limit:  NoLimits,
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	// previous export is kept as a whole
+	assert.NoError(t, os.Remove(filepath.Join(directory, "first.csv")))
+	assert.NoError(t, os.WriteFile(filepath.Join(directory, "second.csv"), []byte("previous\n"), 0o600))
+
+	code, err = main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.EqualError(t, err, "file second.csv already exists, use -force to overwrite it")
+	assert.Equal(t, main.ExitStatusIOError, code)
+	assert.NoFileExists(t, filepath.Join(directory, "first.csv"))
+	checkFileContent(t, filepath.Join(directory, "second.csv"), "previous\n")
+}
+
 // TestConstructIgnoreTableMapEmptyInput checks the function
 // constructIgnoredTablesMap for empty input.
 func TestConstructIgnoreTableMapEmptyInput(t *testing.T) {
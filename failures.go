@@ -0,0 +1,106 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains support for continue-on-error mode. In this
+// mode, failure of one table does not stop the export. Instead, all
+// failures are recorded and reported in _failures.json file or object.
+// Failures of metadata, schema and other reports still stop the export.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/failures.html
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+)
+
+// Messages
+const (
+	storeFailuresFailed = "Store failures report failed"
+	exportPartiallyDone = "Export finished, but some tables were not exported"
+	nothingExported     = "no table has been exported"
+)
+
+// TableFailure represents export of one table that failed.
+type TableFailure struct {
+	// TableName is name of table that was not exported
+	TableName TableName `json:"table"`
+
+	// Prefix is a directory or prefix of S3 object the table was exported
+	// into (it differs for each partition)
+	Prefix string `json:"prefix,omitempty"`
+
+	// Error is textual representation of error that occurred
+	Error string `json:"error"`
+}
+
+// ExportFailures collects failures that occurred during export.
+type ExportFailures struct {
+	continueOnError bool
+	failures        []TableFailure
+}
+
+// NewExportFailures function constructs new collector of failures. When
+// continueOnError is not set, no failure is collected.
+func NewExportFailures(continueOnError bool) *ExportFailures {
+	return &ExportFailures{
+		continueOnError: continueOnError,
+		failures:        make([]TableFailure, 0),
+	}
+}
+
+// Record method records failure of given table. Error is returned back when
+// continue-on-error mode is not enabled, so the export can be stopped.
+func (failures *ExportFailures) Record(tableName TableName, prefix string, err error) error {
+	if err == nil || !failures.continueOnError {
+		return err
+	}
+
+	failures.failures = append(failures.failures, TableFailure{
+		TableName: tableName,
+		Prefix:    prefix,
+		Error:     err.Error(),
+	})
+	return nil
+}
+
+// Failures method returns all recorded failures.
+func (failures *ExportFailures) Failures() []TableFailure {
+	return failures.failures
+}
+
+// Any method returns true if any failure has been recorded.
+func (failures *ExportFailures) Any() bool {
+	return len(failures.failures) > 0
+}
+
+// FailuresToJSON function exports list of failures into JSON.
+func FailuresToJSON(buffer io.Writer, failures []TableFailure) error {
+	if buffer == nil {
+		err := errors.New(bufferIsNil)
+		return err
+	}
+
+	encoder := json.NewEncoder(buffer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(failures)
+}
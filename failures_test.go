@@ -0,0 +1,175 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/failures_test.html
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// TestExportFailuresStopOnError checks that failures are not collected when
+// continue-on-error mode is disabled
+func TestExportFailuresStopOnError(t *testing.T) {
+	failures := main.NewExportFailures(false)
+
+	storeError := errors.New("store error")
+	err := failures.Record("report", "", storeError)
+	assert.ErrorIs(t, err, storeError)
+	assert.False(t, failures.Any())
+}
+
+// TestExportFailuresContinueOnError checks that failures are collected in
+// continue-on-error mode
+func TestExportFailuresContinueOnError(t *testing.T) {
+	failures := main.NewExportFailures(true)
+
+	// success is not recorded
+	err := failures.Record("report", "", nil)
+	assert.NoError(t, err)
+	assert.False(t, failures.Any())
+
+	err = failures.Record("rule_hit", "org_id=1", errors.New("store error"))
+	assert.NoError(t, err)
+	assert.True(t, failures.Any())
+	assert.Equal(t, []main.TableFailure{
+		{TableName: "rule_hit", Prefix: "org_id=1", Error: "store error"},
+	}, failures.Failures())
+}
+
+// TestFailuresToJSONNilBuffer check how nil buffer is handled by
+// FailuresToJSON function
+func TestFailuresToJSONNilBuffer(t *testing.T) {
+	err := main.FailuresToJSON(nil, nil)
+	assert.Error(t, err, "Buffer is nil")
+}
+
+// TestFailuresToJSON check exporting failures into JSON
+func TestFailuresToJSON(t *testing.T) {
+	buffer := new(bytes.Buffer)
+
+	err := main.FailuresToJSON(buffer, []main.TableFailure{})
+	assert.NoError(t, err)
+	assert.Equal(t, "[]\n", buffer.String())
+}
+
+// prepareFailingDatabase helper function creates SQLite database with one
+// table that can be exported and one view that can't be read
+func prepareFailingDatabase(t *testing.T, directory string) main.ConfigStruct {
+	return prepareSQLiteDatabase(t, directory,
+		"CREATE TABLE good (id INTEGER PRIMARY KEY, value TEXT)",
+		"INSERT INTO good VALUES (1, 'a'), (2, 'b')",
+		"CREATE TABLE removed (a INTEGER)",
+		"CREATE VIEW bad AS SELECT a FROM removed",
+		"DROP TABLE removed")
+}
+
+// prepareSQLiteDatabase helper function creates SQLite database in given
+// directory, performs given statements in it and returns configuration that
+// uses the database
+func prepareSQLiteDatabase(t *testing.T, directory string, statements ...string) main.ConfigStruct {
+	configuration := main.ConfigStruct{
+		Storage: main.StorageConfiguration{
+			Driver:           "sqlite3",
+			SQLiteDataSource: filepath.Join(directory, "test.db"),
+		},
+	}
+	alterDatabase(t, &configuration, statements...)
+	return configuration
+}
+
+// TestPerformDataExportStopOnError checks that export is stopped on first
+// failure by default
+func TestPerformDataExportStopOnError(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output: "file",
+		Limit:  NoLimits,
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.Equal(t, main.ExitStatusStorageError, code)
+	assert.Error(t, err)
+
+	assert.NoFileExists(t, filepath.Join(directory, "_failures.json"))
+}
+
+// TestPerformDataExportContinueOnError checks that all tables that can be
+// exported are exported in continue-on-error mode and that failures are
+// reported
+func TestPerformDataExportContinueOnError(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:          "file",
+		Limit:           NoLimits,
+		ContinueOnError: true,
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.Equal(t, main.ExitStatusPartialSuccess, code)
+	assert.NoError(t, err)
+
+	checkFileContent(t, filepath.Join(directory, "good.csv"), "id,value\n1,a\n2,b\n")
+
+	content, err := os.ReadFile(filepath.Join(directory, "_failures.json"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"table": "bad"`)
+	assert.Contains(t, string(content), "no such table")
+}
+
+// TestPerformDataExportContinueOnErrorNothingExported checks that export
+// where all tables failed is not reported as partial success
+func TestPerformDataExportContinueOnErrorNothingExported(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:          "file",
+		Limit:           NoLimits,
+		IgnoredTables:   "good",
+		ContinueOnError: true,
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.Equal(t, main.ExitStatusStorageError, code)
+	assert.EqualError(t, err, "no table has been exported")
+
+	// failures are reported anyway
+	content, err := os.ReadFile(filepath.Join(directory, "_failures.json"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"table": "bad"`)
+}
@@ -0,0 +1,326 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains report aggregating user feedback. Ratings from
+// advisor_ratings table and votes from cluster_rule_user_feedback table are
+// counted per rule and error key together with net score, number of
+// organizations and the most recent feedback date. Optionally, the report is
+// joined with disabled rules so rules that are both down-rated and
+// frequently disabled are flagged.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/feedback.html
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Messages
+const (
+	exportingFeedbackSummary   = "Exporting feedback summary"
+	readFeedbackSummaryFailed  = "Read feedback summary failed"
+	storeFeedbackSummaryFailed = "Store feedback summary failed"
+	unknownFeedbackFormat      = "unknown feedback summary format: %s"
+	writeFeedbackSummaryToCSV  = "Write feedback summary to CSV"
+	writeFeedbackSummaryToJSON = "Write feedback summary to JSON"
+)
+
+// supported formats of feedback summary
+const (
+	feedbackFormatCSV  = "csv"
+	feedbackFormatJSON = "json"
+)
+
+// feedbackSummary is name of file or object with feedback summary without
+// extension
+const feedbackSummary = "_feedback_summary"
+
+// SQL queries used to read user feedback. Votes are not stored with
+// organization ID so it is taken from report table, the derived table keeps
+// name and columns of the original table so rows can be filtered the same
+// way as during export. Cluster reported under more organizations is
+// attributed to one of them, so each vote is counted once.
+const (
+	selectAdvisorRatings = `
+           SELECT org_id, rule_fqdn, error_key, rating, last_updated_at
+             FROM advisor_ratings`
+
+	selectClusterRuleUserFeedback = `
+           SELECT org_id, rule_id, error_key, user_vote, updated_at
+             FROM (SELECT report.org_id, feedback.cluster_id, feedback.rule_id,
+                          feedback.error_key, feedback.user_vote, feedback.updated_at
+                     FROM cluster_rule_user_feedback feedback
+                     LEFT JOIN report
+                            ON report.cluster = feedback.cluster_id
+                           AND report.org_id = (SELECT min(org_id) FROM report first_report
+                                                 WHERE first_report.cluster = feedback.cluster_id)
+                   ) cluster_rule_user_feedback`
+)
+
+// tables the feedback summary is derived from
+const (
+	advisorRatingsTable          TableName = "advisor_ratings"
+	clusterRuleUserFeedbackTable TableName = "cluster_rule_user_feedback"
+)
+
+// ruleModuleSuffix is suffix used by some tables in rule names
+const ruleModuleSuffix = ".report"
+
+// FeedbackInfo contains aggregated feedback of one rule and error key
+type FeedbackInfo struct {
+	Rule           string `json:"rule"`
+	ErrorKey       string `json:"error_key"`
+	Positive       int    `json:"positive"`
+	Negative       int    `json:"negative"`
+	Neutral        int    `json:"neutral"`
+	NetScore       int    `json:"net_score"`
+	Orgs           int    `json:"orgs"`
+	LastFeedbackAt string `json:"last_feedback_at"`
+
+	// filled in only when feedback is joined with disabled rules
+	DisabledCount        *int `json:"disabled_count,omitempty"`
+	DownRatedAndDisabled bool `json:"down_rated_and_disabled,omitempty"`
+}
+
+// feedbackAggregate contains feedback of one rule during aggregation
+type feedbackAggregate struct {
+	info FeedbackInfo
+	orgs map[string]struct{}
+}
+
+// feedbackFileName function returns name of file or object with feedback
+// summary in given format.
+func feedbackFileName(format string) (string, error) {
+	switch format {
+	case feedbackFormatCSV, feedbackFormatJSON:
+		return feedbackSummary + "." + format, nil
+	default:
+		return "", fmt.Errorf(unknownFeedbackFormat, format)
+	}
+}
+
+// normalizeRuleName function removes module suffix from rule name, so rules
+// stored with and without the suffix are aggregated together.
+func normalizeRuleName(rule string) string {
+	return strings.TrimSuffix(rule, ruleModuleSuffix)
+}
+
+// ReadFeedbackSummary method reads ratings and votes of all rules and
+// aggregates them. Rows are filtered by organizations when selective export
+// is enabled. When joinDisabledRules is set, rules reported in disabled
+// rules report are joined too.
+func (storage DBStorage) ReadFeedbackSummary(ctx context.Context, configuration *ConfigStruct,
+	joinDisabledRules bool) ([]FeedbackInfo, error) {
+	rules := make(map[DisabledRuleKey]*feedbackAggregate)
+
+	err := storage.readFeedback(ctx, rules, selectAdvisorRatings, advisorRatingsTable)
+	if err != nil {
+		return nil, err
+	}
+
+	err = storage.readFeedback(ctx, rules, selectClusterRuleUserFeedback, clusterRuleUserFeedbackTable)
+	if err != nil {
+		return nil, err
+	}
+
+	summary := make([]FeedbackInfo, 0, len(rules))
+	for _, rule := range rules {
+		rule.info.NetScore = rule.info.Positive - rule.info.Negative
+		rule.info.Orgs = len(rule.orgs)
+		summary = append(summary, rule.info)
+	}
+	sort.Slice(summary, func(i, j int) bool {
+		if summary[i].Rule != summary[j].Rule {
+			return summary[i].Rule < summary[j].Rule
+		}
+		return summary[i].ErrorKey < summary[j].ErrorKey
+	})
+
+	if joinDisabledRules {
+		reportConfiguration := GetDisabledRulesConfiguration(configuration)
+
+		disabledRulesInfo, err := storage.ReadDisabledRules(ctx, reportConfiguration.minCount(),
+			reportConfiguration.windowStart(time.Now()))
+		if err != nil {
+			return nil, err
+		}
+		applyDisabledRules(summary, disabledRulesInfo)
+	}
+
+	return summary, nil
+}
+
+// readFeedback method reads ratings or votes by given query and adds them
+// into aggregated feedback.
+func (storage DBStorage) readFeedback(ctx context.Context, rules map[DisabledRuleKey]*feedbackAggregate,
+	query string, tableName TableName) error {
+	storage.applySelectiveExport(&query, tableName)
+
+	rows, err := storage.query(ctx, tableName, "read feedback", query)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Error().Err(err).Msg(unableToCloseDBRowsHandle)
+		}
+	}()
+
+	for rows.Next() {
+		var orgID, updatedAt sql.NullString
+		var key DisabledRuleKey
+		var rating int
+
+		err := rows.Scan(&orgID, &key.Rule, &key.ErrorKey, &rating, &updatedAt)
+		if err != nil {
+			return err
+		}
+		key.Rule = normalizeRuleName(key.Rule)
+
+		rule, found := rules[key]
+		if !found {
+			rule = &feedbackAggregate{
+				info: FeedbackInfo{Rule: key.Rule, ErrorKey: key.ErrorKey},
+				orgs: make(map[string]struct{}),
+			}
+			rules[key] = rule
+		}
+
+		switch {
+		case rating > 0:
+			rule.info.Positive++
+		case rating < 0:
+			rule.info.Negative++
+		default:
+			rule.info.Neutral++
+		}
+		if orgID.Valid {
+			rule.orgs[orgID.String] = struct{}{}
+		}
+		if updatedAt.String > rule.info.LastFeedbackAt {
+			rule.info.LastFeedbackAt = updatedAt.String
+		}
+	}
+
+	return rows.Err()
+}
+
+// applyDisabledRules function sets number of disables to feedback of rules
+// reported in disabled rules report and flags rules that are down-rated
+// too. Number of disables is not set for rules that are not reported.
+func applyDisabledRules(summary []FeedbackInfo, disabledRulesInfo []DisabledRuleInfo) {
+	disabled := make(map[DisabledRuleKey]int)
+	for _, info := range disabledRulesInfo {
+		disabled[DisabledRuleKey{normalizeRuleName(info.Rule), info.ErrorKey}] += info.Count
+	}
+
+	for i := range summary {
+		info := &summary[i]
+
+		count, found := disabled[DisabledRuleKey{info.Rule, info.ErrorKey}]
+		if found {
+			info.DisabledCount = &count
+		}
+		info.DownRatedAndDisabled = found && info.NetScore < 0
+	}
+}
+
+// FeedbackSummaryToCSV function exports feedback summary into CSV file.
+// Columns related to disabled rules are empty when feedback is not joined
+// with disabled rules.
+func FeedbackSummaryToCSV(buffer io.Writer, summary []FeedbackInfo) error {
+	if buffer == nil {
+		err := errors.New(bufferIsNil)
+		log.Error().Err(err).Msg(writeFeedbackSummaryToCSV)
+		return err
+	}
+
+	writer := csv.NewWriter(buffer)
+
+	err := writer.Write([]string{"Rule", "Error key", "Positive", "Negative",
+		"Neutral", "Net score", "Organizations", "Last feedback at",
+		"Disabled count", "Down-rated and disabled"})
+	if err != nil {
+		return err
+	}
+
+	for _, info := range summary {
+		disabledCount, downRatedAndDisabled := "", ""
+		if info.DisabledCount != nil {
+			disabledCount = strconv.Itoa(*info.DisabledCount)
+			downRatedAndDisabled = strconv.FormatBool(info.DownRatedAndDisabled)
+		}
+
+		err := writer.Write([]string{
+			info.Rule,
+			info.ErrorKey,
+			strconv.Itoa(info.Positive),
+			strconv.Itoa(info.Negative),
+			strconv.Itoa(info.Neutral),
+			strconv.Itoa(info.NetScore),
+			strconv.Itoa(info.Orgs),
+			info.LastFeedbackAt,
+			disabledCount,
+			downRatedAndDisabled})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// FeedbackSummaryToJSON function exports feedback summary into JSON.
+func FeedbackSummaryToJSON(buffer io.Writer, summary []FeedbackInfo) error {
+	if buffer == nil {
+		err := errors.New(bufferIsNil)
+		log.Error().Err(err).Msg(writeFeedbackSummaryToJSON)
+		return err
+	}
+
+	encoder := json.NewEncoder(buffer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(summary)
+}
+
+// FeedbackSummaryToFormat function exports feedback summary in given
+// format.
+func FeedbackSummaryToFormat(buffer io.Writer, format string, summary []FeedbackInfo) error {
+	if format == feedbackFormatJSON {
+		return FeedbackSummaryToJSON(buffer, summary)
+	}
+	return FeedbackSummaryToCSV(buffer, summary)
+}
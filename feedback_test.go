@@ -0,0 +1,227 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/feedback_test.html
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// feedbackStatements contains statements that create tables with user
+// feedback
+var feedbackStatements = []string{
+	`CREATE TABLE report (org_id INTEGER, cluster VARCHAR, report VARCHAR)`,
+	`CREATE TABLE advisor_ratings (user_id VARCHAR, org_id INTEGER, rule_fqdn VARCHAR,
+		error_key VARCHAR, rated_at TIMESTAMP, last_updated_at TIMESTAMP, rating SMALLINT,
+		rule_id VARCHAR)`,
+	`CREATE TABLE cluster_rule_user_feedback (cluster_id VARCHAR, rule_id VARCHAR,
+		user_id VARCHAR, message VARCHAR, user_vote SMALLINT, added_at TIMESTAMP,
+		updated_at TIMESTAMP, error_key VARCHAR)`,
+	// votes of cluster reported under two organizations are counted once
+	`INSERT INTO report VALUES (1, 'c1', '{}'), (2, 'c2', '{}'), (3, 'c2', '{}')`,
+	`INSERT INTO advisor_ratings VALUES
+		('1', 1, 'rule.a', 'KEY_A', NULL, '2021-09-20T00:00:00Z', -1, 'rule.a|KEY_A'),
+		('2', 3, 'rule.a', 'KEY_A', NULL, '2021-09-22T00:00:00Z', -1, 'rule.a|KEY_A'),
+		('3', 1, 'rule.b', 'KEY_B', NULL, '2021-09-21T00:00:00Z', 1, 'rule.b|KEY_B')`,
+	`INSERT INTO cluster_rule_user_feedback VALUES
+		('c1', 'rule.a.report', '1', 'msg', 1, NULL, '2021-09-21T00:00:00Z', 'KEY_A'),
+		('c2', 'rule.a.report', '2', 'msg', 0, NULL, '2021-09-25T00:00:00Z', 'KEY_A'),
+		('c2', 'rule.b.report', '2', 'msg', -1, NULL, '2021-09-19T00:00:00Z', 'KEY_B')`,
+}
+
+// TestReadFeedbackSummary checks aggregation of ratings and votes
+func TestReadFeedbackSummary(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, feedbackStatements...)
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &testConfig)
+
+	summary, err := storage.ReadFeedbackSummary(context.Background(), &main.ConfigStruct{}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, []main.FeedbackInfo{
+		{
+			Rule: "rule.a", ErrorKey: "KEY_A", Positive: 1, Negative: 2, Neutral: 1,
+			NetScore: -1, Orgs: 3, LastFeedbackAt: "2021-09-25T00:00:00Z",
+		},
+		{
+			Rule: "rule.b", ErrorKey: "KEY_B", Positive: 1, Negative: 1, Neutral: 0,
+			NetScore: 0, Orgs: 2, LastFeedbackAt: "2021-09-21T00:00:00Z",
+		},
+	}, summary)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestReadFeedbackSummaryOrgFiltering checks that ratings and votes are
+// filtered by organizations
+func TestReadFeedbackSummaryOrgFiltering(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, feedbackStatements...)
+
+	config := testConfig
+	config.EnableOrgIDFiltering = true
+	config.OrganizationsToExport = []string{"1"}
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	summary, err := storage.ReadFeedbackSummary(context.Background(), &main.ConfigStruct{}, false)
+	assert.NoError(t, err)
+	assert.Len(t, summary, 2)
+	assert.Equal(t, 1, summary[0].Positive)
+	assert.Equal(t, 1, summary[0].Negative)
+	assert.Equal(t, 1, summary[0].Orgs)
+	assert.Equal(t, "2021-09-21T00:00:00Z", summary[0].LastFeedbackAt)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestReadFeedbackSummaryWithDisabledRules checks that feedback is joined
+// with disabled rules
+func TestReadFeedbackSummaryWithDisabledRules(t *testing.T) {
+	statements := append([]string{
+		`CREATE TABLE rule_disable (org_id INTEGER, user_id VARCHAR, rule_id VARCHAR,
+			error_key VARCHAR, justification VARCHAR, created_at TIMESTAMP, updated_at TIMESTAMP)`,
+		`CREATE TABLE cluster_rule_toggle (cluster_id VARCHAR, rule_id VARCHAR, user_id VARCHAR,
+			disabled SMALLINT, disabled_at TIMESTAMP, enabled_at TIMESTAMP, updated_at TIMESTAMP,
+			error_key VARCHAR)`,
+		`CREATE TABLE cluster_user_rule_disable_feedback (cluster_id VARCHAR, user_id VARCHAR,
+			rule_id VARCHAR, message VARCHAR, added_at TIMESTAMP, updated_at TIMESTAMP,
+			error_key VARCHAR)`,
+		`INSERT INTO rule_disable VALUES
+			(1, '1', 'rule.a.report', 'KEY_A', 'x', '2021-09-20T00:00:00Z', NULL),
+			(2, '2', 'rule.a.report', 'KEY_A', 'x', '2021-09-20T00:00:00Z', NULL),
+			(2, '2', 'rule.b.report', 'KEY_B', 'x', '2021-09-20T00:00:00Z', NULL)`,
+	}, feedbackStatements...)
+	connection := mustCreateSQLiteConnection(t, statements...)
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &testConfig)
+
+	summary, err := storage.ReadFeedbackSummary(context.Background(), &main.ConfigStruct{}, true)
+	assert.NoError(t, err)
+	assert.Len(t, summary, 2)
+
+	// rule.a is down-rated and disabled by two users
+	assert.Equal(t, 2, *summary[0].DisabledCount)
+	assert.True(t, summary[0].DownRatedAndDisabled)
+
+	// rule.b is disabled by one user only which is under the threshold,
+	// so it is not reported
+	assert.Nil(t, summary[1].DisabledCount)
+	assert.False(t, summary[1].DownRatedAndDisabled)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestReadFeedbackSummaryMissingTable checks that missing table is reported
+func TestReadFeedbackSummaryMissingTable(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, feedbackStatements[:2]...)
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &testConfig)
+
+	_, err := storage.ReadFeedbackSummary(context.Background(), &main.ConfigStruct{}, false)
+	assert.Error(t, err)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestFeedbackSummaryToCSV checks conversion of feedback summary into CSV
+func TestFeedbackSummaryToCSV(t *testing.T) {
+	disabled := 4
+	summary := []main.FeedbackInfo{
+		{
+			Rule: "rule.a", ErrorKey: "KEY_A", Positive: 1, Negative: 3,
+			NetScore: -2, Orgs: 2, LastFeedbackAt: "2021-09-25T00:00:00Z",
+			DisabledCount: &disabled, DownRatedAndDisabled: true,
+		},
+		{Rule: "rule.b", ErrorKey: "KEY_B", Neutral: 1, Orgs: 1},
+	}
+
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, main.FeedbackSummaryToCSV(buffer, summary))
+
+	lines := strings.Split(buffer.String(), "\n")
+	assert.Equal(t, "Rule,Error key,Positive,Negative,Neutral,Net score,Organizations,Last feedback at,Disabled count,Down-rated and disabled", lines[0])
+	assert.Equal(t, "rule.a,KEY_A,1,3,0,-2,2,2021-09-25T00:00:00Z,4,true", lines[1])
+	assert.Equal(t, "rule.b,KEY_B,0,0,1,0,1,,,", lines[2])
+
+	assert.Error(t, main.FeedbackSummaryToCSV(nil, summary))
+	assert.Error(t, main.FeedbackSummaryToJSON(nil, summary))
+}
+
+// TestPerformDataExportFeedbackSummary checks that feedback summary is
+// stored into file in selected format
+func TestPerformDataExportFeedbackSummary(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareSQLiteDatabase(t, directory, feedbackStatements...)
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:                "file",
+		Limit:                 NoLimits,
+		ExportFeedbackSummary: true,
+		FeedbackFormat:        "json",
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.NoFileExists(t, filepath.Join(directory, "_feedback_summary.csv"))
+
+	content, err := os.ReadFile(filepath.Join(directory, "_feedback_summary.json"))
+	assert.NoError(t, err)
+
+	var summary []main.FeedbackInfo
+	assert.NoError(t, json.Unmarshal(content, &summary))
+	assert.Len(t, summary, 2)
+	assert.Equal(t, -1, summary[0].NetScore)
+	assert.Nil(t, summary[0].DisabledCount)
+
+	// unknown format is refused before anything is exported
+	cliFlags.FeedbackFormat = "xml"
+	code, err = main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.EqualError(t, err, "unknown feedback summary format: xml")
+	assert.Equal(t, main.ExitStatusConfigurationError, code)
+}
+
+// TestPerformDataExportFeedbackSummaryS3 checks that feedback summary is
+// stored into S3 without prefix
+func TestPerformDataExportFeedbackSummaryS3(t *testing.T) {
+	configuration := prepareSQLiteDatabase(t, t.TempDir(), feedbackStatements...)
+	requests := mockS3(t, &configuration, "bucket")
+
+	cliFlags := main.CliFlags{
+		Output:                "S3",
+		Limit:                 NoLimits,
+		ExportFeedbackSummary: true,
+		FeedbackFormat:        "csv",
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.Contains(t, requests(), "PUT /bucket/_feedback_summary.csv")
+}
@@ -23,87 +23,311 @@ package main
 // https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/file.html
 
 import (
-	"encoding/csv"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
-
-	"github.com/rs/zerolog/log"
+	"path/filepath"
+	"time"
 )
 
 // Messages
 const (
-	writeTableNameToCSV        = "Write table name to CSV"
-	writeDisabledRuleInfoToCSV = "Write disabled rule info to CSV"
+	fileNameIsNotSet  = "File name is not set"
+	fileAlreadyExists = "file %s already exists, use -force to overwrite it"
 )
 
-// storeTableNamesIntoFile function stores names of all tables into the
-// specified file
-func storeTableNamesIntoFile(fileName string, tableNames []TableName) error {
-	// open new CSV file to be filled in
+// temporaryFileSuffix is suffix of temporary files content is written into
+// before they are renamed to their final names
+const temporaryFileSuffix = ".*.tmp"
 
-	// disable "G304 (CWE-22): Potential file inclusion via variable"
-	fout, err := os.Create(fileName) // #nosec G304
+// FileConfiguration represents configuration of file output
+type FileConfiguration struct {
+	// OutputDirectory is directory exported files are written into.
+	// Current directory is used when not set. Directory given by
+	// -output-dir flag takes precedence.
+	OutputDirectory string `mapstructure:"output_dir" toml:"output_dir"`
+
+	// PerRunDirectory enables separate subdirectory of output directory
+	// for each run. Subdirectory is named by ID of the run.
+	PerRunDirectory bool `mapstructure:"per_run_directory" toml:"per_run_directory"`
+}
+
+// outputDirectory method returns directory files of run with given ID are
+// written into.
+func (configuration FileConfiguration) outputDirectory(flagValue, runID string) string {
+	directory := configuration.OutputDirectory
+	if flagValue != "" {
+		directory = flagValue
+	}
+
+	if configuration.PerRunDirectory {
+		directory = filepath.Join(directory, runID)
+	}
+	return directory
+}
+
+// stateFiles contains files read by the next export: snapshot of columns
+// used to detect schema drift and disabled rules report used to compute
+// trend. They are replaced even when overwriting is not forced, otherwise
+// they could never be refreshed without per-run directories.
+var stateFiles = map[string]struct{}{
+	columnsInfo:   {},
+	disabledRules: {},
+}
+
+// fileSink is Sink that stores objects into files in local file system.
+// Object names are paths relative to output directory, directories are
+// created when needed. Existing files (except state files) are not
+// overwritten unless forced. Objects not found in output directory are read
+// from directories of previous runs, when they are set.
+type fileSink struct {
+	directory    string
+	force        bool
+	previousRuns []string
+}
+
+// fileObject is object being written into temporary file. The file is
+// renamed to its final name when the object is committed, so files that
+// were not written completely never look complete.
+type fileObject struct {
+	file      *os.File
+	fileName  string
+	overwrite bool
+}
+
+// newFileSink function constructs sink that stores objects into files in
+// given directory.
+func newFileSink(directory string, force bool) *fileSink {
+	return &fileSink{
+		directory: directory,
+		force:     force,
+	}
+}
+
+// readPreviousRuns method makes the sink read objects that are not found in
+// output directory from directories of previous runs. It is used when each
+// run writes into its own subdirectory, so files stored by previous run (for
+// example snapshot of columns) are found.
+func (sink *fileSink) readPreviousRuns() error {
+	previousRuns, err := previousRunDirectories(sink.directory)
 	if err != nil {
 		return err
 	}
+	sink.previousRuns = previousRuns
+	return nil
+}
 
-	// initialize CSV writer
-	writer := csv.NewWriter(fout)
-	var data = [][]string{{tableNameMsg}}
+// previousRunDirectories function returns directories of runs that precede
+// run with given directory, newest first. Run directories are siblings named
+// by run ID, and run IDs start with time, so they can be sorted.
+func previousRunDirectories(directory string) ([]string, error) {
+	parent, current := filepath.Split(filepath.Clean(directory))
 
-	// header
-	err = writer.WriteAll(data)
+	entries, err := os.ReadDir(filepath.Clean(parent))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
 	if err != nil {
-		return err
+		return nil, err
+	}
+
+	var previousRuns []string
+	// entries are sorted by name
+	for i := len(entries) - 1; i >= 0; i-- {
+		name := entries[i].Name()
+		if entries[i].IsDir() && name < current && isRunID(name) {
+			previousRuns = append(previousRuns, filepath.Join(parent, name))
+		}
 	}
+	return previousRuns, nil
+}
 
-	// table names
-	for _, tableName := range tableNames {
-		err := writer.Write([]string{string(tableName)})
+// isRunID function checks if given name starts with time part of run ID.
+func isRunID(name string) bool {
+	if len(name) < len(runIDTimeFormat) {
+		return false
+	}
+	_, err := time.Parse(runIDTimeFormat, name[:len(runIDTimeFormat)])
+	return err == nil
+}
+
+// fileName method returns name of file the object with given name is stored
+// into.
+func (sink *fileSink) fileName(name string) string {
+	return filepath.Join(sink.directory, filepath.FromSlash(name))
+}
+
+// checkExisting method checks that files with given names don't exist, so
+// export into directory that holds previous export fails before anything is
+// written. Nothing is checked when overwriting is forced.
+func (sink *fileSink) checkExisting(names []string) error {
+	for _, name := range names {
+		if sink.overwrites(name) {
+			continue
+		}
+		err := checkFileNotExists(sink.fileName(name))
 		if err != nil {
-			log.Error().Err(err).Msg(writeTableNameToCSV)
+			return err
 		}
 	}
+	return nil
+}
 
-	writer.Flush()
+// overwrites method checks if existing file with given name is replaced.
+func (sink *fileSink) overwrites(name string) bool {
+	_, state := stateFiles[name]
+	return sink.force || state
+}
 
-	// check for any error during export to CSV
-	err = writer.Error()
-	if err != nil {
+// checkFileNotExists function returns error when given file exists.
+func checkFileNotExists(fileName string) error {
+	_, err := os.Stat(fileName)
+	if err == nil {
+		return fmt.Errorf(fileAlreadyExists, fileName)
+	}
+	if !errors.Is(err, fs.ErrNotExist) {
 		return err
 	}
+	return nil
+}
 
-	// close the file and check if close operation was ok
-	err = fout.Close()
+// Create method creates temporary file for object with given name. Content
+// type is not used.
+func (sink *fileSink) Create(_ context.Context, name, _ string) (SinkObject, error) {
+	if name == "" {
+		return nil, errors.New(fileNameIsNotSet)
+	}
+
+	fileName := sink.fileName(name)
+	overwrite := sink.overwrites(name)
+	if !overwrite {
+		err := checkFileNotExists(fileName)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// temporary file needs to be in the same directory, so it can be
+	// renamed atomically
+	directory := filepath.Dir(fileName)
+	err := os.MkdirAll(directory, 0o750)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	return nil
+	fout, err := os.CreateTemp(directory, "."+filepath.Base(fileName)+temporaryFileSuffix)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileObject{
+		file:      fout,
+		fileName:  fileName,
+		overwrite: overwrite,
+	}, nil
 }
 
-// storeDisabledRulesIntoFile function stores info about disabled rules into
-// specified file
-func storeDisabledRulesIntoFile(fileName string, disabledRulesInfo []DisabledRuleInfo) error {
-	// open new CSV file to be filled in
+// Read method reads content of file with given name. The newest previous
+// run that contains the file is used when the file is not found in output
+// directory.
+func (sink *fileSink) Read(_ context.Context, name string) ([]byte, bool, error) {
+	content, found, err := readFile(sink.fileName(name))
+	if found || err != nil {
+		return content, found, err
+	}
 
-	// disable "G304 (CWE-22): Potential file inclusion via variable"
-	fout, err := os.Create(fileName) // #nosec G304
+	for _, directory := range sink.previousRuns {
+		content, found, err = readFile(filepath.Join(directory, filepath.FromSlash(name)))
+		if found || err != nil {
+			return content, found, err
+		}
+	}
+	return nil, false, nil
+}
+
+// Write method writes data into temporary file.
+func (object *fileObject) Write(data []byte) (int, error) {
+	return object.file.Write(data)
+}
+
+// Commit method flushes data to disk and moves temporary file to its final
+// name.
+func (object *fileObject) Commit() error {
+	err := object.file.Sync()
 	if err != nil {
-		return err
+		return errors.Join(err, object.Abort())
+	}
+
+	err = object.file.Close()
+	if err != nil {
+		return errors.Join(err, os.Remove(object.file.Name()))
+	}
+
+	err = object.publish()
+	if err != nil {
+		return errors.Join(err, os.Remove(object.file.Name()))
+	}
+
+	// moved file needs to be persisted too
+	return syncDirectory(filepath.Dir(object.fileName))
+}
+
+// publish method moves temporary file to its final name. Existing file is
+// replaced only when allowed, so file that appeared after the object has
+// been created is not overwritten silently.
+func (object *fileObject) publish() error {
+	if object.overwrite {
+		return os.Rename(object.file.Name(), object.fileName)
 	}
 
-	// conversion to CSV
-	err = DisabledRulesToCSV(fout, disabledRulesInfo)
+	// link fails when the final name exists already
+	err := os.Link(object.file.Name(), object.fileName)
+	if errors.Is(err, fs.ErrExist) {
+		return fmt.Errorf(fileAlreadyExists, object.fileName)
+	}
 	if err != nil {
-		log.Error().Err(err).Msg(writeDisabledRuleInfoToCSV)
 		return err
 	}
+	return os.Remove(object.file.Name())
+}
 
-	// close the file and check if close operation was ok
-	err = fout.Close()
+// Abort method closes and removes temporary file.
+func (object *fileObject) Abort() error {
+	return errors.Join(object.file.Close(), os.Remove(object.file.Name()))
+}
+
+// createOutputDirectory function creates output directory when it is set.
+// Current directory is used otherwise.
+func createOutputDirectory(directory string) error {
+	if directory == "" {
+		return nil
+	}
+	return os.MkdirAll(directory, 0o750)
+}
+
+// syncDirectory function flushes entries of given directory to disk.
+func syncDirectory(directory string) error {
+	// disable "G304 (CWE-22): Potential file inclusion via variable"
+	dir, err := os.Open(directory) // #nosec G304
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return errors.Join(dir.Sync(), dir.Close())
+}
+
+// readFile function reads content of given file. False is returned when the
+// file does not exist.
+func readFile(fileName string) ([]byte, bool, error) {
+	// disable "G304 (CWE-22): Potential file inclusion via variable"
+	content, err := os.ReadFile(fileName) // #nosec G304
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	return content, true, nil
 }
@@ -23,8 +23,10 @@ package main_test
 // https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/file_test.html
 
 import (
+	"context"
 	"os"
 	"testing"
+	"time"
 
 	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
 
@@ -82,12 +84,12 @@ func TestStoreTableNamesIntoFileNoWritableFile(t *testing.T) {
 	const filename = ""
 	tableNames := []main.TableName{}
 
-	err := main.StoreTableNamesIntoFile(filename, tableNames)
+	err := main.StoreTableNames(context.Background(), main.NewFileSink("", false), filename, tableNames)
 	assert.Error(t, err, "Error should be thrown for empty file name")
 }
 
 // TestStoreTableNamesIntoFileEmptyListOfTables check the behaviour if empty
-// list of tables is pass into the storeDisabledRulesIntoFile function
+// list of tables is pass into the storeTableNames function with file sink
 func TestStoreTableNamesIntoFileEmptyListOfTables(t *testing.T) {
 	directory := mustCreateTemporaryDirectory(t)
 	defer mustRemoveTempDirectory(t, directory)
@@ -98,7 +100,7 @@ func TestStoreTableNamesIntoFileEmptyListOfTables(t *testing.T) {
 	// just to be sure
 	assert.NoFileExists(t, filename, "File must not exist")
 
-	err := main.StoreTableNamesIntoFile(filename, tableNames)
+	err := main.StoreTableNames(context.Background(), main.NewFileSink("", false), filename, tableNames)
 	assert.NoError(t, err, "Error should not be thrown for regular file name")
 
 	// file with exported data must be created
@@ -113,7 +115,7 @@ func TestStoreTableNamesIntoFileEmptyListOfTables(t *testing.T) {
 }
 
 // TestStoreTableNamesIntoFile check the behaviour of
-// storeDisabledRulesIntoFile function
+// storeTableNames function with file sink
 func TestStoreTableNamesIntoFile(t *testing.T) {
 	directory := mustCreateTemporaryDirectory(t)
 	defer mustRemoveTempDirectory(t, directory)
@@ -127,7 +129,7 @@ func TestStoreTableNamesIntoFile(t *testing.T) {
 	// just to be sure
 	assert.NoFileExists(t, filename, "File must not exist")
 
-	err := main.StoreTableNamesIntoFile(filename, tableNames)
+	err := main.StoreTableNames(context.Background(), main.NewFileSink("", false), filename, tableNames)
 	assert.NoError(t, err, "Error should not be thrown for regular file name")
 
 	// file with exported data must be created
@@ -147,12 +149,13 @@ func TestStoreDisableRulesIntoFile(t *testing.T) {
 	const filename = ""
 	disabledRules := []main.DisabledRuleInfo{}
 
-	err := main.StoreDisabledRulesIntoFile(filename, disabledRules)
+	err := main.StoreDisabledRules(context.Background(), main.NewFileSink("", false), filename, disabledRules)
 	assert.Error(t, err, "Error should be thrown for empty file name")
 }
 
 // TestStoreDisabledRulesIntoFileEmptyListOfTables check the behaviour if empty
-// list of disabled rules is pass into the storeDisabledRulesIntoFile function
+// list of disabled rules is pass into the storeDisabledRules function with
+// file sink
 func TestStoreDisabledRulesIntoFileEmptyListOfTables(t *testing.T) {
 	directory := mustCreateTemporaryDirectory(t)
 	defer mustRemoveTempDirectory(t, directory)
@@ -163,14 +166,14 @@ func TestStoreDisabledRulesIntoFileEmptyListOfTables(t *testing.T) {
 	// just to be sure
 	assert.NoFileExists(t, filename, "File must not exist")
 
-	err := main.StoreDisabledRulesIntoFile(filename, disabledRules)
+	err := main.StoreDisabledRules(context.Background(), main.NewFileSink("", false), filename, disabledRules)
 	assert.NoError(t, err, "Error should not be thrown for regular file name")
 
 	// file with exported data must be created
 	assert.FileExists(t, filename, "File must be created")
 
 	// check generated file content
-	expected := "Rule,Count\n"
+	expected := "Rule,Count,Error key,Organizations,First disabled at,Last disabled at,Count in window,Empty justifications share,Cluster toggles,Cluster feedbacks,Previous count,Trend\n"
 	checkFileContent(t, filename, expected)
 
 	// delete temporary file
@@ -178,29 +181,204 @@ func TestStoreDisabledRulesIntoFileEmptyListOfTables(t *testing.T) {
 }
 
 // TestStoreDisabledRulesIntoFile check the behaviour of
-// storeDisabledRulesIntoFile function
+// storeDisabledRules function with file sink
 func TestStoreDisabledRulesIntoFile(t *testing.T) {
 	directory := mustCreateTemporaryDirectory(t)
 	defer mustRemoveTempDirectory(t, directory)
 
 	filename := directory + "disabled_rules.csv"
 	disabledRules := []main.DisabledRuleInfo{
-		{"first", 1},
-		{"second", 2},
-		{"third", 3},
+		{Rule: "first", Count: 1},
+		{Rule: "second", Count: 2},
+		{Rule: "third", Count: 3},
 	}
 
 	// just to be sure
 	assert.NoFileExists(t, filename, "File must not exist")
 
-	err := main.StoreDisabledRulesIntoFile(filename, disabledRules)
+	err := main.StoreDisabledRules(context.Background(), main.NewFileSink("", false), filename, disabledRules)
 	assert.NoError(t, err, "Error should not be thrown for regular file name")
 
 	// file with exported data must be created
 	assert.FileExists(t, filename, "File must be created")
 
 	// check generated file content
-	expected := "Rule,Count\nfirst,1\nsecond,2\nthird,3\n"
+	expected := "Rule,Count,Error key,Organizations,First disabled at,Last disabled at,Count in window,Empty justifications share,Cluster toggles,Cluster feedbacks,Previous count,Trend\n" +
+		"first,1,,0,,,0,0.00,0,0,,\n" +
+		"second,2,,0,,,0,0.00,0,0,,\n" +
+		"third,3,,0,,,0,0.00,0,0,,\n"
+	checkFileContent(t, filename, expected)
+
+	// delete temporary file
+	mustDeleteFile(t, filename)
+}
+
+// TestStoreSamplingIntoFileNoWritableFile checks that error is thrown when
+// file can not be created
+func TestStoreSamplingIntoFileNoWritableFile(t *testing.T) {
+	err := main.StoreSampling(context.Background(), main.NewFileSink("", false), "", main.Sampling{})
+	assert.Error(t, err, "Error should be thrown for empty file name")
+}
+
+// TestStoreSamplingIntoFile check the behaviour of storeSampling
+// function with file sink
+func TestStoreSamplingIntoFile(t *testing.T) {
+	directory := mustCreateTemporaryDirectory(t)
+	defer mustRemoveTempDirectory(t, directory)
+
+	filename := directory + "sampling.csv"
+
+	err := main.StoreSampling(context.Background(), main.NewFileSink("", false), filename, main.Sampling{Orgs: 5, Seed: 42})
+	assert.NoError(t, err, "Error should not be thrown for regular file name")
+
+	// check generated file content
+	const expected = "Parameter,Value\npercent,0\nrows per organization,0\norganizations,5\nseed,42\n"
+	checkFileContent(t, filename, expected)
+
+	// delete temporary file
+	mustDeleteFile(t, filename)
+}
+
+// TestStorePartitionsIntoFileNoWritableFile check the behaviour of
+// storePartitions function with file sink when file name is not specified
+func TestStorePartitionsIntoFileNoWritableFile(t *testing.T) {
+	err := main.StorePartitions(context.Background(), main.NewFileSink("", false), "", nil)
+	assert.Error(t, err, "Error should be thrown for empty file name")
+}
+
+// TestStorePartitionsIntoFile check the behaviour of storePartitions
+// function with file sink
+func TestStorePartitionsIntoFile(t *testing.T) {
+	directory := mustCreateTemporaryDirectory(t)
+	defer mustRemoveTempDirectory(t, directory)
+
+	filename := directory + "partitions.csv"
+
+	counts := []main.PartitionCount{
+		{OrgID: "42", TableName: "rule_hit", Count: 3},
+	}
+
+	err := main.StorePartitions(context.Background(), main.NewFileSink("", false), filename, counts)
+	assert.NoError(t, err, "Error should not be thrown for regular file name")
+
+	// check generated file content
+	const expected = "org_id,Table name,Records\n42,rule_hit,3\n"
+	checkFileContent(t, filename, expected)
+
+	// delete temporary file
+	mustDeleteFile(t, filename)
+}
+
+// TestStoreFailuresIntoFileNoWritableFile check the behaviour of
+// storeFailures function with file sink when file name is not specified
+func TestStoreFailuresIntoFileNoWritableFile(t *testing.T) {
+	err := main.StoreFailures(context.Background(), main.NewFileSink("", false), "", nil)
+	assert.Error(t, err, "Error should be thrown for empty file name")
+}
+
+// TestStoreFailuresIntoFile check the behaviour of storeFailures
+// function with file sink
+func TestStoreFailuresIntoFile(t *testing.T) {
+	directory := mustCreateTemporaryDirectory(t)
+	defer mustRemoveTempDirectory(t, directory)
+
+	filename := directory + "failures.json"
+
+	failures := []main.TableFailure{
+		{TableName: "report", Error: "connection reset"},
+	}
+
+	err := main.StoreFailures(context.Background(), main.NewFileSink("", false), filename, failures)
+	assert.NoError(t, err, "Error should not be thrown for regular file name")
+
+	// check generated file content
+	const expected = `[
+  {
+    "table": "report",
+    "error": "connection reset"
+  }
+]
+`
+	checkFileContent(t, filename, expected)
+
+	// delete temporary file
+	mustDeleteFile(t, filename)
+}
+
+// TestStoreIncompleteIntoFileNoWritableFile check the behaviour of
+// storeIncomplete function with file sink when file name is not specified
+func TestStoreIncompleteIntoFileNoWritableFile(t *testing.T) {
+	err := main.StoreIncomplete(context.Background(), main.NewFileSink("", false), "", main.IncompleteRun{})
+	assert.Error(t, err, "Error should be thrown for empty file name")
+}
+
+// TestStoreIncompleteIntoFile check the behaviour of storeIncomplete
+// function with file sink
+func TestStoreIncompleteIntoFile(t *testing.T) {
+	directory := mustCreateTemporaryDirectory(t)
+	defer mustRemoveTempDirectory(t, directory)
+
+	filename := directory + "incomplete.json"
+
+	incomplete := main.IncompleteRun{
+		Reason:    "terminated signal received",
+		StoppedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC),
+		Exported: []main.ExportedTable{
+			{TableName: "report", Prefix: "org_id=1"},
+		},
+	}
+
+	err := main.StoreIncomplete(context.Background(), main.NewFileSink("", false), filename, incomplete)
+	assert.NoError(t, err, "Error should not be thrown for regular file name")
+
+	// check generated file content
+	const expected = `{
+  "reason": "terminated signal received",
+  "stopped_at": "2026-01-02T03:04:05Z",
+  "exported": [
+    {
+      "table": "report",
+      "prefix": "org_id=1"
+    }
+  ]
+}
+`
+	checkFileContent(t, filename, expected)
+
+	// delete temporary file
+	mustDeleteFile(t, filename)
+}
+
+// TestStoreSummaryIntoFileNoWritableFile check the behaviour of
+// storeSummary function with file sink when file name is not specified
+func TestStoreSummaryIntoFileNoWritableFile(t *testing.T) {
+	err := main.StoreSummary(context.Background(), main.NewFileSink("", false), "", main.NewExportSummary())
+	assert.Error(t, err, "Error should be thrown for empty file name")
+}
+
+// TestStoreSummaryIntoFile check the behaviour of storeSummary
+// function with file sink
+func TestStoreSummaryIntoFile(t *testing.T) {
+	directory := mustCreateTemporaryDirectory(t)
+	defer mustRemoveTempDirectory(t, directory)
+
+	filename := directory + "summary.json"
+
+	err := main.StoreSummary(context.Background(), main.NewFileSink("", false), filename, main.NewExportSummary())
+	assert.NoError(t, err, "Error should not be thrown for regular file name")
+
+	// check generated file content
+	const expected = `{
+  "tables": [],
+  "total": {
+    "rows": 0,
+    "bytes": 0,
+    "duration_seconds": 0,
+    "rows_per_second": 0,
+    "bytes_per_second": 0
+  }
+}
+`
 	checkFileContent(t, filename, expected)
 
 	// delete temporary file
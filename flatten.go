@@ -0,0 +1,327 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains derived export selected by -flatten-reports
+// flag. JSON stored in report column of report table is parsed and rule
+// results are written as normalized rows: organization, cluster, rule
+// module, error key and details. Rule hits, info, passed and skipped
+// entries are written into separate files, reports that can't be parsed
+// are counted.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/flatten.html
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"io"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Messages
+const (
+	flatteningReports     = "Flattening reports"
+	flattenReportsFailed  = "Flattening reports failed"
+	storeFlattenedFailed  = "Store flattened reports failed"
+	unableToParseReport   = "Unable to parse report, it is skipped"
+	unparsableReportsMsg  = "Some reports can't be parsed"
+	unparsableReportCount = "unparsable"
+)
+
+// files or objects with flattened reports
+const (
+	flattenedRules   = "_report_rules.csv"
+	flattenedInfo    = "_report_info.csv"
+	flattenedPasses  = "_report_passes.csv"
+	flattenedSkips   = "_report_skips.csv"
+	flattenedSummary = "_report_flattening.json"
+)
+
+// SQL query used to read reports
+const selectReports = `
+           SELECT org_id, cluster, report
+             FROM report`
+
+// ReportEntry represents one entry of rule results stored in report. Rule
+// hits, info and passed entries contain component and key, skipped entries
+// contain rule name and reason.
+type ReportEntry struct {
+	Component string          `json:"component"`
+	RuleFQDN  string          `json:"rule_fqdn"`
+	Key       string          `json:"key"`
+	Reason    string          `json:"reason"`
+	Details   json.RawMessage `json:"details"`
+}
+
+// reportContent represents parts of report that are flattened
+type reportContent struct {
+	Reports []ReportEntry `json:"reports"`
+	Info    []ReportEntry `json:"info"`
+	Pass    []ReportEntry `json:"pass"`
+	Skips   []ReportEntry `json:"skips"`
+}
+
+// FlatteningSummary contains number of flattened reports and entries
+type FlatteningSummary struct {
+	Reports    int `json:"reports"`
+	Unparsable int `json:"unparsable"`
+	Rules      int `json:"rules"`
+	Info       int `json:"info"`
+	Passes     int `json:"passes"`
+	Skips      int `json:"skips"`
+}
+
+// flattenedObject represents object in sink that flattened entries of one
+// kind are written into
+type flattenedObject struct {
+	name   string
+	object SinkObject
+}
+
+// flattenedWriters contains CSV writers for all kinds of entries together
+// with objects they write into
+type flattenedWriters struct {
+	rules   *csv.Writer
+	info    *csv.Writer
+	passes  *csv.Writer
+	skips   *csv.Writer
+	objects []flattenedObject
+}
+
+// newFlattenedWriters function creates objects for all kinds of entries in
+// given sink under given prefix, constructs CSV writers writing into them
+// and writes headers.
+func newFlattenedWriters(ctx context.Context, sink Sink, prefix string) (*flattenedWriters, error) {
+	writers := &flattenedWriters{}
+
+	for _, kind := range []struct {
+		writer **csv.Writer
+		name   string
+	}{
+		{&writers.rules, flattenedRules},
+		{&writers.info, flattenedInfo},
+		{&writers.passes, flattenedPasses},
+		{&writers.skips, flattenedSkips},
+	} {
+		name := setObjectPrefix(prefix, kind.name)
+		object, err := sink.Create(ctx, name, contentTypeCSV)
+		if err != nil {
+			writers.abort()
+			return nil, err
+		}
+		writers.objects = append(writers.objects, flattenedObject{name, object})
+		*kind.writer = csv.NewWriter(object)
+	}
+
+	header := []string{"org_id", "cluster", "rule_module", "error_key", "details"}
+	for _, writer := range []*csv.Writer{writers.rules, writers.info, writers.passes} {
+		if err := writer.Write(header); err != nil {
+			writers.abort()
+			return nil, err
+		}
+	}
+
+	err := writers.skips.Write([]string{"org_id", "cluster", "rule_module", "reason", "details"})
+	if err != nil {
+		writers.abort()
+		return nil, err
+	}
+	return writers, nil
+}
+
+// flush method flushes all writers and returns errors that occurred during
+// writing.
+func (writers *flattenedWriters) flush() error {
+	var errs []error
+	for _, writer := range []*csv.Writer{writers.rules, writers.info, writers.passes, writers.skips} {
+		writer.Flush()
+		errs = append(errs, writer.Error())
+	}
+	return errors.Join(errs...)
+}
+
+// commit method flushes all writers and commits objects they write into.
+// All objects are aborted when content can't be written. Objects are
+// committed one by one, so when commit of one object fails the objects
+// committed before it stay stored and the set of flattened objects is
+// incomplete. The remaining objects are aborted in such case.
+func (writers *flattenedWriters) commit() error {
+	err := writers.flush()
+	if err != nil {
+		writers.abort()
+		return err
+	}
+
+	for i, object := range writers.objects {
+		err := object.object.Commit()
+		if err != nil {
+			for _, remaining := range writers.objects[i+1:] {
+				abortObject(remaining.object, remaining.name)
+			}
+			return err
+		}
+	}
+	return nil
+}
+
+// abort method discards all objects created so far.
+func (writers *flattenedWriters) abort() {
+	for _, object := range writers.objects {
+		abortObject(object.object, object.name)
+	}
+}
+
+// compactDetails function returns details of entry as compact JSON, empty
+// string is returned for missing details.
+func compactDetails(details json.RawMessage) string {
+	if len(details) == 0 || string(details) == "null" {
+		return ""
+	}
+
+	buffer := new(bytes.Buffer)
+	if err := json.Compact(buffer, details); err != nil {
+		return string(details)
+	}
+	return buffer.String()
+}
+
+// writeEntries function writes entries of one kind as normalized rows.
+func writeEntries(writer *csv.Writer, orgID, cluster string, entries []ReportEntry, skipped bool) error {
+	for _, entry := range entries {
+		module, key := entry.Component, entry.Key
+		if skipped {
+			key = entry.Reason
+		}
+		if module == "" {
+			module = entry.RuleFQDN
+		}
+
+		err := writer.Write([]string{orgID, cluster, module, key, compactDetails(entry.Details)})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeReport function writes entries of one parsed report by given
+// writers, numbers of entries are added into summary.
+func writeReport(writers *flattenedWriters, summary *FlatteningSummary,
+	orgID, cluster string, content *reportContent) error {
+	for _, kind := range []struct {
+		writer  *csv.Writer
+		entries []ReportEntry
+		count   *int
+		skipped bool
+	}{
+		{writers.rules, content.Reports, &summary.Rules, false},
+		{writers.info, content.Info, &summary.Info, false},
+		{writers.passes, content.Pass, &summary.Passes, false},
+		{writers.skips, content.Skips, &summary.Skips, true},
+	} {
+		err := writeEntries(kind.writer, orgID, cluster, kind.entries, kind.skipped)
+		if err != nil {
+			return err
+		}
+		*kind.count += len(kind.entries)
+	}
+	return nil
+}
+
+// FlattenReports method reads all reports, flattens them and streams the
+// rows into objects created in given sink under given prefix. Reports are
+// filtered by organizations the same way as exported report table. Reports
+// that can't be parsed are skipped and counted.
+func (storage DBStorage) FlattenReports(ctx context.Context, sink Sink, prefix string) (FlatteningSummary, error) {
+	var summary FlatteningSummary
+
+	query := selectReports
+	storage.applySelectiveExport(&query, reportTable)
+
+	rows, err := storage.query(ctx, reportTable, "read reports", query)
+	if err != nil {
+		return summary, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Error().Err(err).Msg(unableToCloseDBRowsHandle)
+		}
+	}()
+
+	writers, err := newFlattenedWriters(ctx, sink, prefix)
+	if err != nil {
+		return summary, err
+	}
+
+	for rows.Next() {
+		var orgID, cluster string
+		var report sql.NullString
+
+		err := rows.Scan(&orgID, &cluster, &report)
+		if err != nil {
+			writers.abort()
+			return summary, err
+		}
+
+		summary.Reports++
+		var content reportContent
+		err = json.Unmarshal([]byte(report.String), &content)
+		if err != nil {
+			log.Warn().Err(err).Str("cluster", cluster).Msg(unableToParseReport)
+			summary.Unparsable++
+			continue
+		}
+
+		err = writeReport(writers, &summary, orgID, cluster, &content)
+		if err != nil {
+			writers.abort()
+			return summary, err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		writers.abort()
+		return summary, err
+	}
+
+	if summary.Unparsable > 0 {
+		log.Warn().Int(unparsableReportCount, summary.Unparsable).Msg(unparsableReportsMsg)
+	}
+	return summary, writers.commit()
+}
+
+// FlatteningSummaryToJSON function exports summary of flattening into JSON.
+func FlatteningSummaryToJSON(buffer io.Writer, summary FlatteningSummary) error {
+	if buffer == nil {
+		err := errors.New(bufferIsNil)
+		return err
+	}
+
+	encoder := json.NewEncoder(buffer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(summary)
+}
@@ -0,0 +1,281 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/flatten_test.html
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// reportWithAllEntries contains report with rule hit, info, passed and
+// skipped entries
+const reportWithAllEntries = `{
+	"system": {"metadata": {}, "hostname": null},
+	"reports": [
+		{"rule_id": "rule.a|KEY_A", "component": "rule.a.report", "type": "rule",
+		 "key": "KEY_A", "details": {"nodes": ["n1", "n2"], "kcs": "x"}, "tags": [], "links": {}}
+	],
+	"fingerprints": [],
+	"info": [
+		{"info_id": "info.a|INFO_A", "component": "info.a.report", "type": "info",
+		 "key": "INFO_A", "details": {"version": "4.10"}}
+	],
+	"pass": [
+		{"pass_id": "rule.b|KEY_B", "component": "rule.b.report", "type": "pass",
+		 "key": "KEY_B", "details": null}
+	],
+	"skips": [
+		{"rule_fqdn": "rule.c.report", "reason": "MISSING_REQUIREMENTS",
+		 "details": "All: [x] Any: ", "type": "skip"}
+	]
+}`
+
+// reportStatements contains statements that create report table with
+// reports that can and can't be parsed
+var reportStatements = []string{
+	`CREATE TABLE report (org_id INTEGER, cluster VARCHAR, report VARCHAR)`,
+	`INSERT INTO report VALUES
+		(1, 'c1', '` + reportWithAllEntries + `'),
+		(1, 'c2', '{"reports": [{"component": "rule.a.report", "key": "KEY_A", "details": {}}]}'),
+		(2, 'c3', '{"reports": []}'),
+		(2, 'c4', 'not JSON'),
+		(3, 'c5', NULL)`,
+}
+
+// TestFlattenReports checks that reports are parsed into normalized rows
+func TestFlattenReports(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, reportStatements...)
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &testConfig)
+
+	directory := t.TempDir()
+	summary, err := storage.FlattenReports(context.Background(),
+		main.NewFileSink(directory, false), "prefix")
+	assert.NoError(t, err)
+	assert.Equal(t, main.FlatteningSummary{
+		Reports: 5, Unparsable: 2, Rules: 2, Info: 1, Passes: 1, Skips: 1,
+	}, summary)
+
+	directory = filepath.Join(directory, "prefix")
+	assert.Equal(t, [][]string{
+		{"org_id", "cluster", "rule_module", "error_key", "details"},
+		{"1", "c1", "rule.a.report", "KEY_A", `{"nodes":["n1","n2"],"kcs":"x"}`},
+		{"1", "c2", "rule.a.report", "KEY_A", `{}`},
+	}, readDisabledRulesReport(t, filepath.Join(directory, "_report_rules.csv")))
+	assert.Equal(t, [][]string{
+		{"org_id", "cluster", "rule_module", "error_key", "details"},
+		{"1", "c1", "info.a.report", "INFO_A", `{"version":"4.10"}`},
+	}, readDisabledRulesReport(t, filepath.Join(directory, "_report_info.csv")))
+	assert.Equal(t, [][]string{
+		{"org_id", "cluster", "rule_module", "error_key", "details"},
+		{"1", "c1", "rule.b.report", "KEY_B", ""},
+	}, readDisabledRulesReport(t, filepath.Join(directory, "_report_passes.csv")))
+	assert.Equal(t, [][]string{
+		{"org_id", "cluster", "rule_module", "reason", "details"},
+		{"1", "c1", "rule.c.report", "MISSING_REQUIREMENTS", `"All: [x] Any: "`},
+	}, readDisabledRulesReport(t, filepath.Join(directory, "_report_skips.csv")))
+
+	checkConnectionClose(t, connection)
+}
+
+// TestFlattenReportsOrgFiltering checks that reports are filtered by
+// organizations
+func TestFlattenReportsOrgFiltering(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, reportStatements...)
+
+	config := testConfig
+	config.EnableOrgIDFiltering = true
+	config.OrganizationsToExport = []string{"2"}
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	summary, err := storage.FlattenReports(context.Background(),
+		main.NewFileSink(t.TempDir(), false), "")
+	assert.NoError(t, err)
+	assert.Equal(t, main.FlatteningSummary{Reports: 2, Unparsable: 1}, summary)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestFlattenReportsMissingTable checks that missing report table is
+// reported and that no file is written
+func TestFlattenReportsMissingTable(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t)
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &testConfig)
+
+	directory := t.TempDir()
+	_, err := storage.FlattenReports(context.Background(), main.NewFileSink(directory, false), "")
+	assert.Error(t, err)
+
+	entries, err := os.ReadDir(directory)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestFlattenReportsAbortsObjects checks that flattened reports are not
+// stored partially when reading of reports fails
+func TestFlattenReportsAbortsObjects(t *testing.T) {
+	connection, mock := mustCreateMockConnection(t)
+
+	rows := sqlmock.NewRows([]string{"org_id", "cluster", "report"}).
+		AddRow("1", "c1", reportWithAllEntries).
+		AddRow("1", "c2", reportWithAllEntries).
+		RowError(1, errors.New("read failed"))
+	mock.ExpectQuery("SELECT org_id, cluster, report").WillReturnRows(rows)
+	mock.ExpectClose()
+
+	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
+
+	directory := t.TempDir()
+	_, err := storage.FlattenReports(context.Background(), main.NewFileSink(directory, false), "")
+	assert.EqualError(t, err, "read failed")
+
+	entries, err := os.ReadDir(directory)
+	assert.NoError(t, err)
+	assert.Empty(t, entries)
+
+	checkConnectionClose(t, connection)
+	checkAllExpectations(t, mock)
+}
+
+// failingCommitSink is sink that records committed and aborted objects and
+// fails to commit object with given name
+type failingCommitSink struct {
+	failingName string
+	committed   []string
+	aborted     []string
+}
+
+// failingCommitObject is object created by failingCommitSink
+type failingCommitObject struct {
+	sink *failingCommitSink
+	name string
+}
+
+// Create method creates object that records how it has been finished
+func (sink *failingCommitSink) Create(_ context.Context, name, _ string) (main.SinkObject, error) {
+	return &failingCommitObject{sink, name}, nil
+}
+
+// Read method reports that no object exists
+func (sink *failingCommitSink) Read(_ context.Context, _ string) ([]byte, bool, error) {
+	return nil, false, nil
+}
+
+// Write method discards written data
+func (object *failingCommitObject) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+// Commit method records committed object or fails for configured name
+func (object *failingCommitObject) Commit() error {
+	if object.name == object.sink.failingName {
+		return errors.New("commit failed")
+	}
+	object.sink.committed = append(object.sink.committed, object.name)
+	return nil
+}
+
+// Abort method records aborted object
+func (object *failingCommitObject) Abort() error {
+	object.sink.aborted = append(object.sink.aborted, object.name)
+	return nil
+}
+
+// TestFlattenReportsCommitFailure checks that objects that are not
+// committed yet are aborted when commit of one object fails
+func TestFlattenReportsCommitFailure(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, reportStatements...)
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &testConfig)
+
+	sink := &failingCommitSink{failingName: "_report_info.csv"}
+	_, err := storage.FlattenReports(context.Background(), sink, "")
+	assert.EqualError(t, err, "commit failed")
+
+	assert.Equal(t, []string{"_report_rules.csv"}, sink.committed)
+	assert.Equal(t, []string{"_report_passes.csv", "_report_skips.csv"}, sink.aborted)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestPerformDataExportFlattenReports checks that flattened reports are
+// stored into files next to tables
+func TestPerformDataExportFlattenReports(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareSQLiteDatabase(t, directory, reportStatements...)
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:         "file",
+		Limit:          NoLimits,
+		FlattenReports: true,
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	for _, fileName := range []string{"report.csv", "_report_rules.csv", "_report_info.csv",
+		"_report_passes.csv", "_report_skips.csv"} {
+		assert.FileExists(t, filepath.Join(directory, fileName))
+	}
+	assert.Len(t, readDisabledRulesReport(t, filepath.Join(directory, "_report_rules.csv")), 3)
+
+	content, err := os.ReadFile(filepath.Join(directory, "_report_flattening.json"))
+	assert.NoError(t, err)
+
+	var summary main.FlatteningSummary
+	assert.NoError(t, json.Unmarshal(content, &summary))
+	assert.Equal(t, 5, summary.Reports)
+	assert.Equal(t, 2, summary.Unparsable)
+}
+
+// TestPerformDataExportFlattenReportsS3 checks that flattened reports are
+// stored into S3 under configured prefix
+func TestPerformDataExportFlattenReportsS3(t *testing.T) {
+	configuration := prepareSQLiteDatabase(t, t.TempDir(), reportStatements...)
+	requests := mockS3(t, &configuration, "bucket")
+
+	cliFlags := main.CliFlags{
+		Output:         "S3",
+		Limit:          NoLimits,
+		FlattenReports: true,
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.Contains(t, requests(), "PUT /bucket/prefix/_report_rules.csv")
+	assert.Contains(t, requests(), "PUT /bucket/prefix/_report_skips.csv")
+	assert.Contains(t, requests(), "PUT /bucket/prefix/_report_flattening.json")
+}
@@ -0,0 +1,220 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains handling of signals and overall deadline. The
+// first SIGTERM or SIGINT (or reached deadline) requests a graceful stop:
+// table that is currently exported is finished, no other table is exported
+// and the run is marked as incomplete. The second signal cancels all
+// database queries and S3 uploads immediately.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/interrupt.html
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Messages
+const (
+	stopRequested         = "Stop requested, export will be stopped after the current table"
+	cancelRequested       = "Stop requested again, export is cancelled"
+	exportIncomplete      = "Export has been stopped, it is incomplete"
+	storeIncompleteFailed = "Store incomplete run marker failed"
+	signalMsg             = "signal"
+	reasonMsg             = "reason"
+)
+
+// errDeadlineReached is reported when export is stopped by deadline
+var errDeadlineReached = errors.New("deadline reached")
+
+// errExportStopped is returned by table loop when no other table should be
+// exported
+var errExportStopped = errors.New("export has been stopped")
+
+// Interruption tracks requests to stop the export, either by signal or by
+// reaching overall deadline.
+type Interruption struct {
+	// ctx is cancelled when export needs to be stopped immediately
+	ctx    context.Context
+	cancel context.CancelCauseFunc
+
+	// stop is cancelled when export needs to be stopped after the
+	// current table
+	stop       context.Context
+	stopCancel context.CancelCauseFunc
+
+	signals chan os.Signal
+	done    chan struct{}
+	once    sync.Once
+}
+
+// NewInterruption function starts handling of SIGTERM and SIGINT signals.
+// When deadline is positive, the export is stopped gracefully after given
+// duration. Close method needs to be called to stop handling signals.
+func NewInterruption(deadline time.Duration) *Interruption {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	stop, stopCancel := context.WithCancelCause(context.Background())
+
+	interruption := &Interruption{
+		ctx:        ctx,
+		cancel:     cancel,
+		stop:       stop,
+		stopCancel: stopCancel,
+		signals:    make(chan os.Signal, 2),
+		done:       make(chan struct{}),
+	}
+
+	if deadline > 0 {
+		var stopDeadline context.CancelFunc
+		interruption.stop, stopDeadline = context.WithTimeoutCause(stop,
+			deadline, errDeadlineReached)
+		interruption.stopCancel = func(cause error) {
+			stopCancel(cause)
+			stopDeadline()
+		}
+	}
+
+	signal.Notify(interruption.signals, syscall.SIGTERM, syscall.SIGINT)
+	go interruption.handleSignals()
+
+	return interruption
+}
+
+// handleSignals method waits for signals until the interruption is closed.
+func (interruption *Interruption) handleSignals() {
+	for {
+		select {
+		case sig := <-interruption.signals:
+			interruption.handleSignal(sig)
+		case <-interruption.done:
+			return
+		}
+	}
+}
+
+// handleSignal method requests graceful stop for the first signal and
+// cancels the export for any other one.
+func (interruption *Interruption) handleSignal(sig os.Signal) {
+	if !interruption.Stopped() {
+		log.Warn().Str(signalMsg, sig.String()).Msg(stopRequested)
+		interruption.stopCancel(fmt.Errorf("%s signal received", sig))
+		return
+	}
+
+	log.Warn().Str(signalMsg, sig.String()).Msg(cancelRequested)
+	interruption.cancel(fmt.Errorf("%s signal received again", sig))
+}
+
+// Context method returns context that is cancelled when export needs to be
+// stopped immediately. It should be used for all database queries and S3
+// uploads.
+func (interruption *Interruption) Context() context.Context {
+	return interruption.ctx
+}
+
+// Stopped method returns true when export needs to be stopped, either
+// gracefully or immediately.
+func (interruption *Interruption) Stopped() bool {
+	return interruption.stop.Err() != nil || interruption.ctx.Err() != nil
+}
+
+// Reason method returns the reason why export has been stopped.
+func (interruption *Interruption) Reason() error {
+	if interruption.ctx.Err() != nil {
+		return context.Cause(interruption.ctx)
+	}
+	return context.Cause(interruption.stop)
+}
+
+// Close method stops handling of signals and releases all resources.
+func (interruption *Interruption) Close() {
+	interruption.once.Do(func() {
+		signal.Stop(interruption.signals)
+		close(interruption.done)
+		interruption.stopCancel(context.Canceled)
+		interruption.cancel(context.Canceled)
+	})
+}
+
+// IncompleteRun represents marker stored when the export has been stopped
+// before all tables were exported.
+type IncompleteRun struct {
+	// Reason is textual representation of reason why export was stopped
+	Reason string `json:"reason"`
+
+	// StoppedAt is time when the export was stopped
+	StoppedAt time.Time `json:"stopped_at"`
+
+	// Exported contains tables that were exported completely
+	Exported []ExportedTable `json:"exported"`
+}
+
+// ExportedTable represents one table exported under given prefix.
+type ExportedTable struct {
+	// TableName is name of exported table
+	TableName TableName `json:"table"`
+
+	// Prefix is a directory or prefix of S3 object the table was exported
+	// into
+	Prefix string `json:"prefix,omitempty"`
+}
+
+// IncompleteRunToJSON function exports incomplete run marker into JSON.
+func IncompleteRunToJSON(buffer io.Writer, incomplete IncompleteRun) error {
+	if buffer == nil {
+		err := errors.New(bufferIsNil)
+		return err
+	}
+
+	encoder := json.NewEncoder(buffer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(incomplete)
+}
+
+// newIncompleteRun function constructs incomplete run marker.
+func newIncompleteRun(interruption *Interruption, exported []ExportedTable) IncompleteRun {
+	return IncompleteRun{
+		Reason:    interruption.Reason().Error(),
+		StoppedAt: time.Now().UTC(),
+		Exported:  exported,
+	}
+}
+
+// incomplete function reports export that has been stopped before all
+// tables were exported.
+func incomplete(interruption *Interruption, operationLogger *zerolog.Logger) (int, error) {
+	reason := interruption.Reason().Error()
+	log.Warn().Str(reasonMsg, reason).Msg(exportIncomplete)
+	operationLogger.Warn().Str(reasonMsg, reason).Msg(exportIncomplete)
+	return ExitStatusIncomplete, nil
+}
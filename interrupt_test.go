@@ -0,0 +1,136 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/interrupt_test.html
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// TestInterruptionNotStopped checks that export is not stopped without
+// signal or deadline
+func TestInterruptionNotStopped(t *testing.T) {
+	interruption := main.NewInterruption(0)
+	defer interruption.Close()
+
+	assert.False(t, interruption.Stopped())
+	assert.NoError(t, interruption.Context().Err())
+}
+
+// TestInterruptionDeadline checks that export is stopped gracefully when
+// deadline is reached
+func TestInterruptionDeadline(t *testing.T) {
+	interruption := main.NewInterruption(time.Millisecond)
+	defer interruption.Close()
+
+	assert.Eventually(t, interruption.Stopped, time.Second, time.Millisecond)
+	assert.EqualError(t, interruption.Reason(), "deadline reached")
+
+	// queries and uploads are not cancelled
+	assert.NoError(t, interruption.Context().Err())
+}
+
+// TestInterruptionSignals checks that the first signal stops export
+// gracefully and the second one cancels it
+func TestInterruptionSignals(t *testing.T) {
+	interruption := main.NewInterruption(0)
+	defer interruption.Close()
+
+	main.HandleSignal(interruption, syscall.SIGTERM)
+	assert.True(t, interruption.Stopped())
+	assert.EqualError(t, interruption.Reason(), "terminated signal received")
+	assert.NoError(t, interruption.Context().Err())
+
+	main.HandleSignal(interruption, syscall.SIGTERM)
+	assert.True(t, interruption.Stopped())
+	assert.EqualError(t, interruption.Reason(), "terminated signal received again")
+	assert.ErrorIs(t, interruption.Context().Err(), context.Canceled)
+}
+
+// TestInterruptionSIGTERM checks that SIGTERM sent to the process is handled
+func TestInterruptionSIGTERM(t *testing.T) {
+	interruption := main.NewInterruption(0)
+	defer interruption.Close()
+
+	err := syscall.Kill(os.Getpid(), syscall.SIGTERM)
+	assert.NoError(t, err)
+
+	assert.Eventually(t, interruption.Stopped, time.Second, time.Millisecond)
+	assert.NoError(t, interruption.Context().Err())
+}
+
+// TestIncompleteRunToJSONNilBuffer check how nil buffer is handled by
+// IncompleteRunToJSON function
+func TestIncompleteRunToJSONNilBuffer(t *testing.T) {
+	err := main.IncompleteRunToJSON(nil, main.IncompleteRun{})
+	assert.Error(t, err, "Buffer is nil")
+}
+
+// TestIncompleteRunToJSON check exporting incomplete run marker into JSON
+func TestIncompleteRunToJSON(t *testing.T) {
+	buffer := new(bytes.Buffer)
+
+	err := main.IncompleteRunToJSON(buffer, main.IncompleteRun{
+		Reason:   "deadline reached",
+		Exported: []main.ExportedTable{},
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, buffer.String(), `"reason": "deadline reached"`)
+	assert.Contains(t, buffer.String(), `"exported": []`)
+}
+
+// TestPerformDataExportDeadline checks that export is stopped when deadline
+// is reached and that the run is marked as incomplete
+func TestPerformDataExportDeadline(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:   "file",
+		Limit:    NoLimits,
+		Deadline: time.Nanosecond,
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.Equal(t, main.ExitStatusIncomplete, code)
+	assert.NoError(t, err)
+
+	// no table has been exported
+	assert.NoFileExists(t, filepath.Join(directory, "good.csv"))
+
+	content, err := os.ReadFile(filepath.Join(directory, "_incomplete.json"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `"reason": "deadline reached"`)
+	assert.Contains(t, string(content), `"exported": []`)
+}
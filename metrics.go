@@ -0,0 +1,195 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains Prometheus metrics pushed into Pushgateway at
+// the end of each export. The exporter is a batch job that can't be scraped,
+// so metrics are pushed instead. Metrics are added into the group (POST
+// method), so the timestamp of the last successful run is kept in
+// Pushgateway even when later runs fail.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/metrics.html
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/rs/zerolog/log"
+)
+
+// Messages
+const (
+	pushingMetrics    = "Pushing metrics into Pushgateway"
+	pushMetricsFailed = "Unable to push metrics into Pushgateway"
+	metricsPushed     = "Metrics pushed into Pushgateway"
+	pushGatewayURLMsg = "Pushgateway URL"
+)
+
+// Metrics related constants
+const (
+	defaultMetricsJob  = "insights_results_aggregator_exporter"
+	metricsNamespace   = "insights_results_aggregator_exporter"
+	tableLabel         = "table"
+	defaultPushTimeout = 10 * time.Second
+)
+
+// MetricsConfiguration represents configuration of Pushgateway the metrics
+// are pushed into
+type MetricsConfiguration struct {
+	// PushGatewayURL is URL of Pushgateway. Metrics are not pushed when
+	// the URL is not set.
+	PushGatewayURL string `mapstructure:"push_gateway_url" toml:"push_gateway_url"`
+
+	// JobName is name of job metrics are grouped by in Pushgateway
+	JobName string `mapstructure:"job_name" toml:"job_name"`
+
+	// Timeout limits time spent by pushing metrics
+	Timeout time.Duration `mapstructure:"timeout" toml:"timeout"`
+}
+
+// RunMetrics contains values measured during one export.
+type RunMetrics struct {
+	Duration   time.Duration
+	ExitStatus int
+	Finished   time.Time
+	Summary    *ExportSummary
+	RetryStats *RetryStats
+}
+
+// newRegistry function constructs registry with all metrics for given run.
+func newRegistry(runMetrics RunMetrics) *prometheus.Registry {
+	registry := prometheus.NewRegistry()
+
+	newGauge := func(name, help string) prometheus.Gauge {
+		gauge := prometheus.NewGauge(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      name,
+			Help:      help,
+		})
+		registry.MustRegister(gauge)
+		return gauge
+	}
+
+	newTableGauge := func(name, help string) *prometheus.GaugeVec {
+		gauge := prometheus.NewGaugeVec(prometheus.GaugeOpts{
+			Namespace: metricsNamespace,
+			Name:      name,
+			Help:      help,
+		}, []string{tableLabel})
+		registry.MustRegister(gauge)
+		return gauge
+	}
+
+	newGauge("run_duration_seconds",
+		"Duration of the last export run").Set(runMetrics.Duration.Seconds())
+	newGauge("exit_status",
+		"Exit status of the last export run").Set(float64(runMetrics.ExitStatus))
+	newGauge("last_run_timestamp_seconds",
+		"Time when the last export run finished").Set(float64(runMetrics.Finished.Unix()))
+
+	// not pushed for failed runs, so Pushgateway keeps the previous value
+	if runMetrics.ExitStatus == ExitStatusOK {
+		newGauge("last_success_timestamp_seconds",
+			"Time when the last successful export run finished").Set(float64(runMetrics.Finished.Unix()))
+	}
+
+	rows := newTableGauge("table_rows", "Number of rows exported from table")
+	bytes := newTableGauge("table_bytes", "Number of bytes exported from table")
+	durations := newTableGauge("table_duration_seconds", "Duration of table export")
+	failures := newTableGauge("table_failures", "Number of failed exports of table")
+	retries := newTableGauge("table_retries", "Number of retries performed during table export")
+	failedTables := newGauge("failed_tables", "Number of table exports that failed")
+
+	// partitions of the same table are summed up
+	if runMetrics.Summary != nil {
+		for _, tableSummary := range runMetrics.Summary.Tables {
+			table := string(tableSummary.TableName)
+			rows.WithLabelValues(table).Add(float64(tableSummary.Rows))
+			bytes.WithLabelValues(table).Add(float64(tableSummary.Bytes))
+			durations.WithLabelValues(table).Add(tableSummary.Duration)
+			failures.WithLabelValues(table).Add(0)
+			if tableSummary.Status == tableStatusFailed {
+				failures.WithLabelValues(table).Inc()
+				failedTables.Inc()
+			}
+		}
+	}
+
+	if runMetrics.RetryStats != nil {
+		for tableName, count := range runMetrics.RetryStats.retries {
+			if tableName == "" {
+				continue
+			}
+			retries.WithLabelValues(string(tableName)).Set(float64(count))
+		}
+	}
+
+	return registry
+}
+
+// pushMetrics function pushes metrics for given run into configured
+// Pushgateway. Failure to push metrics does not change the result of export,
+// so it is only logged.
+func pushMetrics(configuration MetricsConfiguration, runMetrics RunMetrics) error {
+	if configuration.PushGatewayURL == "" {
+		return nil
+	}
+
+	jobName := configuration.JobName
+	if jobName == "" {
+		jobName = defaultMetricsJob
+	}
+
+	timeout := configuration.Timeout
+	if timeout <= 0 {
+		timeout = defaultPushTimeout
+	}
+
+	log.Info().Str(pushGatewayURLMsg, configuration.PushGatewayURL).Msg(pushingMetrics)
+
+	err := push.New(configuration.PushGatewayURL, jobName).
+		Gatherer(newRegistry(runMetrics)).
+		Client(&http.Client{Timeout: timeout}).
+		Add()
+	if err != nil {
+		log.Error().Err(err).Str(pushGatewayURLMsg, configuration.PushGatewayURL).Msg(pushMetricsFailed)
+		return err
+	}
+
+	log.Info().Msg(metricsPushed)
+	return nil
+}
+
+// pushRunMetrics function pushes metrics of a run with its final exit status.
+// Nothing is pushed when the run did not perform any export.
+func pushRunMetrics(configuration *ConfigStruct, runMetrics *RunMetrics,
+	started time.Time, exitStatus int) error {
+	if runMetrics.Summary == nil {
+		return nil
+	}
+
+	runMetrics.Finished = time.Now()
+	runMetrics.Duration = runMetrics.Finished.Sub(started)
+	runMetrics.ExitStatus = exitStatus
+	return pushMetrics(GetMetricsConfiguration(configuration), *runMetrics)
+}
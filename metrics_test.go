@@ -0,0 +1,302 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/metrics_test.html
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// pushedRequest represents request received by local Pushgateway stand-in
+type pushedRequest struct {
+	method string
+	path   string
+	body   string
+}
+
+// mockPushGateway helper function starts HTTP server that records all
+// requests and responds with given status code
+func mockPushGateway(t *testing.T, statusCode int) (*httptest.Server, func() []pushedRequest) {
+	var mutex sync.Mutex
+	var requests []pushedRequest
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, err := io.ReadAll(r.Body)
+		assert.NoError(t, err)
+
+		mutex.Lock()
+		requests = append(requests, pushedRequest{r.Method, r.URL.Path, string(body)})
+		mutex.Unlock()
+
+		w.WriteHeader(statusCode)
+	}))
+	t.Cleanup(server.Close)
+
+	return server, func() []pushedRequest {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]pushedRequest{}, requests...)
+	}
+}
+
+// prepareRunMetrics helper function constructs metrics for one run
+func prepareRunMetrics(exitStatus int) main.RunMetrics {
+	summary := main.NewExportSummary()
+	summary.Add("report", "org_id=1",
+		main.TableStats{Rows: 10, Bytes: 100}, time.Second, nil)
+	summary.Add("report", "org_id=2",
+		main.TableStats{Rows: 5, Bytes: 50}, time.Second, nil)
+	summary.Add("rule_hit", "", main.TableStats{},
+		time.Second, errors.New("connection reset"))
+
+	retryStats := main.NewRetryStats()
+	retryStats.Add("report", 2)
+
+	return main.RunMetrics{
+		Duration:   time.Minute,
+		ExitStatus: exitStatus,
+		Finished:   time.Unix(1700000000, 0),
+		Summary:    summary,
+		RetryStats: retryStats,
+	}
+}
+
+// TestNewRegistry checks values of all metrics for one run
+func TestNewRegistry(t *testing.T) {
+	registry := main.NewRegistry(prepareRunMetrics(main.ExitStatusOK))
+
+	const expected = `
+# HELP insights_results_aggregator_exporter_exit_status Exit status of the last export run
+# TYPE insights_results_aggregator_exporter_exit_status gauge
+insights_results_aggregator_exporter_exit_status 0
+# HELP insights_results_aggregator_exporter_failed_tables Number of table exports that failed
+# TYPE insights_results_aggregator_exporter_failed_tables gauge
+insights_results_aggregator_exporter_failed_tables 1
+# HELP insights_results_aggregator_exporter_last_run_timestamp_seconds Time when the last export run finished
+# TYPE insights_results_aggregator_exporter_last_run_timestamp_seconds gauge
+insights_results_aggregator_exporter_last_run_timestamp_seconds 1.7e+09
+# HELP insights_results_aggregator_exporter_last_success_timestamp_seconds Time when the last successful export run finished
+# TYPE insights_results_aggregator_exporter_last_success_timestamp_seconds gauge
+insights_results_aggregator_exporter_last_success_timestamp_seconds 1.7e+09
+# HELP insights_results_aggregator_exporter_run_duration_seconds Duration of the last export run
+# TYPE insights_results_aggregator_exporter_run_duration_seconds gauge
+insights_results_aggregator_exporter_run_duration_seconds 60
+# HELP insights_results_aggregator_exporter_table_bytes Number of bytes exported from table
+# TYPE insights_results_aggregator_exporter_table_bytes gauge
+insights_results_aggregator_exporter_table_bytes{table="report"} 150
+insights_results_aggregator_exporter_table_bytes{table="rule_hit"} 0
+# HELP insights_results_aggregator_exporter_table_duration_seconds Duration of table export
+# TYPE insights_results_aggregator_exporter_table_duration_seconds gauge
+insights_results_aggregator_exporter_table_duration_seconds{table="report"} 2
+insights_results_aggregator_exporter_table_duration_seconds{table="rule_hit"} 1
+# HELP insights_results_aggregator_exporter_table_failures Number of failed exports of table
+# TYPE insights_results_aggregator_exporter_table_failures gauge
+insights_results_aggregator_exporter_table_failures{table="report"} 0
+insights_results_aggregator_exporter_table_failures{table="rule_hit"} 1
+# HELP insights_results_aggregator_exporter_table_retries Number of retries performed during table export
+# TYPE insights_results_aggregator_exporter_table_retries gauge
+insights_results_aggregator_exporter_table_retries{table="report"} 2
+# HELP insights_results_aggregator_exporter_table_rows Number of rows exported from table
+# TYPE insights_results_aggregator_exporter_table_rows gauge
+insights_results_aggregator_exporter_table_rows{table="report"} 15
+insights_results_aggregator_exporter_table_rows{table="rule_hit"} 0
+`
+	err := testutil.GatherAndCompare(registry, strings.NewReader(expected))
+	assert.NoError(t, err)
+}
+
+// TestNewRegistryFailedRun checks that timestamp of the last successful run
+// is not set when export fails
+func TestNewRegistryFailedRun(t *testing.T) {
+	registry := main.NewRegistry(prepareRunMetrics(main.ExitStatusStorageError))
+
+	count, err := testutil.GatherAndCount(registry,
+		"insights_results_aggregator_exporter_last_success_timestamp_seconds")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+
+	count, err = testutil.GatherAndCount(registry,
+		"insights_results_aggregator_exporter_exit_status")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count)
+}
+
+// TestNewRegistryEmptyRun checks metrics for run that failed before any
+// table was exported
+func TestNewRegistryEmptyRun(t *testing.T) {
+	registry := main.NewRegistry(main.RunMetrics{ExitStatus: main.ExitStatusConfigurationError})
+
+	count, err := testutil.GatherAndCount(registry,
+		"insights_results_aggregator_exporter_table_rows")
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+// TestPushMetricsDisabled checks that metrics are not pushed when
+// Pushgateway is not configured
+func TestPushMetricsDisabled(t *testing.T) {
+	err := main.PushMetrics(main.MetricsConfiguration{}, prepareRunMetrics(main.ExitStatusOK))
+	assert.NoError(t, err)
+}
+
+// TestPushMetrics checks that metrics are added into Pushgateway group
+func TestPushMetrics(t *testing.T) {
+	server, requests := mockPushGateway(t, http.StatusOK)
+
+	configuration := main.MetricsConfiguration{
+		PushGatewayURL: server.URL,
+		JobName:        "nightly_export",
+	}
+	err := main.PushMetrics(configuration, prepareRunMetrics(main.ExitStatusOK))
+	assert.NoError(t, err)
+
+	pushed := requests()
+	assert.Len(t, pushed, 1)
+	assert.Equal(t, http.MethodPost, pushed[0].method)
+	assert.Equal(t, "/metrics/job/nightly_export", pushed[0].path)
+	assert.Contains(t, pushed[0].body, "insights_results_aggregator_exporter_table_rows")
+	assert.Contains(t, pushed[0].body, "insights_results_aggregator_exporter_last_success_timestamp_seconds")
+}
+
+// TestPushMetricsDefaultJob checks that default job name is used when it is
+// not configured
+func TestPushMetricsDefaultJob(t *testing.T) {
+	server, requests := mockPushGateway(t, http.StatusOK)
+
+	configuration := main.MetricsConfiguration{PushGatewayURL: server.URL}
+	err := main.PushMetrics(configuration, prepareRunMetrics(main.ExitStatusOK))
+	assert.NoError(t, err)
+
+	pushed := requests()
+	assert.Len(t, pushed, 1)
+	assert.Equal(t, "/metrics/job/insights_results_aggregator_exporter", pushed[0].path)
+}
+
+// TestPushMetricsError checks that error returned by Pushgateway is reported
+func TestPushMetricsError(t *testing.T) {
+	server, _ := mockPushGateway(t, http.StatusInternalServerError)
+
+	configuration := main.MetricsConfiguration{PushGatewayURL: server.URL}
+	err := main.PushMetrics(configuration, prepareRunMetrics(main.ExitStatusOK))
+	assert.Error(t, err)
+}
+
+// TestPerformDataExportPushMetrics checks that metrics are pushed even when
+// export of some tables fails
+func TestPerformDataExportPushMetrics(t *testing.T) {
+	server, requests := mockPushGateway(t, http.StatusOK)
+
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	configuration.Metrics.PushGatewayURL = server.URL
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:          "file",
+		Limit:           NoLimits,
+		ContinueOnError: true,
+	}
+
+	runMetrics := main.RunMetrics{}
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, &runMetrics)
+	assert.Equal(t, main.ExitStatusPartialSuccess, code)
+	assert.NoError(t, err)
+
+	// nothing is pushed before the final exit status is known
+	assert.Empty(t, requests())
+
+	err = main.PushRunMetrics(&configuration, &runMetrics, time.Now(), code)
+	assert.NoError(t, err)
+
+	pushed := requests()
+	assert.Len(t, pushed, 1)
+	assert.Contains(t, pushed[0].body, "insights_results_aggregator_exporter_exit_status")
+	assert.Contains(t, pushed[0].body, "insights_results_aggregator_exporter_table_failures")
+	assert.NotContains(t, pushed[0].body, "insights_results_aggregator_exporter_last_success_timestamp_seconds")
+}
+
+// TestPerformDataExportPushMetricsOnError checks that metrics are pushed
+// when export fails before any table is exported
+func TestPerformDataExportPushMetricsOnError(t *testing.T) {
+	server, requests := mockPushGateway(t, http.StatusOK)
+
+	configuration := main.ConfigStruct{
+		Storage: main.StorageConfiguration{Driver: "unknown"},
+		Metrics: main.MetricsConfiguration{PushGatewayURL: server.URL},
+	}
+	cliFlags := main.CliFlags{Output: "file"}
+
+	runMetrics := main.RunMetrics{}
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, &runMetrics)
+	assert.Equal(t, main.ExitStatusStorageError, code)
+	assert.Error(t, err)
+
+	err = main.PushRunMetrics(&configuration, &runMetrics, time.Now(), code)
+	assert.NoError(t, err)
+	assert.Len(t, requests(), 1)
+}
+
+// TestPushRunMetricsFinalStatus checks that metrics are pushed with the exit
+// status given by caller, not the one reported by export
+func TestPushRunMetricsFinalStatus(t *testing.T) {
+	server, requests := mockPushGateway(t, http.StatusOK)
+
+	configuration := main.ConfigStruct{
+		Metrics: main.MetricsConfiguration{PushGatewayURL: server.URL},
+	}
+	runMetrics := prepareRunMetrics(main.ExitStatusOK)
+
+	err := main.PushRunMetrics(&configuration, &runMetrics, time.Now(), main.ExitStatusIOError)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusIOError, runMetrics.ExitStatus)
+
+	pushed := requests()
+	assert.Len(t, pushed, 1)
+	assert.NotContains(t, pushed[0].body, "insights_results_aggregator_exporter_last_success_timestamp_seconds")
+}
+
+// TestPushRunMetricsNoExport checks that nothing is pushed when the run did
+// not perform any export
+func TestPushRunMetricsNoExport(t *testing.T) {
+	server, requests := mockPushGateway(t, http.StatusOK)
+
+	configuration := main.ConfigStruct{
+		Metrics: main.MetricsConfiguration{PushGatewayURL: server.URL},
+	}
+
+	err := main.PushRunMetrics(&configuration, &main.RunMetrics{}, time.Now(), main.ExitStatusOK)
+	assert.NoError(t, err)
+	assert.Empty(t, requests())
+}
@@ -0,0 +1,264 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains operation log enabled by -export-log flag. The
+// log is written incrementally into local file, so it is not lost when
+// export fails or the process is killed. Each line carries ID of the run.
+// When data are exported into S3, the file is uploaded at the end of
+// export regardless of the export result and the last line contains status
+// of the run.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/operation_log.html
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Messages
+const (
+	operationLogInitialized = "Operation log initialized"
+	operationFinished       = "Operation finished"
+	storeOperationLogFailed = "Storing log into S3 failed"
+	closeOperationLogFailed = "Closing operation log failed"
+	runIDMsg                = "run_id"
+	runStatusMsg            = "status"
+	exitStatusMsg           = "exit_status"
+	operationLogFileMsg     = "file"
+)
+
+// Status of the whole run written into the last line of operation log
+const (
+	runStatusOK         = "ok"
+	runStatusPartial    = "partial"
+	runStatusIncomplete = "incomplete"
+	runStatusFailed     = "failed"
+)
+
+// runIDTimeFormat is format of time part of run ID
+const runIDTimeFormat = "20060102T150405Z"
+
+// OperationLogConfiguration represents configuration of operation log
+type OperationLogConfiguration struct {
+	// File is name of local file the operation log is written into. When
+	// not set, _logs.txt in output directory is used for file output and
+	// temporary file (removed after upload) is used for S3 output.
+	File string `mapstructure:"file" toml:"file"`
+
+	// Object is name of S3 object (under configured S3 prefix) the log is
+	// uploaded into. _logs.txt is used when not set.
+	Object string `mapstructure:"object" toml:"object"`
+}
+
+// OperationLog represents log of one run that is written into local file.
+type OperationLog struct {
+	// RunID identifies the run, it is written on every line of the log
+	RunID string
+
+	// Logger is used to write messages into operation log
+	Logger zerolog.Logger
+
+	file      *os.File
+	fileName  string
+	temporary bool
+}
+
+// newRunID function generates unique ID of run. The ID starts with UTC
+// time, so IDs of runs can be sorted.
+func newRunID() string {
+	random := make([]byte, 4)
+	// rand.Read never returns an error
+	_, _ = rand.Read(random)
+	return time.Now().UTC().Format(runIDTimeFormat) + "-" + hex.EncodeToString(random)
+}
+
+// NewOperationLog function constructs operation log of run with given ID for
+// given output. The log is discarded when it is not enabled by -export-log
+// flag or when dry run is performed.
+func NewOperationLog(cliFlags CliFlags, configuration OperationLogConfiguration,
+	runID string) (*OperationLog, error) {
+	operationLog := &OperationLog{
+		RunID:  runID,
+		Logger: zerolog.New(DummyWriter{}).With().Logger(),
+	}
+
+	if !cliFlags.ExportLog || cliFlags.DryRun {
+		return operationLog, nil
+	}
+
+	fileName := configuration.File
+	switch cliFlags.Output {
+	case s3Output:
+		if fileName == "" {
+			fileName = filepath.Join(os.TempDir(), operationLog.RunID+logFile)
+			operationLog.temporary = true
+		}
+	case fileOutput:
+		if fileName == "" {
+			err := createOutputDirectory(cliFlags.OutputDir)
+			if err != nil {
+				return operationLog, err
+			}
+			fileName = filepath.Join(cliFlags.OutputDir, logFile)
+		}
+	default:
+		return operationLog, fmt.Errorf(unknownOutputType, cliFlags.Output)
+	}
+
+	// log of previous run is not overwritten unless forced
+	flags := os.O_WRONLY | os.O_CREATE | os.O_EXCL
+	if cliFlags.Force {
+		flags = os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	}
+
+	// disable "G304 (CWE-22): Potential file inclusion via variable"
+	file, err := os.OpenFile(fileName, flags, 0o600) // #nosec G304
+	if errors.Is(err, fs.ErrExist) {
+		return operationLog, fmt.Errorf(fileAlreadyExists, fileName)
+	}
+	if err != nil {
+		return operationLog, err
+	}
+
+	operationLog.file = file
+	operationLog.fileName = fileName
+	operationLog.Logger = zerolog.New(file).With().
+		Timestamp().
+		Str(runIDMsg, operationLog.RunID).
+		Logger()
+	operationLog.Logger.Info().Str(operationLogFileMsg, fileName).Msg(operationLogInitialized)
+
+	return operationLog, nil
+}
+
+// runStatus function returns status of run for given exit status.
+func runStatus(exitStatus int) string {
+	switch exitStatus {
+	case ExitStatusOK:
+		return runStatusOK
+	case ExitStatusPartialSuccess:
+		return runStatusPartial
+	case ExitStatusIncomplete:
+		return runStatusIncomplete
+	default:
+		return runStatusFailed
+	}
+}
+
+// Finish method writes status of the run as the last line of the log.
+func (operationLog *OperationLog) Finish(exitStatus int, err error) {
+	event := operationLog.Logger.Info()
+	if exitStatus != ExitStatusOK {
+		event = operationLog.Logger.Error()
+	}
+	if err != nil {
+		event = event.Err(err)
+	}
+	event.Int(exitStatusMsg, exitStatus).
+		Str(runStatusMsg, runStatus(exitStatus)).
+		Msg(operationFinished)
+}
+
+// FileName method returns name of local file the log is written into or
+// empty string when the log is not enabled.
+func (operationLog *OperationLog) FileName() string {
+	return operationLog.fileName
+}
+
+// Close method closes the file the log is written into.
+func (operationLog *OperationLog) Close() error {
+	if operationLog.file == nil {
+		return nil
+	}
+	err := operationLog.file.Close()
+	operationLog.file = nil
+	return err
+}
+
+// Remove method removes the file the log has been written into when it is
+// temporary file.
+func (operationLog *OperationLog) Remove() error {
+	if !operationLog.temporary {
+		return nil
+	}
+	return os.Remove(operationLog.fileName)
+}
+
+// operationLogObject function returns name of S3 object the operation
+// log is uploaded into.
+func operationLogObject(configuration *ConfigStruct) string {
+	object := GetOperationLogConfiguration(configuration).Object
+	if object == "" {
+		object = logFile
+	}
+	return setObjectPrefix(GetS3Configuration(configuration).Prefix, object)
+}
+
+// finishOperationLog function writes status of the run into operation log,
+// closes it and uploads it into S3 when data are exported into S3. The log
+// is uploaded even when the export failed.
+func finishOperationLog(configuration *ConfigStruct, cliFlags CliFlags,
+	operationLog *OperationLog, exitStatus int, exitErr error) (int, error) {
+	operationLog.Finish(exitStatus, exitErr)
+
+	err := operationLog.Close()
+	if err != nil {
+		log.Err(err).Msg(closeOperationLogFailed)
+		return ExitStatusIOError, err
+	}
+
+	if !cliFlags.ExportLog || cliFlags.DryRun || cliFlags.Output != s3Output {
+		return ExitStatusOK, nil
+	}
+
+	minioClient, err := NewS3Connection(configuration)
+	if err != nil {
+		log.Err(err).Msg(storeOperationLogFailed)
+		return ExitStatusS3Error, err
+	}
+
+	err = storeOperationLogIntoS3(context.Background(), NewRetryPolicy(GetRetryConfiguration(configuration)), minioClient,
+		GetS3Configuration(configuration).Bucket,
+		operationLogObject(configuration), operationLog.FileName())
+	if err != nil {
+		log.Err(err).Msg(storeOperationLogFailed)
+		return ExitStatusS3Error, err
+	}
+
+	// local copy of uploaded log is not needed anymore
+	err = operationLog.Remove()
+	if err != nil {
+		log.Warn().Err(err).Msg(closeOperationLogFailed)
+	}
+
+	return ExitStatusOK, nil
+}
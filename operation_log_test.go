@@ -0,0 +1,296 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/operation_log_test.html
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// mustReadLogLines helper function reads all lines from operation log file
+func mustReadLogLines(t *testing.T, fileName string) []map[string]interface{} {
+	content, err := os.ReadFile(fileName)
+	assert.NoError(t, err)
+
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(content)), "\n") {
+		var decoded map[string]interface{}
+		err := json.Unmarshal([]byte(line), &decoded)
+		assert.NoError(t, err)
+		lines = append(lines, decoded)
+	}
+	return lines
+}
+
+// TestNewOperationLogDisabled checks that nothing is written when operation
+// log is not enabled
+func TestNewOperationLogDisabled(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	operationLog, err := main.NewOperationLog(main.CliFlags{Output: "file"},
+		main.OperationLogConfiguration{}, main.NewRunID())
+	assert.NoError(t, err)
+	assert.NotEmpty(t, operationLog.RunID)
+	assert.Empty(t, operationLog.FileName())
+
+	operationLog.Logger.Info().Msg("message")
+	assert.NoError(t, operationLog.Close())
+
+	_, err = os.Stat("_logs.txt")
+	assert.True(t, os.IsNotExist(err))
+}
+
+// TestNewOperationLogUnknownOutput checks that unknown output is reported
+func TestNewOperationLogUnknownOutput(t *testing.T) {
+	_, err := main.NewOperationLog(main.CliFlags{Output: "foo", ExportLog: true},
+		main.OperationLogConfiguration{}, main.NewRunID())
+	assert.EqualError(t, err, "Unknown output type: foo")
+}
+
+// TestNewOperationLogWrongFile checks that error is reported when log file
+// can't be created
+func TestNewOperationLogWrongFile(t *testing.T) {
+	_, err := main.NewOperationLog(main.CliFlags{Output: "file", ExportLog: true},
+		main.OperationLogConfiguration{
+			File: filepath.Join(t.TempDir(), "missing", "log.txt"),
+		}, main.NewRunID())
+	assert.Error(t, err)
+}
+
+// TestNewOperationLogDefaultFile checks that _logs.txt in current directory
+// is used for file output
+func TestNewOperationLogDefaultFile(t *testing.T) {
+	t.Chdir(t.TempDir())
+
+	operationLog, err := main.NewOperationLog(main.CliFlags{Output: "file", ExportLog: true},
+		main.OperationLogConfiguration{}, main.NewRunID())
+	assert.NoError(t, err)
+	assert.Equal(t, "_logs.txt", operationLog.FileName())
+	assert.NoError(t, operationLog.Close())
+
+	// log file is not temporary
+	assert.NoError(t, operationLog.Remove())
+	assert.FileExists(t, "_logs.txt")
+}
+
+// TestNewOperationLogOutputDirectory checks that _logs.txt is created in
+// output directory and that log of previous run is not overwritten unless
+// forced
+func TestNewOperationLogOutputDirectory(t *testing.T) {
+	directory := filepath.Join(t.TempDir(), "export")
+	cliFlags := main.CliFlags{Output: "file", ExportLog: true, OutputDir: directory}
+
+	operationLog, err := main.NewOperationLog(cliFlags,
+		main.OperationLogConfiguration{}, main.NewRunID())
+	assert.NoError(t, err)
+	assert.Equal(t, filepath.Join(directory, "_logs.txt"), operationLog.FileName())
+	assert.NoError(t, operationLog.Close())
+
+	_, err = main.NewOperationLog(cliFlags,
+		main.OperationLogConfiguration{}, main.NewRunID())
+	assert.Error(t, err)
+
+	cliFlags.Force = true
+	operationLog, err = main.NewOperationLog(cliFlags,
+		main.OperationLogConfiguration{}, main.NewRunID())
+	assert.NoError(t, err)
+	assert.NoError(t, operationLog.Close())
+}
+
+// TestNewOperationLogTemporaryFile checks that temporary file is used for
+// S3 output and that it is removed after upload
+func TestNewOperationLogTemporaryFile(t *testing.T) {
+	directory := t.TempDir()
+	t.Setenv("TMPDIR", directory)
+
+	operationLog, err := main.NewOperationLog(main.CliFlags{Output: "S3", ExportLog: true},
+		main.OperationLogConfiguration{}, main.NewRunID())
+	assert.NoError(t, err)
+	assert.Equal(t, directory, filepath.Dir(operationLog.FileName()))
+	assert.Contains(t, operationLog.FileName(), operationLog.RunID)
+	assert.NoError(t, operationLog.Close())
+
+	assert.NoError(t, operationLog.Remove())
+	assert.NoFileExists(t, operationLog.FileName())
+}
+
+// TestOperationLogIsWrittenIncrementally checks that messages are written
+// into file immediately and that every line carries run ID
+func TestOperationLogIsWrittenIncrementally(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "operation.log")
+
+	operationLog, err := main.NewOperationLog(main.CliFlags{Output: "S3", ExportLog: true},
+		main.OperationLogConfiguration{File: fileName}, main.NewRunID())
+	assert.NoError(t, err)
+	defer func() {
+		assert.NoError(t, operationLog.Close())
+	}()
+
+	operationLog.Logger.Info().Msg("Exporting tables")
+
+	// file is not closed yet
+	lines := mustReadLogLines(t, fileName)
+	assert.Len(t, lines, 2)
+	assert.Equal(t, "Exporting tables", lines[1]["message"])
+	for _, line := range lines {
+		assert.Equal(t, operationLog.RunID, line["run_id"])
+		assert.Contains(t, line, "time")
+	}
+
+	// configured file is not removed
+	assert.NoError(t, operationLog.Remove())
+	assert.FileExists(t, fileName)
+}
+
+// TestOperationLogFinish checks that status of the run is written as the
+// last line of the log
+func TestOperationLogFinish(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "operation.log")
+
+	operationLog, err := main.NewOperationLog(main.CliFlags{Output: "file", ExportLog: true},
+		main.OperationLogConfiguration{File: fileName}, main.NewRunID())
+	assert.NoError(t, err)
+
+	operationLog.Finish(main.ExitStatusStorageError, errors.New("connection refused"))
+	assert.NoError(t, operationLog.Close())
+
+	lines := mustReadLogLines(t, fileName)
+	last := lines[len(lines)-1]
+	assert.Equal(t, "Operation finished", last["message"])
+	assert.Equal(t, "error", last["level"])
+	assert.Equal(t, "failed", last["status"])
+	assert.Equal(t, float64(main.ExitStatusStorageError), last["exit_status"])
+	assert.Equal(t, "connection refused", last["error"])
+	assert.Equal(t, operationLog.RunID, last["run_id"])
+}
+
+// TestRunStatus checks status of run for all exit statuses
+func TestRunStatus(t *testing.T) {
+	assert.Equal(t, "ok", main.RunStatus(main.ExitStatusOK))
+	assert.Equal(t, "partial", main.RunStatus(main.ExitStatusPartialSuccess))
+	assert.Equal(t, "incomplete", main.RunStatus(main.ExitStatusIncomplete))
+	assert.Equal(t, "failed", main.RunStatus(main.ExitStatusStorageError))
+	assert.Equal(t, "failed", main.RunStatus(main.ExitStatusS3Error))
+}
+
+// TestOperationLogObject checks name of S3 object the log is uploaded into
+func TestOperationLogObject(t *testing.T) {
+	configuration := main.ConfigStruct{}
+	assert.Equal(t, "_logs.txt", main.OperationLogObject(&configuration))
+
+	configuration.S3.Prefix = "prefix"
+	assert.Equal(t, "prefix/_logs.txt", main.OperationLogObject(&configuration))
+
+	configuration.OperationLog.Object = "logs/export.log"
+	assert.Equal(t, "prefix/logs/export.log", main.OperationLogObject(&configuration))
+}
+
+// TestFinishOperationLogFileOutput checks that log is closed and kept in
+// file when data are exported into files
+func TestFinishOperationLogFileOutput(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "operation.log")
+	cliFlags := main.CliFlags{Output: "file", ExportLog: true}
+
+	operationLog, err := main.NewOperationLog(cliFlags,
+		main.OperationLogConfiguration{File: fileName}, main.NewRunID())
+	assert.NoError(t, err)
+
+	status, err := main.FinishOperationLog(&main.ConfigStruct{}, cliFlags,
+		operationLog, main.ExitStatusOK, nil)
+	assert.Equal(t, main.ExitStatusOK, status)
+	assert.NoError(t, err)
+
+	lines := mustReadLogLines(t, fileName)
+	assert.Equal(t, "ok", lines[len(lines)-1]["status"])
+}
+
+// TestFinishOperationLogS3Failure checks that failed upload is reported and
+// that local copy of the log is kept
+func TestFinishOperationLogS3Failure(t *testing.T) {
+	t.Setenv("TMPDIR", t.TempDir())
+	cliFlags := main.CliFlags{Output: "S3", ExportLog: true}
+
+	operationLog, err := main.NewOperationLog(cliFlags, main.OperationLogConfiguration{}, main.NewRunID())
+	assert.NoError(t, err)
+
+	configuration := main.ConfigStruct{
+		S3: main.S3Configuration{
+			EndpointURL:  "localhost",
+			EndpointPort: 1234,
+			Bucket:       "bucket",
+		},
+	}
+	status, err := main.FinishOperationLog(&configuration, cliFlags,
+		operationLog, main.ExitStatusStorageError, errors.New("export failed"))
+	assert.Equal(t, main.ExitStatusS3Error, status)
+	assert.Error(t, err)
+
+	lines := mustReadLogLines(t, operationLog.FileName())
+	assert.Equal(t, "failed", lines[len(lines)-1]["status"])
+}
+
+// TestStoreOperationLogIntoS3 checks the function storeOperationLogIntoS3
+func TestStoreOperationLogIntoS3(t *testing.T) {
+	ctx := context.Background()
+
+	fileName := filepath.Join(t.TempDir(), "operation.log")
+	err := os.WriteFile(fileName, []byte("{}\n"), 0o600)
+	assert.NoError(t, err)
+
+	// all test cases
+	testCases := s3ParametersTestCases(t)
+
+	// run all specified test cases
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			err := main.StoreOperationLogIntoS3(ctx, main.RetryPolicy{}, testCase.minioClient,
+				testCase.bucketName, testCase.objectName, fileName)
+
+			// check for error
+			if testCase.shouldFail {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), testCase.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestStoreOperationLogIntoS3MissingFile checks that missing log file is
+// reported
+func TestStoreOperationLogIntoS3MissingFile(t *testing.T) {
+	err := main.StoreOperationLogIntoS3(context.Background(), main.RetryPolicy{},
+		mustConstructMinioClient(t), "bucket", "object",
+		filepath.Join(t.TempDir(), "missing.log"))
+	assert.Error(t, err)
+}
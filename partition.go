@@ -0,0 +1,193 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains export partitioned by organizations. Each
+// organization is exported into its own directory (or prefix in S3) named
+// in Hive style, for example org_id=123/report.csv, so the export for one
+// organization is self-contained and tools like Spark or Athena are able to
+// prune partitions. Tables not related to organizations are exported only
+// once, outside of partitions.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/partition.html
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Messages
+const (
+	exportingPartition    = "Exporting partition"
+	orgIDMsg              = "org ID"
+	noPartitionsMsg       = "No organizations found, no partitions will be exported"
+	storePartitionsFailed = "Store partitions info failed"
+)
+
+// partitionDirectoryFormat is format of Hive-style partition directory
+const partitionDirectoryFormat = orgIDColumn + "=%s"
+
+// PartitionCount represents number of records exported from given table for
+// one organization.
+type PartitionCount struct {
+	OrgID     string
+	TableName TableName
+	Count     int
+}
+
+// tableStorer is a function that stores given table under given prefix
+// (directory or prefix of S3 object). Storage passed to the function has
+// subset plan for the exported partition already set.
+type tableStorer func(storage DBStorage, prefix string, tableName TableName) error
+
+// partitionPrefix function returns prefix for files or objects that belong
+// to given organization.
+func partitionPrefix(prefix, orgID string) string {
+	return setObjectPrefix(prefix, fmt.Sprintf(partitionDirectoryFormat, orgID))
+}
+
+// partitionOrgIDs method returns organizations to be exported into
+// partitions. Organizations selected in configuration are used when
+// filtering is enabled, otherwise all organizations found in tables filtered
+// directly by org_id column are used.
+func (storage DBStorage) partitionOrgIDs(ctx context.Context, structure subsetStructure) ([]string, error) {
+	if storage.config.EnableOrgIDFiltering {
+		orgIDs := append([]string{}, storage.config.OrganizationsToExport...)
+		sortOrgIDs(orgIDs)
+		return orgIDs, nil
+	}
+
+	found := make(map[string]bool)
+	orgIDs := make([]string, 0)
+
+	// tables that depend on other tables can't contain other organizations
+	plan := structure.plan(nil)
+	directCondition := fmt.Sprintf(orgIDCondition, "")
+
+	for _, tableName := range structure.tableNames {
+		if plan[tableName] != directCondition {
+			continue
+		}
+
+		tableOrgIDs, err := storage.ReadOrgIDs(ctx, tableName)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, orgID := range tableOrgIDs {
+			if !found[orgID] {
+				found[orgID] = true
+				orgIDs = append(orgIDs, orgID)
+			}
+		}
+	}
+
+	sortOrgIDs(orgIDs)
+	return orgIDs, nil
+}
+
+// storePartitionedTables function stores all tables that are not ignored
+// into partitions, one partition for each organization. Tables not related to
+// organizations are stored once under given prefix. Number of records stored
+// into each partition, as recorded by export statistic, is returned when
+// countRecords is set.
+func storePartitionedTables(ctx context.Context, storage DBStorage, tableNames []TableName,
+	ignoredTables IgnoredTables, prefix string, countRecords bool,
+	storeTable tableStorer, operationLogger *zerolog.Logger) ([]PartitionCount, error) {
+	counts := make([]PartitionCount, 0)
+
+	structure, err := storage.readSubsetStructure(ctx, tableNames)
+	if err != nil {
+		return counts, err
+	}
+
+	orgIDs, err := storage.partitionOrgIDs(ctx, structure)
+	if err != nil {
+		return counts, err
+	}
+
+	if len(orgIDs) == 0 {
+		log.Warn().Msg(noPartitionsMsg)
+		operationLogger.Warn().Msg(noPartitionsMsg)
+	}
+
+	// tables that need to be exported
+	var exportedTables []TableName
+	for _, tableName := range tableNames {
+		if _, found := ignoredTables[string(tableName)]; found {
+			operationLogger.Info().
+				Str(tableNameMsg, string(tableName)).
+				Msg(tableIsIgnored)
+			continue
+		}
+		exportedTables = append(exportedTables, tableName)
+	}
+
+	// tables without condition are not related to any organization
+	storage.subset = structure.plan(orgIDs)
+	for _, tableName := range exportedTables {
+		if storage.subset[tableName] != "" {
+			continue
+		}
+		operationLogger.Info().
+			Str(tableNameMsg, string(tableName)).
+			Msg(exportingTable)
+		err := storeTable(storage, prefix, tableName)
+		if err != nil {
+			return counts, err
+		}
+	}
+
+	for _, orgID := range orgIDs {
+		operationLogger.Info().Str(orgIDMsg, orgID).Msg(exportingPartition)
+
+		storage.subset = structure.plan([]string{orgID})
+		for _, tableName := range exportedTables {
+			if storage.subset[tableName] == "" {
+				continue
+			}
+			operationLogger.Info().
+				Str(orgIDMsg, orgID).
+				Str(tableNameMsg, string(tableName)).
+				Msg(exportingTable)
+			err := storeTable(storage, partitionPrefix(prefix, orgID), tableName)
+			if err != nil {
+				return counts, err
+			}
+
+			if !countRecords {
+				continue
+			}
+			// rows are counted when the partition is stored, so the
+			// table is not read again
+			counts = append(counts, PartitionCount{
+				OrgID:     orgID,
+				TableName: tableName,
+				Count:     storage.Stats(partitionPrefix(prefix, orgID), tableName).Rows,
+			})
+		}
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,179 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/partition_test.html
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// TestPartitionPrefix checks the function partitionPrefix
+func TestPartitionPrefix(t *testing.T) {
+	assert.Equal(t, "org_id=42", main.PartitionPrefix("", "42"))
+	assert.Equal(t, "prefix/org_id=42", main.PartitionPrefix("prefix", "42"))
+}
+
+// TestStorePartitionedTables checks that each organization found in data is
+// exported into its own partition and that tables not related to
+// organizations are exported once
+func TestStorePartitionedTables(t *testing.T) {
+	connection := mustCreateSubsetDatabase(t)
+
+	config := testConfig
+	config.EnableOrgIDFiltering = false
+	config.Relationships = clusterRelationships
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	tableNames, err := storage.ReadListOfTables(context.Background())
+	assert.NoError(t, err)
+
+	// record all stored tables together with exported rows
+	var stored []string
+	sink := main.NewFileSink(t.TempDir(), false)
+	storeTable := func(storage main.DBStorage, prefix string, tableName main.TableName) error {
+		err := storage.StoreTable(context.Background(), sink, prefix, tableName, NoLimits)
+		stored = append(stored, fmt.Sprintf("%s/%s:%d", prefix, tableName,
+			storage.Stats(prefix, tableName).Rows))
+		return err
+	}
+
+	ignoredTables := main.IgnoredTables{"toggle_note": struct{}{}}
+	counts, err := main.StorePartitionedTables(context.Background(), *storage, tableNames,
+		ignoredTables, "prefix", true, storeTable, &log.Logger)
+	assert.NoError(t, err)
+
+	assert.Equal(t, []string{
+		"prefix/migration_info:1",
+		"prefix/org_id=1/cluster_rule_toggle:2",
+		"prefix/org_id=1/report:2",
+		"prefix/org_id=1/report_info:1",
+		"prefix/org_id=2/cluster_rule_toggle:0",
+		"prefix/org_id=2/report:1",
+		"prefix/org_id=2/report_info:1",
+		"prefix/org_id=3/cluster_rule_toggle:1",
+		"prefix/org_id=3/report:1",
+		"prefix/org_id=3/report_info:1",
+	}, stored)
+
+	assert.Equal(t, []main.PartitionCount{
+		{OrgID: "1", TableName: "cluster_rule_toggle", Count: 2},
+		{OrgID: "1", TableName: "report", Count: 2},
+		{OrgID: "1", TableName: "report_info", Count: 1},
+		{OrgID: "2", TableName: "cluster_rule_toggle", Count: 0},
+		{OrgID: "2", TableName: "report", Count: 1},
+		{OrgID: "2", TableName: "report_info", Count: 1},
+		{OrgID: "3", TableName: "cluster_rule_toggle", Count: 1},
+		{OrgID: "3", TableName: "report", Count: 1},
+		{OrgID: "3", TableName: "report_info", Count: 1},
+	}, counts)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestStorePartitionedTablesSelectedOrganizations checks that organizations
+// selected in configuration are used for partitioning
+func TestStorePartitionedTablesSelectedOrganizations(t *testing.T) {
+	connection := mustCreateSubsetDatabase(t)
+
+	config := testConfig
+	config.EnableOrgIDFiltering = true
+	config.OrganizationsToExport = []string{"3", "1"}
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	tableNames, err := storage.ReadListOfTables(context.Background())
+	assert.NoError(t, err)
+
+	var prefixes []string
+	storeTable := func(_ main.DBStorage, prefix string, tableName main.TableName) error {
+		if tableName == "report" {
+			prefixes = append(prefixes, prefix)
+		}
+		return nil
+	}
+
+	counts, err := main.StorePartitionedTables(context.Background(), *storage, tableNames,
+		main.IgnoredTables{}, "", false, storeTable, &log.Logger)
+	assert.NoError(t, err)
+
+	// partitions are exported in org ID order
+	assert.Equal(t, []string{"org_id=1", "org_id=3"}, prefixes)
+
+	// records are not counted
+	assert.Empty(t, counts)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestStorePartitionedTablesStoreError checks that error returned during
+// storing table is propagated
+func TestStorePartitionedTablesStoreError(t *testing.T) {
+	connection := mustCreateSubsetDatabase(t)
+
+	config := testConfig
+	config.EnableOrgIDFiltering = false
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	tableNames, err := storage.ReadListOfTables(context.Background())
+	assert.NoError(t, err)
+
+	storeError := errors.New("store error")
+	storeTable := func(_ main.DBStorage, _ string, _ main.TableName) error {
+		return storeError
+	}
+
+	_, err = main.StorePartitionedTables(context.Background(), *storage, tableNames,
+		main.IgnoredTables{}, "", false, storeTable, &log.Logger)
+	assert.ErrorIs(t, err, storeError)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestStoreTableIntoDirectory checks that table is stored into partition
+// directory that is created when needed
+func TestStoreTableIntoDirectory(t *testing.T) {
+	connection := mustCreateSubsetDatabase(t)
+
+	directory := mustCreateTemporaryDirectory(t)
+	defer mustRemoveTempDirectory(t, directory)
+
+	config := testConfig
+	config.EnableOrgIDFiltering = false
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	partition := main.PartitionPrefix(directory, "1")
+	err := storage.StoreTable(context.Background(), main.NewFileSink("", false), partition, "report", NoLimits)
+	assert.NoError(t, err)
+
+	checkFileContent(t, filepath.Join(partition, "report.csv"),
+		"org_id,cluster\n1,a\n1,b\n2,c\n3,d\n")
+
+	checkConnectionClose(t, connection)
+}
@@ -0,0 +1,262 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains preflight checks selected by -preflight flag.
+// The checks verify that the export can be performed with actual
+// configuration: database connectivity and credentials, read permission on
+// every selected table, readability of CSV file with organization IDs and
+// write permission to S3 bucket. Pass/fail checklist is printed and non-zero
+// exit status is returned when any check fails, so the checks can be run as
+// an init step of deployment.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/preflight.html
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog/log"
+)
+
+// Messages
+const (
+	preflightFailed    = "preflight check failed"
+	bucketNotFound     = "bucket %s not found"
+	skippedNoDatabase  = "database is not accessible"
+	skippedNoS3        = "S3 is not accessible"
+	skippedFileOutput  = "output is not S3"
+	skippedNoFiltering = "selective export is disabled"
+)
+
+// Status of one check
+const (
+	checkPassed  = "PASS"
+	checkFailed  = "FAIL"
+	checkSkipped = "SKIP"
+)
+
+// Names of checks
+const (
+	databaseConnectionCheck = "database connection"
+	listOfTablesCheck       = "list of tables"
+	readTableCheck          = "read table %s"
+	organizationsCSVCheck   = "organization IDs CSV file"
+	s3ConnectionCheck       = "S3 connection"
+	s3BucketCheck           = "S3 bucket %s"
+	s3WriteCheck            = "S3 write permission"
+)
+
+// probeObject is prefix of object written into S3 to check write permission
+const probeObject = "_preflight_"
+
+// CheckResult represents result of one preflight check
+type CheckResult struct {
+	Name   string
+	Status string
+	Detail string
+}
+
+// Checklist contains results of all preflight checks
+type Checklist struct {
+	Checks []CheckResult
+}
+
+// Pass method records passed check.
+func (checklist *Checklist) Pass(name, detail string) {
+	checklist.Checks = append(checklist.Checks, CheckResult{name, checkPassed, detail})
+}
+
+// Fail method records failed check.
+func (checklist *Checklist) Fail(name string, err error) {
+	log.Error().Err(err).Str("check", name).Msg(preflightFailed)
+	checklist.Checks = append(checklist.Checks, CheckResult{name, checkFailed, err.Error()})
+}
+
+// Skip method records check that has not been performed.
+func (checklist *Checklist) Skip(name, reason string) {
+	checklist.Checks = append(checklist.Checks, CheckResult{name, checkSkipped, reason})
+}
+
+// Failed method returns true when any check failed.
+func (checklist *Checklist) Failed() bool {
+	for _, check := range checklist.Checks {
+		if check.Status == checkFailed {
+			return true
+		}
+	}
+	return false
+}
+
+// PrintChecklist function prints results of all checks, one check per line.
+func PrintChecklist(output io.Writer, checklist *Checklist) error {
+	if output == nil {
+		err := errors.New(bufferIsNil)
+		return err
+	}
+
+	for _, check := range checklist.Checks {
+		line := fmt.Sprintf("[%s] %s", check.Status, check.Name)
+		if check.Detail != "" {
+			line += ": " + check.Detail
+		}
+		_, err := fmt.Fprintln(output, line)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPreflight function performs all preflight checks and prints the
+// checklist into given output.
+func runPreflight(configuration *ConfigStruct, cliFlags CliFlags, output io.Writer) (int, error) {
+	log.Info().Msg("Performing preflight checks")
+
+	checklist := &Checklist{}
+	checkDatabase(configuration, cliFlags, checklist)
+	checkOrganizationsCSV(configuration, checklist)
+	checkS3Write(configuration, cliFlags, checklist)
+
+	err := PrintChecklist(output, checklist)
+	if err != nil {
+		return ExitStatusIOError, err
+	}
+
+	if checklist.Failed() {
+		return ExitStatusPreflightFailed, errors.New(preflightFailed)
+	}
+	return ExitStatusOK, nil
+}
+
+// checkDatabase function checks connection to database and read permission
+// on all tables selected for export.
+func checkDatabase(configuration *ConfigStruct, cliFlags CliFlags, checklist *Checklist) {
+	// GetStorageConfiguration is not used, because it exits when file
+	// with organization IDs can't be read; that is checked separately
+	storageConfiguration := configuration.Storage
+	// connection is checked once, transient errors are reported too
+	ctx := context.Background()
+	storage, err := NewStorage(ctx, &storageConfiguration, RetryPolicy{})
+	if err != nil {
+		checklist.Fail(databaseConnectionCheck, err)
+		checklist.Skip(listOfTablesCheck, skippedNoDatabase)
+		return
+	}
+	defer func() {
+		_ = storage.Close()
+	}()
+	checklist.Pass(databaseConnectionCheck, storage.dbSystem())
+
+	tableNames, err := storage.ReadListOfTables(ctx)
+	if err != nil {
+		checklist.Fail(listOfTablesCheck, err)
+		return
+	}
+	checklist.Pass(listOfTablesCheck, fmt.Sprintf("%d tables", len(tableNames)))
+
+	ignoredTables := constructIgnoredTablesMap(cliFlags.IgnoredTables)
+	for _, tableName := range tableNames {
+		if _, found := ignoredTables[string(tableName)]; found {
+			continue
+		}
+		name := fmt.Sprintf(readTableCheck, tableName)
+		_, err := storage.RetrieveColumnTypes(ctx, tableName)
+		if err != nil {
+			checklist.Fail(name, err)
+			continue
+		}
+		checklist.Pass(name, "")
+	}
+}
+
+// checkOrganizationsCSV function checks that CSV file with organization IDs
+// can be read when selective export is enabled.
+func checkOrganizationsCSV(configuration *ConfigStruct, checklist *Checklist) {
+	if !configuration.Storage.EnableOrgIDFiltering {
+		checklist.Skip(organizationsCSVCheck, skippedNoFiltering)
+		return
+	}
+
+	organizations, err := GetOrganizationsToExport(configuration)
+	if err != nil {
+		checklist.Fail(organizationsCSVCheck, err)
+		return
+	}
+	checklist.Pass(organizationsCSVCheck, fmt.Sprintf("%d organizations", len(organizations)))
+}
+
+// checkS3Write function checks that configured bucket exists and that
+// objects can be written into it. Probe object is written and deleted.
+func checkS3Write(configuration *ConfigStruct, cliFlags CliFlags, checklist *Checklist) {
+	if cliFlags.Output != s3Output {
+		checklist.Skip(s3ConnectionCheck, skippedFileOutput)
+		return
+	}
+
+	minioClient, err := NewS3Connection(configuration)
+	if err != nil {
+		checklist.Fail(s3ConnectionCheck, err)
+		checklist.Skip(s3WriteCheck, skippedNoS3)
+		return
+	}
+	checklist.Pass(s3ConnectionCheck, "")
+
+	ctx := context.Background()
+
+	s3Configuration := GetS3Configuration(configuration)
+	bucketName := s3Configuration.Bucket
+	bucketCheck := fmt.Sprintf(s3BucketCheck, bucketName)
+
+	exists, err := s3BucketExists(ctx, minioClient, bucketName)
+	if err == nil && !exists {
+		err = fmt.Errorf(bucketNotFound, bucketName)
+	}
+	if err != nil {
+		checklist.Fail(bucketCheck, err)
+		checklist.Skip(s3WriteCheck, skippedNoS3)
+		return
+	}
+	checklist.Pass(bucketCheck, "")
+
+	objectName := setObjectPrefix(s3Configuration.Prefix, probeObject+newRunID())
+	err = writeProbeObject(ctx, minioClient, bucketName, objectName)
+	if err != nil {
+		checklist.Fail(s3WriteCheck, err)
+		return
+	}
+	checklist.Pass(s3WriteCheck, objectName)
+}
+
+// writeProbeObject function writes empty object into S3 and deletes it.
+func writeProbeObject(ctx context.Context, minioClient *minio.Client,
+	bucketName, objectName string) error {
+	_, err := minioClient.PutObject(ctx, bucketName, objectName,
+		bytes.NewReader(nil), 0, minio.PutObjectOptions{})
+	if err != nil {
+		return err
+	}
+	return minioClient.RemoveObject(ctx, bucketName, objectName, minio.RemoveObjectOptions{})
+}
@@ -0,0 +1,332 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/preflight_test.html
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// mockS3 helper function starts HTTP server that behaves like S3 with one
+// bucket and configures connection to it. Methods and paths of all requests
+// are recorded and uploaded objects can be read back.
+func mockS3(t *testing.T, configuration *main.ConfigStruct, bucketName string) func() []string {
+	var mutex sync.Mutex
+	var requests []string
+	objects := make(map[string][]byte)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		mutex.Unlock()
+
+		if !strings.HasPrefix(r.URL.Path, "/"+bucketName+"/") && r.URL.Path != "/"+bucketName {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		switch {
+		case r.URL.Query().Has("location"):
+			_, _ = w.Write([]byte(`<LocationConstraint>us-east-1</LocationConstraint>`))
+		case r.Method == http.MethodPut:
+			body, err := io.ReadAll(r.Body)
+			assert.NoError(t, err)
+			if strings.HasPrefix(r.Header.Get("X-Amz-Content-Sha256"), "STREAMING-") {
+				body = decodeChunkedPayload(t, body)
+			}
+			mutex.Lock()
+			objects[r.URL.Path] = body
+			mutex.Unlock()
+			w.Header().Set("ETag", `"d41d8cd98f00b204e9800998ecf8427e"`)
+		case r.URL.Query().Get("list-type") == "2":
+			listObjects(w, r.URL.Query().Get("prefix"), bucketName, &mutex, objects)
+		case r.Method == http.MethodGet && strings.Count(r.URL.Path, "/") > 1:
+			mutex.Lock()
+			body, found := objects[r.URL.Path]
+			mutex.Unlock()
+			if !found {
+				w.Header().Set("Content-Type", "application/xml")
+				w.WriteHeader(http.StatusNotFound)
+				_, _ = w.Write([]byte(`<Error><Code>NoSuchKey</Code></Error>`))
+				return
+			}
+			w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+			w.Header().Set("Last-Modified", "Mon, 2 Jan 2006 15:04:05 GMT")
+			_, _ = w.Write(body)
+		case r.Method == http.MethodDelete:
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+	t.Cleanup(server.Close)
+
+	host, port, err := net.SplitHostPort(server.Listener.Addr().String())
+	assert.NoError(t, err)
+	portNumber, err := strconv.Atoi(port)
+	assert.NoError(t, err)
+
+	configuration.S3 = main.S3Configuration{
+		EndpointURL:     host,
+		EndpointPort:    uint(portNumber),
+		AccessKeyID:     "access",
+		SecretAccessKey: "secret",
+		Bucket:          "bucket",
+		Prefix:          "prefix",
+	}
+
+	return func() []string {
+		mutex.Lock()
+		defer mutex.Unlock()
+		return append([]string{}, requests...)
+	}
+}
+
+// listObjects helper function writes list of stored objects with given
+// prefix in the format of S3 ListObjectsV2 response
+func listObjects(w http.ResponseWriter, prefix, bucketName string,
+	mutex *sync.Mutex, objects map[string][]byte) {
+	mutex.Lock()
+	defer mutex.Unlock()
+
+	var keys []string
+	for path := range objects {
+		key := strings.TrimPrefix(path, "/"+bucketName+"/")
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	response := "<ListBucketResult><Name>" + bucketName + "</Name><Prefix>" + prefix +
+		"</Prefix><KeyCount>" + strconv.Itoa(len(keys)) + "</KeyCount><IsTruncated>false</IsTruncated>"
+	for _, key := range keys {
+		response += "<Contents><Key>" + key + "</Key><LastModified>2006-01-02T15:04:05.000Z</LastModified>" +
+			"<Size>" + strconv.Itoa(len(objects["/"+bucketName+"/"+key])) + "</Size></Contents>"
+	}
+	response += "</ListBucketResult>"
+
+	w.Header().Set("Content-Type", "application/xml")
+	_, _ = w.Write([]byte(response))
+}
+
+// decodeChunkedPayload helper function removes chunk headers from payload
+// uploaded with streaming signature
+func decodeChunkedPayload(t *testing.T, payload []byte) []byte {
+	var decoded []byte
+	for len(payload) > 0 {
+		header, rest, found := bytes.Cut(payload, []byte("\r\n"))
+		assert.True(t, found)
+
+		size, _, _ := strings.Cut(string(header), ";")
+		length, err := strconv.ParseInt(size, 16, 64)
+		assert.NoError(t, err)
+		if length == 0 {
+			break
+		}
+
+		decoded = append(decoded, rest[:length]...)
+		payload = bytes.TrimPrefix(rest[length:], []byte("\r\n"))
+	}
+	return decoded
+}
+
+// TestPrintChecklist checks printing of preflight checklist
+func TestPrintChecklist(t *testing.T) {
+	checklist := &main.Checklist{}
+	checklist.Pass("database connection", "sqlite")
+	checklist.Fail("read table bad", errors.New("no such table"))
+	checklist.Skip("S3 connection", "output is not S3")
+
+	assert.True(t, checklist.Failed())
+
+	buffer := new(bytes.Buffer)
+	err := main.PrintChecklist(buffer, checklist)
+	assert.NoError(t, err)
+
+	expected := "[PASS] database connection: sqlite\n" +
+		"[FAIL] read table bad: no such table\n" +
+		"[SKIP] S3 connection: output is not S3\n"
+	assert.Equal(t, expected, buffer.String())
+}
+
+// TestPrintChecklistNilBuffer check how nil output is handled by
+// PrintChecklist function
+func TestPrintChecklistNilBuffer(t *testing.T) {
+	err := main.PrintChecklist(nil, &main.Checklist{})
+	assert.Error(t, err, "Buffer is nil")
+}
+
+// TestRunPreflightPassed checks that all checks pass for accessible database
+// when broken view is ignored
+func TestRunPreflightPassed(t *testing.T) {
+	configuration := prepareFailingDatabase(t, t.TempDir())
+	cliFlags := main.CliFlags{Output: "file", IgnoredTables: "bad"}
+
+	buffer := new(bytes.Buffer)
+	code, err := main.RunPreflight(&configuration, cliFlags, buffer)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.NoError(t, err)
+
+	output := buffer.String()
+	assert.Contains(t, output, "[PASS] database connection: sqlite\n")
+	assert.Contains(t, output, "[PASS] list of tables: 2 tables\n")
+	assert.Contains(t, output, "[PASS] read table good\n")
+	assert.NotContains(t, output, "read table bad")
+	assert.Contains(t, output, "[SKIP] organization IDs CSV file: selective export is disabled\n")
+	assert.Contains(t, output, "[SKIP] S3 connection: output is not S3\n")
+}
+
+// TestRunPreflightUnreadableTable checks that table that can't be read is
+// reported
+func TestRunPreflightUnreadableTable(t *testing.T) {
+	configuration := prepareFailingDatabase(t, t.TempDir())
+	cliFlags := main.CliFlags{Output: "file"}
+
+	buffer := new(bytes.Buffer)
+	code, err := main.RunPreflight(&configuration, cliFlags, buffer)
+	assert.Equal(t, main.ExitStatusPreflightFailed, code)
+	assert.Error(t, err)
+
+	output := buffer.String()
+	assert.Contains(t, output, "[PASS] read table good\n")
+	assert.Contains(t, output, "[FAIL] read table bad: no such table: main.removed\n")
+}
+
+// TestRunPreflightNoDatabase checks that inaccessible database is reported
+func TestRunPreflightNoDatabase(t *testing.T) {
+	configuration := main.ConfigStruct{
+		Storage: main.StorageConfiguration{Driver: "unknown"},
+	}
+	cliFlags := main.CliFlags{Output: "file"}
+
+	buffer := new(bytes.Buffer)
+	code, err := main.RunPreflight(&configuration, cliFlags, buffer)
+	assert.Equal(t, main.ExitStatusPreflightFailed, code)
+	assert.Error(t, err)
+
+	output := buffer.String()
+	assert.Contains(t, output, "[FAIL] database connection: driver unknown is not supported\n")
+	assert.Contains(t, output, "[SKIP] list of tables: database is not accessible\n")
+}
+
+// TestRunPreflightOrganizationsCSV checks that CSV file with organization
+// IDs is read when selective export is enabled
+func TestRunPreflightOrganizationsCSV(t *testing.T) {
+	configuration := prepareFailingDatabase(t, t.TempDir())
+	configuration.Storage.EnableOrgIDFiltering = true
+	configuration.Storage.OrganizationIDsCSVFile = "tests/db_exporter_organization_ids.csv"
+	cliFlags := main.CliFlags{Output: "file", IgnoredTables: "bad"}
+
+	buffer := new(bytes.Buffer)
+	code, err := main.RunPreflight(&configuration, cliFlags, buffer)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.NoError(t, err)
+	assert.Contains(t, buffer.String(), "[PASS] organization IDs CSV file")
+
+	configuration.Storage.OrganizationIDsCSVFile = "tests/missing.csv"
+
+	buffer.Reset()
+	code, err = main.RunPreflight(&configuration, cliFlags, buffer)
+	assert.Equal(t, main.ExitStatusPreflightFailed, code)
+	assert.Error(t, err)
+	assert.Contains(t, buffer.String(), "[FAIL] organization IDs CSV file")
+}
+
+// TestRunPreflightS3 checks that probe object is written into S3 and deleted
+func TestRunPreflightS3(t *testing.T) {
+	configuration := prepareFailingDatabase(t, t.TempDir())
+	requests := mockS3(t, &configuration, "bucket")
+	cliFlags := main.CliFlags{Output: "S3", IgnoredTables: "bad"}
+
+	buffer := new(bytes.Buffer)
+	code, err := main.RunPreflight(&configuration, cliFlags, buffer)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.NoError(t, err)
+
+	output := buffer.String()
+	assert.Contains(t, output, "[PASS] S3 connection\n")
+	assert.Contains(t, output, "[PASS] S3 bucket bucket\n")
+	assert.Contains(t, output, "[PASS] S3 write permission: prefix/_preflight_")
+
+	var put, deleted string
+	for _, request := range requests() {
+		if strings.HasPrefix(request, http.MethodPut+" ") {
+			put = strings.TrimPrefix(request, http.MethodPut+" ")
+		}
+		if strings.HasPrefix(request, http.MethodDelete+" ") {
+			deleted = strings.TrimPrefix(request, http.MethodDelete+" ")
+		}
+	}
+	assert.Contains(t, put, "/bucket/prefix/_preflight_")
+	assert.Equal(t, put, deleted)
+}
+
+// TestRunPreflightS3MissingBucket checks that missing bucket is reported
+func TestRunPreflightS3MissingBucket(t *testing.T) {
+	configuration := prepareFailingDatabase(t, t.TempDir())
+	mockS3(t, &configuration, "other")
+	cliFlags := main.CliFlags{Output: "S3", IgnoredTables: "bad"}
+
+	buffer := new(bytes.Buffer)
+	code, err := main.RunPreflight(&configuration, cliFlags, buffer)
+	assert.Equal(t, main.ExitStatusPreflightFailed, code)
+	assert.Error(t, err)
+
+	output := buffer.String()
+	assert.Contains(t, output, "[FAIL] S3 bucket bucket: bucket bucket not found\n")
+	assert.Contains(t, output, "[SKIP] S3 write permission: S3 is not accessible\n")
+}
+
+// TestCheckS3ConnectionMissingBucket checks that missing bucket is reported
+// by -check-s3-connection
+func TestCheckS3ConnectionMissingBucket(t *testing.T) {
+	configuration := main.ConfigStruct{}
+	mockS3(t, &configuration, "other")
+
+	code, err := main.CheckS3Connection(&configuration)
+	assert.Equal(t, main.ExitStatusS3Error, code)
+	assert.EqualError(t, err, "bucket bucket not found")
+}
+
+// TestCheckS3ConnectionBucketFound checks that existing bucket is found by
+// -check-s3-connection
+func TestCheckS3ConnectionBucketFound(t *testing.T) {
+	configuration := main.ConfigStruct{}
+	mockS3(t, &configuration, "bucket")
+
+	code, err := main.CheckS3Connection(&configuration)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.NoError(t, err)
+}
@@ -0,0 +1,470 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains column profiles computed when -profile flag is
+// used. Profile of each column contains number of NULL values, number of
+// distinct values (exact or estimated by HyperLogLog), minimum and maximum
+// for numeric and timestamp columns, average and maximum length of text
+// values and most common values for columns with low cardinality. Profiles
+// are computed from the same rows that are exported, so no other query is
+// performed, and they are stored into _profile.json file or object.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/profile.html
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"hash/fnv"
+	"io"
+	"math"
+	"math/bits"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Messages
+const (
+	storeProfileFailed = "Store column profiles failed"
+	writeProfileToJSON = "Write column profiles to JSON"
+)
+
+// Limits used by column profiles
+const (
+	// exactDistinctLimit is number of distinct values counted exactly,
+	// HyperLogLog estimate is used for columns with more distinct values
+	exactDistinctLimit = 10000
+
+	// lowCardinalityLimit is maximum number of distinct values of column
+	// for which the most common values are reported
+	lowCardinalityLimit = 50
+
+	// topValuesCount is number of the most common values reported
+	topValuesCount = 10
+
+	// hyperLogLogPrecision is number of bits used to select register,
+	// standard error of estimate is about 1.04/sqrt(2^precision)
+	hyperLogLogPrecision = 14
+)
+
+// Kinds of columns
+const (
+	otherColumn = iota
+	numericColumn
+	timestampColumn
+	textColumn
+)
+
+// columnKinds maps database type names to kinds of columns
+var columnKinds = map[string]int{
+	"INT2":             numericColumn,
+	"INT4":             numericColumn,
+	"INT8":             numericColumn,
+	"INT":              numericColumn,
+	"INTEGER":          numericColumn,
+	"SMALLINT":         numericColumn,
+	"BIGINT":           numericColumn,
+	"NUMERIC":          numericColumn,
+	"DECIMAL":          numericColumn,
+	"FLOAT4":           numericColumn,
+	"FLOAT8":           numericColumn,
+	"REAL":             numericColumn,
+	"DOUBLE":           numericColumn,
+	"DOUBLE PRECISION": numericColumn,
+	"DATE":             timestampColumn,
+	"DATETIME":         timestampColumn,
+	"TIMESTAMP":        timestampColumn,
+	"TIMESTAMPTZ":      timestampColumn,
+	"CHAR":             textColumn,
+	"BPCHAR":           textColumn,
+	"VARCHAR":          textColumn,
+	"TEXT":             textColumn,
+	"NAME":             textColumn,
+	"UUID":             textColumn,
+	"JSON":             textColumn,
+	"JSONB":            textColumn,
+}
+
+// timestampLayouts contains layouts of timestamps returned by supported
+// database drivers
+var timestampLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02 15:04:05.999999999-07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02",
+}
+
+// ValueCount represents one of the most common values of column
+type ValueCount struct {
+	Value string `json:"value"`
+	Count int    `json:"count"`
+}
+
+// ColumnProfile represents profile of one column
+type ColumnProfile struct {
+	Name              string       `json:"name"`
+	Type              string       `json:"type"`
+	NullCount         int          `json:"null_count"`
+	DistinctCount     int          `json:"distinct_count"`
+	DistinctEstimated bool         `json:"distinct_estimated"`
+	Min               *string      `json:"min,omitempty"`
+	Max               *string      `json:"max,omitempty"`
+	AvgLength         *float64     `json:"avg_length,omitempty"`
+	MaxLength         *int         `json:"max_length,omitempty"`
+	TopValues         []ValueCount `json:"top_values,omitempty"`
+}
+
+// TableProfile represents profiles of all columns of one exported table
+type TableProfile struct {
+	TableName TableName       `json:"table"`
+	Prefix    string          `json:"prefix,omitempty"`
+	Rows      int             `json:"rows"`
+	Columns   []ColumnProfile `json:"columns"`
+}
+
+// ExportProfiles contains profiles of all exported tables
+type ExportProfiles struct {
+	Tables []TableProfile `json:"tables"`
+}
+
+// NewExportProfiles function constructs empty set of profiles.
+func NewExportProfiles() *ExportProfiles {
+	return &ExportProfiles{
+		Tables: make([]TableProfile, 0),
+	}
+}
+
+// Record method records profile of table exported under given prefix.
+func (profiles *ExportProfiles) Record(prefix string, tableName TableName, profile *TableProfile) {
+	if profiles == nil || profile == nil {
+		return
+	}
+	profile.TableName = tableName
+	profile.Prefix = prefix
+	profiles.Tables = append(profiles.Tables, *profile)
+}
+
+// tableProfiler computes profiles of all columns of table from rows read
+// from database
+type tableProfiler struct {
+	rows    int
+	columns []*columnProfiler
+}
+
+// newTableProfiler function constructs profiler for table with given
+// columns.
+func newTableProfiler(columnTypes []*sql.ColumnType) *tableProfiler {
+	profiler := &tableProfiler{}
+	for _, columnType := range columnTypes {
+		profiler.columns = append(profiler.columns,
+			newColumnProfiler(columnType.Name(), columnType.DatabaseTypeName()))
+	}
+	return profiler
+}
+
+// observe method adds one row into profiles. Row is represented by scan
+// arguments filled in by database driver.
+func (profiler *tableProfiler) observe(scanArgs []interface{}) {
+	if profiler == nil {
+		return
+	}
+	profiler.rows++
+	for i, column := range profiler.columns {
+		value, valid := scannedValue(scanArgs[i])
+		column.observe(value, valid)
+	}
+}
+
+// profile method returns profiles of all columns.
+func (profiler *tableProfiler) profile() *TableProfile {
+	if profiler == nil {
+		return nil
+	}
+	profile := &TableProfile{
+		Rows:    profiler.rows,
+		Columns: make([]ColumnProfile, 0, len(profiler.columns)),
+	}
+	for _, column := range profiler.columns {
+		profile.Columns = append(profile.Columns, column.profile())
+	}
+	return profile
+}
+
+// scannedValue function converts value scanned from database into string.
+// False is returned for NULL values.
+func scannedValue(scanArg interface{}) (string, bool) {
+	switch value := scanArg.(type) {
+	case *sql.NullString:
+		return value.String, value.Valid
+	case *sql.NullBool:
+		return strconv.FormatBool(value.Bool), value.Valid
+	case *sql.NullInt64:
+		return strconv.FormatInt(value.Int64, 10), value.Valid
+	default:
+		return "", false
+	}
+}
+
+// columnProfiler computes profile of one column
+type columnProfiler struct {
+	name         string
+	databaseType string
+	kind         int
+
+	nullCount int
+	nonNull   int
+
+	// values contains counts of distinct values, it is dropped when
+	// there are too many distinct values and sketch is used instead
+	values map[string]int
+	sketch *hyperLogLog
+
+	min, max           string
+	minOrder, maxOrder float64
+	hasRange           bool
+
+	lengthSum int64
+	maxLength int
+}
+
+// newColumnProfiler function constructs profiler for column of given type.
+func newColumnProfiler(name, databaseType string) *columnProfiler {
+	// type modifiers like VARCHAR(255) are not important
+	baseType, _, _ := strings.Cut(strings.ToUpper(databaseType), "(")
+
+	return &columnProfiler{
+		name:         name,
+		databaseType: databaseType,
+		kind:         columnKinds[strings.TrimSpace(baseType)],
+		values:       make(map[string]int),
+	}
+}
+
+// observe method adds one value into profile.
+func (profiler *columnProfiler) observe(value string, valid bool) {
+	if !valid {
+		profiler.nullCount++
+		return
+	}
+	profiler.nonNull++
+
+	profiler.countDistinct(value)
+
+	switch profiler.kind {
+	case numericColumn:
+		number, err := strconv.ParseFloat(value, 64)
+		if err == nil {
+			profiler.updateRange(value, number)
+		}
+	case timestampColumn:
+		timestamp, ok := parseTimestamp(value)
+		if ok {
+			profiler.updateRange(value, float64(timestamp.UnixNano()))
+		}
+	case textColumn:
+		length := utf8.RuneCountInString(value)
+		profiler.lengthSum += int64(length)
+		if length > profiler.maxLength {
+			profiler.maxLength = length
+		}
+	}
+}
+
+// countDistinct method counts distinct values exactly until the limit is
+// reached, HyperLogLog sketch is used afterwards.
+func (profiler *columnProfiler) countDistinct(value string) {
+	if profiler.sketch != nil {
+		profiler.sketch.add(value)
+		return
+	}
+
+	profiler.values[value]++
+	if len(profiler.values) > exactDistinctLimit {
+		profiler.sketch = newHyperLogLog()
+		for value := range profiler.values {
+			profiler.sketch.add(value)
+		}
+		profiler.values = nil
+	}
+}
+
+// updateRange method updates minimum and maximum of column. Values are
+// compared by given order, but they are reported as read from database.
+func (profiler *columnProfiler) updateRange(value string, order float64) {
+	if !profiler.hasRange || order < profiler.minOrder {
+		profiler.min, profiler.minOrder = value, order
+	}
+	if !profiler.hasRange || order > profiler.maxOrder {
+		profiler.max, profiler.maxOrder = value, order
+	}
+	profiler.hasRange = true
+}
+
+// profile method returns profile of column.
+func (profiler *columnProfiler) profile() ColumnProfile {
+	profile := ColumnProfile{
+		Name:      profiler.name,
+		Type:      profiler.databaseType,
+		NullCount: profiler.nullCount,
+	}
+
+	if profiler.sketch != nil {
+		profile.DistinctCount = profiler.sketch.estimate()
+		profile.DistinctEstimated = true
+	} else {
+		profile.DistinctCount = len(profiler.values)
+		if len(profiler.values) <= lowCardinalityLimit {
+			profile.TopValues = topValues(profiler.values, topValuesCount)
+		}
+	}
+
+	if profiler.hasRange {
+		minValue, maxValue := profiler.min, profiler.max
+		profile.Min, profile.Max = &minValue, &maxValue
+	}
+
+	if profiler.kind == textColumn && profiler.nonNull > 0 {
+		avgLength := float64(profiler.lengthSum) / float64(profiler.nonNull)
+		maxLength := profiler.maxLength
+		profile.AvgLength, profile.MaxLength = &avgLength, &maxLength
+	}
+
+	return profile
+}
+
+// topValues function returns given number of the most common values. Values
+// with the same count are ordered alphabetically.
+func topValues(values map[string]int, count int) []ValueCount {
+	result := make([]ValueCount, 0, len(values))
+	for value, valueCount := range values {
+		result = append(result, ValueCount{value, valueCount})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Value < result[j].Value
+	})
+
+	if len(result) > count {
+		result = result[:count]
+	}
+	return result
+}
+
+// parseTimestamp function parses timestamp in any format returned by
+// supported database drivers.
+func parseTimestamp(value string) (time.Time, bool) {
+	for _, layout := range timestampLayouts {
+		timestamp, err := time.Parse(layout, value)
+		if err == nil {
+			return timestamp, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// hyperLogLog is probabilistic counter of distinct values
+type hyperLogLog struct {
+	registers []uint8
+}
+
+// newHyperLogLog function constructs empty HyperLogLog sketch.
+func newHyperLogLog() *hyperLogLog {
+	return &hyperLogLog{
+		registers: make([]uint8, 1<<hyperLogLogPrecision),
+	}
+}
+
+// add method adds value into sketch.
+func (sketch *hyperLogLog) add(value string) {
+	hash := hashValue(value)
+
+	// first bits select register, position of the first set bit in the
+	// rest is stored into the register
+	index := hash >> (64 - hyperLogLogPrecision)
+	rest := hash<<hyperLogLogPrecision | 1<<(hyperLogLogPrecision-1)
+	rank := uint8(bits.LeadingZeros64(rest) + 1)
+
+	if rank > sketch.registers[index] {
+		sketch.registers[index] = rank
+	}
+}
+
+// estimate method returns estimated number of distinct values added into
+// sketch.
+func (sketch *hyperLogLog) estimate() int {
+	m := float64(len(sketch.registers))
+
+	sum := 0.0
+	zeros := 0
+	for _, register := range sketch.registers {
+		sum += math.Pow(2, -float64(register))
+		if register == 0 {
+			zeros++
+		}
+	}
+
+	alpha := 0.7213 / (1 + 1.079/m)
+	estimate := alpha * m * m / sum
+
+	// linear counting is more precise for small cardinalities
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return int(math.Round(estimate))
+}
+
+// hashValue function computes 64bit hash of given value. FNV hash is
+// finalized by SplitMix64 mixer, so all bits are distributed uniformly.
+func hashValue(value string) uint64 {
+	hasher := fnv.New64a()
+	_, _ = hasher.Write([]byte(value))
+	hash := hasher.Sum64()
+
+	hash ^= hash >> 30
+	hash *= 0xbf58476d1ce4e5b9
+	hash ^= hash >> 27
+	hash *= 0x94d049bb133111eb
+	hash ^= hash >> 31
+	return hash
+}
+
+// ProfilesToJSON function writes profiles of all exported tables into given
+// writer.
+func ProfilesToJSON(writer io.Writer, profiles *ExportProfiles) error {
+	if writer == nil {
+		err := errors.New(bufferIsNil)
+		log.Error().Err(err).Msg(writeProfileToJSON)
+		return err
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(profiles)
+}
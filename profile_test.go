@@ -0,0 +1,263 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/profile_test.html
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// TestColumnProfilerNumeric checks profile of numeric column
+func TestColumnProfilerNumeric(t *testing.T) {
+	profiler := main.NewColumnProfiler("count", "INT4")
+	for _, value := range []string{"10", "-2", "10", "7"} {
+		main.ColumnProfilerObserve(profiler, value, true)
+	}
+	main.ColumnProfilerObserve(profiler, "", false)
+
+	profile := main.ColumnProfilerProfile(profiler)
+	assert.Equal(t, "count", profile.Name)
+	assert.Equal(t, "INT4", profile.Type)
+	assert.Equal(t, 1, profile.NullCount)
+	assert.Equal(t, 3, profile.DistinctCount)
+	assert.False(t, profile.DistinctEstimated)
+	assert.Equal(t, "-2", *profile.Min)
+	assert.Equal(t, "10", *profile.Max)
+	assert.Nil(t, profile.AvgLength)
+	assert.Nil(t, profile.MaxLength)
+	assert.Equal(t, []main.ValueCount{{Value: "10", Count: 2}, {Value: "-2", Count: 1}, {Value: "7", Count: 1}},
+		profile.TopValues)
+}
+
+// TestColumnProfilerTimestamp checks profile of timestamp column
+func TestColumnProfilerTimestamp(t *testing.T) {
+	profiler := main.NewColumnProfiler("updated_at", "TIMESTAMP")
+	for _, value := range []string{
+		"2024-05-01T10:00:00Z",
+		"2023-12-31 23:59:59",
+		"2024-05-01T12:00:00+02:00",
+		"2025-01-01",
+		"not a timestamp",
+	} {
+		main.ColumnProfilerObserve(profiler, value, true)
+	}
+
+	profile := main.ColumnProfilerProfile(profiler)
+	assert.Equal(t, "2023-12-31 23:59:59", *profile.Min)
+	assert.Equal(t, "2025-01-01", *profile.Max)
+	assert.Equal(t, 5, profile.DistinctCount)
+}
+
+// TestColumnProfilerText checks profile of text column
+func TestColumnProfilerText(t *testing.T) {
+	profiler := main.NewColumnProfiler("name", "VARCHAR(255)")
+	for _, value := range []string{"a", "bcd", "žluť", ""} {
+		main.ColumnProfilerObserve(profiler, value, true)
+	}
+
+	profile := main.ColumnProfilerProfile(profiler)
+	assert.Nil(t, profile.Min)
+	assert.Nil(t, profile.Max)
+	assert.Equal(t, 2.0, *profile.AvgLength)
+	assert.Equal(t, 4, *profile.MaxLength)
+}
+
+// TestColumnProfilerHighCardinality checks that distinct values are
+// estimated and top values are not reported for column with many distinct
+// values
+func TestColumnProfilerHighCardinality(t *testing.T) {
+	const distinct = 50000
+
+	profiler := main.NewColumnProfiler("id", "TEXT")
+	for i := 0; i < distinct; i++ {
+		main.ColumnProfilerObserve(profiler, fmt.Sprintf("value-%d", i), true)
+	}
+
+	profile := main.ColumnProfilerProfile(profiler)
+	assert.True(t, profile.DistinctEstimated)
+	assert.InEpsilon(t, distinct, profile.DistinctCount, 0.05)
+	assert.Empty(t, profile.TopValues)
+
+	// column with more distinct values than low cardinality limit, but
+	// counted exactly
+	profiler = main.NewColumnProfiler("id", "TEXT")
+	for i := 0; i < 100; i++ {
+		main.ColumnProfilerObserve(profiler, fmt.Sprintf("value-%d", i), true)
+	}
+	profile = main.ColumnProfilerProfile(profiler)
+	assert.False(t, profile.DistinctEstimated)
+	assert.Equal(t, 100, profile.DistinctCount)
+	assert.Empty(t, profile.TopValues)
+}
+
+// TestHyperLogLog checks precision of HyperLogLog estimate
+func TestHyperLogLog(t *testing.T) {
+	for _, distinct := range []int{0, 1, 100, 10000, 200000} {
+		sketch := main.NewHyperLogLog()
+		for i := 0; i < distinct; i++ {
+			// every value is added twice
+			main.HyperLogLogAdd(sketch, fmt.Sprint(i))
+			main.HyperLogLogAdd(sketch, fmt.Sprint(i))
+		}
+
+		estimate := main.HyperLogLogEstimate(sketch)
+		if distinct == 0 {
+			assert.Equal(t, 0, estimate)
+			continue
+		}
+		assert.InEpsilon(t, distinct, estimate, 0.03, "distinct values: %d", distinct)
+	}
+}
+
+// TestStoreTableProfiles checks that profiles are computed from exported
+// rows
+func TestStoreTableProfiles(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t,
+		"CREATE TABLE t (id INTEGER PRIMARY KEY, kind VARCHAR, created TIMESTAMP)",
+		"INSERT INTO t VALUES (1, 'a', '2024-01-01 00:00:00'), (2, 'b', NULL), (3, 'a', '2023-01-01 00:00:00')")
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &testConfig)
+
+	profiles := main.NewExportProfiles()
+	main.SetProfiles(storage, profiles)
+
+	err := storage.StoreTable(context.Background(), main.NewFileSink("", false), t.TempDir(), "t", NoLimits)
+	assert.NoError(t, err)
+
+	assert.Len(t, profiles.Tables, 1)
+	profile := profiles.Tables[0]
+	assert.Equal(t, main.TableName("t"), profile.TableName)
+	assert.Equal(t, 3, profile.Rows)
+	assert.Len(t, profile.Columns, 3)
+
+	assert.Equal(t, "1", *profile.Columns[0].Min)
+	assert.Equal(t, "3", *profile.Columns[0].Max)
+	assert.Equal(t, []main.ValueCount{{Value: "a", Count: 2}, {Value: "b", Count: 1}},
+		profile.Columns[1].TopValues)
+	assert.Equal(t, 1, profile.Columns[2].NullCount)
+	assert.Equal(t, 2, profile.Columns[2].DistinctCount)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestReadTableWithoutProfiles checks that profiles are not computed by
+// default
+func TestReadTableWithoutProfiles(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t,
+		"CREATE TABLE t (id INTEGER PRIMARY KEY)",
+		"INSERT INTO t VALUES (1)")
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &testConfig)
+
+	rows, profile, err := main.ReadTableWithProfile(*storage, context.Background(), "t", NoLimits)
+	assert.NoError(t, err)
+	assert.Len(t, rows, 1)
+	assert.Nil(t, profile)
+
+	// nil profiles ignore recorded profile
+	var profiles *main.ExportProfiles
+	profiles.Record("", "t", &main.TableProfile{})
+	assert.Nil(t, profiles)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestProfilesToJSON checks conversion of profiles into JSON
+func TestProfilesToJSON(t *testing.T) {
+	profiles := main.NewExportProfiles()
+	profiles.Record("org_id=1", "t", &main.TableProfile{
+		Rows:    1,
+		Columns: []main.ColumnProfile{{Name: "a", Type: "INT4", DistinctCount: 1}},
+	})
+
+	buffer := new(bytes.Buffer)
+	err := main.ProfilesToJSON(buffer, profiles)
+	assert.NoError(t, err)
+
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &decoded))
+	table := decoded["tables"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "t", table["table"])
+	assert.Equal(t, "org_id=1", table["prefix"])
+	column := table["columns"].([]interface{})[0].(map[string]interface{})
+	assert.NotContains(t, column, "min")
+	assert.NotContains(t, column, "top_values")
+
+	assert.Error(t, main.ProfilesToJSON(nil, profiles))
+}
+
+// TestPerformDataExportProfile checks that profiles are exported into file
+func TestPerformDataExportProfile(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:        "file",
+		Limit:         NoLimits,
+		IgnoredTables: "bad",
+		ExportProfile: true,
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	content, err := os.ReadFile(filepath.Join(directory, "_profile.json"))
+	assert.NoError(t, err)
+
+	var profiles main.ExportProfiles
+	assert.NoError(t, json.Unmarshal(content, &profiles))
+	assert.Len(t, profiles.Tables, 1)
+	assert.Equal(t, main.TableName("good"), profiles.Tables[0].TableName)
+	assert.Equal(t, 2, profiles.Tables[0].Rows)
+}
+
+// TestPerformDataExportWithoutProfile checks that profiles are not exported
+// when they are not requested
+func TestPerformDataExportWithoutProfile(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:        "file",
+		Limit:         NoLimits,
+		IgnoredTables: "bad",
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	assert.FileExists(t, filepath.Join(directory, "good.csv"))
+	assert.NoFileExists(t, filepath.Join(directory, "_profile.json"))
+}
@@ -0,0 +1,429 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains export of user-defined queries. Named queries
+// are defined in [[queries]] sections of configuration file. Each query is
+// run in read-only mode with statement timeout and its result is stored as
+// separate file or object next to exported tables, so new reports don't
+// need any code change.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/queries.html
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Messages
+const (
+	exportingQuery          = "Exporting query"
+	queryNameMsg            = "query"
+	unableToResetQuery      = "Unable to switch connection back from read-only mode"
+	unableToCloseConnection = "Unable to close connection used by query"
+	queryNameMissing        = "query without name"
+	invalidQueryName        = "invalid name of query: %s"
+	duplicateQueryName      = "duplicate name of query: %s"
+	querySQLMissing         = "query %s without SQL statement"
+	unknownQueryFormat      = "unknown format of query %s: %s"
+	unknownQueryParam       = "unknown parameter of query %s: %s"
+	negativeQueryTimeout    = "negative timeout of query %s"
+	queryNameIsTable        = "name of query %s is the same as name of exported table"
+)
+
+// supported formats of query results
+const (
+	queryFormatCSV  = "csv"
+	queryFormatJSON = "json"
+)
+
+// parameters that can be passed to queries
+const (
+	// comma-separated list of organizations to export, empty when
+	// filtering by organizations is disabled
+	queryParameterOrgIDs = "org_ids"
+
+	// time when the query is run in RFC3339 format
+	queryParameterNow = "now"
+)
+
+// defaultQueryTimeout is used for queries without configured timeout
+const defaultQueryTimeout = time.Minute
+
+// SQL statements used to run queries in read-only mode
+const (
+	setStatementTimeout = "SET LOCAL statement_timeout = %d"
+	setQueryOnly        = "PRAGMA query_only = ON"
+	resetQueryOnly      = "PRAGMA query_only = OFF"
+)
+
+// queryNamePattern is used to check names of queries, the name is part of
+// file or object name
+var queryNamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// QueryConfiguration represents one user-defined query
+type QueryConfiguration struct {
+	// Name is used as name of file or object with results
+	Name string `mapstructure:"name" toml:"name"`
+
+	// SQL is statement to be run, parameters are referred as $1, $2...
+	SQL string `mapstructure:"sql" toml:"sql"`
+
+	// Parameters contains names of values passed to the statement in
+	// given order: org_ids or now
+	Parameters []string `mapstructure:"parameters" toml:"parameters"`
+
+	// Format of results: csv (default) or json
+	Format string `mapstructure:"format" toml:"format"`
+
+	// Timeout of the statement. Zero means the default value (1 minute).
+	Timeout time.Duration `mapstructure:"timeout" toml:"timeout"`
+}
+
+// format method returns format of results with default applied.
+func (query QueryConfiguration) format() string {
+	if query.Format == "" {
+		return queryFormatCSV
+	}
+	return query.Format
+}
+
+// timeout method returns statement timeout with default applied.
+func (query QueryConfiguration) timeout() time.Duration {
+	if query.Timeout == 0 {
+		return defaultQueryTimeout
+	}
+	return query.Timeout
+}
+
+// fileName method returns name of file or object with query results.
+func (query QueryConfiguration) fileName() string {
+	return query.Name + "." + query.format()
+}
+
+// validateQueries function checks all user-defined queries before export is
+// started.
+func validateQueries(queries []QueryConfiguration) error {
+	names := make(map[string]struct{})
+
+	for _, query := range queries {
+		if query.Name == "" {
+			return errors.New(queryNameMissing)
+		}
+		if !queryNamePattern.MatchString(query.Name) {
+			return fmt.Errorf(invalidQueryName, query.Name)
+		}
+		if _, found := names[query.Name]; found {
+			return fmt.Errorf(duplicateQueryName, query.Name)
+		}
+		names[query.Name] = struct{}{}
+
+		if strings.TrimSpace(query.SQL) == "" {
+			return fmt.Errorf(querySQLMissing, query.Name)
+		}
+		if format := query.format(); format != queryFormatCSV && format != queryFormatJSON {
+			return fmt.Errorf(unknownQueryFormat, query.Name, format)
+		}
+		for _, parameter := range query.Parameters {
+			if parameter != queryParameterOrgIDs && parameter != queryParameterNow {
+				return fmt.Errorf(unknownQueryParam, query.Name, parameter)
+			}
+		}
+		if query.Timeout < 0 {
+			return fmt.Errorf(negativeQueryTimeout, query.Name)
+		}
+	}
+	return nil
+}
+
+// checkQueryNames function checks that results of user-defined queries do
+// not overwrite exported tables. File names are compared, so query stored
+// in JSON format can have the same name as exported table. Ignored tables
+// are not exported, so their names can be used.
+func checkQueryNames(queries []QueryConfiguration, tableNames []TableName,
+	ignoredTables IgnoredTables) error {
+	for _, query := range queries {
+		if _, ignored := ignoredTables[query.Name]; ignored {
+			continue
+		}
+		for _, tableName := range tableNames {
+			if query.fileName() == string(tableName)+CSVFileExtension {
+				return fmt.Errorf(queryNameIsTable, query.Name)
+			}
+		}
+	}
+	return nil
+}
+
+// queryArguments method returns values of parameters of given query.
+func (storage DBStorage) queryArguments(query QueryConfiguration) []interface{} {
+	arguments := make([]interface{}, 0, len(query.Parameters))
+
+	for _, parameter := range query.Parameters {
+		switch parameter {
+		case queryParameterOrgIDs:
+			orgIDs := ""
+			if storage.config.EnableOrgIDFiltering {
+				orgIDs = strings.Join(storage.config.OrganizationsToExport, ",")
+			}
+			arguments = append(arguments, orgIDs)
+		case queryParameterNow:
+			arguments = append(arguments, time.Now().UTC().Format(time.RFC3339))
+		}
+	}
+	return arguments
+}
+
+// QueryResult represents columns and rows returned by query
+type QueryResult struct {
+	Columns []string
+	Rows    []M
+}
+
+// ReadQuery method runs given user-defined query in read-only mode and
+// returns its result. Reading is retried when transient error occurs.
+func (storage DBStorage) ReadQuery(ctx context.Context, query QueryConfiguration) (*QueryResult, error) {
+	var result *QueryResult
+	err := storage.retry(ctx, TableName(query.Name), "run query", func(ctx context.Context) error {
+		var err error
+		result, err = storage.readQuery(ctx, query)
+		return err
+	})
+	return result, err
+}
+
+// readQuery method performs one attempt to run given query. Dedicated
+// connection is used, so read-only mode set for the query does not affect
+// other queries.
+func (storage DBStorage) readQuery(ctx context.Context, query QueryConfiguration) (*QueryResult, error) {
+	ctx, cancel := context.WithTimeout(ctx, query.timeout())
+	defer cancel()
+
+	connection, err := storage.connection.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	defer func() {
+		err := connection.Close()
+		if err != nil {
+			log.Error().Err(err).Msg(unableToCloseConnection)
+		}
+	}()
+
+	log.Info().Str(queryNameMsg, query.Name).Str(sqlStatementExecuted, query.SQL).Msg("Performing")
+
+	var rows *sql.Rows
+	switch storage.dbDriverType {
+	case DBDriverPostgres:
+		// read-only transaction is rolled back when the query is read
+		tx, err := connection.BeginTx(ctx, &sql.TxOptions{ReadOnly: true})
+		if err != nil {
+			return nil, err
+		}
+
+		defer func() {
+			_ = tx.Rollback()
+		}()
+
+		_, err = tx.ExecContext(ctx, fmt.Sprintf(setStatementTimeout,
+			query.timeout().Milliseconds()))
+		if err != nil {
+			return nil, err
+		}
+
+		rows, err = tx.QueryContext(ctx, query.SQL, storage.queryArguments(query)...)
+		if err != nil {
+			return nil, err
+		}
+	default:
+		_, err = connection.ExecContext(ctx, setQueryOnly)
+		if err != nil {
+			return nil, err
+		}
+
+		// connection is returned into pool in normal mode
+		defer func() {
+			_, err := connection.ExecContext(context.Background(), resetQueryOnly)
+			if err != nil {
+				log.Error().Err(err).Msg(unableToResetQuery)
+			}
+		}()
+
+		rows, err = connection.QueryContext(ctx, query.SQL, storage.queryArguments(query)...)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Error().Err(err).Msg(unableToCloseDBRowsHandle)
+		}
+	}()
+
+	columnTypes, err := rows.ColumnTypes()
+	if err != nil {
+		log.Error().Err(err).Msg(unableToRetrieveColumnTypes)
+		return nil, err
+	}
+
+	result := &QueryResult{
+		Columns: getColumnNames(columnTypes),
+		Rows:    []M{},
+	}
+	for rows.Next() {
+		scanArgs := fillInScanArgs(columnTypes)
+
+		err := rows.Scan(scanArgs...)
+		if err != nil {
+			log.Error().Err(err).Msg("Unable to scan row")
+			return nil, err
+		}
+		result.Rows = append(result.Rows, fillInMasterData(columnTypes, scanArgs))
+	}
+
+	return result, rows.Err()
+}
+
+// QueryResultToCSV function exports query result into CSV file. Values are
+// formatted the same way as values of exported tables.
+func QueryResultToCSV(buffer io.Writer, result *QueryResult) error {
+	if buffer == nil {
+		err := errors.New(bufferIsNil)
+		return err
+	}
+
+	writer := csv.NewWriter(buffer)
+
+	err := writeColumnNames(writer, result.Columns)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range result.Rows {
+		columns := make([]string, 0, len(result.Columns))
+		for _, column := range result.Columns {
+			columns = append(columns, fmt.Sprintf("%v", row[column]))
+		}
+		err := writer.Write(columns)
+		if err != nil {
+			log.Error().Err(err).Msg(writeOneRowToCSV)
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// QueryResultToJSON function exports query result into JSON as list of
+// objects.
+func QueryResultToJSON(buffer io.Writer, result *QueryResult) error {
+	if buffer == nil {
+		err := errors.New(bufferIsNil)
+		return err
+	}
+
+	encoder := json.NewEncoder(buffer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(result.Rows)
+}
+
+// queryResultToFormat function exports query result in format selected for
+// the query.
+func queryResultToFormat(buffer io.Writer, query QueryConfiguration, result *QueryResult) error {
+	if query.format() == queryFormatJSON {
+		return QueryResultToJSON(buffer, result)
+	}
+	return QueryResultToCSV(buffer, result)
+}
+
+// StoreQuery method runs given query and stores its result into given sink
+// under given prefix (directory or prefix of S3 object).
+func (storage DBStorage) StoreQuery(ctx context.Context, sink Sink, prefix string, query QueryConfiguration) error {
+	result, err := storage.ReadQuery(ctx, query)
+	if err != nil {
+		return err
+	}
+
+	contentType := contentTypeCSV
+	if query.format() == queryFormatJSON {
+		contentType = contentTypeJSON
+	}
+
+	objectName := setObjectPrefix(prefix, query.fileName())
+	object, err := sink.Create(ctx, objectName, contentType)
+	if err != nil {
+		return err
+	}
+
+	counter := &countingWriter{writer: object}
+	err = queryResultToFormat(counter, query, result)
+	if err != nil {
+		abortObject(object, objectName)
+		return err
+	}
+
+	err = object.Commit()
+	storage.retryStats.Add(TableName(query.Name), objectRetries(object))
+	if err != nil {
+		return err
+	}
+
+	storage.exportStats.Record(prefix, TableName(query.Name), TableStats{
+		Rows:  len(result.Rows),
+		Bytes: counter.count,
+	})
+	return nil
+}
+
+// queryStorer represents function that stores result of one query under
+// given prefix (directory or prefix of S3 object)
+type queryStorer func(storage DBStorage, prefix string, query QueryConfiguration) error
+
+// storeQueries function stores results of all user-defined queries under
+// given prefix.
+func storeQueries(storage DBStorage, queries []QueryConfiguration,
+	prefix string, storeQuery queryStorer, operationLogger *zerolog.Logger) error {
+	for _, query := range queries {
+		operationLogger.Info().
+			Str(queryNameMsg, query.Name).
+			Msg(exportingQuery)
+		err := storeQuery(storage, prefix, query)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,266 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/queries_test.html
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// TestValidateQueries checks validation of user-defined queries
+func TestValidateQueries(t *testing.T) {
+	valid := main.QueryConfiguration{Name: "query", SQL: "SELECT 1"}
+	assert.NoError(t, main.ValidateQueries(nil))
+	assert.NoError(t, main.ValidateQueries([]main.QueryConfiguration{valid}))
+
+	for expected, query := range map[string]main.QueryConfiguration{
+		"query without name":                   {SQL: "SELECT 1"},
+		"invalid name of query: ../x":          {Name: "../x", SQL: "SELECT 1"},
+		"invalid name of query: _tables":       {Name: "_tables", SQL: "SELECT 1"},
+		"query q without SQL statement":        {Name: "q", SQL: " "},
+		"unknown format of query q: xml":       {Name: "q", SQL: "SELECT 1", Format: "xml"},
+		"unknown parameter of query q: orgs":   {Name: "q", SQL: "SELECT 1", Parameters: []string{"orgs"}},
+		"negative timeout of query q":          {Name: "q", SQL: "SELECT 1", Timeout: -time.Second},
+		"duplicate name of query: query":       valid,
+		"unknown format of query q: CSV":       {Name: "q", SQL: "SELECT 1", Format: "CSV"},
+		"unknown parameter of query q: org_id": {Name: "q", SQL: "SELECT 1", Parameters: []string{"org_id"}},
+	} {
+		err := main.ValidateQueries([]main.QueryConfiguration{valid, query})
+		assert.EqualError(t, err, expected)
+	}
+}
+
+// TestCheckQueryNames checks that query can't overwrite exported table
+func TestCheckQueryNames(t *testing.T) {
+	queries := []main.QueryConfiguration{
+		{Name: "hits", SQL: "SELECT 1"},
+		{Name: "rule_hit", SQL: "SELECT 1", Format: "json"},
+		{Name: "report", SQL: "SELECT 1"},
+	}
+	tableNames := []main.TableName{"report", "rule_hit"}
+
+	err := main.CheckQueryNames(queries, tableNames, main.IgnoredTables{})
+	assert.EqualError(t, err, "name of query report is the same as name of exported table")
+
+	// result in JSON format doesn't overwrite exported table
+	err = main.CheckQueryNames(queries[:2], tableNames, main.IgnoredTables{})
+	assert.NoError(t, err)
+
+	// ignored table is not exported
+	err = main.CheckQueryNames(queries, tableNames, main.IgnoredTables{"report": {}})
+	assert.NoError(t, err)
+}
+
+// TestReadQuery checks that query is run with parameters
+func TestReadQuery(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, ruleHitsStatements...)
+
+	config := testConfig
+	config.EnableOrgIDFiltering = true
+	config.OrganizationsToExport = []string{"1", "3"}
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	result, err := storage.ReadQuery(context.Background(), main.QueryConfiguration{
+		Name: "hits",
+		SQL: `SELECT org_id, count(*) AS hits, $1 AS orgs, $2 <> '' AS now FROM rule_hit
+		       WHERE instr(',' || $1 || ',', ',' || org_id || ',') > 0 GROUP BY org_id`,
+		Parameters: []string{"org_ids", "now"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"org_id", "hits", "orgs", "now"}, result.Columns)
+	assert.Len(t, result.Rows, 1)
+	assert.Equal(t, "1", result.Rows[0]["org_id"])
+	assert.Equal(t, "4", result.Rows[0]["hits"])
+	assert.Equal(t, "1,3", result.Rows[0]["orgs"])
+	assert.Equal(t, "1", result.Rows[0]["now"])
+
+	checkConnectionClose(t, connection)
+}
+
+// TestReadQueryReadOnly checks that query can't change data and that
+// connection is writable again after the query
+func TestReadQueryReadOnly(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, ruleHitsStatements...)
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &testConfig)
+
+	_, err := storage.ReadQuery(context.Background(), main.QueryConfiguration{
+		Name: "delete",
+		SQL:  "DELETE FROM rule_hit",
+	})
+	assert.ErrorContains(t, err, "readonly")
+
+	_, err = connection.Exec("DELETE FROM rule_hit")
+	assert.NoError(t, err)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestReadQueryTimeout checks that long running query is stopped
+func TestReadQueryTimeout(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t)
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &testConfig)
+
+	started := time.Now()
+	_, err := storage.ReadQuery(context.Background(), main.QueryConfiguration{
+		Name: "endless",
+		SQL: `WITH RECURSIVE counter(x) AS (SELECT 1 UNION ALL SELECT x + 1 FROM counter)
+		      SELECT count(*) FROM counter`,
+		Timeout: 100 * time.Millisecond,
+	})
+	assert.Error(t, err)
+	assert.Less(t, time.Since(started), 10*time.Second)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestReadQueryPostgres checks that query is run in read-only transaction
+// with statement timeout in PostgreSQL
+func TestReadQueryPostgres(t *testing.T) {
+	connection, mock := mustCreateMockConnection(t)
+
+	mock.ExpectBegin()
+	mock.ExpectExec(`SET LOCAL statement_timeout = 30000`).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectQuery(`SELECT rule_fqdn FROM rule_hit`).
+		WillReturnRows(sqlmock.NewRows([]string{"rule_fqdn"}).AddRow("rule.a"))
+	mock.ExpectRollback()
+	mock.ExpectClose()
+
+	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
+
+	result, err := storage.ReadQuery(context.Background(), main.QueryConfiguration{
+		Name:    "rules",
+		SQL:     "SELECT rule_fqdn FROM rule_hit",
+		Timeout: 30 * time.Second,
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, []main.M{{"rule_fqdn": "rule.a"}}, result.Rows)
+
+	checkConnectionClose(t, connection)
+	checkAllExpectations(t, mock)
+}
+
+// TestQueryResultToCSV checks conversion of query result into CSV and JSON
+func TestQueryResultToCSV(t *testing.T) {
+	result := &main.QueryResult{
+		Columns: []string{"b", "a"},
+		Rows:    []main.M{{"a": int64(1), "b": "x"}},
+	}
+
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, main.QueryResultToCSV(buffer, result))
+	assert.Equal(t, "b,a\nx,1\n", buffer.String())
+
+	buffer.Reset()
+	assert.NoError(t, main.QueryResultToJSON(buffer, result))
+	assert.JSONEq(t, `[{"a": 1, "b": "x"}]`, buffer.String())
+
+	assert.Error(t, main.QueryResultToCSV(nil, result))
+	assert.Error(t, main.QueryResultToJSON(nil, result))
+}
+
+// TestPerformDataExportQueries checks that results of queries are stored
+// into files next to tables
+func TestPerformDataExportQueries(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareSQLiteDatabase(t, directory, ruleHitsStatements...)
+	configuration.Queries = []main.QueryConfiguration{
+		{Name: "hits_per_org", SQL: "SELECT org_id, count(*) AS hits FROM rule_hit GROUP BY org_id"},
+		{Name: "rules", SQL: "SELECT DISTINCT rule_fqdn FROM rule_hit ORDER BY 1", Format: "json"},
+	}
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output: "file",
+		Limit:  NoLimits,
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.FileExists(t, filepath.Join(directory, "rule_hit.csv"))
+
+	content, err := os.ReadFile(filepath.Join(directory, "hits_per_org.csv"))
+	assert.NoError(t, err)
+	assert.Equal(t, "org_id,hits\n1,4\n2,1\n", string(content))
+
+	content, err = os.ReadFile(filepath.Join(directory, "rules.json"))
+	assert.NoError(t, err)
+	assert.JSONEq(t, `[{"rule_fqdn": "rule.a"}, {"rule_fqdn": "rule.b"}, {"rule_fqdn": "rule.c"}]`,
+		string(content))
+
+	// failing query is reported like failing table
+	configuration.Queries = []main.QueryConfiguration{
+		{Name: "broken", SQL: "SELECT * FROM nonexistent"},
+	}
+	cliFlags.ContinueOnError = true
+	cliFlags.Force = true
+	code, err = main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusPartialSuccess, code)
+	assert.FileExists(t, filepath.Join(directory, "_failures.json"))
+
+	// invalid query is refused before anything is exported
+	configuration.Queries = []main.QueryConfiguration{{Name: "broken"}}
+	code, err = main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.EqualError(t, err, "query broken without SQL statement")
+	assert.Equal(t, main.ExitStatusConfigurationError, code)
+
+	// query with the same name as table is refused too
+	configuration.Queries = []main.QueryConfiguration{
+		{Name: "rule_hit", SQL: "SELECT 1"},
+	}
+	code, err = main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.EqualError(t, err, "name of query rule_hit is the same as name of exported table")
+	assert.Equal(t, main.ExitStatusConfigurationError, code)
+}
+
+// TestPerformDataExportQueriesS3 checks that results of queries are stored
+// into S3 under configured prefix
+func TestPerformDataExportQueriesS3(t *testing.T) {
+	configuration := prepareSQLiteDatabase(t, t.TempDir(), ruleHitsStatements...)
+	configuration.Queries = []main.QueryConfiguration{
+		{Name: "rules", SQL: "SELECT DISTINCT rule_fqdn FROM rule_hit", Format: "json"},
+	}
+	requests := mockS3(t, &configuration, "bucket")
+
+	cliFlags := main.CliFlags{
+		Output: "S3",
+		Limit:  NoLimits,
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.Contains(t, requests(), "PUT /bucket/prefix/rules.json")
+}
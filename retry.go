@@ -0,0 +1,260 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains retry policy used for database queries and S3
+// uploads. Only transient errors (lost connection, database failover, S3
+// 5xx responses etc.) are retried, with exponential backoff and jitter.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/retry.html
+
+import (
+	"bytes"
+	"context"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"math/rand"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+
+	"github.com/lib/pq"
+	"github.com/minio/minio-go/v7"
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel/attribute"
+)
+
+// Messages
+const (
+	retryingOperation = "Transient error, operation will be retried"
+	operationMsg      = "operation"
+	attemptMsg        = "attempt"
+	retriesMsg        = "retries"
+)
+
+// RetryConfiguration represents configuration of retries of database queries
+// and S3 uploads
+type RetryConfiguration struct {
+	// MaxAttempts is maximum number of attempts, including the first one.
+	// Zero or one means that operations are not retried.
+	MaxAttempts int `mapstructure:"max_attempts" toml:"max_attempts"`
+
+	// BaseDelay is delay before the first retry. Delay is doubled before
+	// each next retry.
+	BaseDelay time.Duration `mapstructure:"base_delay" toml:"base_delay"`
+
+	// MaxDelay limits delay between retries. Zero means no limit.
+	MaxDelay time.Duration `mapstructure:"max_delay" toml:"max_delay"`
+
+	// Jitter is a fraction of delay (0.0 to 1.0) that is randomly added or
+	// subtracted, so retries from more jobs are not synchronized.
+	Jitter float64 `mapstructure:"jitter" toml:"jitter"`
+}
+
+// RetryPolicy decides whether and when failed operation is retried.
+type RetryPolicy struct {
+	RetryConfiguration
+}
+
+// NewRetryPolicy function constructs retry policy from configuration.
+func NewRetryPolicy(configuration RetryConfiguration) RetryPolicy {
+	return RetryPolicy{configuration}
+}
+
+// attempts method returns maximum number of attempts.
+func (policy RetryPolicy) attempts() int {
+	if policy.MaxAttempts < 1 {
+		return 1
+	}
+	return policy.MaxAttempts
+}
+
+// Delay method computes delay before given retry (counted from 1).
+func (policy RetryPolicy) Delay(retry int) time.Duration {
+	delay := policy.BaseDelay
+	for i := 1; i < retry; i++ {
+		delay *= 2
+		if policy.MaxDelay > 0 && delay >= policy.MaxDelay {
+			break
+		}
+	}
+
+	if policy.MaxDelay > 0 && delay > policy.MaxDelay {
+		delay = policy.MaxDelay
+	}
+
+	if policy.Jitter > 0 {
+		// #nosec G404 -- jitter does not need to be cryptographically secure
+		factor := 1 + policy.Jitter*(2*rand.Float64()-1)
+		delay = time.Duration(float64(delay) * factor)
+	}
+
+	return delay
+}
+
+// Do method calls given function until it succeeds, returns error that can't
+// be retried, or maximum number of attempts is reached. Retries are stopped
+// when given context is cancelled. Number of retries performed is returned
+// together with the last error.
+func (policy RetryPolicy) Do(ctx context.Context, operation string, function func() error) (int, error) {
+	for attempt := 1; ; attempt++ {
+		err := function()
+		if err == nil || attempt >= policy.attempts() || !isRetryable(err) ||
+			ctx.Err() != nil {
+			return attempt - 1, err
+		}
+
+		delay := policy.Delay(attempt)
+		log.Warn().
+			Err(err).
+			Str(operationMsg, operation).
+			Int(attemptMsg, attempt).
+			Dur("delay", delay).
+			Msg(retryingOperation)
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return attempt - 1, err
+		case <-timer.C:
+		}
+	}
+}
+
+// isRetryable function returns true for errors that are transient, so the
+// operation might succeed when it is performed again.
+func isRetryable(err error) bool {
+	if err == nil {
+		return false
+	}
+
+	// operation has been cancelled, it must not be performed again
+	if errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+
+	// connection to database has been lost
+	if errors.Is(err, driver.ErrBadConn) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+
+	var pqError *pq.Error
+	if errors.As(err, &pqError) {
+		return isRetryablePostgresError(pqError)
+	}
+
+	var s3Error minio.ErrorResponse
+	if errors.As(err, &s3Error) {
+		return isRetryableS3Error(s3Error)
+	}
+
+	// connection refused or reset during failover, timeouts
+	if errors.Is(err, syscall.ECONNREFUSED) || errors.Is(err, syscall.ECONNRESET) {
+		return true
+	}
+
+	var netError net.Error
+	return errors.As(err, &netError) && netError.Timeout()
+}
+
+// isRetryablePostgresError function checks SQLSTATE code returned by
+// PostgreSQL.
+func isRetryablePostgresError(err *pq.Error) bool {
+	switch string(err.Code) {
+	case "40001", // serialization failure
+		"40P01", // deadlock detected
+		"57P01", // admin shutdown
+		"57P02", // crash shutdown
+		"57P03": // cannot connect now
+		return true
+	}
+
+	switch string(err.Code.Class()) {
+	case "08", // connection exception
+		"53": // insufficient resources
+		return true
+	}
+
+	return false
+}
+
+// isRetryableS3Error function checks error response returned by S3.
+func isRetryableS3Error(err minio.ErrorResponse) bool {
+	switch err.Code {
+	case "SlowDown", "RequestTimeout", "InternalError", "ServiceUnavailable":
+		return true
+	}
+	return err.StatusCode >= http.StatusInternalServerError ||
+		err.StatusCode == http.StatusTooManyRequests
+}
+
+// putObject function uploads given data into S3. Upload is retried according
+// to given retry policy. Number of retries is returned.
+func putObject(ctx context.Context, policy RetryPolicy, minioClient *minio.Client,
+	bucketName, objectName string, data []byte,
+	options minio.PutObjectOptions) (int, error) {
+	ctx, span := startSpan(ctx, uploadSpan,
+		attribute.String(bucketAttribute, bucketName),
+		attribute.String(objectAttribute, objectName),
+		attribute.Int(bytesAttribute, len(data)))
+
+	retries, err := policy.Do(ctx, "upload "+objectName, func() error {
+		// reader needs to be recreated for each attempt
+		_, err := minioClient.PutObject(ctx, bucketName, objectName,
+			bytes.NewReader(data), int64(len(data)), options)
+		return err
+	})
+
+	span.SetAttributes(attribute.Int(retriesAttribute, retries))
+	endSpan(span, err)
+	return retries, err
+}
+
+// RetryStats contains number of retries performed for each table.
+type RetryStats struct {
+	retries map[TableName]int
+}
+
+// NewRetryStats function constructs empty retry statistic.
+func NewRetryStats() *RetryStats {
+	return &RetryStats{
+		retries: make(map[TableName]int),
+	}
+}
+
+// Add method adds given number of retries for selected table.
+func (stats *RetryStats) Add(tableName TableName, retries int) {
+	if stats == nil || retries == 0 {
+		return
+	}
+	stats.retries[tableName] += retries
+}
+
+// Retries method returns number of retries performed for selected table.
+func (stats *RetryStats) Retries(tableName TableName) int {
+	if stats == nil {
+		return 0
+	}
+	return stats.retries[tableName]
+}
@@ -0,0 +1,230 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/retry_test.html
+
+import (
+	"context"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"io"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/minio/minio-go/v7"
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// testRetryPolicy is retry policy with short delays used by unit tests
+var testRetryPolicy = main.NewRetryPolicy(main.RetryConfiguration{
+	MaxAttempts: 3,
+	BaseDelay:   time.Millisecond,
+})
+
+// TestRetryPolicyDelay checks exponential backoff computation
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := main.NewRetryPolicy(main.RetryConfiguration{
+		BaseDelay: 100 * time.Millisecond,
+		MaxDelay:  time.Second,
+	})
+
+	expected := []time.Duration{
+		100 * time.Millisecond,
+		200 * time.Millisecond,
+		400 * time.Millisecond,
+		800 * time.Millisecond,
+		time.Second,
+		time.Second,
+	}
+
+	for i, delay := range expected {
+		assert.Equal(t, delay, policy.Delay(i+1), "retry %d", i+1)
+	}
+}
+
+// TestRetryPolicyDelayJitter checks that jitter is applied to delay
+func TestRetryPolicyDelayJitter(t *testing.T) {
+	policy := main.NewRetryPolicy(main.RetryConfiguration{
+		BaseDelay: time.Second,
+		Jitter:    0.5,
+	})
+
+	for i := 0; i < 100; i++ {
+		delay := policy.Delay(1)
+		assert.GreaterOrEqual(t, delay, 500*time.Millisecond)
+		assert.LessOrEqual(t, delay, 1500*time.Millisecond)
+	}
+}
+
+// TestRetryPolicyDoSuccessAfterRetries checks that transient errors are
+// retried
+func TestRetryPolicyDoSuccessAfterRetries(t *testing.T) {
+	calls := 0
+	retries, err := testRetryPolicy.Do(context.Background(), "test", func() error {
+		calls++
+		if calls < 3 {
+			return driver.ErrBadConn
+		}
+		return nil
+	})
+
+	assert.NoError(t, err)
+	assert.Equal(t, 2, retries)
+	assert.Equal(t, 3, calls)
+}
+
+// TestRetryPolicyDoMaxAttempts checks that operation is not retried more
+// than configured
+func TestRetryPolicyDoMaxAttempts(t *testing.T) {
+	calls := 0
+	retries, err := testRetryPolicy.Do(context.Background(), "test", func() error {
+		calls++
+		return driver.ErrBadConn
+	})
+
+	assert.ErrorIs(t, err, driver.ErrBadConn)
+	assert.Equal(t, 2, retries)
+	assert.Equal(t, 3, calls)
+}
+
+// TestRetryPolicyDoPermanentError checks that permanent errors are not
+// retried
+func TestRetryPolicyDoPermanentError(t *testing.T) {
+	calls := 0
+	permanentError := errors.New("syntax error")
+	retries, err := testRetryPolicy.Do(context.Background(), "test", func() error {
+		calls++
+		return permanentError
+	})
+
+	assert.ErrorIs(t, err, permanentError)
+	assert.Equal(t, 0, retries)
+	assert.Equal(t, 1, calls)
+}
+
+// TestRetryPolicyDoDisabled checks that zero policy does not retry
+func TestRetryPolicyDoDisabled(t *testing.T) {
+	calls := 0
+	retries, err := main.RetryPolicy{}.Do(context.Background(), "test", func() error {
+		calls++
+		return driver.ErrBadConn
+	})
+
+	assert.Error(t, err)
+	assert.Equal(t, 0, retries)
+	assert.Equal(t, 1, calls)
+}
+
+// TestRetryPolicyDoCancelled checks that operation is not retried when
+// context is cancelled
+func TestRetryPolicyDoCancelled(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	calls := 0
+	policy := main.NewRetryPolicy(main.RetryConfiguration{
+		MaxAttempts: 3,
+		BaseDelay:   time.Hour,
+	})
+	retries, err := policy.Do(ctx, "test", func() error {
+		calls++
+		return syscall.ECONNRESET
+	})
+
+	assert.ErrorIs(t, err, syscall.ECONNRESET)
+	assert.Equal(t, 0, retries)
+	assert.Equal(t, 1, calls)
+}
+
+// TestIsRetryable checks classification of errors
+func TestIsRetryable(t *testing.T) {
+	testCases := []struct {
+		description string
+		err         error
+		retryable   bool
+	}{
+		{"no error", nil, false},
+		{"generic error", errors.New("error"), false},
+		{"cancelled", context.Canceled, false},
+		{"deadline exceeded", fmt.Errorf("query: %w", context.DeadlineExceeded), false},
+		{"bad connection", driver.ErrBadConn, true},
+		{"unexpected EOF", fmt.Errorf("read: %w", io.ErrUnexpectedEOF), true},
+		{"connection reset", fmt.Errorf("read: %w", syscall.ECONNRESET), true},
+		{"connection refused", fmt.Errorf("dial: %w", syscall.ECONNREFUSED), true},
+		{"PostgreSQL connection failure", &pq.Error{Code: "08006"}, true},
+		{"PostgreSQL admin shutdown", &pq.Error{Code: "57P01"}, true},
+		{"PostgreSQL serialization failure", &pq.Error{Code: "40001"}, true},
+		{"PostgreSQL undefined table", &pq.Error{Code: "42P01"}, false},
+		{"S3 internal error", minio.ErrorResponse{StatusCode: 500}, true},
+		{"S3 service unavailable", minio.ErrorResponse{StatusCode: 503}, true},
+		{"S3 slow down", minio.ErrorResponse{Code: "SlowDown"}, true},
+		{"S3 too many requests", minio.ErrorResponse{StatusCode: 429}, true},
+		{"S3 no such bucket", minio.ErrorResponse{StatusCode: 404, Code: "NoSuchBucket"}, false},
+		{"S3 access denied", minio.ErrorResponse{StatusCode: 403, Code: "AccessDenied"}, false},
+	}
+
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			assert.Equal(t, testCase.retryable, main.IsRetryable(testCase.err))
+		})
+	}
+}
+
+// TestReadTableRetry checks that reading table is retried when database
+// is not available for a while and that retries are counted
+func TestReadTableRetry(t *testing.T) {
+	// prepare new mocked connection to database
+	connection, mock := mustCreateMockConnection(t)
+
+	// the first attempt fails because of database failover
+	expectPrimaryKeyQuery(mock, "table_name", "id")
+	mock.ExpectQuery("SELECT \\* FROM table_name").
+		WillReturnError(&pq.Error{Code: "57P01"})
+
+	// the second attempt succeeds
+	expectPrimaryKeyQuery(mock, "table_name", "id")
+	rows := sqlmock.NewRows([]string{"id"}).AddRow(1)
+	mock.ExpectQuery("SELECT \\* FROM table_name").WillReturnRows(rows)
+	mock.ExpectClose()
+
+	config := testConfig
+	config.EnableOrgIDFiltering = false
+	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &config)
+	main.SetRetryPolicy(storage, testRetryPolicy)
+
+	values, err := storage.ReadTable(context.Background(), "table_name", NoLimits)
+	assert.NoError(t, err)
+	assert.Len(t, values, 1)
+	assert.Equal(t, 1, storage.Retries("table_name"))
+
+	// connection to mocked DB needs to be closed properly
+	checkConnectionClose(t, connection)
+
+	// check if all expectations were met
+	checkAllExpectations(t, mock)
+}
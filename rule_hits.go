@@ -0,0 +1,471 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains analytics export derived from rule_hit and
+// report tables. For each rule and error key, number of hits, clusters hit
+// and organizations affected are computed together with the most frequent
+// keys of template data. Distribution of hits per cluster is computed for
+// all clusters stored in report table. Rows are filtered by organizations
+// the same way as during export of tables.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/rule_hits.html
+
+import (
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Messages
+const (
+	exportingRuleHitsSummary    = "Exporting rule hits summary"
+	readRuleHitsSummaryFailed   = "Read rule hits summary failed"
+	storeRuleHitsSummaryFailed  = "Store rule hits summary failed"
+	templateDataIsNotJSONObject = "Template data is not JSON object, keys are not counted"
+	writeRuleHitsSummaryToCSV   = "Write rule hits summary to CSV"
+	writeRuleHitsSummaryToJSON  = "Write rule hits summary to JSON"
+)
+
+// SQL queries used to read rule hits, filter by organizations is added into
+// WHERE clause
+const (
+	selectRuleHitCounts = `
+           SELECT rule_fqdn, error_key, count(*),
+                  count(DISTINCT cluster_id), count(DISTINCT org_id)
+             FROM rule_hit`
+
+	selectHitsPerCluster = `
+           SELECT cluster_id, count(*)
+             FROM rule_hit`
+
+	selectTemplateData = `
+           SELECT rule_fqdn, error_key, template_data
+             FROM rule_hit`
+
+	selectReportedClusters = `
+           SELECT DISTINCT cluster
+             FROM report`
+
+	templateDataIsSet = "template_data IS NOT NULL"
+	groupByRuleFQDN   = " GROUP BY rule_fqdn, error_key"
+	groupByClusterID  = " GROUP BY cluster_id"
+)
+
+// tables the rule hits summary is derived from
+const (
+	ruleHitTable TableName = "rule_hit"
+	reportTable  TableName = "report"
+)
+
+// topTemplateKeysCount is number of the most frequent template data keys
+// reported for each rule
+const topTemplateKeysCount = 5
+
+// hitsPerClusterBuckets contains upper bounds of buckets used for
+// distribution of hits per cluster, the last bucket is unbounded
+var hitsPerClusterBuckets = []int{0, 1, 2, 5, 10, 20}
+
+// KeyCount represents number of occurrences of template data key
+type KeyCount struct {
+	Key   string `json:"key"`
+	Count int    `json:"count"`
+}
+
+// RuleHitsInfo contains aggregated hits of one rule and error key
+type RuleHitsInfo struct {
+	RuleFQDN      string     `json:"rule_fqdn"`
+	ErrorKey      string     `json:"error_key"`
+	Hits          int        `json:"hits"`
+	Clusters      int        `json:"clusters"`
+	Orgs          int        `json:"orgs"`
+	ClustersShare float64    `json:"clusters_share"`
+	TemplateKeys  []KeyCount `json:"template_keys"`
+}
+
+// HitsBucket represents number of clusters with number of hits in given
+// range
+type HitsBucket struct {
+	Hits     string `json:"hits"`
+	Clusters int    `json:"clusters"`
+}
+
+// HitsDistribution represents distribution of rule hits per cluster
+type HitsDistribution struct {
+	Min       int          `json:"min"`
+	Max       int          `json:"max"`
+	Mean      float64      `json:"mean"`
+	Median    int          `json:"median"`
+	P90       int          `json:"p90"`
+	Histogram []HitsBucket `json:"histogram"`
+}
+
+// RuleHitsSummary represents analytics derived from rule hits
+type RuleHitsSummary struct {
+	Clusters         int              `json:"clusters"`
+	ClustersWithHits int              `json:"clusters_with_hits"`
+	HitsPerCluster   HitsDistribution `json:"hits_per_cluster"`
+	Rules            []RuleHitsInfo   `json:"rules"`
+}
+
+// ruleHitsAggregate contains hits of one rule during aggregation
+type ruleHitsAggregate struct {
+	hits         int
+	clusters     int
+	orgs         int
+	templateKeys map[string]int
+}
+
+// ReadRuleHitsSummary method reads rule hits and reported clusters and
+// computes analytics from them. Hits are counted by database, only template
+// data are read row by row. Rows are filtered by organizations when
+// selective export is enabled.
+func (storage DBStorage) ReadRuleHitsSummary(ctx context.Context) (*RuleHitsSummary, error) {
+	clusters, err := storage.readReportedClusters(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rules, err := storage.readRuleHitCounts(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	hitsPerCluster, err := storage.readHitsPerCluster(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	err = storage.readTemplateKeys(ctx, rules)
+	if err != nil {
+		return nil, err
+	}
+
+	// clusters with hits need not be stored in report table
+	for clusterID := range hitsPerCluster {
+		clusters[clusterID] = struct{}{}
+	}
+
+	return newRuleHitsSummary(rules, clusters, hitsPerCluster), nil
+}
+
+// queryRuleHits method performs given query on table with rule hits or
+// reports, filter by organizations is applied to it. Given function is called
+// for each row.
+func (storage DBStorage) queryRuleHits(ctx context.Context, tableName TableName,
+	query, condition, groupBy string, scan func(rows *sql.Rows) error) error {
+	storage.applySelectiveExport(&query, tableName)
+	if condition != "" {
+		appendCondition(&query, condition)
+	}
+	query += groupBy
+
+	rows, err := storage.query(ctx, tableName, "read rule hits", query)
+	if err != nil {
+		return err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Error().Err(err).Msg(unableToCloseDBRowsHandle)
+		}
+	}()
+
+	for rows.Next() {
+		err := scan(rows)
+		if err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// readRuleHitCounts method reads number of hits, clusters and organizations
+// for each rule and error key.
+func (storage DBStorage) readRuleHitCounts(ctx context.Context) (map[DisabledRuleKey]*ruleHitsAggregate, error) {
+	rules := make(map[DisabledRuleKey]*ruleHitsAggregate)
+
+	err := storage.queryRuleHits(ctx, ruleHitTable, selectRuleHitCounts, "", groupByRuleFQDN,
+		func(rows *sql.Rows) error {
+			var key DisabledRuleKey
+			rule := &ruleHitsAggregate{templateKeys: make(map[string]int)}
+
+			err := rows.Scan(&key.Rule, &key.ErrorKey, &rule.hits, &rule.clusters, &rule.orgs)
+			if err != nil {
+				return err
+			}
+			rules[key] = rule
+			return nil
+		})
+	return rules, err
+}
+
+// readHitsPerCluster method reads number of rule hits for each cluster with
+// at least one hit.
+func (storage DBStorage) readHitsPerCluster(ctx context.Context) (map[string]int, error) {
+	hitsPerCluster := make(map[string]int)
+
+	err := storage.queryRuleHits(ctx, ruleHitTable, selectHitsPerCluster, "", groupByClusterID,
+		func(rows *sql.Rows) error {
+			var clusterID string
+			var hits int
+
+			err := rows.Scan(&clusterID, &hits)
+			if err != nil {
+				return err
+			}
+			hitsPerCluster[clusterID] = hits
+			return nil
+		})
+	return hitsPerCluster, err
+}
+
+// readTemplateKeys method counts keys of template data for given rules.
+// Template data are streamed, so they are never held in memory together.
+func (storage DBStorage) readTemplateKeys(ctx context.Context, rules map[DisabledRuleKey]*ruleHitsAggregate) error {
+	return storage.queryRuleHits(ctx, ruleHitTable, selectTemplateData, templateDataIsSet, "",
+		func(rows *sql.Rows) error {
+			var key DisabledRuleKey
+			var templateData string
+
+			err := rows.Scan(&key.Rule, &key.ErrorKey, &templateData)
+			if err != nil {
+				return err
+			}
+
+			// hits inserted after counts were read are not counted
+			if rule, found := rules[key]; found {
+				countTemplateKeys(rule.templateKeys, templateData)
+			}
+			return nil
+		})
+}
+
+// readReportedClusters method reads IDs of all clusters stored in report
+// table.
+func (storage DBStorage) readReportedClusters(ctx context.Context) (map[string]struct{}, error) {
+	clusters := make(map[string]struct{})
+
+	err := storage.queryRuleHits(ctx, reportTable, selectReportedClusters, "", "",
+		func(rows *sql.Rows) error {
+			var clusterID string
+			if err := rows.Scan(&clusterID); err != nil {
+				return err
+			}
+			clusters[clusterID] = struct{}{}
+			return nil
+		})
+	return clusters, err
+}
+
+// countTemplateKeys function counts top level keys of template data stored
+// as JSON object.
+func countTemplateKeys(counts map[string]int, templateData string) {
+	if templateData == "" {
+		return
+	}
+
+	var object map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(templateData), &object); err != nil {
+		log.Debug().Err(err).Msg(templateDataIsNotJSONObject)
+		return
+	}
+	for key := range object {
+		counts[key]++
+	}
+}
+
+// newRuleHitsSummary function constructs summary from aggregated rule hits.
+// Rules are ordered by number of clusters hit.
+func newRuleHitsSummary(rules map[DisabledRuleKey]*ruleHitsAggregate,
+	clusters map[string]struct{}, hitsPerCluster map[string]int) *RuleHitsSummary {
+	summary := &RuleHitsSummary{
+		Clusters:         len(clusters),
+		ClustersWithHits: len(hitsPerCluster),
+		Rules:            make([]RuleHitsInfo, 0, len(rules)),
+	}
+
+	for key, rule := range rules {
+		summary.Rules = append(summary.Rules, RuleHitsInfo{
+			RuleFQDN:      key.Rule,
+			ErrorKey:      key.ErrorKey,
+			Hits:          rule.hits,
+			Clusters:      rule.clusters,
+			Orgs:          rule.orgs,
+			ClustersShare: share(rule.clusters, len(clusters)),
+			TemplateKeys:  topTemplateKeys(rule.templateKeys),
+		})
+	}
+	sort.Slice(summary.Rules, func(i, j int) bool {
+		a, b := summary.Rules[i], summary.Rules[j]
+		if a.Clusters != b.Clusters {
+			return a.Clusters > b.Clusters
+		}
+		if a.RuleFQDN != b.RuleFQDN {
+			return a.RuleFQDN < b.RuleFQDN
+		}
+		return a.ErrorKey < b.ErrorKey
+	})
+
+	// clusters without any hit are part of distribution too
+	hits := make([]int, 0, len(clusters))
+	for clusterID := range clusters {
+		hits = append(hits, hitsPerCluster[clusterID])
+	}
+	summary.HitsPerCluster = newHitsDistribution(hits)
+
+	return summary
+}
+
+// share function returns ratio of two numbers rounded to four decimal
+// places, zero is returned for zero total.
+func share(count, total int) float64 {
+	if total == 0 {
+		return 0
+	}
+	return math.Round(float64(count)/float64(total)*10000) / 10000
+}
+
+// topTemplateKeys function returns the most frequent template data keys.
+func topTemplateKeys(counts map[string]int) []KeyCount {
+	keys := make([]KeyCount, 0, len(counts))
+	for key, count := range counts {
+		keys = append(keys, KeyCount{Key: key, Count: count})
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].Count != keys[j].Count {
+			return keys[i].Count > keys[j].Count
+		}
+		return keys[i].Key < keys[j].Key
+	})
+	if len(keys) > topTemplateKeysCount {
+		keys = keys[:topTemplateKeysCount]
+	}
+	return keys
+}
+
+// newHitsDistribution function computes distribution of given numbers of
+// hits per cluster.
+func newHitsDistribution(hits []int) HitsDistribution {
+	distribution := HitsDistribution{
+		Histogram: make([]HitsBucket, 0, len(hitsPerClusterBuckets)+1),
+	}
+
+	lower := 0
+	for _, upper := range hitsPerClusterBuckets {
+		distribution.Histogram = append(distribution.Histogram,
+			HitsBucket{Hits: bucketName(lower, upper)})
+		lower = upper + 1
+	}
+	distribution.Histogram = append(distribution.Histogram,
+		HitsBucket{Hits: fmt.Sprintf("%d+", lower)})
+
+	if len(hits) == 0 {
+		return distribution
+	}
+
+	sort.Ints(hits)
+	total := 0
+	for _, count := range hits {
+		total += count
+		bucket := sort.SearchInts(hitsPerClusterBuckets, count)
+		distribution.Histogram[bucket].Clusters++
+	}
+
+	distribution.Min = hits[0]
+	distribution.Max = hits[len(hits)-1]
+	distribution.Mean = math.Round(float64(total)/float64(len(hits))*100) / 100
+	distribution.Median = hits[(len(hits)-1)/2]
+	distribution.P90 = hits[int(math.Ceil(0.9*float64(len(hits))))-1]
+	return distribution
+}
+
+// bucketName function returns name of histogram bucket.
+func bucketName(lower, upper int) string {
+	if lower == upper {
+		return strconv.Itoa(lower)
+	}
+	return fmt.Sprintf("%d-%d", lower, upper)
+}
+
+// RuleHitsSummaryToCSV function exports hits of all rules into CSV file.
+// Template data keys are written as key:count pairs separated by semicolon.
+func RuleHitsSummaryToCSV(buffer io.Writer, summary *RuleHitsSummary) error {
+	if buffer == nil {
+		err := errors.New(bufferIsNil)
+		log.Error().Err(err).Msg(writeRuleHitsSummaryToCSV)
+		return err
+	}
+
+	writer := csv.NewWriter(buffer)
+
+	err := writer.Write([]string{"Rule", "Error key", "Hits", "Clusters",
+		"Organizations", "Clusters share", "Template keys"})
+	if err != nil {
+		return err
+	}
+
+	for _, rule := range summary.Rules {
+		keys := make([]string, 0, len(rule.TemplateKeys))
+		for _, key := range rule.TemplateKeys {
+			keys = append(keys, fmt.Sprintf("%s:%d", key.Key, key.Count))
+		}
+
+		err := writer.Write([]string{
+			rule.RuleFQDN,
+			rule.ErrorKey,
+			strconv.Itoa(rule.Hits),
+			strconv.Itoa(rule.Clusters),
+			strconv.Itoa(rule.Orgs),
+			strconv.FormatFloat(rule.ClustersShare, 'f', 4, 64),
+			strings.Join(keys, ";")})
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// RuleHitsSummaryToJSON function exports whole rule hits summary into JSON.
+func RuleHitsSummaryToJSON(buffer io.Writer, summary *RuleHitsSummary) error {
+	if buffer == nil {
+		err := errors.New(bufferIsNil)
+		log.Error().Err(err).Msg(writeRuleHitsSummaryToJSON)
+		return err
+	}
+
+	encoder := json.NewEncoder(buffer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(summary)
+}
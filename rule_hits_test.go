@@ -0,0 +1,222 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/rule_hits_test.html
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// ruleHitsStatements contains statements that create tables with rule hits
+var ruleHitsStatements = []string{
+	`CREATE TABLE report (org_id INTEGER, cluster VARCHAR, report VARCHAR)`,
+	`CREATE TABLE rule_hit (org_id INTEGER, cluster_id VARCHAR, rule_fqdn VARCHAR,
+		error_key VARCHAR, template_data VARCHAR)`,
+	`INSERT INTO report VALUES (1, 'c1', '{}'), (1, 'c2', '{}'), (2, 'c3', '{}'), (2, 'c4', '{}')`,
+	`INSERT INTO rule_hit VALUES
+		(1, 'c1', 'rule.a', 'KEY_A', '{"kcs": "x", "nodes": []}'),
+		(1, 'c2', 'rule.a', 'KEY_A', '{"kcs": "y"}'),
+		(2, 'c3', 'rule.a', 'KEY_A', 'not JSON'),
+		(1, 'c1', 'rule.b', 'KEY_B', NULL),
+		(1, 'c1', 'rule.c', 'KEY_C', '{"kcs": "z"}')`,
+}
+
+// TestReadRuleHitsSummary checks analytics computed from rule hits
+func TestReadRuleHitsSummary(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, ruleHitsStatements...)
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &testConfig)
+
+	summary, err := storage.ReadRuleHitsSummary(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, 4, summary.Clusters)
+	assert.Equal(t, 3, summary.ClustersWithHits)
+	assert.Equal(t, []main.RuleHitsInfo{
+		{
+			RuleFQDN: "rule.a", ErrorKey: "KEY_A", Hits: 3, Clusters: 3, Orgs: 2,
+			ClustersShare: 0.75,
+			TemplateKeys:  []main.KeyCount{{Key: "kcs", Count: 2}, {Key: "nodes", Count: 1}},
+		},
+		{
+			RuleFQDN: "rule.b", ErrorKey: "KEY_B", Hits: 1, Clusters: 1, Orgs: 1,
+			ClustersShare: 0.25,
+			TemplateKeys:  []main.KeyCount{},
+		},
+		{
+			RuleFQDN: "rule.c", ErrorKey: "KEY_C", Hits: 1, Clusters: 1, Orgs: 1,
+			ClustersShare: 0.25,
+			TemplateKeys:  []main.KeyCount{{Key: "kcs", Count: 1}},
+		},
+	}, summary.Rules)
+
+	// hits per cluster are 3, 1, 1 and 0
+	distribution := summary.HitsPerCluster
+	assert.Equal(t, 0, distribution.Min)
+	assert.Equal(t, 3, distribution.Max)
+	assert.Equal(t, 1.25, distribution.Mean)
+	assert.Equal(t, 1, distribution.Median)
+	assert.Equal(t, 3, distribution.P90)
+	assert.Equal(t, []main.HitsBucket{
+		{Hits: "0", Clusters: 1},
+		{Hits: "1", Clusters: 2},
+		{Hits: "2", Clusters: 0},
+		{Hits: "3-5", Clusters: 1},
+		{Hits: "6-10", Clusters: 0},
+		{Hits: "11-20", Clusters: 0},
+		{Hits: "21+", Clusters: 0},
+	}, distribution.Histogram)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestReadRuleHitsSummaryOrgFiltering checks that rule hits are filtered by
+// organizations
+func TestReadRuleHitsSummaryOrgFiltering(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, ruleHitsStatements...)
+
+	config := testConfig
+	config.EnableOrgIDFiltering = true
+	config.OrganizationsToExport = []string{"2"}
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	summary, err := storage.ReadRuleHitsSummary(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, 2, summary.Clusters)
+	assert.Equal(t, 1, summary.ClustersWithHits)
+	assert.Len(t, summary.Rules, 1)
+	assert.Equal(t, "rule.a", summary.Rules[0].RuleFQDN)
+	assert.Equal(t, 1, summary.Rules[0].Hits)
+	assert.Equal(t, 0.5, summary.Rules[0].ClustersShare)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestReadRuleHitsSummaryEmpty checks summary computed from empty tables
+func TestReadRuleHitsSummaryEmpty(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, ruleHitsStatements[:2]...)
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &testConfig)
+
+	summary, err := storage.ReadRuleHitsSummary(context.Background())
+	assert.NoError(t, err)
+
+	assert.Equal(t, 0, summary.Clusters)
+	assert.Empty(t, summary.Rules)
+	assert.Len(t, summary.HitsPerCluster.Histogram, 7)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestReadRuleHitsSummaryMissingTable checks that missing table is reported
+func TestReadRuleHitsSummaryMissingTable(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, ruleHitsStatements[0])
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &testConfig)
+
+	_, err := storage.ReadRuleHitsSummary(context.Background())
+	assert.Error(t, err)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestRuleHitsSummaryToCSV checks conversion of rule hits summary into CSV
+func TestRuleHitsSummaryToCSV(t *testing.T) {
+	summary := &main.RuleHitsSummary{
+		Rules: []main.RuleHitsInfo{
+			{
+				RuleFQDN: "rule.a", ErrorKey: "KEY_A", Hits: 3, Clusters: 2, Orgs: 1,
+				ClustersShare: 0.5,
+				TemplateKeys:  []main.KeyCount{{Key: "kcs", Count: 3}, {Key: "nodes", Count: 1}},
+			},
+		},
+	}
+
+	buffer := new(bytes.Buffer)
+	assert.NoError(t, main.RuleHitsSummaryToCSV(buffer, summary))
+
+	lines := strings.Split(buffer.String(), "\n")
+	assert.Equal(t, "Rule,Error key,Hits,Clusters,Organizations,Clusters share,Template keys", lines[0])
+	assert.Equal(t, "rule.a,KEY_A,3,2,1,0.5000,kcs:3;nodes:1", lines[1])
+
+	assert.Error(t, main.RuleHitsSummaryToCSV(nil, summary))
+	assert.Error(t, main.RuleHitsSummaryToJSON(nil, summary))
+}
+
+// TestPerformDataExportRuleHitsSummary checks that rule hits summary is
+// stored into files
+func TestPerformDataExportRuleHitsSummary(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareSQLiteDatabase(t, directory, ruleHitsStatements...)
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:                "file",
+		Limit:                 NoLimits,
+		ExportRuleHitsSummary: true,
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	records := readDisabledRulesReport(t, filepath.Join(directory, "_rule_hits_summary.csv"))
+	assert.Len(t, records, 4)
+	assert.Equal(t, []string{"rule.a", "KEY_A", "3", "3", "2", "0.7500", "kcs:2;nodes:1"}, records[1])
+
+	content, err := os.ReadFile(filepath.Join(directory, "_rule_hits_summary.json"))
+	assert.NoError(t, err)
+
+	var summary main.RuleHitsSummary
+	assert.NoError(t, json.Unmarshal(content, &summary))
+	assert.Equal(t, 4, summary.Clusters)
+	assert.Len(t, summary.Rules, 3)
+	assert.Equal(t, 3, summary.HitsPerCluster.Max)
+}
+
+// TestPerformDataExportRuleHitsSummaryS3 checks that rule hits summary is
+// stored into S3 without prefix
+func TestPerformDataExportRuleHitsSummaryS3(t *testing.T) {
+	configuration := prepareSQLiteDatabase(t, t.TempDir(), ruleHitsStatements...)
+	requests := mockS3(t, &configuration, "bucket")
+
+	cliFlags := main.CliFlags{
+		Output:                "S3",
+		Limit:                 NoLimits,
+		ExportRuleHitsSummary: true,
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+	assert.Contains(t, requests(), "PUT /bucket/_rule_hits_summary.csv")
+	assert.Contains(t, requests(), "PUT /bucket/_rule_hits_summary.json")
+}
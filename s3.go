@@ -25,10 +25,10 @@ package main
 import (
 	"bytes"
 	"context"
-	"encoding/csv"
 	"errors"
 	"fmt"
 	"io"
+	"os"
 
 	"github.com/rs/zerolog/log"
 
@@ -50,12 +50,12 @@ const (
 )
 
 // NewS3Connection function initializes connection to S3/Minio storage.
-func NewS3Connection(configuration *ConfigStruct) (*minio.Client, context.Context, error) {
+func NewS3Connection(configuration *ConfigStruct) (*minio.Client, error) {
 	// check if configuration structure has been provided
 	if configuration == nil {
 		err := errors.New(configurationIsNil)
 		log.Error().Err(err).Msg(configurationError)
-		return nil, nil, err
+		return nil, err
 	}
 
 	// retrieve S3/Minio configuration
@@ -70,8 +70,6 @@ func NewS3Connection(configuration *ConfigStruct) (*minio.Client, context.Contex
 	}
 	log.Info().Str("S3 endpoint", endpoint).Msg("Preparing connection")
 
-	ctx := context.Background()
-
 	// initialize Minio client object
 	minioClient, err := minio.New(endpoint, &minio.Options{
 		Creds: credentials.NewStaticV4(
@@ -83,11 +81,11 @@ func NewS3Connection(configuration *ConfigStruct) (*minio.Client, context.Contex
 	// check if client has been constructed properly
 	if err != nil {
 		log.Error().Err(err).Msg(unableToInitializeConnection)
-		return nil, nil, err
+		return nil, err
 	}
 
 	log.Info().Msg("Connection established")
-	return minioClient, ctx, nil
+	return minioClient, nil
 }
 
 // s3BucketExists function checks if bucket with given name exists and can be
@@ -119,68 +117,120 @@ func s3BucketExists(ctx context.Context, minioClient *minio.Client,
 	return found, nil
 }
 
-// storeTableNames function stores all table names passed via tableNames
-// parameter into given bucket under selected object name
-func storeTableNames(ctx context.Context, minioClient *minio.Client,
-	bucketName string, objectName string, tableNames []TableName) error {
-	// check if Minio client has been passed to this function
-	if minioClient == nil {
-		err := errors.New(minioClientIsNil)
-		log.Error().Err(err).Msg(wrongMinioClientReference)
-		return err
-	}
+// s3Sink is Sink that stores objects into S3 bucket. Object names are used
+// as keys of objects in the bucket.
+type s3Sink struct {
+	minioClient *minio.Client
+	bucketName  string
+	retryPolicy RetryPolicy
+}
 
-	// check if proper bucket name has been passed to this function
-	if bucketName == "" {
-		err := errors.New(bucketNameIsNotSet)
-		log.Error().Err(err).Msg(wrongBucketName)
-		return err
+// s3Object is object being written into S3. Content is buffered and uploaded
+// when the object is committed, because exact object size is used instead of
+// default value -1
+//
+// Warning: possible problems with large tables and 32bit architecture
+// Warning: passing -1 will allocate a large amount of memory
+//
+// Previous warning taken from:
+// https://docs.min.io/docs/golang-client-api-reference#PutObject
+type s3Object struct {
+	ctx         context.Context
+	sink        *s3Sink
+	objectName  string
+	contentType string
+	buffer      bytes.Buffer
+	retryCount  int
+}
+
+// newS3Sink function constructs sink that stores objects into given bucket.
+func newS3Sink(minioClient *minio.Client, bucketName string, retryPolicy RetryPolicy) *s3Sink {
+	return &s3Sink{
+		minioClient: minioClient,
+		bucketName:  bucketName,
+		retryPolicy: retryPolicy,
 	}
+}
 
-	// check if proper object name has been passed to this function
-	if objectName == "" {
-		err := errors.New(objectNameIsNotSet)
-		log.Error().Err(err).Msg(wrongObjectName)
-		return err
+// Create method creates new S3 object with given name and content type.
+func (sink *s3Sink) Create(ctx context.Context, name, contentType string) (SinkObject, error) {
+	err := checkS3Parameters(sink.minioClient, sink.bucketName, name)
+	if err != nil {
+		return nil, err
 	}
 
-	// conversion to CSV
-	buffer := new(bytes.Buffer)
+	return &s3Object{
+		ctx:         ctx,
+		sink:        sink,
+		objectName:  name,
+		contentType: contentType,
+	}, nil
+}
 
-	writer := csv.NewWriter(buffer)
-	var data = [][]string{{tableNameMsg}}
+// Read method reads content of S3 object with given name.
+func (sink *s3Sink) Read(ctx context.Context, name string) ([]byte, bool, error) {
+	return readObjectFromS3(ctx, sink.minioClient, sink.bucketName, name)
+}
 
-	err := writer.WriteAll(data)
-	if err != nil {
-		return err
-	}
+// Write method writes data into buffer with object content.
+func (object *s3Object) Write(data []byte) (int, error) {
+	return object.buffer.Write(data)
+}
 
-	for _, tableName := range tableNames {
-		err := writer.Write([]string{string(tableName)})
-		if err != nil {
-			log.Error().Err(err).Msg("Write to CSV")
-		}
-	}
+// Commit method uploads buffered content into S3/Minio.
+func (object *s3Object) Commit() error {
+	options := minio.PutObjectOptions{ContentType: object.contentType}
+	retries, err := putObject(object.ctx, object.sink.retryPolicy, object.sink.minioClient,
+		object.sink.bucketName, object.objectName, object.buffer.Bytes(), options)
+	object.retryCount = retries
+
+	// reset buffer before it will be garbage collected
+	object.buffer.Reset()
+	return err
+}
 
-	writer.Flush()
+// Abort method discards buffered content, nothing has been uploaded yet.
+func (object *s3Object) Abort() error {
+	object.buffer.Reset()
+	return nil
+}
 
-	reader := io.Reader(buffer)
+// retries method returns number of retries performed during upload
+func (object *s3Object) retries() int {
+	return object.retryCount
+}
 
-	// store CSV data into S3/Minio
-	options := minio.PutObjectOptions{ContentType: contentTypeCSV}
-	_, err = minioClient.PutObject(ctx, bucketName, objectName, reader, -1, options)
+// readObjectFromS3 function reads content of S3 object. False is returned
+// when the object does not exist.
+func readObjectFromS3(ctx context.Context, minioClient *minio.Client,
+	bucketName string, objectName string) ([]byte, bool, error) {
+	err := checkS3Parameters(minioClient, bucketName, objectName)
 	if err != nil {
-		return err
+		return nil, false, err
 	}
 
-	// everything seems to be ok
-	return nil
+	object, err := minioClient.GetObject(ctx, bucketName, objectName, minio.GetObjectOptions{})
+	if err != nil {
+		return nil, false, err
+	}
+	defer func() {
+		_ = object.Close()
+	}()
+
+	// error response is returned by the first read operation
+	content, err := io.ReadAll(object)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, false, nil
+		}
+		return nil, false, err
+	}
+	return content, true, nil
 }
 
-// storeDisabledRulesIntoS3 function stores info about disabled rules into S3
-// into given bucket under selected object name
-func storeDisabledRulesIntoS3(ctx context.Context, minioClient *minio.Client,
-	bucketName string, objectName string, disabledRulesInfo []DisabledRuleInfo) error {
+// checkS3Parameters function checks if Minio client, bucket name and object
+// name have been passed to function that writes into S3
+func checkS3Parameters(minioClient *minio.Client, bucketName, objectName string) error {
 	// check if Minio client has been passed to this function
 	if minioClient == nil {
 		err := errors.New(minioClientIsNil)
@@ -202,30 +252,26 @@ func storeDisabledRulesIntoS3(ctx context.Context, minioClient *minio.Client,
 		return err
 	}
 
-	// conversion to CSV
-	buffer := new(bytes.Buffer)
-	err := DisabledRulesToCSV(buffer, disabledRulesInfo)
+	return nil
+}
+
+// storeOperationLogIntoS3 function stores content of operation log file
+// into S3 into given bucket under selected object name. Upload is retried
+// according to given retry policy.
+func storeOperationLogIntoS3(ctx context.Context, policy RetryPolicy, minioClient *minio.Client,
+	bucketName string, objectName string, fileName string) error {
+	err := checkS3Parameters(minioClient, bucketName, objectName)
 	if err != nil {
-		log.Error().Err(err).Msg("Write table name to CSV")
 		return err
 	}
 
-	reader := io.Reader(buffer)
-
-	// store CSV data into S3/Minio
-	options := minio.PutObjectOptions{ContentType: contentTypeCSV}
-	_, err = minioClient.PutObject(ctx, bucketName, objectName, reader, -1, options)
+	// disable "G304 (CWE-22): Potential file inclusion via variable"
+	content, err := os.ReadFile(fileName) // #nosec G304
 	if err != nil {
 		return err
 	}
 
-	// everything seems to be ok
-	return nil
-}
-
-func storeBufferToS3(ctx context.Context, minioClient *minio.Client,
-	bucketName string, objectName string, buffer bytes.Buffer) error {
 	options := minio.PutObjectOptions{ContentType: "text/plain"}
-	_, err := minioClient.PutObject(ctx, bucketName, objectName, &buffer, -1, options)
+	_, err = putObject(ctx, policy, minioClient, bucketName, objectName, content, options)
 	return err
 }
@@ -102,7 +102,7 @@ func TestNewS3Connection(t *testing.T) {
 		t.Run(testCase.description, func(t *testing.T) {
 			// try to construct Minio client using nil
 			// configuration
-			client, _, err := main.NewS3Connection(testCase.configuration)
+			client, err := main.NewS3Connection(testCase.configuration)
 
 			// check for error
 			if testCase.shouldFail {
@@ -186,7 +186,7 @@ type storeTableTestSpecification struct {
 	expectedError string
 }
 
-// TestStoreTableNamesNoClient checks the function storeTableNames
+// TestStoreTable checks the function storeTableNames with S3 sink
 func TestStoreTable(t *testing.T) {
 	ctx := context.Background()
 
@@ -241,8 +241,8 @@ func TestStoreTable(t *testing.T) {
 	// run all specified test cases
 	for _, testCase := range testCases {
 		t.Run(testCase.description, func(t *testing.T) {
-			err := main.StoreTableNames(ctx, testCase.minioClient,
-				testCase.bucketName, testCase.objectName,
+			err := main.StoreTableNames(ctx, main.NewS3Sink(testCase.minioClient,
+				testCase.bucketName, main.RetryPolicy{}), testCase.objectName,
 				testCase.tableNames)
 
 			// check for error
@@ -255,3 +255,166 @@ func TestStoreTable(t *testing.T) {
 		})
 	}
 }
+
+// s3ParametersTestCases helper function returns test cases that check how
+// improper parameters and inaccessible S3 are handled
+func s3ParametersTestCases(t *testing.T) []storeTableTestSpecification {
+	return []storeTableTestSpecification{
+		{
+			description:   "NoMinioClient",
+			minioClient:   nil,
+			bucketName:    "bucket",
+			objectName:    "object",
+			shouldFail:    true,
+			expectedError: "Minio Client is nil",
+		},
+		{
+			description:   "EmptyBucketName",
+			minioClient:   mustConstructMinioClient(t),
+			bucketName:    "",
+			objectName:    "object",
+			shouldFail:    true,
+			expectedError: "Bucket name is not set",
+		},
+		{
+			description:   "EmptyObjectName",
+			minioClient:   mustConstructMinioClient(t),
+			bucketName:    "bucket",
+			objectName:    "",
+			shouldFail:    true,
+			expectedError: "Object name is not set",
+		},
+		{
+			description:   "NotAccessibleClient",
+			minioClient:   mustConstructMinioClient(t),
+			bucketName:    "bucket",
+			objectName:    "object",
+			shouldFail:    true,
+			expectedError: "connect: connection refused",
+		}}
+}
+
+// TestStoreSamplingIntoS3 checks the function storeSampling with S3 sink
+func TestStoreSamplingIntoS3(t *testing.T) {
+	ctx := context.Background()
+
+	// all test cases
+	testCases := s3ParametersTestCases(t)
+
+	// run all specified test cases
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			err := main.StoreSampling(ctx, main.NewS3Sink(testCase.minioClient,
+				testCase.bucketName, main.RetryPolicy{}), testCase.objectName,
+				main.Sampling{Percent: 10, Seed: 42})
+
+			// check for error
+			if testCase.shouldFail {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), testCase.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestStorePartitionsIntoS3 checks the function storePartitions with S3 sink
+func TestStorePartitionsIntoS3(t *testing.T) {
+	ctx := context.Background()
+
+	// all test cases
+	testCases := s3ParametersTestCases(t)
+
+	// run all specified test cases
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			err := main.StorePartitions(ctx, main.NewS3Sink(testCase.minioClient,
+				testCase.bucketName, main.RetryPolicy{}), testCase.objectName,
+				[]main.PartitionCount{{OrgID: "1", TableName: "report", Count: 1}})
+
+			// check for error
+			if testCase.shouldFail {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), testCase.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestStoreFailuresIntoS3 checks the function storeFailures with S3 sink
+func TestStoreFailuresIntoS3(t *testing.T) {
+	ctx := context.Background()
+
+	// all test cases
+	testCases := s3ParametersTestCases(t)
+
+	// run all specified test cases
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			err := main.StoreFailures(ctx, main.NewS3Sink(testCase.minioClient,
+				testCase.bucketName, main.RetryPolicy{}), testCase.objectName,
+				[]main.TableFailure{{TableName: "report", Error: "error"}})
+
+			// check for error
+			if testCase.shouldFail {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), testCase.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestStoreIncompleteIntoS3 checks the function storeIncomplete with S3 sink
+func TestStoreIncompleteIntoS3(t *testing.T) {
+	ctx := context.Background()
+
+	// all test cases
+	testCases := s3ParametersTestCases(t)
+
+	// run all specified test cases
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			err := main.StoreIncomplete(ctx, main.NewS3Sink(testCase.minioClient,
+				testCase.bucketName, main.RetryPolicy{}), testCase.objectName,
+				main.IncompleteRun{Reason: "deadline reached"})
+
+			// check for error
+			if testCase.shouldFail {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), testCase.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
+
+// TestStoreSummaryIntoS3 checks the function storeSummary with S3 sink
+func TestStoreSummaryIntoS3(t *testing.T) {
+	ctx := context.Background()
+
+	// all test cases
+	testCases := s3ParametersTestCases(t)
+
+	// run all specified test cases
+	for _, testCase := range testCases {
+		t.Run(testCase.description, func(t *testing.T) {
+			err := main.StoreSummary(ctx, main.NewS3Sink(testCase.minioClient,
+				testCase.bucketName, main.RetryPolicy{}), testCase.objectName,
+				main.NewExportSummary())
+
+			// check for error
+			if testCase.shouldFail {
+				assert.Error(t, err)
+				assert.Contains(t, err.Error(), testCase.expectedError)
+			} else {
+				assert.NoError(t, err)
+			}
+		})
+	}
+}
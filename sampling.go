@@ -0,0 +1,371 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains data sampling support. Sampling can be used
+// instead of plain LIMIT clause to get more representative subset of data
+// for test environments. Three modes are supported:
+//
+// 1. percentage of rows selected randomly from each table
+// 2. at most N rows selected randomly for each organization (stratified
+//    sampling)
+// 3. the same randomly selected set of organizations for all tables
+//
+// All modes are driven by a seed that is recorded in the output, so the
+// sample can be reproduced later.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/sampling.html
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math/rand"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Messages
+const (
+	samplingSeedMsg     = "Sampling seed"
+	sampledOrganization = "Sampled organizations"
+	samplingSkipped     = "Object has no row ID, sampling is skipped"
+)
+
+// SQL statements and fragments used for sampling
+const (
+	// Select all organizations that can be sampled
+	selectDistinctOrgIDs = "SELECT DISTINCT org_id FROM %s ORDER BY org_id"
+
+	// random subset of rows read from PostgreSQL table
+	tableSampleClause = " TABLESAMPLE BERNOULLI (%g) REPEATABLE (%d)"
+
+	// SQLite does not support TABLESAMPLE and its random() function can
+	// not be seeded, so pseudo random filter based on row ID is used
+	// instead: row ID is hashed, mixed with seed using XOR (SQLite does
+	// not have XOR operator, so (a|b)-(a&b) is used) and hashed again
+	rowIDHash       = "((rowid * 1103515245 + 12345) % 2147483648)"
+	seededRowIDHash = "((((%[1]s | %[2]d) - (%[1]s & %[2]d)) * 1664525 + 1013904223) %% 2147483648)"
+	randomRowFilter = "((%s >> 8) %% 10000) < %d"
+
+	// PostgreSQL rows are hashed by primary key (or by physical row ID
+	// when table has no primary key) mixed with seed
+	rowKeyHash = "md5(concat_ws(',', %s) || ':%d')"
+
+	// rows of each organization ordered randomly, only first N rows of
+	// each organization are selected by row ID
+	rankedRowsSelectList = "%[1]s AS sampled_row, row_number() OVER (PARTITION BY org_id ORDER BY %[2]s, %[1]s) AS sample_rank"
+	perOrgCondition      = "%s IN (SELECT sampled_row FROM (%s) AS ranked WHERE sample_rank <= %d)"
+
+	// Select type and definition of table or view in SQLite
+	selectObjectInSQLite = "SELECT type, coalesce(sql, '') FROM sqlite_master WHERE name = $1"
+
+	// row identifiers
+	rowIDInPostgres = "ctid"
+	rowIDInSQLite   = "rowid"
+
+	// table used as a source of organizations to be sampled
+	sampledOrgsSourceTable = TableName("report")
+
+	// column that contains organization ID
+	orgIDColumn = "org_id"
+)
+
+// Sampling represents configuration of data sampling that is used instead of
+// plain LIMIT clause. Zero value means that sampling is disabled.
+type Sampling struct {
+	// Percent is a percentage of rows to be exported from each table
+	Percent float64
+
+	// PerOrg is a maximum number of rows exported for each organization
+	PerOrg int
+
+	// Orgs is number of organizations selected randomly that are exported
+	// from all tables
+	Orgs int
+
+	// Seed is a seed used for all random choices
+	Seed int64
+}
+
+// Enabled method returns true if any sampling mode has been selected.
+func (sampling Sampling) Enabled() bool {
+	return sampling.Percent > 0 || sampling.PerOrg > 0 || sampling.Orgs > 0
+}
+
+// newSampling function checks sampling-related command line flags and
+// constructs sampling configuration from them. New seed is generated when
+// sampling is enabled, but seed is not specified by user.
+func newSampling(cliFlags CliFlags) (Sampling, error) {
+	sampling := Sampling{
+		Percent: cliFlags.SamplePercent,
+		PerOrg:  cliFlags.SamplePerOrg,
+		Orgs:    cliFlags.SampleOrgs,
+		Seed:    cliFlags.SampleSeed,
+	}
+
+	if sampling.Percent < 0 || sampling.Percent > 100 {
+		return sampling, fmt.Errorf("sample percentage must be in range 0..100, but %g was set", sampling.Percent)
+	}
+
+	if sampling.PerOrg < 0 {
+		return sampling, errors.New("number of rows per organization can not be negative")
+	}
+
+	if sampling.Orgs < 0 {
+		return sampling, errors.New("number of sampled organizations can not be negative")
+	}
+
+	if sampling.Enabled() && sampling.Seed == 0 {
+		sampling.Seed = time.Now().UnixNano()
+	}
+
+	return sampling, nil
+}
+
+// appendCondition helper function adds given condition into WHERE clause of
+// SQL statement constructed by exporter.
+func appendCondition(sqlStatement *string, condition string) {
+	if strings.Contains(*sqlStatement, " WHERE ") {
+		*sqlStatement += " AND " + condition
+	} else {
+		*sqlStatement += " WHERE " + condition
+	}
+}
+
+// applyTableSample method adds TABLESAMPLE clause right after table name in
+// SQL statement. It needs to be called before any WHERE clause is
+// constructed. Only PostgreSQL supports this clause.
+func (storage DBStorage) applyTableSample(sqlStatement *string) {
+	if storage.sampling.Percent <= 0 || storage.dbDriverType != DBDriverPostgres {
+		return
+	}
+	*sqlStatement += fmt.Sprintf(tableSampleClause, storage.sampling.Percent,
+		storage.sampling.Seed)
+}
+
+// applyRandomFilter method adds pseudo random filter into SQL statement when
+// percentage sampling is used with SQLite database. Views and tables without
+// row ID are not sampled.
+func (storage DBStorage) applyRandomFilter(ctx context.Context, sqlStatement *string, tableName TableName) error {
+	if storage.sampling.Percent <= 0 || storage.dbDriverType != DBDriverSQLite3 {
+		return nil
+	}
+
+	rowID, err := storage.rowIdentifier(ctx, tableName)
+	if err != nil || rowID == "" {
+		return err
+	}
+
+	hash, err := storage.sampleHash(ctx, tableName)
+	if err != nil {
+		return err
+	}
+
+	// percentage is expressed in hundredths of percent
+	threshold := int(storage.sampling.Percent * 100)
+	appendCondition(sqlStatement, fmt.Sprintf(randomRowFilter, hash, threshold))
+	return nil
+}
+
+// applyPerOrgSample method adds condition that selects at most given number
+// of randomly chosen rows for each organization. Tables without org_id
+// column are exported entirely.
+func (storage DBStorage) applyPerOrgSample(ctx context.Context, sqlStatement *string, tableName TableName) error {
+	if storage.sampling.PerOrg <= 0 {
+		return nil
+	}
+
+	columnTypes, err := storage.RetrieveColumnTypes(ctx, tableName)
+	if err != nil {
+		return err
+	}
+	if !slices.Contains(getColumnNames(columnTypes), orgIDColumn) {
+		return nil
+	}
+
+	rowID, err := storage.rowIdentifier(ctx, tableName)
+	if err != nil || rowID == "" {
+		return err
+	}
+
+	hash, err := storage.sampleHash(ctx, tableName)
+	if err != nil {
+		return err
+	}
+
+	// rows are ranked after all other filters are applied
+	ranked, err := storage.filteredStatement(ctx,
+		fmt.Sprintf(rankedRowsSelectList, rowID, hash), tableName)
+	if err != nil {
+		return err
+	}
+
+	appendCondition(sqlStatement, fmt.Sprintf(perOrgCondition,
+		rowID, ranked, storage.sampling.PerOrg))
+	return nil
+}
+
+// rowIdentifier method returns expression that identifies row of given
+// table. Empty string is returned for SQLite views and tables created
+// WITHOUT ROWID, because they can't be sampled.
+func (storage DBStorage) rowIdentifier(ctx context.Context, tableName TableName) (string, error) {
+	if storage.dbDriverType != DBDriverSQLite3 {
+		return rowIDInPostgres, nil
+	}
+
+	var objectType, definition string
+	err := storage.queryRow(ctx, tableName, "read table definition", selectObjectInSQLite,
+		[]interface{}{string(tableName)}, &objectType, &definition)
+	if err != nil {
+		log.Error().Err(err).Str(sqlStatementExecuted, selectObjectInSQLite).Msg(sqlStatementExecutionError)
+		return "", err
+	}
+
+	if objectType != "table" || strings.Contains(strings.ToUpper(definition), "WITHOUT ROWID") {
+		log.Warn().Str(tableNameMsg, string(tableName)).Msg(samplingSkipped)
+		return "", nil
+	}
+	return rowIDInSQLite, nil
+}
+
+// sampleHash method returns expression that computes pseudo random value for
+// each row of given table. The value depends on seed only, so the sample can
+// be reproduced.
+func (storage DBStorage) sampleHash(ctx context.Context, tableName TableName) (string, error) {
+	if storage.dbDriverType == DBDriverSQLite3 {
+		// seed is scrambled so that similar seeds lead to different samples
+		// #nosec G404 -- reproducibility is needed there, not security
+		seed := rand.New(rand.NewSource(storage.sampling.Seed)).Int63n(2147483648)
+		return fmt.Sprintf(seededRowIDHash, rowIDHash, seed), nil
+	}
+
+	columns, err := storage.ReadPrimaryKey(ctx, tableName)
+	if err != nil {
+		return "", err
+	}
+	if len(columns) == 0 {
+		columns = []string{rowIDInPostgres}
+	}
+	return fmt.Sprintf(rowKeyHash, strings.Join(columns, ", "), storage.sampling.Seed), nil
+}
+
+// ReadOrgIDs method reads all distinct organization IDs stored in given
+// table.
+func (storage DBStorage) ReadOrgIDs(ctx context.Context, tableName TableName) ([]string, error) {
+	var orgIDs = make([]string, 0)
+
+	// it is not possible to use parameter for table name or a key
+	// disable "G201 (CWE-89): SQL string formatting (Confidence: HIGH, Severity: MEDIUM)"
+	// #nosec G201
+	sqlStatement := fmt.Sprintf(selectDistinctOrgIDs, string(tableName))
+
+	rows, err := storage.query(ctx, tableName, "read organizations", sqlStatement)
+	if err != nil {
+		log.Error().Err(err).Str(sqlStatementExecuted, sqlStatement).Msg(sqlStatementExecutionError)
+		return orgIDs, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Error().Err(err).Msg(unableToCloseDBRowsHandle)
+		}
+	}()
+
+	for rows.Next() {
+		var orgID string
+
+		err := rows.Scan(&orgID)
+		if err != nil {
+			return orgIDs, err
+		}
+		orgIDs = append(orgIDs, orgID)
+	}
+
+	return orgIDs, nil
+}
+
+// chooseOrgIDs function selects given number of organizations from the input
+// list. The selection depends on seed only, so it can be reproduced. Selected
+// organizations are returned in numeric order.
+func chooseOrgIDs(orgIDs []string, count int, seed int64) []string {
+	chosen := make([]string, len(orgIDs))
+	copy(chosen, orgIDs)
+
+	// input might come in any order
+	sortOrgIDs(chosen)
+
+	// #nosec G404 -- reproducibility is needed there, not security
+	generator := rand.New(rand.NewSource(seed))
+	generator.Shuffle(len(chosen), func(i, j int) {
+		chosen[i], chosen[j] = chosen[j], chosen[i]
+	})
+
+	if count < len(chosen) {
+		chosen = chosen[:count]
+	}
+
+	sortOrgIDs(chosen)
+	return chosen
+}
+
+// sortOrgIDs helper function sorts organization IDs numerically.
+func sortOrgIDs(orgIDs []string) {
+	sort.Slice(orgIDs, func(i, j int) bool {
+		first, err1 := strconv.ParseUint(orgIDs[i], 10, 64)
+		second, err2 := strconv.ParseUint(orgIDs[j], 10, 64)
+		if err1 != nil || err2 != nil {
+			return orgIDs[i] < orgIDs[j]
+		}
+		return first < second
+	})
+}
+
+// sampleOrganizations method selects organizations to be exported from all
+// tables. When filtering by organizations is enabled, organizations are
+// sampled from the configured list.
+func (storage DBStorage) sampleOrganizations(ctx context.Context) ([]string, error) {
+	var candidates []string
+	if storage.config.EnableOrgIDFiltering {
+		candidates = storage.config.OrganizationsToExport
+	} else {
+		orgIDs, err := storage.ReadOrgIDs(ctx, sampledOrgsSourceTable)
+		if err != nil {
+			return nil, err
+		}
+		candidates = orgIDs
+	}
+
+	sampled := chooseOrgIDs(candidates, storage.sampling.Orgs, storage.sampling.Seed)
+
+	log.Info().
+		Int("available", len(candidates)).
+		Strs("org IDs", sampled).
+		Msg(sampledOrganization)
+
+	return sampled, nil
+}
@@ -0,0 +1,365 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/sampling_test.html
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// TestNewSamplingDisabled checks that sampling is disabled by default
+func TestNewSamplingDisabled(t *testing.T) {
+	sampling, err := main.NewSampling(main.CliFlags{})
+	assert.NoError(t, err)
+	assert.False(t, sampling.Enabled())
+
+	// seed is not generated when sampling is disabled
+	assert.Equal(t, int64(0), sampling.Seed)
+}
+
+// TestNewSamplingGeneratedSeed checks that seed is generated when it is not
+// specified on command line
+func TestNewSamplingGeneratedSeed(t *testing.T) {
+	sampling, err := main.NewSampling(main.CliFlags{SamplePercent: 10})
+	assert.NoError(t, err)
+	assert.True(t, sampling.Enabled())
+	assert.NotEqual(t, int64(0), sampling.Seed)
+}
+
+// TestNewSamplingSpecifiedSeed checks that seed specified on command line is
+// used as is
+func TestNewSamplingSpecifiedSeed(t *testing.T) {
+	sampling, err := main.NewSampling(main.CliFlags{SampleOrgs: 5, SampleSeed: 42})
+	assert.NoError(t, err)
+	assert.Equal(t, int64(42), sampling.Seed)
+	assert.Equal(t, 5, sampling.Orgs)
+}
+
+// TestNewSamplingWrongParameters checks that improper sampling parameters are
+// refused
+func TestNewSamplingWrongParameters(t *testing.T) {
+	wrongFlags := []main.CliFlags{
+		{SamplePercent: -1},
+		{SamplePercent: 100.5},
+		{SamplePerOrg: -1},
+		{SampleOrgs: -1},
+	}
+
+	for _, cliFlags := range wrongFlags {
+		_, err := main.NewSampling(cliFlags)
+		assert.Error(t, err)
+	}
+}
+
+// TestChooseOrgIDs checks that organizations are chosen reproducibly
+func TestChooseOrgIDs(t *testing.T) {
+	orgIDs := []string{"100", "2", "30", "4", "5", "60", "7"}
+
+	chosen1 := main.ChooseOrgIDs(orgIDs, 3, 42)
+	chosen2 := main.ChooseOrgIDs(orgIDs, 3, 42)
+
+	assert.Len(t, chosen1, 3)
+	assert.Equal(t, chosen1, chosen2, "The same seed needs to lead to the same sample")
+
+	// the order of input does not matter
+	reversed := []string{"7", "60", "5", "4", "30", "2", "100"}
+	assert.Equal(t, chosen1, main.ChooseOrgIDs(reversed, 3, 42))
+
+	// input must not be changed
+	assert.Equal(t, "100", orgIDs[0])
+}
+
+// TestChooseOrgIDsNotEnoughOrgs checks the choice when there are less
+// organizations than requested
+func TestChooseOrgIDsNotEnoughOrgs(t *testing.T) {
+	chosen := main.ChooseOrgIDs([]string{"10", "9", "1000"}, 10, 1)
+	assert.Equal(t, []string{"9", "10", "1000"}, chosen)
+}
+
+// check the function ReadTable with percentage sampling on PostgreSQL
+func TestReadTableSamplePercentPostgres(t *testing.T) {
+	config := testConfig
+	config.EnableOrgIDFiltering = true
+	config.OrganizationsToExport = []string{"1"}
+
+	// prepare new mocked connection to database
+	connection, mock := mustCreateMockConnection(t)
+
+	column1 := sqlmock.NewColumn("id").OfType("INT4", int64(0))
+	rows := mock.NewRowsWithColumnDefinition(column1).AddRow(1)
+
+	// expected queries performed by tested function
+	expectPrimaryKeyQuery(mock, "report", "id")
+	mock.ExpectQuery("SELECT \\* FROM report TABLESAMPLE BERNOULLI \\(12.5\\) REPEATABLE \\(42\\) WHERE org_id IN \\('1'\\) ORDER BY id").
+		WillReturnRows(rows)
+	mock.ExpectClose()
+
+	// prepare connection to mocked database
+	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &config)
+	main.SetSampling(storage, main.Sampling{Percent: 12.5, Seed: 42})
+
+	// call the tested method
+	values, err := storage.ReadTable(context.Background(), "report", NoLimits)
+	assert.NoError(t, err)
+	assert.Len(t, values, 1)
+
+	// connection to mocked DB needs to be closed properly
+	checkConnectionClose(t, connection)
+
+	// check if all expectations were met
+	checkAllExpectations(t, mock)
+}
+
+// check the function ReadTable with percentage sampling on SQLite
+func TestReadTableSamplePercentSQLite(t *testing.T) {
+	statements := []string{"CREATE TABLE t (id INTEGER PRIMARY KEY, value TEXT)"}
+	for i := 1; i <= 1000; i++ {
+		statements = append(statements,
+			fmt.Sprintf("INSERT INTO t VALUES (%d, 'value %d')", i, i))
+	}
+	connection := mustCreateSQLiteConnection(t, statements...)
+
+	config := testConfig
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+	main.SetSampling(storage, main.Sampling{Percent: 10, Seed: 42})
+
+	sample1, err := storage.ReadTable(context.Background(), "t", NoLimits)
+	assert.NoError(t, err)
+
+	sample2, err := storage.ReadTable(context.Background(), "t", NoLimits)
+	assert.NoError(t, err)
+
+	// sample needs to be reproducible and roughly of expected size
+	assert.Equal(t, sample1, sample2)
+	assert.InDelta(t, 100, len(sample1), 30)
+
+	// different seed leads to different sample
+	main.SetSampling(storage, main.Sampling{Percent: 10, Seed: 43})
+	sample3, err := storage.ReadTable(context.Background(), "t", NoLimits)
+	assert.NoError(t, err)
+	assert.NotEqual(t, sample1, sample3)
+
+	checkConnectionClose(t, connection)
+}
+
+// check the function ReadTable with sampling per organization on PostgreSQL
+func TestReadTableSamplePerOrgPostgres(t *testing.T) {
+	config := testConfig
+	config.EnableOrgIDFiltering = false
+
+	// prepare new mocked connection to database
+	connection, mock := mustCreateMockConnection(t)
+
+	orgID := sqlmock.NewColumn("org_id").OfType("INT4", int64(0))
+	cluster := sqlmock.NewColumn("cluster").OfType("VARCHAR", "")
+	columns := mock.NewRowsWithColumnDefinition(orgID, cluster)
+	rows := mock.NewRowsWithColumnDefinition(orgID, cluster).AddRow(1, "a")
+
+	// expected queries performed by tested function
+	mock.ExpectQuery("SELECT \\* FROM report LIMIT 1").WillReturnRows(columns)
+	expectPrimaryKeyQuery(mock, "report", "org_id", "cluster")
+	expectPrimaryKeyQuery(mock, "report", "org_id", "cluster")
+	mock.ExpectQuery("SELECT \\* FROM report WHERE ctid IN " +
+		"\\(SELECT sampled_row FROM \\(SELECT ctid AS sampled_row, row_number\\(\\) OVER " +
+		"\\(PARTITION BY org_id ORDER BY md5\\(concat_ws\\(',', org_id, cluster\\) \\|\\| ':42'\\), ctid\\) AS sample_rank " +
+		"FROM report\\) AS ranked WHERE sample_rank <= 2\\) ORDER BY org_id, cluster").
+		WillReturnRows(rows)
+	mock.ExpectClose()
+
+	// prepare connection to mocked database
+	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &config)
+	main.SetSampling(storage, main.Sampling{PerOrg: 2, Seed: 42})
+
+	// call the tested method
+	values, err := storage.ReadTable(context.Background(), "report", NoLimits)
+	assert.NoError(t, err)
+	assert.Len(t, values, 1)
+
+	// connection to mocked DB needs to be closed properly
+	checkConnectionClose(t, connection)
+
+	// check if all expectations were met
+	checkAllExpectations(t, mock)
+}
+
+// readClusters function reads table with clusters and returns clusters
+// grouped by organization
+func readClusters(t *testing.T, storage *main.DBStorage) map[string][]string {
+	values, err := storage.ReadTable(context.Background(), "report", NoLimits)
+	assert.NoError(t, err)
+
+	clusters := make(map[string][]string)
+	for _, value := range values {
+		orgID := fmt.Sprint(value["org_id"])
+		clusters[orgID] = append(clusters[orgID], fmt.Sprint(value["cluster"]))
+	}
+	return clusters
+}
+
+// check the function ReadTable with sampling per organization
+func TestReadTableSamplePerOrg(t *testing.T) {
+	statements := []string{
+		"CREATE TABLE report (org_id INTEGER, cluster TEXT, PRIMARY KEY (org_id, cluster))",
+		"INSERT INTO report VALUES (2, 'x'), (3, 'y'), (3, 'z')",
+	}
+	for i := 1; i <= 50; i++ {
+		statements = append(statements,
+			fmt.Sprintf("INSERT INTO report VALUES (1, 'cluster%02d')", i))
+	}
+	connection := mustCreateSQLiteConnection(t, statements...)
+
+	config := testConfig
+	config.EnableOrgIDFiltering = false
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+	main.SetSampling(storage, main.Sampling{PerOrg: 2, Seed: 1})
+
+	sample1 := readClusters(t, storage)
+	sample2 := readClusters(t, storage)
+
+	// sample needs to be reproducible
+	assert.Equal(t, sample1, sample2)
+
+	// at most given number of rows per organization
+	assert.Len(t, sample1["1"], 2)
+	assert.Equal(t, []string{"x"}, sample1["2"])
+	assert.ElementsMatch(t, []string{"y", "z"}, sample1["3"])
+
+	// rows are selected randomly, not the first ones
+	seeds := []int64{2, 3, 4, 5}
+	different := false
+	for _, seed := range seeds {
+		main.SetSampling(storage, main.Sampling{PerOrg: 2, Seed: seed})
+		if !assert.ObjectsAreEqual(sample1["1"], readClusters(t, storage)["1"]) {
+			different = true
+		}
+	}
+	assert.True(t, different, "Different seed needs to lead to different sample")
+
+	checkConnectionClose(t, connection)
+}
+
+// check the function ReadTable with sampling per organization when filter by
+// organizations is enabled too
+func TestReadTableSamplePerOrgWithFilter(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t,
+		"CREATE TABLE report (org_id INTEGER, cluster TEXT, PRIMARY KEY (org_id, cluster))",
+		"INSERT INTO report VALUES (1, 'a'), (1, 'b'), (1, 'c'), (2, 'd'), (2, 'e'), (3, 'f')")
+
+	config := testConfig
+	config.EnableOrgIDFiltering = true
+	config.OrganizationsToExport = []string{"1", "3"}
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+	main.SetSampling(storage, main.Sampling{PerOrg: 1, Seed: 1})
+
+	clusters := readClusters(t, storage)
+	assert.Len(t, clusters, 2)
+	assert.Len(t, clusters["1"], 1)
+	assert.Equal(t, []string{"f"}, clusters["3"])
+
+	checkConnectionClose(t, connection)
+}
+
+// check that SQLite objects without row ID are exported without sampling
+func TestReadTableSampleWithoutRowID(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t,
+		"CREATE TABLE report (org_id INTEGER, cluster TEXT, PRIMARY KEY (org_id, cluster)) WITHOUT ROWID",
+		"INSERT INTO report VALUES (1, 'a'), (1, 'b'), (1, 'c'), (2, 'd')",
+		"CREATE VIEW report_view AS SELECT * FROM report")
+
+	config := testConfig
+	config.EnableOrgIDFiltering = false
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	samplings := []main.Sampling{
+		{Percent: 10, Seed: 1},
+		{PerOrg: 1, Seed: 1},
+	}
+
+	for _, sampling := range samplings {
+		main.SetSampling(storage, sampling)
+		for _, tableName := range []main.TableName{"report", "report_view"} {
+			values, err := storage.ReadTable(context.Background(), tableName, NoLimits)
+			assert.NoError(t, err)
+			assert.Len(t, values, 4)
+		}
+	}
+
+	checkConnectionClose(t, connection)
+}
+
+// check the method sampleOrganizations
+func TestSampleOrganizations(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t,
+		"CREATE TABLE report (org_id INTEGER, cluster TEXT, PRIMARY KEY (org_id, cluster))",
+		"INSERT INTO report VALUES (1, 'a'), (1, 'b'), (2, 'c'), (3, 'd'), (4, 'e'), (5, 'f')")
+
+	config := testConfig
+	config.EnableOrgIDFiltering = false
+	config.OrganizationsToExport = nil
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+	main.SetSampling(storage, main.Sampling{Orgs: 2, Seed: 42})
+
+	sampled, err := main.SampleOrganizations(*storage, context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, sampled, 2)
+	assert.Equal(t, main.ChooseOrgIDs([]string{"1", "2", "3", "4", "5"}, 2, 42), sampled)
+
+	// configuration must not be changed
+	assert.False(t, config.EnableOrgIDFiltering)
+	assert.Nil(t, config.OrganizationsToExport)
+
+	checkConnectionClose(t, connection)
+}
+
+// check the method sampleOrganizations when organizations are selected by
+// configuration
+func TestSampleOrganizationsFromConfiguredList(t *testing.T) {
+	// prepare new mocked connection to database
+	connection, mock := mustCreateMockConnection(t)
+	mock.ExpectClose()
+
+	config := testConfig
+	config.EnableOrgIDFiltering = true
+	config.OrganizationsToExport = []string{"10", "20", "30"}
+	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &config)
+	main.SetSampling(storage, main.Sampling{Orgs: 1, Seed: 42})
+
+	// no query is expected
+	sampled, err := main.SampleOrganizations(*storage, context.Background())
+	assert.NoError(t, err)
+	assert.Len(t, sampled, 1)
+	assert.Contains(t, []string{"10", "20", "30"}, sampled[0])
+	assert.Len(t, config.OrganizationsToExport, 3)
+
+	// connection to mocked DB needs to be closed properly
+	checkConnectionClose(t, connection)
+
+	// check if all expectations were met
+	checkAllExpectations(t, mock)
+}
@@ -0,0 +1,607 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains export of database schema selected by -schema
+// and -schema-sql flags. Schema of each exported table contains columns with
+// their types, nullability and defaults, primary key, foreign keys, indexes
+// and number of rows. Schema is read from pg_catalog on PostgreSQL and by
+// PRAGMA functions on SQLite, and it is stored into _schema.json and
+// optionally as DDL script into _schema.sql, so tables can be recreated
+// exactly.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/schema.html
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Messages
+const (
+	exportingSchema   = "Exporting schema"
+	readSchemaFailed  = "Read schema failed"
+	storeSchemaFailed = "Store schema failed"
+	writeSchemaToJSON = "Write schema to JSON"
+	writeSchemaToSQL  = "Write schema to SQL"
+	invalidDBDriver   = "Invalid DB driver"
+)
+
+// SQL statements used to read schema from PostgreSQL
+const (
+	selectColumnsInPostgres = `
+           SELECT a.attname,
+                  format_type(a.atttypid, a.atttypmod),
+                  NOT a.attnotnull,
+                  pg_get_expr(d.adbin, d.adrelid)
+             FROM pg_attribute a
+             LEFT JOIN pg_attrdef d ON d.adrelid = a.attrelid
+                                   AND d.adnum = a.attnum
+            WHERE a.attrelid = $1::regclass
+              AND a.attnum > 0
+              AND NOT a.attisdropped
+            ORDER BY a.attnum;
+   `
+
+	selectTableForeignKeysInPostgres = `
+           SELECT c.conname,
+                  array_to_string(ARRAY(
+                      SELECT a.attname
+                        FROM unnest(c.conkey) WITH ORDINALITY AS k(attnum, n)
+                        JOIN pg_attribute a ON a.attrelid = c.conrelid
+                                           AND a.attnum = k.attnum
+                       ORDER BY k.n), ','),
+                  (SELECT r.relname FROM pg_class r WHERE r.oid = c.confrelid),
+                  array_to_string(ARRAY(
+                      SELECT a.attname
+                        FROM unnest(c.confkey) WITH ORDINALITY AS k(attnum, n)
+                        JOIN pg_attribute a ON a.attrelid = c.confrelid
+                                           AND a.attnum = k.attnum
+                       ORDER BY k.n), ',')
+             FROM pg_constraint c
+            WHERE c.conrelid = $1::regclass
+              AND c.contype = 'f'
+            ORDER BY c.conname;
+   `
+
+	selectIndexesInPostgres = `
+           SELECT ic.relname,
+                  i.indisunique,
+                  array_to_string(ARRAY(
+                      SELECT pg_get_indexdef(i.indexrelid, k.n, true)
+                        FROM generate_series(1, i.indnatts) AS k(n)
+                       ORDER BY k.n), ','),
+                  pg_get_indexdef(i.indexrelid)
+             FROM pg_index i
+             JOIN pg_class ic ON ic.oid = i.indexrelid
+            WHERE i.indrelid = $1::regclass
+              AND NOT i.indisprimary
+            ORDER BY ic.relname;
+   `
+)
+
+// SQL statements used to read schema from SQLite
+const (
+	selectColumnsInSQLite = `
+           SELECT name, type, "notnull" = 0, dflt_value
+             FROM pragma_table_info($1)
+            ORDER BY cid;
+   `
+
+	selectTableForeignKeysInSQLite = `
+           SELECT id, "from", "table", coalesce("to", '')
+             FROM pragma_foreign_key_list($1)
+            ORDER BY id, seq;
+   `
+
+	selectIndexesInSQLite = `
+           SELECT l.name, l."unique",
+                  (SELECT group_concat(name, ',')
+                     FROM (SELECT name FROM pragma_index_info(l.name) ORDER BY seqno)),
+                  coalesce(m.sql, '')
+             FROM pragma_index_list($1) AS l
+             LEFT JOIN sqlite_master m ON m.type = 'index' AND m.name = l.name
+            WHERE l.origin != 'pk'
+            ORDER BY l.name;
+   `
+)
+
+// SQL statements used in DDL script
+const (
+	createSequence = "CREATE SEQUENCE IF NOT EXISTS %s;\n"
+)
+
+// sequenceDefault matches default value of PostgreSQL column filled from
+// sequence, the sequence name is already formatted as SQL identifier
+var sequenceDefault = regexp.MustCompile(`^nextval\('((?:[^']|'')+)'::regclass\)$`)
+
+// ColumnSchema represents one column of database table
+type ColumnSchema struct {
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	Nullable bool    `json:"nullable"`
+	Default  *string `json:"default"`
+}
+
+// ForeignKeySchema represents foreign key constraint of database table
+type ForeignKeySchema struct {
+	Name              string   `json:"name,omitempty"`
+	Columns           []string `json:"columns"`
+	ReferencedTable   string   `json:"referenced_table"`
+	ReferencedColumns []string `json:"referenced_columns"`
+}
+
+// IndexSchema represents index of database table. Index backing the primary
+// key is not included, because it is part of the primary key.
+type IndexSchema struct {
+	Name       string   `json:"name"`
+	Columns    []string `json:"columns"`
+	Unique     bool     `json:"unique"`
+	Definition string   `json:"definition,omitempty"`
+}
+
+// TableSchema represents schema of one database table
+type TableSchema struct {
+	Name        TableName          `json:"name"`
+	Columns     []ColumnSchema     `json:"columns"`
+	PrimaryKey  []string           `json:"primary_key"`
+	ForeignKeys []ForeignKeySchema `json:"foreign_keys"`
+	Indexes     []IndexSchema      `json:"indexes"`
+	RowCount    int                `json:"row_count"`
+}
+
+// Schema represents schema of all exported tables
+type Schema struct {
+	Database string        `json:"database"`
+	Tables   []TableSchema `json:"tables"`
+}
+
+// ReadSchema method reads schema of all given tables that are not ignored.
+func (storage DBStorage) ReadSchema(ctx context.Context, tableNames []TableName, ignoredTables IgnoredTables) (*Schema, error) {
+	schema := &Schema{
+		Database: storage.dbSystem(),
+		Tables:   make([]TableSchema, 0, len(tableNames)),
+	}
+
+	for _, tableName := range tableNames {
+		if _, found := ignoredTables[string(tableName)]; found {
+			continue
+		}
+		tableSchema, err := storage.ReadTableSchema(ctx, tableName)
+		if err != nil {
+			return nil, err
+		}
+		schema.Tables = append(schema.Tables, tableSchema)
+	}
+
+	return schema, nil
+}
+
+// ReadTableSchema method reads schema of given table together with number
+// of rows stored in it.
+func (storage DBStorage) ReadTableSchema(ctx context.Context, tableName TableName) (TableSchema, error) {
+	tableSchema := TableSchema{Name: tableName}
+	err := storage.retry(ctx, tableName, "read table schema", func(ctx context.Context) error {
+		var err error
+		tableSchema, err = storage.readTableSchema(ctx, tableName)
+		return err
+	})
+	if err != nil {
+		log.Error().Err(err).Str(tableNameMsg, string(tableName)).Msg(readSchemaFailed)
+		return tableSchema, err
+	}
+
+	tableSchema.RowCount, err = storage.ReadRecordsCount(ctx, tableName)
+	return tableSchema, err
+}
+
+// readTableSchema method performs one attempt to read schema of given table.
+func (storage DBStorage) readTableSchema(ctx context.Context, tableName TableName) (TableSchema, error) {
+	tableSchema := TableSchema{Name: tableName}
+
+	var selectColumns, selectIndexes string
+	switch storage.dbDriverType {
+	case DBDriverSQLite3:
+		selectColumns = selectColumnsInSQLite
+		selectIndexes = selectIndexesInSQLite
+	case DBDriverPostgres:
+		selectColumns = selectColumnsInPostgres
+		selectIndexes = selectIndexesInPostgres
+	default:
+		return tableSchema, errors.New(invalidDBDriver)
+	}
+
+	var err error
+	tableSchema.Columns, err = storage.readColumns(ctx, selectColumns, tableName)
+	if err != nil {
+		return tableSchema, err
+	}
+
+	tableSchema.PrimaryKey, err = storage.ReadPrimaryKey(ctx, tableName)
+	if err != nil {
+		return tableSchema, err
+	}
+
+	tableSchema.ForeignKeys, err = storage.readForeignKeys(ctx, tableName)
+	if err != nil {
+		return tableSchema, err
+	}
+
+	tableSchema.Indexes, err = storage.readIndexes(ctx, selectIndexes, tableName)
+	return tableSchema, err
+}
+
+// querySchema method performs given query with table name as parameter and
+// calls given function for each row.
+func (storage DBStorage) querySchema(ctx context.Context, sqlStatement string, tableName TableName,
+	scan func(rows *sql.Rows) error) error {
+	rows, err := storage.query(ctx, tableName, "read schema", sqlStatement, string(tableName))
+	if err != nil {
+		log.Error().Err(err).Str(sqlStatementExecuted, sqlStatement).Msg(sqlStatementExecutionError)
+		return err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Error().Err(err).Msg(unableToCloseDBRowsHandle)
+		}
+	}()
+
+	for rows.Next() {
+		err := scan(rows)
+		if err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// readColumns method reads all columns of given table.
+func (storage DBStorage) readColumns(ctx context.Context, sqlStatement string, tableName TableName) ([]ColumnSchema, error) {
+	columns := make([]ColumnSchema, 0)
+
+	err := storage.querySchema(ctx, sqlStatement, tableName, func(rows *sql.Rows) error {
+		var column ColumnSchema
+		var defaultValue sql.NullString
+
+		err := rows.Scan(&column.Name, &column.Type, &column.Nullable, &defaultValue)
+		if err != nil {
+			return err
+		}
+		if defaultValue.Valid {
+			column.Default = &defaultValue.String
+		}
+		columns = append(columns, column)
+		return nil
+	})
+
+	// table without columns does not exist
+	if err == nil && len(columns) == 0 {
+		err = fmt.Errorf("no such table: %s", tableName)
+	}
+	return columns, err
+}
+
+// readForeignKeys method reads all foreign keys of given table. SQLite
+// returns one row per column of foreign key, so the rows are merged by
+// foreign key identifier. Foreign keys are used both in schema and by
+// subsetting engine.
+func (storage DBStorage) readForeignKeys(ctx context.Context, tableName TableName) ([]ForeignKeySchema, error) {
+	foreignKeys := make([]ForeignKeySchema, 0)
+
+	var sqlStatement string
+	switch storage.dbDriverType {
+	case DBDriverSQLite3:
+		sqlStatement = selectTableForeignKeysInSQLite
+	case DBDriverPostgres:
+		sqlStatement = selectTableForeignKeysInPostgres
+	default:
+		return foreignKeys, errors.New(invalidDBDriver)
+	}
+
+	var lastID string
+	err := storage.querySchema(ctx, sqlStatement, tableName, func(rows *sql.Rows) error {
+		var id, referencedTable, columns, referencedColumns string
+
+		err := rows.Scan(&id, &columns, &referencedTable, &referencedColumns)
+		if err != nil {
+			return err
+		}
+
+		if storage.dbDriverType == DBDriverSQLite3 {
+			// columns are returned one by one, constraint is not named
+			if len(foreignKeys) > 0 && id == lastID {
+				foreignKey := &foreignKeys[len(foreignKeys)-1]
+				foreignKey.Columns = append(foreignKey.Columns, columns)
+				foreignKey.ReferencedColumns = append(foreignKey.ReferencedColumns, referencedColumns)
+				return nil
+			}
+			lastID = id
+			foreignKeys = append(foreignKeys, ForeignKeySchema{
+				Columns:           []string{columns},
+				ReferencedTable:   referencedTable,
+				ReferencedColumns: []string{referencedColumns},
+			})
+			return nil
+		}
+
+		foreignKeys = append(foreignKeys, ForeignKeySchema{
+			Name:              id,
+			Columns:           strings.Split(columns, ","),
+			ReferencedTable:   referencedTable,
+			ReferencedColumns: strings.Split(referencedColumns, ","),
+		})
+		return nil
+	})
+
+	// SQLite returns empty column name when primary key of referenced table
+	// is referenced
+	for i := range foreignKeys {
+		if len(foreignKeys[i].ReferencedColumns) > 0 && foreignKeys[i].ReferencedColumns[0] == "" {
+			foreignKeys[i].ReferencedColumns = []string{}
+		}
+	}
+	return foreignKeys, err
+}
+
+// readIndexes method reads all indexes of given table except the index of
+// primary key.
+func (storage DBStorage) readIndexes(ctx context.Context, sqlStatement string, tableName TableName) ([]IndexSchema, error) {
+	indexes := make([]IndexSchema, 0)
+
+	err := storage.querySchema(ctx, sqlStatement, tableName, func(rows *sql.Rows) error {
+		var index IndexSchema
+		var columns sql.NullString
+
+		err := rows.Scan(&index.Name, &index.Unique, &columns, &index.Definition)
+		if err != nil {
+			return err
+		}
+		index.Columns = []string{}
+		if columns.String != "" {
+			index.Columns = strings.Split(columns.String, ",")
+		}
+		indexes = append(indexes, index)
+		return nil
+	})
+	return indexes, err
+}
+
+// SchemaToJSON function writes schema of tables into given writer.
+func SchemaToJSON(writer io.Writer, schema *Schema) error {
+	if writer == nil {
+		err := errors.New(bufferIsNil)
+		log.Error().Err(err).Msg(writeSchemaToJSON)
+		return err
+	}
+
+	encoder := json.NewEncoder(writer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(schema)
+}
+
+// PrintTableSchema function prints schema of one table in human readable
+// form.
+func PrintTableSchema(output io.Writer, table TableSchema) error {
+	if output == nil {
+		err := errors.New(bufferIsNil)
+		return err
+	}
+
+	fmt.Fprintf(output, "Table: %s\nRows:  %d\n\n", table.Name, table.RowCount)
+
+	writer := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(writer, "Column\tType\tNullable\tDefault")
+	for _, column := range table.Columns {
+		defaultValue := ""
+		if column.Default != nil {
+			defaultValue = *column.Default
+		}
+		fmt.Fprintf(writer, "%s\t%s\t%t\t%s\n", column.Name, column.Type,
+			column.Nullable, defaultValue)
+	}
+	err := writer.Flush()
+	if err != nil {
+		return err
+	}
+
+	if len(table.PrimaryKey) > 0 {
+		fmt.Fprintf(output, "\nPrimary key: %s\n", strings.Join(table.PrimaryKey, ", "))
+	}
+
+	if len(table.ForeignKeys) > 0 {
+		fmt.Fprintln(output, "\nForeign keys:")
+		for _, foreignKey := range table.ForeignKeys {
+			fmt.Fprintf(output, "  (%s) -> %s (%s)\n",
+				strings.Join(foreignKey.Columns, ", "), foreignKey.ReferencedTable,
+				strings.Join(foreignKey.ReferencedColumns, ", "))
+		}
+	}
+
+	if len(table.Indexes) > 0 {
+		fmt.Fprintln(output, "\nIndexes:")
+		for _, index := range table.Indexes {
+			unique := ""
+			if index.Unique {
+				unique = " (unique)"
+			}
+			_, err = fmt.Fprintf(output, "  %s%s: %s\n", index.Name, unique,
+				strings.Join(index.Columns, ", "))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// SchemaToSQL function writes DDL script that recreates all tables from
+// schema into given writer. Tables are ordered so that referenced tables are
+// created before tables that reference them.
+func SchemaToSQL(writer io.Writer, schema *Schema) error {
+	if writer == nil {
+		err := errors.New(bufferIsNil)
+		log.Error().Err(err).Msg(writeSchemaToSQL)
+		return err
+	}
+
+	for _, table := range orderByDependencies(schema.Tables) {
+		_, err := io.WriteString(writer, tableDDL(table))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tableDDL function returns CREATE TABLE and CREATE INDEX statements for
+// given table. Sequences used by default values of columns are created
+// before the table.
+func tableDDL(table TableSchema) string {
+	var ddl string
+	var definitions []string
+
+	for _, column := range table.Columns {
+		definition := fmt.Sprintf("    %s %s", quoteIdentifier(column.Name), column.Type)
+		if !column.Nullable {
+			definition += " NOT NULL"
+		}
+		if column.Default != nil {
+			definition += " DEFAULT " + *column.Default
+			if match := sequenceDefault.FindStringSubmatch(*column.Default); match != nil {
+				ddl += fmt.Sprintf(createSequence, strings.ReplaceAll(match[1], "''", "'"))
+			}
+		}
+		definitions = append(definitions, definition)
+	}
+
+	if len(table.PrimaryKey) > 0 {
+		definitions = append(definitions, fmt.Sprintf("    PRIMARY KEY (%s)",
+			quoteIdentifiers(table.PrimaryKey)))
+	}
+
+	for _, foreignKey := range table.ForeignKeys {
+		definition := "    "
+		if foreignKey.Name != "" {
+			definition += fmt.Sprintf("CONSTRAINT %s ", quoteIdentifier(foreignKey.Name))
+		}
+		definition += fmt.Sprintf("FOREIGN KEY (%s) REFERENCES %s",
+			quoteIdentifiers(foreignKey.Columns), quoteIdentifier(foreignKey.ReferencedTable))
+		if len(foreignKey.ReferencedColumns) > 0 {
+			definition += fmt.Sprintf(" (%s)", quoteIdentifiers(foreignKey.ReferencedColumns))
+		}
+		definitions = append(definitions, definition)
+	}
+
+	ddl += fmt.Sprintf("CREATE TABLE %s (\n%s\n);\n", quoteIdentifier(string(table.Name)),
+		strings.Join(definitions, ",\n"))
+
+	for _, index := range table.Indexes {
+		// index definition read from database is preferred, because it
+		// contains index method and expressions
+		if index.Definition != "" {
+			ddl += index.Definition + ";\n"
+			continue
+		}
+		unique := ""
+		if index.Unique {
+			unique = "UNIQUE "
+		}
+		ddl += fmt.Sprintf("CREATE %sINDEX %s ON %s (%s);\n", unique, quoteIdentifier(index.Name),
+			quoteIdentifier(string(table.Name)), quoteIdentifiers(index.Columns))
+	}
+
+	return ddl + "\n"
+}
+
+// quoteIdentifier function quotes given name, so it can be used as SQL
+// identifier even when it contains special characters or it is a keyword.
+func quoteIdentifier(name string) string {
+	return `"` + strings.ReplaceAll(name, `"`, `""`) + `"`
+}
+
+// quoteIdentifiers function quotes all given names and joins them into a
+// list.
+func quoteIdentifiers(names []string) string {
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = quoteIdentifier(name)
+	}
+	return strings.Join(quoted, ", ")
+}
+
+// orderByDependencies function returns tables ordered so that each table
+// follows all tables it references. Tables in reference cycle keep their
+// original order.
+func orderByDependencies(tables []TableSchema) []TableSchema {
+	exported := make(map[TableName]bool, len(tables))
+	for _, table := range tables {
+		exported[table.Name] = false
+	}
+
+	ordered := make([]TableSchema, 0, len(tables))
+	remaining := tables
+	for len(remaining) > 0 {
+		var postponed []TableSchema
+		for _, table := range remaining {
+			if dependenciesResolved(table, exported) {
+				ordered = append(ordered, table)
+				exported[table.Name] = true
+			} else {
+				postponed = append(postponed, table)
+			}
+		}
+
+		// cycle detected - the rest is written as is
+		if len(postponed) == len(remaining) {
+			return append(ordered, postponed...)
+		}
+		remaining = postponed
+	}
+
+	return ordered
+}
+
+// dependenciesResolved function returns true when all tables referenced by
+// given table have been already ordered or are not part of schema.
+func dependenciesResolved(table TableSchema, exported map[TableName]bool) bool {
+	for _, foreignKey := range table.ForeignKeys {
+		referenced := TableName(foreignKey.ReferencedTable)
+		if referenced == table.Name {
+			continue
+		}
+		if done, found := exported[referenced]; found && !done {
+			return false
+		}
+	}
+	return true
+}
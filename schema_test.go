@@ -0,0 +1,332 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/schema_test.html
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// schemaStatements contains tables with all schema features
+var schemaStatements = []string{
+	"CREATE TABLE rule_hit (org_id INTEGER NOT NULL, cluster_id VARCHAR NOT NULL, rule_fqdn VARCHAR, template_data TEXT, PRIMARY KEY (cluster_id, org_id), FOREIGN KEY (cluster_id, org_id) REFERENCES report (cluster, org_id))",
+	"CREATE TABLE report (org_id INTEGER NOT NULL, cluster VARCHAR NOT NULL UNIQUE, gathered_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP, kind VARCHAR DEFAULT 'x', PRIMARY KEY (org_id, cluster))",
+	"CREATE INDEX report_gathered_at ON report (gathered_at, kind)",
+	"INSERT INTO report (org_id, cluster) VALUES (1, 'a'), (1, 'b')",
+	"INSERT INTO rule_hit VALUES (1, 'a', 'rule', '{}')",
+}
+
+// stringPointer helper function returns pointer to given string
+func stringPointer(value string) *string {
+	return &value
+}
+
+// TestReadTableSchemaSQLite checks reading schema from SQLite database
+func TestReadTableSchemaSQLite(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, schemaStatements...)
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &testConfig)
+
+	tableSchema, err := storage.ReadTableSchema(context.Background(), "report")
+	assert.NoError(t, err)
+
+	assert.Equal(t, main.TableName("report"), tableSchema.Name)
+	assert.Equal(t, []main.ColumnSchema{
+		{Name: "org_id", Type: "INTEGER", Nullable: false},
+		{Name: "cluster", Type: "VARCHAR", Nullable: false},
+		{Name: "gathered_at", Type: "TIMESTAMP", Nullable: true, Default: stringPointer("CURRENT_TIMESTAMP")},
+		{Name: "kind", Type: "VARCHAR", Nullable: true, Default: stringPointer("'x'")},
+	}, tableSchema.Columns)
+	assert.Equal(t, []string{"org_id", "cluster"}, tableSchema.PrimaryKey)
+	assert.Empty(t, tableSchema.ForeignKeys)
+	assert.Equal(t, 2, tableSchema.RowCount)
+
+	// index created for UNIQUE constraint has no definition
+	assert.Len(t, tableSchema.Indexes, 2)
+	assert.Equal(t, "report_gathered_at", tableSchema.Indexes[0].Name)
+	assert.Equal(t, []string{"gathered_at", "kind"}, tableSchema.Indexes[0].Columns)
+	assert.False(t, tableSchema.Indexes[0].Unique)
+	assert.Contains(t, tableSchema.Indexes[0].Definition, "CREATE INDEX report_gathered_at")
+	assert.Equal(t, []string{"cluster"}, tableSchema.Indexes[1].Columns)
+	assert.True(t, tableSchema.Indexes[1].Unique)
+	assert.Empty(t, tableSchema.Indexes[1].Definition)
+
+	tableSchema, err = storage.ReadTableSchema(context.Background(), "rule_hit")
+	assert.NoError(t, err)
+	assert.Equal(t, []main.ForeignKeySchema{{
+		Columns:           []string{"cluster_id", "org_id"},
+		ReferencedTable:   "report",
+		ReferencedColumns: []string{"cluster", "org_id"},
+	}}, tableSchema.ForeignKeys)
+	assert.Equal(t, 1, tableSchema.RowCount)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestReadTableSchemaUnknownTable checks reading schema of table that does
+// not exist
+func TestReadTableSchemaUnknownTable(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, schemaStatements...)
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &testConfig)
+
+	_, err := storage.ReadTableSchema(context.Background(), "foo")
+	assert.EqualError(t, err, "no such table: foo")
+
+	checkConnectionClose(t, connection)
+}
+
+// TestReadTableSchemaPostgres checks reading schema from PostgreSQL
+// database
+func TestReadTableSchemaPostgres(t *testing.T) {
+	connection, mock := mustCreateMockConnection(t)
+	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
+
+	mock.ExpectQuery("SELECT a.attname, format_type").WithArgs("rule_hit").
+		WillReturnRows(sqlmock.NewRows([]string{"attname", "type", "nullable", "default"}).
+			AddRow("org_id", "integer", false, nil).
+			AddRow("updated_at", "timestamp without time zone", true, "now()"))
+	expectPrimaryKeyQuery(mock, "rule_hit", "org_id")
+	mock.ExpectQuery("SELECT c.conname").WithArgs("rule_hit").
+		WillReturnRows(sqlmock.NewRows([]string{"conname", "columns", "table", "referenced"}).
+			AddRow("rule_hit_fk", "org_id,cluster_id", "report", "org_id,cluster"))
+	mock.ExpectQuery("SELECT ic.relname").WithArgs("rule_hit").
+		WillReturnRows(sqlmock.NewRows([]string{"relname", "unique", "columns", "definition"}).
+			AddRow("rule_hit_idx", true, "org_id,lower(rule_fqdn)",
+				"CREATE UNIQUE INDEX rule_hit_idx ON public.rule_hit USING btree (org_id, lower(rule_fqdn))"))
+	mock.ExpectQuery("SELECT count\\(\\*\\) FROM rule_hit").
+		WillReturnRows(sqlmock.NewRows([]string{"count"}).AddRow(42))
+	mock.ExpectClose()
+
+	tableSchema, err := storage.ReadTableSchema(context.Background(), "rule_hit")
+	assert.NoError(t, err)
+
+	assert.Equal(t, main.TableSchema{
+		Name: "rule_hit",
+		Columns: []main.ColumnSchema{
+			{Name: "org_id", Type: "integer"},
+			{Name: "updated_at", Type: "timestamp without time zone", Nullable: true, Default: stringPointer("now()")},
+		},
+		PrimaryKey: []string{"org_id"},
+		ForeignKeys: []main.ForeignKeySchema{{
+			Name:              "rule_hit_fk",
+			Columns:           []string{"org_id", "cluster_id"},
+			ReferencedTable:   "report",
+			ReferencedColumns: []string{"org_id", "cluster"},
+		}},
+		Indexes: []main.IndexSchema{{
+			Name:       "rule_hit_idx",
+			Columns:    []string{"org_id", "lower(rule_fqdn)"},
+			Unique:     true,
+			Definition: "CREATE UNIQUE INDEX rule_hit_idx ON public.rule_hit USING btree (org_id, lower(rule_fqdn))",
+		}},
+		RowCount: 42,
+	}, tableSchema)
+
+	checkConnectionClose(t, connection)
+	checkAllExpectations(t, mock)
+}
+
+// TestReadSchemaIgnoredTables checks that ignored tables are not part of
+// schema
+func TestReadSchemaIgnoredTables(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, schemaStatements...)
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &testConfig)
+
+	schema, err := storage.ReadSchema(context.Background(), []main.TableName{"report", "rule_hit"},
+		main.IgnoredTables{"report": struct{}{}})
+	assert.NoError(t, err)
+	assert.Equal(t, "sqlite", schema.Database)
+	assert.Len(t, schema.Tables, 1)
+	assert.Equal(t, main.TableName("rule_hit"), schema.Tables[0].Name)
+
+	checkConnectionClose(t, connection)
+}
+
+// TestSchemaToJSON checks conversion of schema into JSON
+func TestSchemaToJSON(t *testing.T) {
+	schema := &main.Schema{
+		Database: "postgresql",
+		Tables: []main.TableSchema{{
+			Name:        "t",
+			Columns:     []main.ColumnSchema{{Name: "a", Type: "integer"}},
+			PrimaryKey:  []string{"a"},
+			ForeignKeys: []main.ForeignKeySchema{},
+			Indexes:     []main.IndexSchema{},
+			RowCount:    1,
+		}},
+	}
+
+	buffer := new(bytes.Buffer)
+	err := main.SchemaToJSON(buffer, schema)
+	assert.NoError(t, err)
+
+	var decoded map[string]interface{}
+	assert.NoError(t, json.Unmarshal(buffer.Bytes(), &decoded))
+	assert.Equal(t, "postgresql", decoded["database"])
+	table := decoded["tables"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "t", table["name"])
+	assert.Equal(t, float64(1), table["row_count"])
+	assert.Nil(t, table["columns"].([]interface{})[0].(map[string]interface{})["default"])
+
+	assert.Error(t, main.SchemaToJSON(nil, schema))
+}
+
+// TestSchemaToSQLRecreatesTables checks that DDL script recreates tables
+// with the same schema
+func TestSchemaToSQLRecreatesTables(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t, schemaStatements...)
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &testConfig)
+
+	schema, err := storage.ReadSchema(context.Background(), []main.TableName{"rule_hit", "report"}, main.IgnoredTables{})
+	assert.NoError(t, err)
+	checkConnectionClose(t, connection)
+
+	buffer := new(bytes.Buffer)
+	err = main.SchemaToSQL(buffer, schema)
+	assert.NoError(t, err)
+
+	// referenced table is created first
+	ddl := buffer.String()
+	assert.Less(t, strings.Index(ddl, `CREATE TABLE "report"`), strings.Index(ddl, `CREATE TABLE "rule_hit"`))
+	assert.Contains(t, ddl, `FOREIGN KEY ("cluster_id", "org_id") REFERENCES "report" ("cluster", "org_id")`)
+	assert.Contains(t, ddl, `CREATE UNIQUE INDEX "sqlite_autoindex_report_1" ON "report" ("cluster");`)
+
+	// SQLite reserves names of automatic indexes
+	ddl = strings.ReplaceAll(ddl, "sqlite_autoindex_", "autoindex_")
+
+	recreated := mustCreateSQLiteConnection(t, ddl)
+	storage = main.NewFromConnection(recreated, main.DBDriverSQLite3, &testConfig)
+	recreatedSchema, err := storage.ReadSchema(context.Background(), []main.TableName{"rule_hit", "report"}, main.IgnoredTables{})
+	assert.NoError(t, err)
+
+	for i := range schema.Tables {
+		assert.Equal(t, schema.Tables[i].Columns, recreatedSchema.Tables[i].Columns)
+		assert.Equal(t, schema.Tables[i].PrimaryKey, recreatedSchema.Tables[i].PrimaryKey)
+		assert.Equal(t, schema.Tables[i].ForeignKeys, recreatedSchema.Tables[i].ForeignKeys)
+		assert.Len(t, recreatedSchema.Tables[i].Indexes, len(schema.Tables[i].Indexes))
+	}
+
+	checkConnectionClose(t, recreated)
+}
+
+// TestSchemaToSQLPostgres checks DDL generated for PostgreSQL schema
+func TestSchemaToSQLPostgres(t *testing.T) {
+	schema := &main.Schema{
+		Tables: []main.TableSchema{{
+			Name: "t",
+			Columns: []main.ColumnSchema{
+				{Name: "a", Type: "integer", Default: stringPointer("nextval('t_a_seq'::regclass)")},
+				{Name: "b", Type: "timestamp", Nullable: true, Default: stringPointer("now()")},
+				{Name: "order", Type: "integer", Nullable: true},
+			},
+			PrimaryKey: []string{"a"},
+			ForeignKeys: []main.ForeignKeySchema{{
+				Name: "t_fk", Columns: []string{"a"},
+				ReferencedTable: "u", ReferencedColumns: []string{"id"},
+			}},
+			Indexes: []main.IndexSchema{{
+				Name: "t_b", Columns: []string{"b"},
+				Definition: "CREATE INDEX t_b ON public.t USING btree (b)",
+			}},
+		}},
+	}
+
+	buffer := new(bytes.Buffer)
+	err := main.SchemaToSQL(buffer, schema)
+	assert.NoError(t, err)
+	assert.Equal(t, `CREATE SEQUENCE IF NOT EXISTS t_a_seq;
+CREATE TABLE "t" (
+    "a" integer NOT NULL DEFAULT nextval('t_a_seq'::regclass),
+    "b" timestamp DEFAULT now(),
+    "order" integer,
+    PRIMARY KEY ("a"),
+    CONSTRAINT "t_fk" FOREIGN KEY ("a") REFERENCES "u" ("id")
+);
+CREATE INDEX t_b ON public.t USING btree (b);
+
+`, buffer.String())
+
+	assert.Error(t, main.SchemaToSQL(nil, schema))
+}
+
+// TestPerformDataExportSchema checks that schema is exported into files
+func TestPerformDataExportSchema(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:          "file",
+		Limit:           NoLimits,
+		IgnoredTables:   "bad",
+		ExportSchemaSQL: true,
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, main.ExitStatusOK, code)
+
+	content, err := os.ReadFile(filepath.Join(directory, "_schema.json"))
+	assert.NoError(t, err)
+
+	var schema main.Schema
+	assert.NoError(t, json.Unmarshal(content, &schema))
+	assert.Len(t, schema.Tables, 1)
+	assert.Equal(t, main.TableName("good"), schema.Tables[0].Name)
+	assert.Equal(t, 2, schema.Tables[0].RowCount)
+
+	content, err = os.ReadFile(filepath.Join(directory, "_schema.sql"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(content), `CREATE TABLE "good" (`)
+}
+
+// TestPerformDataExportSchemaFailure checks that export fails when schema
+// can't be read
+func TestPerformDataExportSchemaFailure(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:       "file",
+		Limit:        NoLimits,
+		ExportSchema: true,
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.Error(t, err)
+	assert.Equal(t, main.ExitStatusStorageError, code)
+
+	_, err = os.Stat(filepath.Join(directory, "_schema.json"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,294 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains Sink abstraction that represents target of
+// export. Export is performed against Sink, so tables, metadata and all
+// reports are written by the same code regardless of selected output.
+// Implementations for local files and for S3 are stored in file.go and s3.go
+// source files.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/sink.html
+
+import (
+	"context"
+	"encoding/csv"
+	"io"
+
+	"github.com/rs/zerolog/log"
+)
+
+// Messages
+const (
+	unableToAbortObject        = "Unable to abort object"
+	objectNameMsg              = "object"
+	writeTableNameToCSV        = "Write table name to CSV"
+	writeDisabledRuleInfoToCSV = "Write disabled rule info to CSV"
+	writeSamplingToCSV         = "Write sampling parameters to CSV"
+	writePartitionsToCSV       = "Write partitions info to CSV"
+	writeFailuresToJSON        = "Write failures report to JSON"
+	writeIncompleteToJSON      = "Write incomplete run marker to JSON"
+	writeSummaryToJSON         = "Write summary to JSON"
+)
+
+// Sink represents target of export, for example directory in local file
+// system or S3 bucket. Objects are identified by names, slash is used as
+// separator in all names.
+type Sink interface {
+	// Create method creates new object with given name. Content written
+	// into the object is visible after the object is committed.
+	Create(ctx context.Context, name, contentType string) (SinkObject, error)
+
+	// Read method reads content of object with given name. False is
+	// returned when the object does not exist.
+	Read(ctx context.Context, name string) ([]byte, bool, error)
+}
+
+// SinkObject represents object being written into sink. Exactly one of
+// Commit and Abort methods needs to be called.
+type SinkObject interface {
+	io.Writer
+
+	// Commit method finishes writing and stores the object
+	Commit() error
+
+	// Abort method discards everything written into the object
+	Abort() error
+}
+
+// existingChecker is implemented by sinks that don't overwrite objects
+// stored by previous export. It is used to check all objects before
+// anything is written.
+type existingChecker interface {
+	checkExisting(names []string) error
+}
+
+// retryingObject is implemented by objects that retry storing their content
+type retryingObject interface {
+	retries() int
+}
+
+// objectRetries function returns number of retries performed when given
+// object was committed.
+func objectRetries(object SinkObject) int {
+	if retrying, ok := object.(retryingObject); ok {
+		return retrying.retries()
+	}
+	return 0
+}
+
+// abortObject function aborts given object, error is just logged because
+// the object is aborted due to another error.
+func abortObject(object SinkObject, name string) {
+	err := object.Abort()
+	if err != nil {
+		log.Error().Err(err).Str(objectNameMsg, name).Msg(unableToAbortObject)
+	}
+}
+
+// storeIntoSink function stores content written by given function into new
+// object in sink. The object is aborted when content can't be written.
+func storeIntoSink(ctx context.Context, sink Sink, name, contentType string,
+	write func(writer io.Writer) error) error {
+	object, err := sink.Create(ctx, name, contentType)
+	if err != nil {
+		return err
+	}
+
+	err = write(object)
+	if err != nil {
+		abortObject(object, name)
+		return err
+	}
+
+	return object.Commit()
+}
+
+// storeTableNames function stores names of all tables into given object
+func storeTableNames(ctx context.Context, sink Sink, name string, tableNames []TableName) error {
+	return storeIntoSink(ctx, sink, name, contentTypeCSV, func(buffer io.Writer) error {
+		// initialize CSV writer
+		writer := csv.NewWriter(buffer)
+
+		// header
+		err := writer.Write([]string{tableNameMsg})
+		if err != nil {
+			return err
+		}
+
+		// table names
+		for _, tableName := range tableNames {
+			err := writer.Write([]string{string(tableName)})
+			if err != nil {
+				log.Error().Err(err).Msg(writeTableNameToCSV)
+			}
+		}
+
+		writer.Flush()
+
+		// check for any error during export to CSV
+		return writer.Error()
+	})
+}
+
+// storeDisabledRules function stores info about disabled rules into given
+// object
+func storeDisabledRules(ctx context.Context, sink Sink, name string,
+	disabledRulesInfo []DisabledRuleInfo) error {
+	return storeIntoSink(ctx, sink, name, contentTypeCSV, func(writer io.Writer) error {
+		err := DisabledRulesToCSV(writer, disabledRulesInfo)
+		if err != nil {
+			log.Error().Err(err).Msg(writeDisabledRuleInfoToCSV)
+		}
+		return err
+	})
+}
+
+// storeRuleHitsSummary function stores rule hits summary into given CSV and
+// JSON objects
+func storeRuleHitsSummary(ctx context.Context, sink Sink,
+	csvName, jsonName string, summary *RuleHitsSummary) error {
+	err := storeIntoSink(ctx, sink, csvName, contentTypeCSV, func(writer io.Writer) error {
+		return RuleHitsSummaryToCSV(writer, summary)
+	})
+	if err != nil {
+		return err
+	}
+
+	return storeIntoSink(ctx, sink, jsonName, contentTypeJSON, func(writer io.Writer) error {
+		return RuleHitsSummaryToJSON(writer, summary)
+	})
+}
+
+// storeFeedbackSummary function stores feedback summary in given format into
+// given object
+func storeFeedbackSummary(ctx context.Context, sink Sink, name string,
+	format string, summary []FeedbackInfo) error {
+	contentType := contentTypeCSV
+	if format == feedbackFormatJSON {
+		contentType = contentTypeJSON
+	}
+
+	return storeIntoSink(ctx, sink, name, contentType, func(writer io.Writer) error {
+		return FeedbackSummaryToFormat(writer, format, summary)
+	})
+}
+
+// storeFlatteningSummary function stores summary of flattening into given
+// object
+func storeFlatteningSummary(ctx context.Context, sink Sink, name string,
+	summary FlatteningSummary) error {
+	return storeIntoSink(ctx, sink, name, contentTypeJSON, func(writer io.Writer) error {
+		return FlatteningSummaryToJSON(writer, summary)
+	})
+}
+
+// storeSampling function stores sampling parameters into given object
+func storeSampling(ctx context.Context, sink Sink, name string, sampling Sampling) error {
+	return storeIntoSink(ctx, sink, name, contentTypeCSV, func(writer io.Writer) error {
+		err := SamplingToCSV(writer, sampling)
+		if err != nil {
+			log.Error().Err(err).Msg(writeSamplingToCSV)
+		}
+		return err
+	})
+}
+
+// storePartitions function stores number of records exported into each
+// partition into given object
+func storePartitions(ctx context.Context, sink Sink, name string, counts []PartitionCount) error {
+	return storeIntoSink(ctx, sink, name, contentTypeCSV, func(writer io.Writer) error {
+		err := PartitionsToCSV(writer, counts)
+		if err != nil {
+			log.Error().Err(err).Msg(writePartitionsToCSV)
+		}
+		return err
+	})
+}
+
+// storeFailures function stores report about tables that were not exported
+// into given object
+func storeFailures(ctx context.Context, sink Sink, name string, failures []TableFailure) error {
+	return storeIntoSink(ctx, sink, name, contentTypeJSON, func(writer io.Writer) error {
+		err := FailuresToJSON(writer, failures)
+		if err != nil {
+			log.Error().Err(err).Msg(writeFailuresToJSON)
+		}
+		return err
+	})
+}
+
+// storeIncomplete function stores marker of incomplete run into given object
+func storeIncomplete(ctx context.Context, sink Sink, name string, incomplete IncompleteRun) error {
+	return storeIntoSink(ctx, sink, name, contentTypeJSON, func(writer io.Writer) error {
+		err := IncompleteRunToJSON(writer, incomplete)
+		if err != nil {
+			log.Error().Err(err).Msg(writeIncompleteToJSON)
+		}
+		return err
+	})
+}
+
+// storeSummary function stores summary of export into given object
+func storeSummary(ctx context.Context, sink Sink, name string, summary *ExportSummary) error {
+	return storeIntoSink(ctx, sink, name, contentTypeJSON, func(writer io.Writer) error {
+		err := SummaryToJSON(writer, summary)
+		if err != nil {
+			log.Error().Err(err).Msg(writeSummaryToJSON)
+		}
+		return err
+	})
+}
+
+// storeSchema function stores schema of exported tables into given object
+func storeSchema(ctx context.Context, sink Sink, name string, schema *Schema) error {
+	return storeIntoSink(ctx, sink, name, contentTypeJSON, func(writer io.Writer) error {
+		err := SchemaToJSON(writer, schema)
+		if err != nil {
+			log.Error().Err(err).Msg(writeSchemaToJSON)
+		}
+		return err
+	})
+}
+
+// storeSchemaDDL function stores DDL script that recreates exported tables
+// into given object
+func storeSchemaDDL(ctx context.Context, sink Sink, name string, schema *Schema) error {
+	return storeIntoSink(ctx, sink, name, contentTypeSQL, func(writer io.Writer) error {
+		err := SchemaToSQL(writer, schema)
+		if err != nil {
+			log.Error().Err(err).Msg(writeSchemaToSQL)
+		}
+		return err
+	})
+}
+
+// storeProfiles function stores column profiles of exported tables into
+// given object
+func storeProfiles(ctx context.Context, sink Sink, name string, profiles *ExportProfiles) error {
+	return storeIntoSink(ctx, sink, name, contentTypeJSON, func(writer io.Writer) error {
+		err := ProfilesToJSON(writer, profiles)
+		if err != nil {
+			log.Error().Err(err).Msg(writeProfileToJSON)
+		}
+		return err
+	})
+}
@@ -0,0 +1,261 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/sink_test.html
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// TestFileSinkCommit checks that committed object is stored into file and
+// that directories are created when needed
+func TestFileSinkCommit(t *testing.T) {
+	ctx := context.Background()
+	directory := t.TempDir()
+	name := filepath.ToSlash(filepath.Join(directory, "org_id=1", "report.csv"))
+
+	sink := main.NewFileSink("", false)
+	object, err := sink.Create(ctx, name, "text/csv")
+	assert.NoError(t, err)
+
+	_, err = object.Write([]byte("org_id\n1\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, object.Commit())
+
+	content, found, err := sink.Read(ctx, name)
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "org_id\n1\n", string(content))
+
+	// missing file is not an error
+	_, found, err = sink.Read(ctx, filepath.Join(directory, "missing.csv"))
+	assert.NoError(t, err)
+	assert.False(t, found)
+}
+
+// TestFileSinkAbort checks that aborted object does not leave partially
+// written file
+func TestFileSinkAbort(t *testing.T) {
+	fileName := filepath.Join(t.TempDir(), "report.csv")
+
+	object, err := main.NewFileSink("", false).Create(context.Background(), fileName, "text/csv")
+	assert.NoError(t, err)
+
+	_, err = object.Write([]byte("org_id\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, object.Abort())
+	assert.NoFileExists(t, fileName)
+}
+
+// TestFileSinkOutputDirectory checks that objects are stored into output
+// directory and that no temporary files are left there
+func TestFileSinkOutputDirectory(t *testing.T) {
+	ctx := context.Background()
+	directory := filepath.Join(t.TempDir(), "export")
+
+	sink := main.NewFileSink(directory, false)
+	object, err := sink.Create(ctx, "org_id=1/report.csv", "text/csv")
+	assert.NoError(t, err)
+
+	_, err = object.Write([]byte("org_id\n1\n"))
+	assert.NoError(t, err)
+
+	// content is not visible before the object is committed
+	assert.NoFileExists(t, filepath.Join(directory, "org_id=1", "report.csv"))
+	assert.NoError(t, object.Commit())
+
+	content, err := os.ReadFile(filepath.Join(directory, "org_id=1", "report.csv"))
+	assert.NoError(t, err)
+	assert.Equal(t, "org_id\n1\n", string(content))
+
+	entries, err := os.ReadDir(filepath.Join(directory, "org_id=1"))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+// TestFileSinkOverwrite checks that existing file is overwritten only when
+// it is forced
+func TestFileSinkOverwrite(t *testing.T) {
+	ctx := context.Background()
+	directory := t.TempDir()
+	fileName := filepath.Join(directory, "report.csv")
+	assert.NoError(t, os.WriteFile(fileName, []byte("previous\n"), 0o600))
+
+	_, err := main.NewFileSink(directory, false).Create(ctx, "report.csv", "text/csv")
+	assert.EqualError(t, err, "file "+fileName+" already exists, use -force to overwrite it")
+
+	object, err := main.NewFileSink(directory, true).Create(ctx, "report.csv", "text/csv")
+	assert.NoError(t, err)
+
+	// previous file is kept until the object is committed
+	_, err = object.Write([]byte("org_id\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, object.Abort())
+
+	content, err := os.ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, "previous\n", string(content))
+}
+
+// TestFileSinkCommitDoesNotOverwrite checks that file created after the
+// object has been created is not overwritten when the object is committed
+func TestFileSinkCommitDoesNotOverwrite(t *testing.T) {
+	directory := t.TempDir()
+	fileName := filepath.Join(directory, "report.csv")
+
+	object, err := main.NewFileSink(directory, false).Create(context.Background(), "report.csv", "text/csv")
+	assert.NoError(t, err)
+	_, err = object.Write([]byte("org_id\n"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, os.WriteFile(fileName, []byte("other\n"), 0o600))
+	assert.EqualError(t, object.Commit(), "file "+fileName+" already exists, use -force to overwrite it")
+
+	content, err := os.ReadFile(fileName)
+	assert.NoError(t, err)
+	assert.Equal(t, "other\n", string(content))
+
+	// temporary file is removed
+	entries, err := os.ReadDir(directory)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}
+
+// TestFileSinkStateFiles checks that files read by the next export are
+// replaced even when overwriting is not forced
+func TestFileSinkStateFiles(t *testing.T) {
+	directory := t.TempDir()
+	sink := main.NewFileSink(directory, false)
+
+	for _, name := range []string{"_columns.json", "_disabled_rules.csv"} {
+		fileName := filepath.Join(directory, name)
+		assert.NoError(t, os.WriteFile(fileName, []byte("previous\n"), 0o600))
+		assert.NoError(t, main.FileSinkCheckExisting(sink, []string{name}))
+
+		object, err := sink.Create(context.Background(), name, "text/csv")
+		assert.NoError(t, err)
+		_, err = object.Write([]byte("current\n"))
+		assert.NoError(t, err)
+		assert.NoError(t, object.Commit())
+
+		content, err := os.ReadFile(fileName)
+		assert.NoError(t, err)
+		assert.Equal(t, "current\n", string(content))
+	}
+}
+
+// TestFileSinkCheckExisting checks that existing files are found before
+// anything is written, unless overwriting is forced
+func TestFileSinkCheckExisting(t *testing.T) {
+	directory := t.TempDir()
+	fileName := filepath.Join(directory, "report.csv")
+
+	assert.NoError(t, main.FileSinkCheckExisting(main.NewFileSink(directory, false),
+		[]string{"report.csv", "_tables.csv"}))
+
+	assert.NoError(t, os.WriteFile(fileName, []byte("previous\n"), 0o600))
+	assert.EqualError(t, main.FileSinkCheckExisting(main.NewFileSink(directory, false),
+		[]string{"_tables.csv", "report.csv"}),
+		"file "+fileName+" already exists, use -force to overwrite it")
+	assert.NoError(t, main.FileSinkCheckExisting(main.NewFileSink(directory, true),
+		[]string{"_tables.csv", "report.csv"}))
+}
+
+// TestFileConfigurationOutputDirectory checks selection of output directory
+func TestFileConfigurationOutputDirectory(t *testing.T) {
+	configuration := main.FileConfiguration{OutputDirectory: "exports"}
+	assert.Equal(t, "exports", main.FileConfigurationOutputDirectory(configuration, "", "run"))
+
+	// flag takes precedence
+	assert.Equal(t, "out", main.FileConfigurationOutputDirectory(configuration, "out", "run"))
+
+	configuration.PerRunDirectory = true
+	assert.Equal(t, filepath.Join("exports", "run"),
+		main.FileConfigurationOutputDirectory(configuration, "", "run"))
+	assert.Equal(t, "run",
+		main.FileConfigurationOutputDirectory(main.FileConfiguration{PerRunDirectory: true}, "", "run"))
+}
+
+// TestS3Sink checks that object is uploaded into S3 when it is committed
+// only
+func TestS3Sink(t *testing.T) {
+	configuration := main.ConfigStruct{}
+	requests := mockS3(t, &configuration, "bucket")
+
+	minioClient, err := main.NewS3Connection(&configuration)
+	assert.NoError(t, err)
+	ctx := context.Background()
+	sink := main.NewS3Sink(minioClient, "bucket", main.RetryPolicy{})
+
+	aborted, err := sink.Create(ctx, "prefix/aborted.csv", "text/csv")
+	assert.NoError(t, err)
+	_, err = aborted.Write([]byte("x\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, aborted.Abort())
+
+	object, err := sink.Create(ctx, "prefix/report.csv", "text/csv")
+	assert.NoError(t, err)
+	_, err = object.Write([]byte("org_id\n1\n"))
+	assert.NoError(t, err)
+	assert.NoError(t, object.Commit())
+
+	assert.Contains(t, requests(), "PUT /bucket/prefix/report.csv")
+	assert.NotContains(t, requests(), "PUT /bucket/prefix/aborted.csv")
+
+	content, found, err := sink.Read(ctx, "prefix/report.csv")
+	assert.NoError(t, err)
+	assert.True(t, found)
+	assert.Equal(t, "org_id\n1\n", string(content))
+}
+
+// TestStoreTableAbortsObject checks that table that can't be read is not
+// stored partially
+func TestStoreTableAbortsObject(t *testing.T) {
+	connection, mock := mustCreateMockConnection(t)
+
+	column := sqlmock.NewColumn("id").OfType("INT4", int64(0))
+	mock.ExpectQuery(readColumnTypesQuery).
+		WillReturnRows(mock.NewRowsWithColumnDefinition(column))
+	expectPrimaryKeyQuery(mock, "table_name", "id")
+	mock.ExpectQuery("SELECT \\* FROM table_name").
+		WillReturnError(errors.New("read failed"))
+	mock.ExpectClose()
+
+	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
+
+	directory := t.TempDir()
+	err := storage.StoreTable(context.Background(), main.NewFileSink("", false), directory, "table_name", NoLimits)
+	assert.EqualError(t, err, "read failed")
+	assert.NoFileExists(t, filepath.Join(directory, "table_name.csv"))
+
+	checkConnectionClose(t, connection)
+	checkAllExpectations(t, mock)
+}
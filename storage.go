@@ -23,13 +23,14 @@ package main
 // https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/storage.html
 
 import (
-	"bytes"
 	"context"
 	"encoding/csv"
 	"fmt"
 	"io"
-	"os"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"database/sql"
 
@@ -38,7 +39,7 @@ import (
 
 	"github.com/rs/zerolog/log"
 
-	"github.com/minio/minio-go/v7"
+	"go.opentelemetry.io/otel/attribute"
 )
 
 // Driver types
@@ -78,12 +79,35 @@ const (
             ORDER BY 1;
    `
 
+	// Select columns forming primary key of given table, in key order
+	selectPrimaryKeyInPostgres = `
+           SELECT a.attname
+             FROM pg_index i
+             JOIN pg_attribute a ON a.attrelid = i.indrelid
+                                AND a.attnum = ANY(i.indkey)
+            WHERE i.indrelid = $1::regclass
+              AND i.indisprimary
+            ORDER BY array_position(i.indkey::int2[], a.attnum);
+   `
+
+	selectPrimaryKeyInSQLite = `
+           SELECT name FROM pragma_table_info($1)
+            WHERE pk > 0
+            ORDER BY pk;
+   `
+
 	selectDisabledRules = `
-           SELECT rule_id, count(rule_id) AS rule_count
-	     FROM rule_disable
-	    GROUP BY rule_id
-	   HAVING count(rule_id)>1
-	    ORDER BY rule_count DESC;
+           SELECT rule_id, error_key, count(rule_id) AS rule_count,
+                  count(DISTINCT org_id),
+                  min(created_at), max(created_at),
+                  sum(CASE WHEN created_at >= $1 THEN 1 ELSE 0 END),
+                  sum(CASE WHEN coalesce(trim(justification), '') = '' THEN 1 ELSE 0 END)
+             FROM rule_disable`
+
+	groupDisabledRules = `
+            GROUP BY rule_id, error_key
+           HAVING count(rule_id)>=$2
+            ORDER BY rule_count DESC, rule_id, error_key;
    `
 )
 
@@ -103,6 +127,24 @@ var (
 	}
 
 	whereOrgIDFilter = " WHERE org_id IN ('%v')"
+
+	orderByClause = " ORDER BY %s"
+
+	unknownOrderingColumn = "ordering column %s does not exist in table %s"
+
+	// values of these PostgreSQL types can't be compared, so rows can't be
+	// ordered by them
+	unorderableTypesInPostgres = map[string]bool{
+		"JSON":    true,
+		"XML":     true,
+		"POINT":   true,
+		"LINE":    true,
+		"LSEG":    true,
+		"BOX":     true,
+		"PATH":    true,
+		"POLYGON": true,
+		"CIRCLE":  true,
+	}
 )
 
 // Storage represents an interface to almost any database or storage system
@@ -121,10 +163,30 @@ type DBStorage struct {
 	connection   *sql.DB
 	dbDriverType DBDriver
 	config       *StorageConfiguration
+	sampling     Sampling
+
+	// subset contains condition for each table when referentially
+	// consistent subset of data is exported
+	subset map[TableName]string
+
+	// retryPolicy is used for all queries that read data
+	retryPolicy RetryPolicy
+
+	// retryStats contains number of retries performed for each table
+	retryStats *RetryStats
+
+	// exportStats contains number of rows and bytes exported from each
+	// table
+	exportStats *ExportStats
+
+	// profiles contains column profiles of exported tables, profiles are
+	// not computed when it is nil
+	profiles *ExportProfiles
 }
 
 // NewStorage function creates and initializes a new instance of Storage interface
-func NewStorage(configuration *StorageConfiguration) (*DBStorage, error) {
+func NewStorage(ctx context.Context, configuration *StorageConfiguration,
+	retryPolicy RetryPolicy) (*DBStorage, error) {
 	log.Info().Msg("Initializing connection to storage")
 
 	// initialize database driver
@@ -147,8 +209,23 @@ func NewStorage(configuration *StorageConfiguration) (*DBStorage, error) {
 		return nil, err
 	}
 
+	// connection is established lazily, so it is checked there; database
+	// might not be available yet, for example during failover
+	_, err = retryPolicy.Do(ctx, "ping", func() error {
+		return connection.PingContext(ctx)
+	})
+	if err != nil {
+		log.Error().Err(err).Msg("Can not connect to data storage")
+		if closeErr := connection.Close(); closeErr != nil {
+			log.Error().Err(closeErr).Msg("Can not close connection to data storage")
+		}
+		return nil, err
+	}
+
 	log.Info().Msg("Connection to storage established")
-	return NewFromConnection(connection, driverType, configuration), nil
+	storage := NewFromConnection(connection, driverType, configuration)
+	storage.retryPolicy = retryPolicy
+	return storage, nil
 }
 
 // NewFromConnection function creates and initializes a new instance of Storage interface from prepared connection
@@ -157,6 +234,8 @@ func NewFromConnection(connection *sql.DB, dbDriverType DBDriver, config *Storag
 		connection:   connection,
 		dbDriverType: dbDriverType,
 		config:       config,
+		retryStats:   NewRetryStats(),
+		exportStats:  NewExportStats(),
 	}
 }
 
@@ -213,8 +292,21 @@ func (storage DBStorage) Close() error {
 }
 
 // ReadListOfTables method reads names of all public tables stored in opened
-// database.
-func (storage DBStorage) ReadListOfTables() ([]TableName, error) {
+// database. It is the first query performed, so connection errors are
+// retried there.
+func (storage DBStorage) ReadListOfTables(ctx context.Context) ([]TableName, error) {
+	var tableList []TableName
+	err := storage.retry(ctx, "", "read list of tables", func(ctx context.Context) error {
+		var err error
+		tableList, err = storage.readListOfTables(ctx)
+		return err
+	})
+	return tableList, err
+}
+
+// readListOfTables method performs one attempt to read names of all public
+// tables.
+func (storage DBStorage) readListOfTables(ctx context.Context) ([]TableName, error) {
 	// slice to make list of tables
 	var tableList = make([]TableName, 0)
 
@@ -228,7 +320,8 @@ func (storage DBStorage) ReadListOfTables() ([]TableName, error) {
 		return tableList, fmt.Errorf("Invalid DB driver")
 	}
 
-	rows, err := storage.connection.Query(selectListOfTables)
+	setSpanAttributes(ctx, attribute.String(statementAttribute, selectListOfTables))
+	rows, err := storage.connection.QueryContext(ctx, selectListOfTables)
 	if err != nil {
 		return tableList, err
 	}
@@ -368,29 +461,89 @@ func selectCountFromTable(tableName TableName) string {
 	return fmt.Sprintf("SELECT count(*) FROM %s", string(tableName))
 }
 
-func selectAllFromTable(tableName TableName) string {
+// selectFromTable is helper function to construct query to database - read
+// given columns or expressions from given table.
+func selectFromTable(selectList string, tableName TableName) string {
 	// it is not possible to use parameter for table name or a key
 	// disable "G201 (CWE-89): SQL string formatting (Confidence: HIGH, Severity: MEDIUM)"
 	// #nosec G201
-	return fmt.Sprintf("SELECT * FROM %s", string(tableName))
+	return fmt.Sprintf("SELECT %s FROM %s", selectList, string(tableName))
 }
 
-// ReadTable method reads the whole content of selected table.
-func (storage DBStorage) ReadTable(tableName TableName, limit int) ([]M, error) {
-	sqlStatement := selectAllFromTable(tableName)
+// ReadTable method reads the whole content of selected table. Reading is
+// retried when transient error occurs.
+func (storage DBStorage) ReadTable(ctx context.Context, tableName TableName, limit int) ([]M, error) {
+	finalRows, _, err := storage.readTableWithProfile(ctx, tableName, limit)
+	return finalRows, err
+}
 
-	storage.applySelectiveExport(&sqlStatement, tableName)
+// readTableWithProfile method reads the whole content of selected table
+// together with column profiles computed from read rows. Profile is nil when
+// profiling is disabled.
+func (storage DBStorage) readTableWithProfile(ctx context.Context, tableName TableName, limit int) ([]M, *TableProfile, error) {
+	var finalRows []M
+	var profile *TableProfile
+	err := storage.retry(ctx, tableName, "read table", func(ctx context.Context) error {
+		var err error
+		finalRows, profile, err = storage.readTable(ctx, tableName, limit)
+		return err
+	})
+	return finalRows, profile, err
+}
+
+// selectStatement method constructs SQL statement that reads content of
+// selected table, including sampling, filter by organizations, ordering and
+// limit. The same statement is used by export and printed by dry run.
+func (storage DBStorage) selectStatement(ctx context.Context, tableName TableName, limit int) (string, error) {
+	sqlStatement, err := storage.filteredStatement(ctx, "*", tableName)
+	if err != nil {
+		return "", err
+	}
+
+	err = storage.applyPerOrgSample(ctx, &sqlStatement, tableName)
+	if err != nil {
+		return "", err
+	}
+
+	err = storage.applyOrdering(ctx, &sqlStatement, tableName)
+	if err != nil {
+		return "", err
+	}
 
 	if limit > 0 {
 		sqlStatement += fmt.Sprintf(" LIMIT %d", limit)
 	}
 
+	return sqlStatement, nil
+}
+
+// filteredStatement method constructs SQL statement that reads given columns
+// or expressions from rows of selected table that are exported: rows
+// selected by percentage sampling and by filter by organizations.
+func (storage DBStorage) filteredStatement(ctx context.Context, selectList string, tableName TableName) (string, error) {
+	sqlStatement := selectFromTable(selectList, tableName)
+
+	storage.applyTableSample(&sqlStatement)
+	storage.applySelectiveExport(&sqlStatement, tableName)
+
+	err := storage.applyRandomFilter(ctx, &sqlStatement, tableName)
+	return sqlStatement, err
+}
+
+// readTable method performs one attempt to read content of selected table.
+func (storage DBStorage) readTable(ctx context.Context, tableName TableName, limit int) ([]M, *TableProfile, error) {
+	sqlStatement, err := storage.selectStatement(ctx, tableName, limit)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	log.Info().Str(sqlStatementExecuted, sqlStatement).Msg("Performing")
 
-	rows, err := storage.connection.Query(sqlStatement)
+	setSpanAttributes(ctx, attribute.String(statementAttribute, sqlStatement))
+	rows, err := storage.connection.QueryContext(ctx, sqlStatement)
 	if err != nil {
 		log.Error().Err(err).Str(sqlStatementExecuted, sqlStatement).Msg(sqlStatementExecutionError)
-		return nil, err
+		return nil, nil, err
 	}
 
 	defer func() {
@@ -405,11 +558,17 @@ func (storage DBStorage) ReadTable(tableName TableName, limit int) ([]M, error)
 
 	if err != nil {
 		log.Error().Err(err).Msg(unableToRetrieveColumnTypes)
-		return nil, err
+		return nil, nil, err
 	}
 
 	logColumnTypes(tableName, columnTypes)
 
+	// column profiles are computed from the same rows that are exported
+	var profiler *tableProfiler
+	if storage.profiles != nil {
+		profiler = newTableProfiler(columnTypes)
+	}
+
 	// prepare data structure to hold raw values
 	var finalRows []M
 
@@ -424,7 +583,7 @@ func (storage DBStorage) ReadTable(tableName TableName, limit int) ([]M, error)
 
 		if err != nil {
 			log.Error().Err(err).Msg("Unable to scan row")
-			return nil, err
+			return nil, nil, err
 		}
 
 		// it is now needed to check each element of values for nil
@@ -432,122 +591,100 @@ func (storage DBStorage) ReadTable(tableName TableName, limit int) ([]M, error)
 		// able to fetch the column into a typed variable if needed
 		masterData := fillInMasterData(columnTypes, scanArgs)
 
+		profiler.observe(scanArgs)
+
 		// TODO: make the export part there
 		// println(masterData)
 		finalRows = append(finalRows, masterData)
 	}
-	return finalRows, nil
+
+	setSpanAttributes(ctx, attribute.Int(rowsAttribute, len(finalRows)))
+	return finalRows, profiler.profile(), nil
 }
 
-// StoreTable function stores specified table into S3/Minio
-func (storage DBStorage) StoreTable(ctx context.Context,
-	minioClient *minio.Client, bucketName, prefix string, tableName TableName,
+// StoreTable method stores specified table into given sink under given
+// prefix (directory or prefix of S3 object).
+func (storage DBStorage) StoreTable(ctx context.Context, sink Sink, prefix string, tableName TableName,
 	limit int) error {
-	columnTypes, err := storage.RetrieveColumnTypes(tableName)
+	columnTypes, err := storage.RetrieveColumnTypes(ctx, tableName)
 	if err != nil {
 		return err
 	}
 
 	colNames := getColumnNames(columnTypes)
 
-	buffer := new(bytes.Buffer)
-
-	// initialize CSV writer
-	writer := csv.NewWriter(buffer)
-
-	err = writeColumnNames(writer, colNames)
-	if err != nil {
-		return err
-	}
-
-	err = storage.WriteTableContent(writer, tableName, colNames, limit)
-	if err != nil {
-		return err
-	}
-
-	writer.Flush()
-
-	reader := io.Reader(buffer)
-
-	// Compute exact object size instead of using default value -1
-	//
-	// Warning: possible problems with large tables and 32bit architecture
-	// Warning: passing -1 will allocate a large amount of memory
-	//
-	// Previous warning taken from:
-	// https://docs.min.io/docs/golang-client-api-reference#PutObject
-	size := buffer.Len()
-
-	options := minio.PutObjectOptions{ContentType: contentTypeCSV}
 	objectName := setObjectPrefix(prefix, string(tableName)) + CSVFileExtension
-	_, err = minioClient.PutObject(ctx, bucketName, objectName, reader, int64(size), options)
+	object, err := sink.Create(ctx, objectName, contentTypeCSV)
 	if err != nil {
 		return err
 	}
 
-	// reset buffer before it will be garbage collected
-	buffer.Reset()
-	return nil
-}
+	// initialize CSV writer, written bytes are counted
+	counter := &countingWriter{writer: object}
+	writer := csv.NewWriter(counter)
 
-// StoreTableIntoFile function stores specified table into selected file
-func (storage DBStorage) StoreTableIntoFile(tableName TableName,
-	limit int) error {
-	columnTypes, err := storage.RetrieveColumnTypes(tableName)
+	rows, profile, err := storage.writeTable(ctx, writer, tableName, colNames, limit)
 	if err != nil {
+		abortObject(object, objectName)
 		return err
 	}
 
-	colNames := getColumnNames(columnTypes)
-
-	fileName := string(tableName) + CSVFileExtension
-
-	// open new CSV file to be filled in
-	// disable "G304 (CWE-22): Potential file inclusion via variable"
-	fout, err := os.Create(fileName) // #nosec G304
+	err = object.Commit()
+	storage.retryStats.Add(tableName, objectRetries(object))
 	if err != nil {
 		return err
 	}
 
-	// initialize CSV writer
-	writer := csv.NewWriter(fout)
+	storage.exportStats.Record(prefix, tableName, TableStats{
+		Rows:  rows,
+		Bytes: counter.count,
+	})
+	storage.profiles.Record(prefix, tableName, profile)
 
-	err = writeColumnNames(writer, colNames)
+	return nil
+}
+
+// writeTable method writes column names and content of given table by
+// CSV writer.
+func (storage DBStorage) writeTable(ctx context.Context, writer *csv.Writer, tableName TableName,
+	colNames []string, limit int) (int, *TableProfile, error) {
+	err := writeColumnNames(writer, colNames)
 	if err != nil {
-		return err
+		return 0, nil, err
 	}
 
-	err = storage.WriteTableContent(writer, tableName, colNames, limit)
+	rows, profile, err := storage.writeTableContent(ctx, writer, tableName, colNames, limit)
 	if err != nil {
-		return err
+		return 0, nil, err
 	}
 
 	writer.Flush()
 
 	// check for any error during export to CSV
-	err = writer.Error()
-	if err != nil {
-		return err
-	}
-
-	// close the file and check if close operation was ok
-	err = fout.Close()
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return rows, profile, writer.Error()
 }
 
 // ReadRecordsCount method reads number of records stored in given database
 // table.
-func (storage DBStorage) ReadRecordsCount(tableName TableName) (int, error) {
+func (storage DBStorage) ReadRecordsCount(ctx context.Context, tableName TableName) (int, error) {
+	count := -1
+	err := storage.retry(ctx, tableName, "read records count", func(ctx context.Context) error {
+		var err error
+		count, err = storage.readRecordsCount(ctx, tableName)
+		return err
+	})
+	return count, err
+}
+
+// readRecordsCount method performs one attempt to read number of records.
+func (storage DBStorage) readRecordsCount(ctx context.Context, tableName TableName) (int, error) {
 	sqlStatement := selectCountFromTable(tableName)
 
 	storage.applySelectiveExport(&sqlStatement, tableName)
 
 	// try to query DB
-	row := storage.connection.QueryRow(sqlStatement)
+	setSpanAttributes(ctx, attribute.String(statementAttribute, sqlStatement))
+	row := storage.connection.QueryRowContext(ctx, sqlStatement)
 
 	var count int
 
@@ -562,11 +699,23 @@ func (storage DBStorage) ReadRecordsCount(tableName TableName) (int, error) {
 }
 
 // RetrieveColumnTypes read column types from given table
-func (storage DBStorage) RetrieveColumnTypes(tableName TableName) ([]*sql.ColumnType, error) {
+func (storage DBStorage) RetrieveColumnTypes(ctx context.Context, tableName TableName) ([]*sql.ColumnType, error) {
+	var columnTypes []*sql.ColumnType
+	err := storage.retry(ctx, tableName, "retrieve column types", func(ctx context.Context) error {
+		var err error
+		columnTypes, err = storage.retrieveColumnTypes(ctx, tableName)
+		return err
+	})
+	return columnTypes, err
+}
+
+// retrieveColumnTypes method performs one attempt to read column types.
+func (storage DBStorage) retrieveColumnTypes(ctx context.Context, tableName TableName) ([]*sql.ColumnType, error) {
 	sqlStatement := select1FromTable(tableName)
 
 	// try to query DB
-	rows, err := storage.connection.Query(sqlStatement)
+	setSpanAttributes(ctx, attribute.String(statementAttribute, sqlStatement))
+	rows, err := storage.connection.QueryContext(ctx, sqlStatement)
 	if err != nil {
 		log.Error().Err(err).Str(sqlStatementExecuted, sqlStatement).Msg(sqlStatementExecutionError)
 		return nil, err
@@ -593,13 +742,21 @@ func (storage DBStorage) RetrieveColumnTypes(tableName TableName) ([]*sql.Column
 
 // WriteTableContent method writes content of whole table into given CSV
 // writera (may be file or S3 bucke)
-func (storage DBStorage) WriteTableContent(writer *csv.Writer,
+func (storage DBStorage) WriteTableContent(ctx context.Context, writer *csv.Writer,
 	tableName TableName, colNames []string, limit int) error {
+	_, _, err := storage.writeTableContent(ctx, writer, tableName, colNames, limit)
+	return err
+}
+
+// writeTableContent method writes content of whole table into given CSV
+// writer and returns number of written rows together with column profiles
+func (storage DBStorage) writeTableContent(ctx context.Context, writer *csv.Writer,
+	tableName TableName, colNames []string, limit int) (int, *TableProfile, error) {
 	// now we know column types, time to perform export
-	finalRows, err := storage.ReadTable(tableName, limit)
+	finalRows, profile, err := storage.readTableWithProfile(ctx, tableName, limit)
 	if err != nil {
 		log.Error().Err(err).Msg(readTableContentFailed)
-		return err
+		return 0, nil, err
 	}
 
 	for _, finalRow := range finalRows {
@@ -612,70 +769,20 @@ func (storage DBStorage) WriteTableContent(writer *csv.Writer,
 		err = writer.Write(columns)
 		if err != nil {
 			log.Error().Err(err).Msg(writeOneRowToCSV)
-			return err
+			return 0, nil, err
 		}
 	}
-	return nil
-}
-
-// StoreTableMetadataIntoFile method stores metadata about given tables into
-// file.
-func (storage DBStorage) StoreTableMetadataIntoFile(fileName string, tableNames []TableName) error {
-	// open new CSV file to be filled in
-	// disable "G304 (CWE-22): Potential file inclusion via variable"
-	fout, err := os.Create(fileName) // #nosec G304
-	if err != nil {
-		return err
-	}
-
-	err = TableMetadataToCSV(fout, tableNames, storage)
-	if err != nil {
-		// logging has been performed already
-		return err
-	}
-
-	// initialize CSV writer
-	writer := csv.NewWriter(fout)
-
-	// check for any error during export to CSV
-	err = writer.Error()
-	if err != nil {
-		return err
-	}
-
-	// close the file and check if close operation was ok
-	err = fout.Close()
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return len(finalRows), profile, nil
 }
 
-// StoreTableMetadataIntoS3 method stores metadata about given tables into
-// S3 or Minio.
-func (storage DBStorage) StoreTableMetadataIntoS3(ctx context.Context,
-	minioClient *minio.Client, bucketName string, objectName string,
-	tableNames []TableName) error {
-	buffer := new(bytes.Buffer)
-
-	err := TableMetadataToCSV(buffer, tableNames, storage)
-	if err != nil {
-		// logging has been performed already
-		return err
-	}
-
-	// write CSV data into S3 bucket or Minio bucket
-	reader := io.Reader(buffer)
-
-	options := minio.PutObjectOptions{ContentType: contentTypeCSV}
-	_, err = minioClient.PutObject(ctx, bucketName, objectName, reader, -1, options)
-	if err != nil {
-		return err
-	}
-
-	// everything look ok
-	return nil
+// StoreTableMetadata method stores metadata about given tables into given
+// object.
+func (storage DBStorage) StoreTableMetadata(ctx context.Context, sink Sink, name string, tableNames []TableName) error {
+	return storeIntoSink(ctx, sink, name, contentTypeCSV,
+		func(writer io.Writer) error {
+			// logging has been performed already
+			return TableMetadataToCSV(ctx, writer, tableNames, storage)
+		})
 }
 
 func getColumnNames(columnTypes []*sql.ColumnType) []string {
@@ -696,12 +803,20 @@ func writeColumnNames(writer *csv.Writer, colNames []string) error {
 	return nil
 }
 
-// ReadDisabledRules method reads rules disabled by more than one user
-func (storage DBStorage) ReadDisabledRules() ([]DisabledRuleInfo, error) {
+// ReadDisabledRules method reads rules disabled by at least given number of
+// users in exported organizations. Disables performed since given time are
+// counted separately.
+// Number of rules disabled for single clusters is read too.
+func (storage DBStorage) ReadDisabledRules(ctx context.Context, minCount int, since time.Time) ([]DisabledRuleInfo, error) {
 	// slice to make list of disabled rule
 	var disabledRulesInfo = make([]DisabledRuleInfo, 0)
 
-	rows, err := storage.connection.Query(selectDisabledRules)
+	// only disables of exported organizations are counted
+	query := selectDisabledRules
+	storage.applySelectiveExport(&query, ruleDisableTable)
+	query += groupDisabledRules
+
+	rows, err := storage.query(ctx, ruleDisableTable, "read disabled rules", query, since, minCount)
 	if err != nil {
 		return disabledRulesInfo, err
 	}
@@ -716,18 +831,25 @@ func (storage DBStorage) ReadDisabledRules() ([]DisabledRuleInfo, error) {
 	// read all records
 	for rows.Next() {
 		var disabledRuleInfo DisabledRuleInfo
+		var firstDisabledAt, lastDisabledAt sql.NullString
 
-		err := rows.Scan(&disabledRuleInfo.Rule, &disabledRuleInfo.Count)
+		err := rows.Scan(&disabledRuleInfo.Rule, &disabledRuleInfo.ErrorKey,
+			&disabledRuleInfo.Count, &disabledRuleInfo.Orgs,
+			&firstDisabledAt, &lastDisabledAt,
+			&disabledRuleInfo.CountInWindow, &disabledRuleInfo.EmptyJustifications)
 		if err != nil {
 			if closeErr := rows.Close(); closeErr != nil {
 				log.Error().Err(closeErr).Msg(unableToCloseDBRowsHandle)
 			}
 			return disabledRulesInfo, err
 		}
+		disabledRuleInfo.FirstDisabledAt = firstDisabledAt.String
+		disabledRuleInfo.LastDisabledAt = lastDisabledAt.String
 		disabledRulesInfo = append(disabledRulesInfo, disabledRuleInfo)
 	}
 
-	return disabledRulesInfo, nil
+	err = storage.readClusterDisables(ctx, disabledRulesInfo)
+	return disabledRulesInfo, err
 }
 
 // check whether table is allowed to be exported selectively by org_id
@@ -740,8 +862,216 @@ func selectiveExportAllowed(tablename TableName) bool {
 	return false
 }
 
+// applySelectiveExport method adds condition that filters rows by
+// organization ID into SQL statement. When subset plan has been constructed,
+// condition from the plan is used, otherwise only tables from predefined list
+// are filtered.
 func (storage DBStorage) applySelectiveExport(sqlStatement *string, tablename TableName) {
+	if storage.subset != nil {
+		if condition := storage.subset[tablename]; condition != "" {
+			appendCondition(sqlStatement, condition)
+		}
+		return
+	}
+
 	if storage.config.EnableOrgIDFiltering && selectiveExportAllowed(tablename) {
 		*sqlStatement += fmt.Sprintf(whereOrgIDFilter, strings.Join(storage.config.OrganizationsToExport, "','"))
 	}
 }
+
+// ReadPrimaryKey method reads names of columns that form the primary key of
+// given table. Columns are returned in key order. Empty slice is returned for
+// tables without primary key.
+func (storage DBStorage) ReadPrimaryKey(ctx context.Context, tableName TableName) ([]string, error) {
+	var columns = make([]string, 0)
+
+	var selectPrimaryKey string
+	switch storage.dbDriverType {
+	case DBDriverSQLite3:
+		selectPrimaryKey = selectPrimaryKeyInSQLite
+	case DBDriverPostgres:
+		selectPrimaryKey = selectPrimaryKeyInPostgres
+	default:
+		return columns, fmt.Errorf("Invalid DB driver")
+	}
+
+	rows, err := storage.query(ctx, tableName, "read primary key", selectPrimaryKey, string(tableName))
+	if err != nil {
+		log.Error().Err(err).Str(tableNameMsg, string(tableName)).Msg("Unable to read primary key")
+		return columns, err
+	}
+
+	defer func() {
+		err := rows.Close()
+		if err != nil {
+			log.Error().Err(err).Msg(unableToCloseDBRowsHandle)
+		}
+	}()
+
+	// read all column names
+	for rows.Next() {
+		var column string
+
+		err := rows.Scan(&column)
+		if err != nil {
+			return columns, err
+		}
+		columns = append(columns, column)
+	}
+
+	return columns, nil
+}
+
+// orderingColumns method returns list of columns used to order rows read from
+// given table. Ordering configured for the table takes precedence over the
+// primary key read from database. Configured columns are checked against
+// columns of the table, because they are inserted into SQL statement.
+func (storage DBStorage) orderingColumns(ctx context.Context, tableName TableName) ([]string, error) {
+	if ordering, found := storage.config.TableOrdering[string(tableName)]; found {
+		columnTypes, err := storage.RetrieveColumnTypes(ctx, tableName)
+		if err != nil {
+			return nil, err
+		}
+		existing := getColumnNames(columnTypes)
+
+		var columns []string
+		for _, column := range strings.Split(ordering, ",") {
+			column = strings.TrimSpace(column)
+			if column == "" {
+				continue
+			}
+			if !slices.Contains(existing, column) {
+				err := fmt.Errorf(unknownOrderingColumn, column, tableName)
+				log.Error().Err(err).Str(tableNameMsg, string(tableName)).Msg("Invalid table ordering")
+				return nil, err
+			}
+			columns = append(columns, column)
+		}
+		return columns, nil
+	}
+
+	return storage.ReadPrimaryKey(ctx, tableName)
+}
+
+// applyOrdering method appends ORDER BY clause to given SQL statement so the
+// rows are always read in the same order. When the table has no primary key
+// and no ordering is configured for it, all columns that can be compared are
+// used instead.
+func (storage DBStorage) applyOrdering(ctx context.Context, sqlStatement *string, tableName TableName) error {
+	columns, err := storage.orderingColumns(ctx, tableName)
+	if err != nil {
+		return err
+	}
+
+	if len(columns) == 0 {
+		log.Warn().
+			Str(tableNameMsg, string(tableName)).
+			Msg("Table has no primary key, ordering by all columns")
+
+		columns, err = storage.comparableColumns(ctx, tableName)
+		if err != nil {
+			return err
+		}
+	}
+
+	if len(columns) > 0 {
+		*sqlStatement += fmt.Sprintf(orderByClause, strings.Join(columns, ", "))
+	}
+	return nil
+}
+
+// comparableColumns method returns positional references to all columns of
+// given table that can be compared. Row identifier is returned when there is
+// no such column, for example for tables with json columns only.
+func (storage DBStorage) comparableColumns(ctx context.Context, tableName TableName) ([]string, error) {
+	columnTypes, err := storage.RetrieveColumnTypes(ctx, tableName)
+	if err != nil {
+		return nil, err
+	}
+
+	// positional references are understood by all supported databases
+	var columns []string
+	for i, columnType := range columnTypes {
+		if storage.dbDriverType == DBDriverPostgres &&
+			unorderableTypesInPostgres[columnType.DatabaseTypeName()] {
+			continue
+		}
+		columns = append(columns, strconv.Itoa(i+1))
+	}
+	if len(columns) > 0 {
+		return columns, nil
+	}
+
+	rowID, err := storage.rowIdentifier(ctx, tableName)
+	if err != nil || rowID == "" {
+		return nil, err
+	}
+	return []string{rowID}, nil
+}
+
+// retry method performs given operation with retry policy set for storage.
+// Number of retries is recorded for given table. The operation is traced, so
+// context passed to the function performs queries within the operation span.
+func (storage DBStorage) retry(ctx context.Context, tableName TableName, operation string, function func(ctx context.Context) error) error {
+	ctx, span := startSpan(ctx, operation,
+		attribute.String(tableAttribute, string(tableName)),
+		attribute.String(dbSystemAttribute, storage.dbSystem()))
+
+	retries, err := storage.retryPolicy.Do(ctx, operation, func() error {
+		return function(ctx)
+	})
+	storage.retryStats.Add(tableName, retries)
+
+	span.SetAttributes(attribute.Int(retriesAttribute, retries))
+	endSpan(span, err)
+	return err
+}
+
+// query method performs given SQL statement with retry policy set for
+// storage, so the statement is traced and retried when transient error
+// occurs. Returned rows are read by caller.
+func (storage DBStorage) query(ctx context.Context, tableName TableName, operation string,
+	sqlStatement string, args ...interface{}) (*sql.Rows, error) {
+	var rows *sql.Rows
+	err := storage.retry(ctx, tableName, operation, func(ctx context.Context) error {
+		setSpanAttributes(ctx, attribute.String(statementAttribute, sqlStatement))
+
+		var err error
+		rows, err = storage.connection.QueryContext(ctx, sqlStatement, args...)
+		return err
+	})
+	return rows, err
+}
+
+// queryRow method performs given SQL statement with retry policy set for
+// storage and scans the only returned row into given destinations.
+func (storage DBStorage) queryRow(ctx context.Context, tableName TableName, operation string,
+	sqlStatement string, args []interface{}, destinations ...interface{}) error {
+	return storage.retry(ctx, tableName, operation, func(ctx context.Context) error {
+		setSpanAttributes(ctx, attribute.String(statementAttribute, sqlStatement))
+		return storage.connection.QueryRowContext(ctx, sqlStatement, args...).Scan(destinations...)
+	})
+}
+
+// dbSystem method returns name of database system used in traces.
+func (storage DBStorage) dbSystem() string {
+	switch storage.dbDriverType {
+	case DBDriverSQLite3:
+		return "sqlite"
+	case DBDriverPostgres:
+		return "postgresql"
+	default:
+		return "other_sql"
+	}
+}
+
+// Stats method returns number of rows and bytes exported from given table
+// under given prefix (directory or prefix of S3 object).
+func (storage DBStorage) Stats(prefix string, tableName TableName) TableStats {
+	return storage.exportStats.Get(prefix, tableName)
+}
+
+// Retries method returns number of retries performed for given table.
+func (storage DBStorage) Retries(tableName TableName) int {
+	return storage.retryStats.Retries(tableName)
+}
@@ -23,9 +23,14 @@ package main_test
 // https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/storage_test.html
 
 import (
+	"context"
 	"errors"
+	"net"
 	"os"
+	"path/filepath"
+	"strings"
 	"testing"
+	"time"
 
 	"database/sql"
 
@@ -56,18 +61,45 @@ var testConfig = main.StorageConfiguration{
 
 // TestNewStorage checks whether constructor for new storage returns error for improper storage configuration
 func TestNewStorageError(t *testing.T) {
-	_, err := main.NewStorage(&main.StorageConfiguration{
+	_, err := main.NewStorage(context.Background(), &main.StorageConfiguration{
 		Driver: "non existing driver",
-	})
+	}, main.RetryPolicy{})
 	assert.EqualError(t, err, "driver non existing driver is not supported")
 }
 
 // TestNewStoragePostgreSQL function tests creating new storage with logs
 func TestNewStoragePostgreSQL(t *testing.T) {
-	_, err := main.NewStorage(&testConfig)
+	_, err := main.NewStorage(context.Background(), &testConfig, main.RetryPolicy{})
 
-	// we just happen to make connection without trying to actually connect
-	assert.Nil(t, err)
+	// connection is checked, but the database does not exist
+	assert.Error(t, err)
+}
+
+// TestNewStoragePingRetry checks that connection to database that is not
+// available is retried
+func TestNewStoragePingRetry(t *testing.T) {
+	// port that refuses connections
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	port := listener.Addr().(*net.TCPAddr).Port
+	assert.NoError(t, listener.Close())
+
+	cfg := testConfig
+	cfg.PGHost = "127.0.0.1"
+	cfg.PGPort = port
+
+	origLogger := log.Logger
+	t.Cleanup(func() { log.Logger = origLogger })
+
+	output, err := capture.ErrorOutput(func() {
+		log.Logger = log.Output(zerolog.New(os.Stderr))
+		_, storageErr := main.NewStorage(context.Background(), &cfg, testRetryPolicy)
+		assert.Error(t, storageErr)
+	})
+	checkCapture(t, err)
+
+	// three attempts mean two retries
+	assert.Equal(t, 2, strings.Count(output, "Transient error, operation will be retried"))
 }
 
 // TestNewStorageDoesNotLogPassword ensures the PostgreSQL password is never
@@ -82,8 +114,8 @@ func TestNewStorageDoesNotLogPassword(t *testing.T) {
 
 	output, err := capture.ErrorOutput(func() {
 		log.Logger = log.Output(zerolog.New(os.Stderr))
-		_, storageErr := main.NewStorage(&cfg)
-		assert.Nil(t, storageErr)
+		// database does not exist, but connection is logged
+		_, _ = main.NewStorage(context.Background(), &cfg, main.RetryPolicy{})
 	})
 	checkCapture(t, err)
 
@@ -93,10 +125,10 @@ func TestNewStorageDoesNotLogPassword(t *testing.T) {
 
 // TestNewStorageSQLite3 function tests creating new storage with logs
 func TestNewStorageSQLite3(t *testing.T) {
-	_, err := main.NewStorage(&main.StorageConfiguration{
+	_, err := main.NewStorage(context.Background(), &main.StorageConfiguration{
 		Driver:        "sqlite3",
 		LogSQLQueries: true,
-	})
+	}, main.RetryPolicy{})
 
 	// we just happen to make connection without trying to actually connect
 	assert.Nil(t, err)
@@ -104,10 +136,10 @@ func TestNewStorageSQLite3(t *testing.T) {
 
 // TestClose function tests database close operation.
 func TestClose(t *testing.T) {
-	storage, err := main.NewStorage(&main.StorageConfiguration{
+	storage, err := main.NewStorage(context.Background(), &main.StorageConfiguration{
 		Driver:        "sqlite3",
 		LogSQLQueries: true,
-	})
+	}, main.RetryPolicy{})
 
 	// we just happen to make connection without trying to actually connect
 	assert.Nil(t, err)
@@ -160,7 +192,9 @@ func checkAllExpectations(t *testing.T, mock sqlmock.Sqlmock) {
 // Expected queries
 const (
 	readRecordCountQuery          = "SELECT count\\(\\*\\) FROM TESTED_TABLE"
-	readDisabledRulesQuery        = "SELECT rule_id, count\\(rule_id\\) AS rule_count FROM rule_disable GROUP BY rule_id HAVING count\\(rule_id\\)\\>1 ORDER BY rule_count DESC;"
+	readDisabledRulesQuery        = "SELECT rule_id, error_key, count\\(rule_id\\) AS rule_count, .* FROM rule_disable( WHERE org_id IN \\(.*\\))? GROUP BY rule_id, error_key HAVING count\\(rule_id\\)>=\\$2 ORDER BY rule_count DESC, rule_id, error_key;"
+	readClusterRuleTogglesQuery   = "SELECT rule_id, error_key, count\\(\\*\\) FROM cluster_rule_toggle WHERE disabled = 1 GROUP BY rule_id, error_key"
+	readRuleDisableFeedbacksQuery = "SELECT rule_id, error_key, count\\(\\*\\) FROM cluster_user_rule_disable_feedback GROUP BY rule_id, error_key"
 	readListOfTablesQueryPostgres = `
            SELECT tablename
              FROM pg_catalog.pg_tables
@@ -177,8 +211,19 @@ const (
 `
 	readTableQuery       = "SELECT \\* FROM table_name"
 	readColumnTypesQuery = "SELECT \\* FROM table_name LIMIT 1"
+	readPrimaryKeyQuery  = "SELECT a.attname FROM pg_index i"
 )
 
+// expectPrimaryKeyQuery function registers expected query that reads primary
+// key of given table together with mocked result.
+func expectPrimaryKeyQuery(mock sqlmock.Sqlmock, tableName string, columns ...string) {
+	rows := sqlmock.NewRows([]string{"attname"})
+	for _, column := range columns {
+		rows.AddRow(column)
+	}
+	mock.ExpectQuery(readPrimaryKeyQuery).WithArgs(tableName).WillReturnRows(rows)
+}
+
 // check the function ReadRecordCount
 func TestReadRecordCount(t *testing.T) {
 	// prepare new mocked connection to database
@@ -197,7 +242,7 @@ func TestReadRecordCount(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
 
 	// call the tested method
-	count, err := storage.ReadRecordsCount("TESTED_TABLE")
+	count, err := storage.ReadRecordsCount(context.Background(), "TESTED_TABLE")
 	if err != nil {
 		t.Errorf("error was not expected %s", err)
 	}
@@ -229,7 +274,7 @@ func TestReadRecordCountScanError(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
 
 	// call the tested method
-	_, err := storage.ReadRecordsCount("TESTED_TABLE")
+	_, err := storage.ReadRecordsCount(context.Background(), "TESTED_TABLE")
 	if err == nil {
 		t.Errorf("error is expected")
 	}
@@ -256,7 +301,7 @@ func TestReadRecordCountOnError(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
 
 	// call the tested method
-	count, err := storage.ReadRecordsCount("TESTED_TABLE")
+	count, err := storage.ReadRecordsCount(context.Background(), "TESTED_TABLE")
 	if err != mockedError {
 		t.Errorf("different error was returned: %v", err)
 	}
@@ -294,7 +339,7 @@ func TestReadRecordCountSelectiveExportDisallowedTable(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, config)
 
 	// call the tested method
-	count, err := storage.ReadRecordsCount("TESTED_TABLE")
+	count, err := storage.ReadRecordsCount(context.Background(), "TESTED_TABLE")
 	if err != nil {
 		t.Errorf("error was not expected %s", err)
 	}
@@ -333,7 +378,7 @@ func TestReadRecordCountSelectiveExportAllowedTableSingleOrgID(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, config)
 
 	// call the tested method
-	count, err := storage.ReadRecordsCount("report")
+	count, err := storage.ReadRecordsCount(context.Background(), "report")
 	if err != nil {
 		t.Errorf("error was not expected %s", err)
 	}
@@ -372,7 +417,7 @@ func TestReadRecordCountSelectiveExportAllowedTable(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, config)
 
 	// call the tested method
-	count, err := storage.ReadRecordsCount("report")
+	count, err := storage.ReadRecordsCount(context.Background(), "report")
 	if err != nil {
 		t.Errorf("error was not expected %s", err)
 	}
@@ -407,7 +452,7 @@ func TestReadListOfTables(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
 
 	// call the tested method
-	tableNames, err := storage.ReadListOfTables()
+	tableNames, err := storage.ReadListOfTables(context.Background())
 	if err != nil {
 		t.Errorf("error was not expected %s", err)
 	}
@@ -442,7 +487,7 @@ func TestReadListOfTablesSQLiteDriver(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &testConfig)
 
 	// call the tested method
-	tableNames, err := storage.ReadListOfTables()
+	tableNames, err := storage.ReadListOfTables(context.Background())
 	if err != nil {
 		t.Errorf("error was not expected %s", err)
 	}
@@ -467,7 +512,7 @@ func TestReadListOfTablesInvalidDriver(t *testing.T) {
 	storage := main.NewFromConnection(connection, 2+main.DBDriverSQLite3, &testConfig)
 
 	// call the tested method
-	_, err := storage.ReadListOfTables()
+	_, err := storage.ReadListOfTables(context.Background())
 	if err == nil {
 		t.Errorf("error was expected")
 	}
@@ -492,7 +537,7 @@ func TestReadListOfTablesOnError(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
 
 	// call the tested method
-	_, err := storage.ReadListOfTables()
+	_, err := storage.ReadListOfTables(context.Background())
 	if err != mockedError {
 		t.Errorf("different error was returned: %v", err)
 	}
@@ -523,7 +568,7 @@ func TestReadListOfTablesScanError(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
 
 	// call the tested method
-	_, err := storage.ReadListOfTables()
+	_, err := storage.ReadListOfTables(context.Background())
 	if err == nil {
 		t.Errorf("error is expected")
 	}
@@ -554,6 +599,7 @@ func TestReadTable(t *testing.T) {
 	rows.AddRow(3, 2.0, "baz", true)
 
 	// expected query performed by tested function
+	expectPrimaryKeyQuery(mock, "table_name", "id")
 	mock.ExpectQuery(readTableQuery).WillReturnRows(rows)
 	mock.ExpectClose()
 
@@ -561,7 +607,7 @@ func TestReadTable(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
 
 	// call the tested method
-	values, err := storage.ReadTable("table_name", NoLimits)
+	values, err := storage.ReadTable(context.Background(), "table_name", NoLimits)
 	if err != nil {
 		t.Errorf("error was not expected %s", err)
 	}
@@ -602,14 +648,15 @@ func TestReadTableWithLimits(t *testing.T) {
 	rows.AddRow(2, 1.5, "bar", false)
 
 	// expected query performed by tested function
-	mock.ExpectQuery(readTableQuery + " LIMIT 2").WillReturnRows(rows)
+	expectPrimaryKeyQuery(mock, "table_name", "id")
+	mock.ExpectQuery(readTableQuery + " ORDER BY id LIMIT 2").WillReturnRows(rows)
 	mock.ExpectClose()
 
 	// prepare connection to mocked database
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
 
 	// call the tested method
-	values, err := storage.ReadTable("table_name", 2)
+	values, err := storage.ReadTable(context.Background(), "table_name", 2)
 	if err != nil {
 		t.Errorf("error was not expected %s", err)
 	}
@@ -652,6 +699,7 @@ func TestReadTableWithSelectiveExportDisallowedTable(t *testing.T) {
 	rows.AddRow(2, 1.5, "bar", false)
 
 	// expected query performed by tested function
+	expectPrimaryKeyQuery(mock, "table_name", "id")
 	mock.ExpectQuery(readTableQuery).WillReturnRows(rows)
 	mock.ExpectClose()
 
@@ -659,7 +707,7 @@ func TestReadTableWithSelectiveExportDisallowedTable(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, config)
 
 	// call the tested method, table name must be in predefined list
-	values, err := storage.ReadTable("table_name", NoLimits)
+	values, err := storage.ReadTable(context.Background(), "table_name", NoLimits)
 	if err != nil {
 		t.Errorf("error was not expected %s", err)
 	}
@@ -702,6 +750,7 @@ func TestReadTableWithSelectiveExportAllowedTableSingleOrgID(t *testing.T) {
 	rows.AddRow(2, 1.5, "bar", false)
 
 	// expected query performed by tested function
+	expectPrimaryKeyQuery(mock, "report", "id")
 	mock.ExpectQuery("SELECT \\* FROM report WHERE org_id IN \\('1'\\)").WillReturnRows(rows)
 	mock.ExpectClose()
 
@@ -709,7 +758,7 @@ func TestReadTableWithSelectiveExportAllowedTableSingleOrgID(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, config)
 
 	// call the tested method, table name must be in predefined list
-	values, err := storage.ReadTable("report", NoLimits)
+	values, err := storage.ReadTable(context.Background(), "report", NoLimits)
 	if err != nil {
 		t.Errorf("error was not expected %s", err)
 	}
@@ -752,6 +801,7 @@ func TestReadTableWithSelectiveExportAllowedTable(t *testing.T) {
 	rows.AddRow(2, 1.5, "bar", false)
 
 	// expected query performed by tested function
+	expectPrimaryKeyQuery(mock, "report", "id")
 	mock.ExpectQuery("SELECT \\* FROM report WHERE org_id IN \\('1','42'\\)").WillReturnRows(rows)
 	mock.ExpectClose()
 
@@ -759,7 +809,7 @@ func TestReadTableWithSelectiveExportAllowedTable(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, config)
 
 	// call the tested method, table name must be in predefined list
-	values, err := storage.ReadTable("report", NoLimits)
+	values, err := storage.ReadTable(context.Background(), "report", NoLimits)
 	if err != nil {
 		t.Errorf("error was not expected %s", err)
 	}
@@ -802,14 +852,15 @@ func TestReadTableWithSelectiveExportAllowedTableWithLimits(t *testing.T) {
 	rows.AddRow(2, 1.5, "bar", false)
 
 	// expected query performed by tested function
-	mock.ExpectQuery("SELECT \\* FROM report WHERE org_id IN \\('1','42'\\) LIMIT 2").WillReturnRows(rows)
+	expectPrimaryKeyQuery(mock, "report", "id")
+	mock.ExpectQuery("SELECT \\* FROM report WHERE org_id IN \\('1','42'\\) ORDER BY id LIMIT 2").WillReturnRows(rows)
 	mock.ExpectClose()
 
 	// prepare connection to mocked database
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, config)
 
 	// call the tested method, table name must be in predefined list, limit == 2
-	values, err := storage.ReadTable("report", 2)
+	values, err := storage.ReadTable(context.Background(), "report", 2)
 	if err != nil {
 		t.Errorf("error was not expected %s", err)
 	}
@@ -839,6 +890,7 @@ func TestReadTableOnError(t *testing.T) {
 	connection, mock := mustCreateMockConnection(t)
 
 	// expected query performed by tested function
+	expectPrimaryKeyQuery(mock, "table_name", "id")
 	mock.ExpectQuery(readTableQuery).WillReturnError(mockedError)
 	mock.ExpectClose()
 
@@ -846,7 +898,7 @@ func TestReadTableOnError(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
 
 	// call the tested method
-	_, err := storage.ReadTable("table_name", NoLimits)
+	_, err := storage.ReadTable(context.Background(), "table_name", NoLimits)
 	if err != mockedError {
 		t.Errorf("different error was returned: %v", err)
 	}
@@ -883,7 +935,7 @@ func TestRetrieveColumnTypes(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
 
 	// call the tested method
-	types, err := storage.RetrieveColumnTypes("table_name")
+	types, err := storage.RetrieveColumnTypes(context.Background(), "table_name")
 	if err != nil {
 		t.Errorf("error was not expected %s", err)
 	}
@@ -919,7 +971,7 @@ func TestRetrieveColumnTypesOnError(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
 
 	// call the tested method
-	_, err := storage.RetrieveColumnTypes("table_name")
+	_, err := storage.RetrieveColumnTypes(context.Background(), "table_name")
 
 	if err != mockedError {
 		t.Errorf("different error was returned: %v", err)
@@ -932,7 +984,7 @@ func TestRetrieveColumnTypesOnError(t *testing.T) {
 	checkAllExpectations(t, mock)
 }
 
-// check the function StoreTableIntoFile
+// check the method StoreTable with file sink
 func TestStoreTableIntoFile(t *testing.T) {
 	// prepare new mocked connection to database
 	connection, mock := mustCreateMockConnection(t)
@@ -953,6 +1005,7 @@ func TestStoreTableIntoFile(t *testing.T) {
 	mock.ExpectQuery(readColumnTypesQuery).WillReturnRows(rows)
 
 	// expected query performed by tested function
+	expectPrimaryKeyQuery(mock, "table_name", "id")
 	expectedQuery2 := "SELECT \\* FROM table_name"
 
 	mock.ExpectQuery(expectedQuery2).WillReturnRows(rows)
@@ -962,7 +1015,8 @@ func TestStoreTableIntoFile(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
 
 	// call the tested method
-	err := storage.StoreTableIntoFile("table_name", NoLimits)
+	directory := t.TempDir()
+	err := storage.StoreTable(context.Background(), main.NewFileSink(directory, false), "", "table_name", NoLimits)
 	if err != nil {
 		t.Errorf("error was not expected %s", err)
 	}
@@ -974,7 +1028,7 @@ func TestStoreTableIntoFile(t *testing.T) {
 	checkAllExpectations(t, mock)
 
 	// check generated file
-	content, err := os.ReadFile("table_name.csv")
+	content, err := os.ReadFile(filepath.Join(directory, "table_name.csv"))
 	if err != nil {
 		t.Errorf("error during reading file %s", err)
 	}
@@ -987,7 +1041,7 @@ func TestStoreTableIntoFile(t *testing.T) {
 	assert.Equal(t, expected, string(content))
 }
 
-// check the function StoreTableIntoFile
+// check the method StoreTable with file sink
 func TestStoreTableIntoFileWithLimit(t *testing.T) {
 	// prepare new mocked connection to database
 	connection, mock := mustCreateMockConnection(t)
@@ -1007,7 +1061,8 @@ func TestStoreTableIntoFileWithLimit(t *testing.T) {
 	mock.ExpectQuery(readColumnTypesQuery).WillReturnRows(rows)
 
 	// expected query performed by tested function
-	expectedQuery2 := "SELECT \\* FROM table_name LIMIT 2"
+	expectPrimaryKeyQuery(mock, "table_name", "id")
+	expectedQuery2 := "SELECT \\* FROM table_name ORDER BY id LIMIT 2"
 
 	mock.ExpectQuery(expectedQuery2).WillReturnRows(rows)
 	mock.ExpectClose()
@@ -1016,7 +1071,8 @@ func TestStoreTableIntoFileWithLimit(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
 
 	// call the tested method
-	err := storage.StoreTableIntoFile("table_name", 2)
+	directory := t.TempDir()
+	err := storage.StoreTable(context.Background(), main.NewFileSink(directory, false), "", "table_name", 2)
 	if err != nil {
 		t.Errorf("error was not expected %s", err)
 	}
@@ -1028,7 +1084,7 @@ func TestStoreTableIntoFileWithLimit(t *testing.T) {
 	checkAllExpectations(t, mock)
 
 	// check generated file
-	content, err := os.ReadFile("table_name.csv")
+	content, err := os.ReadFile(filepath.Join(directory, "table_name.csv"))
 	if err != nil {
 		t.Errorf("error during reading file %s", err)
 	}
@@ -1040,42 +1096,73 @@ func TestStoreTableIntoFileWithLimit(t *testing.T) {
 	assert.Equal(t, expected, string(content))
 }
 
+// expectClusterDisablesTables helper function sets expectation for query
+// that reads list of tables containing both tables with rules disabled for
+// single clusters
+func expectClusterDisablesTables(mock sqlmock.Sqlmock) {
+	tables := sqlmock.NewRows([]string{"table"})
+	tables.AddRow("cluster_rule_toggle")
+	tables.AddRow("cluster_user_rule_disable_feedback")
+	mock.ExpectQuery(readListOfTablesQueryPostgres).WillReturnRows(tables)
+}
+
 // check the function ReadDisabledRules
 func TestReadDisabledRules(t *testing.T) {
 	// prepare new mocked connection to database
 	connection, mock := mustCreateMockConnection(t)
 
-	// prepare mocked result for SQL query
-	rows := sqlmock.NewRows([]string{"rule", "count"})
-	rows.AddRow("rule1", 1)
-	rows.AddRow("rule2", 2)
-	rows.AddRow("rule3", 3)
+	since := time.Date(2021, 9, 1, 0, 0, 0, 0, time.UTC)
 
-	// expected query performed by tested function
-	mock.ExpectQuery(readDisabledRulesQuery).WillReturnRows(rows)
+	// prepare mocked result for SQL query
+	rows := sqlmock.NewRows([]string{"rule", "error_key", "count", "orgs",
+		"first", "last", "window", "empty"})
+	rows.AddRow("rule1", "KEY1", 3, 2, "2021-09-20T00:00:00Z", "2021-09-27T00:00:00Z", 1, 1)
+	rows.AddRow("rule2", "KEY2", 2, 1, "2021-09-27T00:00:00Z", "2021-09-27T00:00:00Z", 2, 0)
+	rows.AddRow("rule3", "KEY3", 2, 2, nil, nil, 0, 2)
+
+	toggles := sqlmock.NewRows([]string{"rule", "error_key", "count"})
+	toggles.AddRow("rule1", "KEY1", 5)
+	toggles.AddRow("rule1", "OTHER", 7)
+
+	feedbacks := sqlmock.NewRows([]string{"rule", "error_key", "count"})
+	feedbacks.AddRow("rule2", "KEY2", 4)
+
+	// expected queries performed by tested function
+	mock.ExpectQuery(readDisabledRulesQuery).WithArgs(since, 2).WillReturnRows(rows)
+	expectClusterDisablesTables(mock)
+	mock.ExpectQuery(readClusterRuleTogglesQuery).WillReturnRows(toggles)
+	mock.ExpectQuery(readRuleDisableFeedbacksQuery).WillReturnRows(feedbacks)
 	mock.ExpectClose()
 
 	// prepare connection to mocked database
-	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
+	// filter by organizations is not used
+	config := testConfig
+	config.EnableOrgIDFiltering = false
+	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &config)
 
 	// call the tested method
-	results, err := storage.ReadDisabledRules()
+	results, err := storage.ReadDisabledRules(context.Background(), 2, since)
 	if err != nil {
 		t.Errorf("error was not expected %s", err)
 	}
 
-	if len(results) != 3 {
-		t.Errorf("wrong number records returned: %d", len(results))
-	}
-
 	// check the list of returned records
-	assert.Equal(t, "rule1", results[0].Rule)
-	assert.Equal(t, "rule2", results[1].Rule)
-	assert.Equal(t, "rule3", results[2].Rule)
-
-	assert.Equal(t, 1, results[0].Count)
-	assert.Equal(t, 2, results[1].Count)
-	assert.Equal(t, 3, results[2].Count)
+	assert.Equal(t, []main.DisabledRuleInfo{
+		{
+			Rule: "rule1", ErrorKey: "KEY1", Count: 3, Orgs: 2,
+			FirstDisabledAt: "2021-09-20T00:00:00Z", LastDisabledAt: "2021-09-27T00:00:00Z",
+			CountInWindow: 1, EmptyJustifications: 1, ClusterToggles: 5,
+		},
+		{
+			Rule: "rule2", ErrorKey: "KEY2", Count: 2, Orgs: 1,
+			FirstDisabledAt: "2021-09-27T00:00:00Z", LastDisabledAt: "2021-09-27T00:00:00Z",
+			CountInWindow: 2, Feedbacks: 4,
+		},
+		{
+			Rule: "rule3", ErrorKey: "KEY3", Count: 2, Orgs: 2,
+			EmptyJustifications: 2,
+		},
+	}, results)
 
 	// connection to mocked DB needs to be closed properly
 	checkConnectionClose(t, connection)
@@ -1100,7 +1187,7 @@ func TestReadDisabledRulesOnError(t *testing.T) {
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
 
 	// call the tested method
-	_, err := storage.ReadDisabledRules()
+	_, err := storage.ReadDisabledRules(context.Background(), 2, time.Now())
 
 	if err != mockedError {
 		t.Errorf("different error was returned: %v", err)
@@ -1119,21 +1206,21 @@ func TestReadDisabledRulesScanError(t *testing.T) {
 	connection, mock := mustCreateMockConnection(t)
 
 	// prepare mocked result for SQL query
-	rows := sqlmock.NewRows([]string{"rule", "count"})
-	rows.AddRow("rule1", "not count")
-	rows.AddRow("rule2", "not count")
-	rows.AddRow("rule3", "not count")
+	rows := sqlmock.NewRows([]string{"rule", "error_key", "count", "orgs",
+		"first", "last", "window", "empty"})
+	rows.AddRow("rule1", "KEY1", "not count", 1, nil, nil, 0, 0)
+	rows.AddRow("rule2", "KEY2", "not count", 1, nil, nil, 0, 0)
+	rows.AddRow("rule3", "KEY3", "not count", 1, nil, nil, 0, 0)
 
 	// expected query performed by tested function
-	expectedQuery := "SELECT rule_id, count\\(rule_id\\) AS rule_count FROM rule_disable GROUP BY rule_id HAVING count\\(rule_id\\)\\>1 ORDER BY rule_count DESC;"
-	mock.ExpectQuery(expectedQuery).WillReturnRows(rows)
+	mock.ExpectQuery(readDisabledRulesQuery).WillReturnRows(rows)
 	mock.ExpectClose()
 
 	// prepare connection to mocked database
 	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
 
 	// call the tested method
-	_, err := storage.ReadDisabledRules()
+	_, err := storage.ReadDisabledRules(context.Background(), 2, time.Now())
 	if err == nil {
 		t.Errorf("error was expected")
 	}
@@ -1144,3 +1231,310 @@ func TestReadDisabledRulesScanError(t *testing.T) {
 	// check if all expectations were met
 	checkAllExpectations(t, mock)
 }
+
+// check the function ReadDisabledRules when rules disabled for single
+// clusters can't be read
+func TestReadDisabledRulesClusterDisablesError(t *testing.T) {
+	// error to be thrown
+	mockedError := errors.New("mocked error")
+
+	// prepare new mocked connection to database
+	connection, mock := mustCreateMockConnection(t)
+
+	rows := sqlmock.NewRows([]string{"rule", "error_key", "count", "orgs",
+		"first", "last", "window", "empty"})
+	rows.AddRow("rule1", "KEY1", 3, 2, nil, nil, 0, 0)
+
+	// expected queries performed by tested function
+	mock.ExpectQuery(readDisabledRulesQuery).WillReturnRows(rows)
+	expectClusterDisablesTables(mock)
+	mock.ExpectQuery(readClusterRuleTogglesQuery).WillReturnError(mockedError)
+	mock.ExpectClose()
+
+	// prepare connection to mocked database
+	// filter by organizations is not used
+	config := testConfig
+	config.EnableOrgIDFiltering = false
+	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &config)
+
+	// call the tested method
+	_, err := storage.ReadDisabledRules(context.Background(), 2, time.Now())
+	assert.Equal(t, mockedError, err)
+
+	// connection to mocked DB needs to be closed properly
+	checkConnectionClose(t, connection)
+
+	// check if all expectations were met
+	checkAllExpectations(t, mock)
+}
+
+// check the function ReadPrimaryKey
+func TestReadPrimaryKey(t *testing.T) {
+	// prepare new mocked connection to database
+	connection, mock := mustCreateMockConnection(t)
+
+	// expected query performed by tested function
+	expectPrimaryKeyQuery(mock, "report", "org_id", "cluster")
+	mock.ExpectClose()
+
+	// prepare connection to mocked database
+	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
+
+	// call the tested method
+	columns, err := storage.ReadPrimaryKey(context.Background(), "report")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"org_id", "cluster"}, columns)
+
+	// connection to mocked DB needs to be closed properly
+	checkConnectionClose(t, connection)
+
+	// check if all expectations were met
+	checkAllExpectations(t, mock)
+}
+
+// mustCreateSQLiteConnection function creates a new connection to in-memory
+// SQLite database and performs all given statements to prepare its content.
+func mustCreateSQLiteConnection(t *testing.T, statements ...string) *sql.DB {
+	connection, err := sql.Open("sqlite3", ":memory:")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// in-memory database exists only within one connection
+	connection.SetMaxOpenConns(1)
+
+	for _, statement := range statements {
+		_, err = connection.Exec(statement)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return connection
+}
+
+// check the function ReadPrimaryKey against real SQLite database
+func TestReadPrimaryKeySQLite(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t,
+		"CREATE TABLE t (a INTEGER, b TEXT, c TEXT, PRIMARY KEY (b, a))")
+
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &testConfig)
+
+	// call the tested method
+	columns, err := storage.ReadPrimaryKey(context.Background(), "t")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"b", "a"}, columns)
+
+	checkConnectionClose(t, connection)
+}
+
+// check the function ReadPrimaryKey for unsupported driver
+func TestReadPrimaryKeyInvalidDriver(t *testing.T) {
+	// prepare new mocked connection to database
+	connection, mock := mustCreateMockConnection(t)
+
+	// prepare connection to mocked database
+	storage := main.NewFromConnection(connection, 2+main.DBDriverSQLite3, &testConfig)
+
+	// call the tested method
+	_, err := storage.ReadPrimaryKey(context.Background(), "report")
+	assert.Error(t, err)
+
+	// check if all expectations were met
+	checkAllExpectations(t, mock)
+}
+
+// check the function ReadTable when primary key can not be read
+func TestReadTablePrimaryKeyOnError(t *testing.T) {
+	// error to be thrown
+	mockedError := errors.New("mocked error")
+
+	// prepare new mocked connection to database
+	connection, mock := mustCreateMockConnection(t)
+
+	// expected query performed by tested function
+	mock.ExpectQuery(readPrimaryKeyQuery).WillReturnError(mockedError)
+	mock.ExpectClose()
+
+	// prepare connection to mocked database
+	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
+
+	// call the tested method
+	_, err := storage.ReadTable(context.Background(), "table_name", NoLimits)
+	assert.Equal(t, mockedError, err)
+
+	// connection to mocked DB needs to be closed properly
+	checkConnectionClose(t, connection)
+
+	// check if all expectations were met
+	checkAllExpectations(t, mock)
+}
+
+// check the function ReadTable for table without primary key
+func TestReadTableNoPrimaryKey(t *testing.T) {
+	// prepare new mocked connection to database
+	connection, mock := mustCreateMockConnection(t)
+
+	column1 := sqlmock.NewColumn("version").OfType("INT4", int64(0))
+	column2 := sqlmock.NewColumn("text").OfType("VARCHAR", "")
+
+	// expected queries performed by tested function
+	expectPrimaryKeyQuery(mock, "table_name")
+	mock.ExpectQuery(readColumnTypesQuery).
+		WillReturnRows(mock.NewRowsWithColumnDefinition(column1, column2))
+	mock.ExpectQuery(readTableQuery + " ORDER BY 1, 2").
+		WillReturnRows(mock.NewRowsWithColumnDefinition(column1, column2).AddRow(23, "foo"))
+	mock.ExpectClose()
+
+	// prepare connection to mocked database
+	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
+
+	// call the tested method
+	values, err := storage.ReadTable(context.Background(), "table_name", NoLimits)
+	assert.NoError(t, err)
+	assert.Len(t, values, 1)
+
+	// connection to mocked DB needs to be closed properly
+	checkConnectionClose(t, connection)
+
+	// check if all expectations were met
+	checkAllExpectations(t, mock)
+}
+
+// check the function ReadTable for table without primary key that contains
+// columns that can't be compared
+func TestReadTableNoPrimaryKeyJSONColumn(t *testing.T) {
+	// prepare new mocked connection to database
+	connection, mock := mustCreateMockConnection(t)
+
+	column1 := sqlmock.NewColumn("content").OfType("JSON", "")
+	column2 := sqlmock.NewColumn("version").OfType("INT4", int64(0))
+
+	// expected queries performed by tested function
+	expectPrimaryKeyQuery(mock, "table_name")
+	mock.ExpectQuery(readColumnTypesQuery).
+		WillReturnRows(mock.NewRowsWithColumnDefinition(column1, column2))
+	mock.ExpectQuery(readTableQuery + " ORDER BY 2$").
+		WillReturnRows(mock.NewRowsWithColumnDefinition(column1, column2).AddRow("{}", 23))
+	mock.ExpectClose()
+
+	// prepare connection to mocked database
+	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
+
+	// call the tested method
+	values, err := storage.ReadTable(context.Background(), "table_name", NoLimits)
+	assert.NoError(t, err)
+	assert.Len(t, values, 1)
+
+	// connection to mocked DB needs to be closed properly
+	checkConnectionClose(t, connection)
+
+	// check if all expectations were met
+	checkAllExpectations(t, mock)
+}
+
+// check the function ReadTable for table without primary key that contains
+// only columns that can't be compared
+func TestReadTableNoPrimaryKeyOnlyJSONColumns(t *testing.T) {
+	// prepare new mocked connection to database
+	connection, mock := mustCreateMockConnection(t)
+
+	column1 := sqlmock.NewColumn("content").OfType("JSON", "")
+	column2 := sqlmock.NewColumn("document").OfType("XML", "")
+
+	// expected queries performed by tested function
+	expectPrimaryKeyQuery(mock, "table_name")
+	mock.ExpectQuery(readColumnTypesQuery).
+		WillReturnRows(mock.NewRowsWithColumnDefinition(column1, column2))
+	mock.ExpectQuery(readTableQuery + " ORDER BY ctid").
+		WillReturnRows(mock.NewRowsWithColumnDefinition(column1, column2).AddRow("{}", "<a/>"))
+	mock.ExpectClose()
+
+	// prepare connection to mocked database
+	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &testConfig)
+
+	// call the tested method
+	values, err := storage.ReadTable(context.Background(), "table_name", NoLimits)
+	assert.NoError(t, err)
+	assert.Len(t, values, 1)
+
+	// connection to mocked DB needs to be closed properly
+	checkConnectionClose(t, connection)
+
+	// check if all expectations were met
+	checkAllExpectations(t, mock)
+}
+
+// check the function ReadTable when ordering is configured for the table
+func TestReadTableConfiguredOrdering(t *testing.T) {
+	config := testConfig
+	config.EnableOrgIDFiltering = false
+	config.TableOrdering = map[string]string{
+		"table_name": "text, id",
+	}
+
+	// prepare new mocked connection to database
+	connection, mock := mustCreateMockConnection(t)
+
+	column1 := sqlmock.NewColumn("id").OfType("INT4", int64(0))
+	column2 := sqlmock.NewColumn("text").OfType("VARCHAR", "")
+	rows := mock.NewRowsWithColumnDefinition(column1, column2)
+	rows.AddRow(2, "bar")
+	rows.AddRow(1, "foo")
+
+	// primary key is not read when ordering is configured, configured
+	// columns are checked instead
+	mock.ExpectQuery(readColumnTypesQuery).
+		WillReturnRows(mock.NewRowsWithColumnDefinition(column1, column2))
+	mock.ExpectQuery(readTableQuery + " ORDER BY text, id LIMIT 10").WillReturnRows(rows)
+	mock.ExpectClose()
+
+	// prepare connection to mocked database
+	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &config)
+
+	// call the tested method
+	values, err := storage.ReadTable(context.Background(), "table_name", 10)
+	assert.NoError(t, err)
+	assert.Len(t, values, 2)
+	assert.Equal(t, "bar", values[0]["text"])
+
+	// connection to mocked DB needs to be closed properly
+	checkConnectionClose(t, connection)
+
+	// check if all expectations were met
+	checkAllExpectations(t, mock)
+}
+
+// check the function ReadTable when ordering configured for the table refers
+// to column that does not exist
+func TestReadTableConfiguredOrderingUnknownColumn(t *testing.T) {
+	config := testConfig
+	config.EnableOrgIDFiltering = false
+	config.TableOrdering = map[string]string{
+		"table_name": "id; DROP TABLE table_name",
+	}
+
+	// prepare new mocked connection to database
+	connection, mock := mustCreateMockConnection(t)
+
+	column1 := sqlmock.NewColumn("id").OfType("INT4", int64(0))
+	column2 := sqlmock.NewColumn("text").OfType("VARCHAR", "")
+
+	// table is not read at all
+	mock.ExpectQuery(readColumnTypesQuery).
+		WillReturnRows(mock.NewRowsWithColumnDefinition(column1, column2))
+	mock.ExpectClose()
+
+	// prepare connection to mocked database
+	storage := main.NewFromConnection(connection, main.DBDriverPostgres, &config)
+
+	// call the tested method
+	_, err := storage.ReadTable(context.Background(), "table_name", 10)
+	assert.EqualError(t, err, "ordering column id; DROP TABLE table_name does not exist in table table_name")
+
+	// connection to mocked DB needs to be closed properly
+	checkConnectionClose(t, connection)
+
+	// check if all expectations were met
+	checkAllExpectations(t, mock)
+}
@@ -0,0 +1,395 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains subsetting engine used when only data for
+// selected organizations are exported. Filtering starts in tables that
+// contain org_id column and then follows foreign keys and configured
+// relationships, so all dependent rows (for example rows keyed by cluster
+// ID) are exported as well and no row refers to a row that has not been
+// exported.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/subset.html
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/rs/zerolog/log"
+)
+
+// SQL fragments used by subsetting engine
+const (
+	// condition used for tables that contain organization ID
+	orgIDCondition = "org_id IN ('%v')"
+
+	// condition used for tables that depend on other table
+	relationshipCondition = "%s IN (SELECT %s FROM %s WHERE %s)"
+
+	// separator used in relationship specification
+	relationshipSeparator = "->"
+
+	// separator of columns of composite key in relationship specification
+	columnSeparator = ","
+)
+
+// Messages
+const (
+	relationshipMsg         = "relationship"
+	subsetConditionMsg      = "Subset condition"
+	wrongRelationshipMsg    = "Wrong relationship specification"
+	unusableRelationshipMsg = "Relationship refers to unknown table or column, ignoring"
+)
+
+// Relationship represents dependency of child table on parent table: each
+// combination of values stored in child columns refers to the same
+// combination of values stored in parent columns. Composite keys have more
+// than one column.
+type Relationship struct {
+	Table         TableName
+	Columns       []string
+	ParentTable   TableName
+	ParentColumns []string
+}
+
+// String method returns relationship in the same format as used in
+// configuration.
+func (relationship Relationship) String() string {
+	return fmt.Sprintf("%s.%s%s%s.%s",
+		relationship.Table, strings.Join(relationship.Columns, columnSeparator),
+		relationshipSeparator,
+		relationship.ParentTable, strings.Join(relationship.ParentColumns, columnSeparator))
+}
+
+// parseRelationship function parses relationship specified in the format
+// "child_table.column->parent_table.column". Columns of composite keys are
+// separated by comma: "child_table.a,b->parent_table.x,y".
+func parseRelationship(specification string) (Relationship, error) {
+	var relationship Relationship
+
+	child, parent, found := strings.Cut(specification, relationshipSeparator)
+	if !found {
+		return relationship, fmt.Errorf("relationship '%s' does not contain '%s'",
+			specification, relationshipSeparator)
+	}
+
+	table, columns, err := parseTableColumns(child)
+	if err != nil {
+		return relationship, err
+	}
+
+	parentTable, parentColumns, err := parseTableColumns(parent)
+	if err != nil {
+		return relationship, err
+	}
+
+	if len(columns) != len(parentColumns) {
+		return relationship, fmt.Errorf("relationship '%s' has different number of columns",
+			specification)
+	}
+
+	relationship.Table = table
+	relationship.Columns = columns
+	relationship.ParentTable = parentTable
+	relationship.ParentColumns = parentColumns
+	return relationship, nil
+}
+
+// parseTableColumns helper function parses columns specified in the format
+// "table.column" or "table.column1,column2".
+func parseTableColumns(specification string) (TableName, []string, error) {
+	table, list, found := strings.Cut(strings.TrimSpace(specification), ".")
+	if !found || table == "" {
+		return "", nil, fmt.Errorf("column '%s' must be specified as table.column",
+			specification)
+	}
+
+	columns := strings.Split(list, columnSeparator)
+	for i, column := range columns {
+		columns[i] = strings.TrimSpace(column)
+		if columns[i] == "" {
+			return "", nil, fmt.Errorf("column '%s' must be specified as table.column",
+				specification)
+		}
+	}
+	return TableName(table), columns, nil
+}
+
+// readRelationships method returns all relationships between given tables
+// that are followed by subsetting engine: foreign keys read from database and
+// relationships specified in configuration.
+func (storage DBStorage) readRelationships(ctx context.Context, tableNames []TableName) ([]Relationship, error) {
+	var relationships []Relationship
+
+	for _, tableName := range tableNames {
+		foreignKeys, err := storage.readForeignKeys(ctx, tableName)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, foreignKey := range foreignKeys {
+			// SQLite does not return columns when primary key is
+			// referenced
+			if len(foreignKey.ReferencedColumns) == 0 {
+				continue
+			}
+			relationships = append(relationships, Relationship{
+				Table:         tableName,
+				Columns:       foreignKey.Columns,
+				ParentTable:   TableName(foreignKey.ReferencedTable),
+				ParentColumns: foreignKey.ReferencedColumns,
+			})
+		}
+	}
+
+	for _, specification := range storage.config.Relationships {
+		relationship, err := parseRelationship(specification)
+		if err != nil {
+			log.Error().Err(err).Msg(wrongRelationshipMsg)
+			return nil, err
+		}
+		relationships = append(relationships, relationship)
+	}
+
+	return relationships, nil
+}
+
+// readColumnNames method reads names of columns of all given tables.
+func (storage DBStorage) readColumnNames(ctx context.Context, tableNames []TableName) (map[TableName]map[string]bool, error) {
+	columns := make(map[TableName]map[string]bool, len(tableNames))
+
+	for _, tableName := range tableNames {
+		columnTypes, err := storage.RetrieveColumnTypes(ctx, tableName)
+		if err != nil {
+			return nil, err
+		}
+
+		columns[tableName] = make(map[string]bool, len(columnTypes))
+		for _, columnName := range getColumnNames(columnTypes) {
+			columns[tableName][columnName] = true
+		}
+	}
+
+	return columns, nil
+}
+
+// usableRelationships function returns relationships that refer to existing
+// tables and columns, grouped by child table. Self references are ignored,
+// because they can't refer to rows outside of the table.
+func usableRelationships(relationships []Relationship,
+	columns map[TableName]map[string]bool) map[TableName][]Relationship {
+	usable := make(map[TableName][]Relationship)
+	seen := make(map[string]bool)
+
+	for _, relationship := range relationships {
+		if relationship.Table == relationship.ParentTable || seen[relationship.String()] {
+			continue
+		}
+
+		if !hasColumns(columns[relationship.Table], relationship.Columns) ||
+			!hasColumns(columns[relationship.ParentTable], relationship.ParentColumns) {
+			log.Warn().
+				Str(relationshipMsg, relationship.String()).
+				Msg(unusableRelationshipMsg)
+			continue
+		}
+
+		seen[relationship.String()] = true
+		usable[relationship.Table] = append(usable[relationship.Table], relationship)
+	}
+
+	return usable
+}
+
+// hasColumns function checks if all given columns exist.
+func hasColumns(existing map[string]bool, columns []string) bool {
+	for _, column := range columns {
+		if !existing[column] {
+			return false
+		}
+	}
+	return true
+}
+
+// buildSubsetPlan function constructs condition for each table so only rows
+// that belong to given organizations are exported. Tables with org_id column
+// are filtered directly by organization ID, tables that depend on other
+// tables are filtered by rows selected from the parent tables. Both
+// conditions are used for tables with org_id column that depend on other
+// tables. Tables not related to organizations have empty condition and are
+// exported entirely.
+func buildSubsetPlan(tableNames []TableName, columns map[TableName]map[string]bool,
+	relationships map[TableName][]Relationship, orgIDs []string) map[TableName]string {
+	plan := make(map[TableName]string, len(tableNames))
+
+	orgFilter := fmt.Sprintf(orgIDCondition, strings.Join(orgIDs, "','"))
+
+	// condition used when table can't be filtered by its parents
+	directCondition := func(tableName TableName) string {
+		if columns[tableName][orgIDColumn] {
+			return orgFilter
+		}
+		return ""
+	}
+
+	// resolve conditions until fixpoint is reached: condition for table
+	// can be constructed only when conditions for all its parents are known
+	for changed := true; changed; {
+		changed = false
+		for _, tableName := range tableNames {
+			if _, planned := plan[tableName]; planned {
+				continue
+			}
+
+			condition, resolved := parentsCondition(plan, relationships[tableName])
+			if !resolved {
+				continue
+			}
+			plan[tableName] = joinConditions(directCondition(tableName), condition)
+			changed = true
+		}
+	}
+
+	// tables with cyclic dependencies
+	for _, tableName := range tableNames {
+		if _, planned := plan[tableName]; !planned {
+			log.Warn().
+				Str(tableNameMsg, string(tableName)).
+				Msg("Cyclic relationship found, filtering table by org_id only")
+			plan[tableName] = directCondition(tableName)
+		}
+	}
+
+	return plan
+}
+
+// parentsCondition function constructs condition that selects only rows
+// referring to rows exported from parent tables. False is returned when
+// condition for any parent table is not known yet.
+func parentsCondition(plan map[TableName]string, relationships []Relationship) (string, bool) {
+	var conditions []string
+
+	for _, relationship := range relationships {
+		parentCondition, planned := plan[relationship.ParentTable]
+		if !planned {
+			return "", false
+		}
+
+		// parent table is exported entirely
+		if parentCondition == "" {
+			continue
+		}
+
+		// it is not possible to use parameter for table name or a key
+		// disable "G201 (CWE-89): SQL string formatting (Confidence: HIGH, Severity: MEDIUM)"
+		// #nosec G201
+		conditions = append(conditions, fmt.Sprintf(relationshipCondition,
+			columnList(relationship.Columns), strings.Join(relationship.ParentColumns, ", "),
+			relationship.ParentTable, parentCondition))
+	}
+
+	// make the condition stable
+	sort.Strings(conditions)
+	return joinConditions(conditions...), true
+}
+
+// columnList function returns column or row value constructor used to
+// compare composite key.
+func columnList(columns []string) string {
+	if len(columns) == 1 {
+		return columns[0]
+	}
+	return "(" + strings.Join(columns, ", ") + ")"
+}
+
+// joinConditions function joins all non-empty conditions by AND.
+func joinConditions(conditions ...string) string {
+	var nonEmpty []string
+	for _, condition := range conditions {
+		if condition != "" {
+			nonEmpty = append(nonEmpty, condition)
+		}
+	}
+	return strings.Join(nonEmpty, " AND ")
+}
+
+// subsetStructure contains information about database structure that is
+// needed to construct subset plan for any set of organizations.
+type subsetStructure struct {
+	tableNames    []TableName
+	columns       map[TableName]map[string]bool
+	relationships map[TableName][]Relationship
+}
+
+// readSubsetStructure method reads columns of given tables and relationships
+// between them.
+func (storage DBStorage) readSubsetStructure(ctx context.Context, tableNames []TableName) (subsetStructure, error) {
+	var structure subsetStructure
+
+	columns, err := storage.readColumnNames(ctx, tableNames)
+	if err != nil {
+		return structure, err
+	}
+
+	relationships, err := storage.readRelationships(ctx, tableNames)
+	if err != nil {
+		return structure, err
+	}
+
+	structure.tableNames = tableNames
+	structure.columns = columns
+	structure.relationships = usableRelationships(relationships, columns)
+	return structure, nil
+}
+
+// plan method constructs subset plan for given organizations.
+func (structure subsetStructure) plan(orgIDs []string) map[TableName]string {
+	return buildSubsetPlan(structure.tableNames, structure.columns,
+		structure.relationships, orgIDs)
+}
+
+// BuildSubsetPlan method reads structure of the database and constructs
+// conditions used to export referentially consistent subset of data that
+// belong to organizations selected in configuration.
+func (storage DBStorage) BuildSubsetPlan(ctx context.Context) (map[TableName]string, error) {
+	tableNames, err := storage.ReadListOfTables(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	structure, err := storage.readSubsetStructure(ctx, tableNames)
+	if err != nil {
+		return nil, err
+	}
+
+	plan := structure.plan(storage.config.OrganizationsToExport)
+
+	for _, tableName := range tableNames {
+		log.Debug().
+			Str(tableNameMsg, string(tableName)).
+			Str("condition", plan[tableName]).
+			Msg(subsetConditionMsg)
+	}
+
+	return plan, nil
+}
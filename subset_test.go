@@ -0,0 +1,264 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/subset_test.html
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// TestParseRelationship checks parsing of relationship specification
+func TestParseRelationship(t *testing.T) {
+	relationship, err := main.ParseRelationship("report_info.cluster_id -> report.cluster")
+	assert.NoError(t, err)
+	assert.Equal(t, main.Relationship{
+		Table:         "report_info",
+		Columns:       []string{"cluster_id"},
+		ParentTable:   "report",
+		ParentColumns: []string{"cluster"},
+	}, relationship)
+	assert.Equal(t, "report_info.cluster_id->report.cluster", relationship.String())
+
+	// composite key
+	relationship, err = main.ParseRelationship("toggle_note.cluster_id, rule_id->cluster_rule_toggle.cluster_id,rule_id")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"cluster_id", "rule_id"}, relationship.Columns)
+	assert.Equal(t, []string{"cluster_id", "rule_id"}, relationship.ParentColumns)
+}
+
+// TestParseRelationshipWrongSpecification checks parsing of improper
+// relationship specifications
+func TestParseRelationshipWrongSpecification(t *testing.T) {
+	specifications := []string{
+		"",
+		"report_info.cluster_id",
+		"report_info->report.cluster",
+		"report_info.cluster_id->report",
+		".cluster_id->report.cluster",
+		"report_info.->report.cluster",
+		"report_info.cluster_id,->report.cluster",
+		"report_info.cluster_id,version->report.cluster",
+	}
+
+	for _, specification := range specifications {
+		_, err := main.ParseRelationship(specification)
+		assert.Error(t, err, specification)
+	}
+}
+
+// check the method readRelationships when invalid driver is used
+func TestReadRelationshipsInvalidDriver(t *testing.T) {
+	connection, mock := mustCreateMockConnection(t)
+	mock.ExpectClose()
+
+	storage := main.NewFromConnection(connection, -1, &testConfig)
+
+	_, err := main.ReadRelationships(*storage, context.Background(), []main.TableName{"report"})
+	assert.Error(t, err)
+
+	checkConnectionClose(t, connection)
+	checkAllExpectations(t, mock)
+}
+
+// check the method readRelationships against real SQLite database
+func TestReadRelationshipsSQLite(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t,
+		"CREATE TABLE report (org_id INTEGER, cluster TEXT PRIMARY KEY)",
+		"CREATE TABLE note (id INTEGER PRIMARY KEY, cluster TEXT REFERENCES report(cluster))",
+		"CREATE TABLE other (id INTEGER PRIMARY KEY, cluster TEXT REFERENCES report)",
+		"CREATE TABLE toggle (cluster TEXT, rule TEXT, PRIMARY KEY (cluster, rule))",
+		"CREATE TABLE toggle_note (id INTEGER PRIMARY KEY, cluster TEXT, rule TEXT, "+
+			"FOREIGN KEY (cluster, rule) REFERENCES toggle(cluster, rule))")
+
+	config := testConfig
+	config.Relationships = []string{"toggle.cluster->report.cluster"}
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	relationships, err := main.ReadRelationships(*storage, context.Background(),
+		[]main.TableName{"report", "note", "other", "toggle", "toggle_note"})
+	assert.NoError(t, err)
+
+	// reference to implicit primary key is skipped, columns of composite
+	// key are kept together
+	assert.Equal(t, []main.Relationship{
+		{
+			Table: "note", Columns: []string{"cluster"},
+			ParentTable: "report", ParentColumns: []string{"cluster"},
+		},
+		{
+			Table: "toggle_note", Columns: []string{"cluster", "rule"},
+			ParentTable: "toggle", ParentColumns: []string{"cluster", "rule"},
+		},
+		{
+			Table: "toggle", Columns: []string{"cluster"},
+			ParentTable: "report", ParentColumns: []string{"cluster"},
+		},
+	}, relationships)
+
+	checkConnectionClose(t, connection)
+}
+
+// mustCreateSubsetDatabase helper function creates database with tables
+// filtered by org_id, tables related to other tables and tables not related to
+// organizations
+func mustCreateSubsetDatabase(t *testing.T) *sql.DB {
+	return mustCreateSQLiteConnection(t,
+		"CREATE TABLE report (org_id INTEGER, cluster TEXT PRIMARY KEY)",
+		"INSERT INTO report VALUES (1, 'a'), (1, 'b'), (2, 'c'), (3, 'd')",
+		"CREATE TABLE report_info (org_id INTEGER, cluster_id TEXT PRIMARY KEY, version_info TEXT)",
+		"INSERT INTO report_info VALUES (1, 'a', '1.0'), (2, 'c', '1.1'), (3, 'd', '1.2'), (2, 'b', '1.3')",
+		"CREATE TABLE cluster_rule_toggle (cluster_id TEXT, rule_id TEXT, PRIMARY KEY (cluster_id, rule_id))",
+		"INSERT INTO cluster_rule_toggle VALUES ('a', 'r1'), ('b', 'r2'), ('d', 'r3')",
+		"CREATE TABLE toggle_note (id INTEGER PRIMARY KEY, cluster_id TEXT, rule_id TEXT, note TEXT, "+
+			"FOREIGN KEY (cluster_id, rule_id) REFERENCES cluster_rule_toggle(cluster_id, rule_id))",
+		"INSERT INTO toggle_note VALUES (1, 'a', 'r1', 'x'), (2, 'd', 'r3', 'y'), (3, 'a', 'r3', 'z')",
+		"CREATE TABLE migration_info (version INTEGER)",
+		"INSERT INTO migration_info VALUES (23)")
+}
+
+// clusterRelationships contains relationships of tables keyed by cluster ID
+// that are not expressed by foreign keys
+var clusterRelationships = []string{
+	"report_info.cluster_id->report.cluster",
+	"cluster_rule_toggle.cluster_id->report.cluster",
+}
+
+// readColumn helper function reads given column from all exported rows
+func readColumn(t *testing.T, storage *main.DBStorage, tableName main.TableName, column string) []string {
+	rows, err := storage.ReadTable(context.Background(), tableName, NoLimits)
+	assert.NoError(t, err)
+
+	var values []string
+	for _, row := range rows {
+		values = append(values, fmt.Sprint(row[column]))
+	}
+	return values
+}
+
+// check the method BuildSubsetPlan against real SQLite database
+func TestBuildSubsetPlan(t *testing.T) {
+	connection := mustCreateSubsetDatabase(t)
+
+	config := testConfig
+	config.EnableOrgIDFiltering = true
+	config.OrganizationsToExport = []string{"1", "3"}
+	config.Relationships = clusterRelationships
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	plan, err := storage.BuildSubsetPlan(context.Background())
+	assert.NoError(t, err)
+
+	// tables with org_id column that depend on other tables are filtered
+	// by both conditions
+	orgFilter := "org_id IN ('1','3')"
+	reportFilter := "cluster_id IN (SELECT cluster FROM report WHERE " + orgFilter + ")"
+	assert.Equal(t, map[main.TableName]string{
+		"report":              orgFilter,
+		"report_info":         orgFilter + " AND " + reportFilter,
+		"cluster_rule_toggle": reportFilter,
+		"toggle_note": "(cluster_id, rule_id) IN (SELECT cluster_id, rule_id " +
+			"FROM cluster_rule_toggle WHERE " + reportFilter + ")",
+		"migration_info": "",
+	}, plan)
+
+	checkConnectionClose(t, connection)
+}
+
+// check that subset of data exported with subset plan does not contain
+// dangling references
+func TestReadTableWithSubsetPlan(t *testing.T) {
+	connection := mustCreateSubsetDatabase(t)
+
+	config := testConfig
+	config.EnableOrgIDFiltering = true
+	config.OrganizationsToExport = []string{"1", "3"}
+	config.Relationships = clusterRelationships
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	plan, err := storage.BuildSubsetPlan(context.Background())
+	assert.NoError(t, err)
+	main.SetSubset(storage, plan)
+
+	assert.Equal(t, []string{"a", "b", "d"}, readColumn(t, storage, "report", "cluster"))
+	assert.Equal(t, []string{"a", "d"}, readColumn(t, storage, "report_info", "cluster_id"))
+	assert.Equal(t, []string{"a", "b", "d"}, readColumn(t, storage, "cluster_rule_toggle", "cluster_id"))
+	assert.Equal(t, []string{"1", "2"}, readColumn(t, storage, "toggle_note", "id"))
+	assert.Equal(t, []string{"23"}, readColumn(t, storage, "migration_info", "version"))
+
+	// number of records needs to be consistent with exported rows
+	count, err := storage.ReadRecordsCount(context.Background(), "report_info")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, count)
+
+	checkConnectionClose(t, connection)
+}
+
+// check the method BuildSubsetPlan with relationship specified in
+// configuration
+func TestBuildSubsetPlanConfiguredRelationship(t *testing.T) {
+	connection := mustCreateSubsetDatabase(t)
+
+	config := testConfig
+	config.EnableOrgIDFiltering = true
+	config.OrganizationsToExport = []string{"2"}
+	config.Relationships = append([]string{
+		"toggle_note.cluster_id->report.cluster",
+		// unknown tables and columns are ignored
+		"unknown.cluster_id->report.cluster",
+		"report_info.unknown->report.cluster",
+	}, clusterRelationships...)
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	plan, err := storage.BuildSubsetPlan(context.Background())
+	assert.NoError(t, err)
+	main.SetSubset(storage, plan)
+
+	// filtered by both parent tables
+	assert.Empty(t, readColumn(t, storage, "toggle_note", "id"))
+	assert.Equal(t, []string{"c"}, readColumn(t, storage, "report_info", "cluster_id"))
+
+	checkConnectionClose(t, connection)
+}
+
+// check the method BuildSubsetPlan with improper relationship specified in
+// configuration
+func TestBuildSubsetPlanWrongRelationship(t *testing.T) {
+	connection := mustCreateSubsetDatabase(t)
+
+	config := testConfig
+	config.EnableOrgIDFiltering = true
+	config.OrganizationsToExport = []string{"2"}
+	config.Relationships = []string{"toggle_note.cluster_id"}
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	_, err := storage.BuildSubsetPlan(context.Background())
+	assert.Error(t, err)
+
+	checkConnectionClose(t, connection)
+}
@@ -0,0 +1,228 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains summary report printed after export when
+// -summary flag is used. Summary contains number of rows and bytes exported
+// from each table, duration, throughput and status of export. The same
+// summary is stored into _summary.json file or object.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/summary.html
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+)
+
+// Messages
+const (
+	storeSummaryFailed = "Store summary failed"
+	printSummaryFailed = "Print summary table failed"
+)
+
+// Status of table export
+const (
+	tableStatusOK     = "ok"
+	tableStatusFailed = "failed"
+)
+
+// summaryTableHeader contains header of printed summary table
+const summaryTableHeader = "Table\tPrefix\tRows\tBytes\tDuration\tRows/s\tBytes/s\tStatus"
+
+// TableStats contains number of rows and bytes written during export of one
+// table.
+type TableStats struct {
+	// Rows is number of exported rows (without CSV header)
+	Rows int
+
+	// Bytes is size of data written into file or S3 object
+	Bytes int64
+}
+
+// statsKey identifies table exported under given prefix
+type statsKey struct {
+	prefix    string
+	tableName TableName
+}
+
+// ExportStats contains statistic for all exported tables.
+type ExportStats struct {
+	tables map[statsKey]TableStats
+}
+
+// NewExportStats function constructs empty export statistic.
+func NewExportStats() *ExportStats {
+	return &ExportStats{
+		tables: make(map[statsKey]TableStats),
+	}
+}
+
+// Record method records statistic for table exported under given prefix.
+func (stats *ExportStats) Record(prefix string, tableName TableName, tableStats TableStats) {
+	if stats == nil {
+		return
+	}
+	stats.tables[statsKey{prefix, tableName}] = tableStats
+}
+
+// Get method returns statistic for table exported under given prefix.
+func (stats *ExportStats) Get(prefix string, tableName TableName) TableStats {
+	if stats == nil {
+		return TableStats{}
+	}
+	return stats.tables[statsKey{prefix, tableName}]
+}
+
+// TableSummary represents summary of export of one table.
+type TableSummary struct {
+	TableName      TableName `json:"table,omitempty"`
+	Prefix         string    `json:"prefix,omitempty"`
+	Rows           int       `json:"rows"`
+	Bytes          int64     `json:"bytes"`
+	Duration       float64   `json:"duration_seconds"`
+	RowsPerSecond  float64   `json:"rows_per_second"`
+	BytesPerSecond float64   `json:"bytes_per_second"`
+	Status         string    `json:"status,omitempty"`
+	Error          string    `json:"error,omitempty"`
+
+	duration time.Duration
+}
+
+// ExportSummary represents summary of the whole export.
+type ExportSummary struct {
+	Tables []TableSummary `json:"tables"`
+	Total  TableSummary   `json:"total"`
+}
+
+// NewExportSummary function constructs empty export summary.
+func NewExportSummary() *ExportSummary {
+	return &ExportSummary{
+		Tables: make([]TableSummary, 0),
+	}
+}
+
+// Add method adds export of one table into summary.
+func (summary *ExportSummary) Add(tableName TableName, prefix string,
+	stats TableStats, duration time.Duration, err error) {
+	tableSummary := TableSummary{
+		TableName: tableName,
+		Prefix:    prefix,
+		Rows:      stats.Rows,
+		Bytes:     stats.Bytes,
+		Status:    tableStatusOK,
+	}
+	if err != nil {
+		tableSummary.Status = tableStatusFailed
+		tableSummary.Error = err.Error()
+	}
+	tableSummary.computeRates(duration)
+	summary.Tables = append(summary.Tables, tableSummary)
+
+	total := &summary.Total
+	total.Rows += stats.Rows
+	total.Bytes += stats.Bytes
+	total.computeRates(total.duration + duration)
+}
+
+// computeRates method computes throughput for given duration.
+func (tableSummary *TableSummary) computeRates(duration time.Duration) {
+	tableSummary.duration = duration
+	tableSummary.Duration = duration.Seconds()
+	if tableSummary.Duration > 0 {
+		tableSummary.RowsPerSecond = float64(tableSummary.Rows) / tableSummary.Duration
+		tableSummary.BytesPerSecond = float64(tableSummary.Bytes) / tableSummary.Duration
+	}
+}
+
+// SummaryToJSON function exports summary into JSON.
+func SummaryToJSON(buffer io.Writer, summary *ExportSummary) error {
+	if buffer == nil {
+		err := errors.New(bufferIsNil)
+		return err
+	}
+
+	encoder := json.NewEncoder(buffer)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(summary)
+}
+
+// PrintSummaryTable function prints summary as formatted table.
+func PrintSummaryTable(output io.Writer, summary *ExportSummary) error {
+	if output == nil {
+		err := errors.New(bufferIsNil)
+		return err
+	}
+
+	writer := tabwriter.NewWriter(output, 0, 0, 2, ' ', 0)
+
+	_, err := fmt.Fprintln(writer, summaryTableHeader)
+	if err != nil {
+		return err
+	}
+
+	for _, tableSummary := range summary.Tables {
+		err = printSummaryRow(writer, tableSummary)
+		if err != nil {
+			return err
+		}
+	}
+
+	total := summary.Total
+	total.TableName = "TOTAL"
+	err = printSummaryRow(writer, total)
+	if err != nil {
+		return err
+	}
+
+	return writer.Flush()
+}
+
+// printSummaryRow function prints one row of summary table.
+func printSummaryRow(writer io.Writer, tableSummary TableSummary) error {
+	_, err := fmt.Fprintf(writer, "%s\t%s\t%d\t%d\t%s\t%.1f\t%.1f\t%s\n",
+		tableSummary.TableName,
+		tableSummary.Prefix,
+		tableSummary.Rows,
+		tableSummary.Bytes,
+		tableSummary.duration.Round(time.Millisecond),
+		tableSummary.RowsPerSecond,
+		tableSummary.BytesPerSecond,
+		tableSummary.Status)
+	return err
+}
+
+// countingWriter is a writer that counts number of bytes written into
+// underlying writer.
+type countingWriter struct {
+	writer io.Writer
+	count  int64
+}
+
+// Write method writes data into underlying writer and counts them.
+func (writer *countingWriter) Write(data []byte) (int, error) {
+	n, err := writer.writer.Write(data)
+	writer.count += int64(n)
+	return n, err
+}
@@ -0,0 +1,239 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/summary_test.html
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// prepareSummary helper function constructs summary with two tables
+func prepareSummary() *main.ExportSummary {
+	summary := main.NewExportSummary()
+	summary.Add("report", "org_id=1",
+		main.TableStats{Rows: 10, Bytes: 500},
+		2*time.Second, nil)
+	summary.Add("rule_hit", "", main.TableStats{},
+		time.Second, errors.New("connection reset"))
+	return summary
+}
+
+// TestExportSummaryAdd checks computing of throughput
+func TestExportSummaryAdd(t *testing.T) {
+	summary := prepareSummary()
+
+	assert.Len(t, summary.Tables, 2)
+
+	report := summary.Tables[0]
+	assert.Equal(t, main.TableName("report"), report.TableName)
+	assert.Equal(t, "org_id=1", report.Prefix)
+	assert.Equal(t, 10, report.Rows)
+	assert.Equal(t, int64(500), report.Bytes)
+	assert.Equal(t, 2.0, report.Duration)
+	assert.Equal(t, 5.0, report.RowsPerSecond)
+	assert.Equal(t, 250.0, report.BytesPerSecond)
+	assert.Equal(t, "ok", report.Status)
+	assert.Empty(t, report.Error)
+
+	ruleHit := summary.Tables[1]
+	assert.Equal(t, "failed", ruleHit.Status)
+	assert.Equal(t, "connection reset", ruleHit.Error)
+	assert.Zero(t, ruleHit.Rows)
+
+	total := summary.Total
+	assert.Equal(t, 10, total.Rows)
+	assert.Equal(t, int64(500), total.Bytes)
+	assert.Equal(t, 3.0, total.Duration)
+}
+
+// TestExportSummaryZeroDuration checks that throughput is not computed for
+// zero duration
+func TestExportSummaryZeroDuration(t *testing.T) {
+	summary := main.NewExportSummary()
+	summary.Add("report", "", main.TableStats{Rows: 1, Bytes: 1}, 0, nil)
+
+	assert.Zero(t, summary.Tables[0].RowsPerSecond)
+	assert.Zero(t, summary.Tables[0].BytesPerSecond)
+}
+
+// TestSummaryToJSONNilBuffer check how nil buffer is handled by
+// SummaryToJSON function
+func TestSummaryToJSONNilBuffer(t *testing.T) {
+	err := main.SummaryToJSON(nil, main.NewExportSummary())
+	assert.Error(t, err, "Buffer is nil")
+}
+
+// TestSummaryToJSON check exporting summary into JSON
+func TestSummaryToJSON(t *testing.T) {
+	buffer := new(bytes.Buffer)
+
+	err := main.SummaryToJSON(buffer, prepareSummary())
+	assert.NoError(t, err)
+
+	var decoded map[string]interface{}
+	err = json.Unmarshal(buffer.Bytes(), &decoded)
+	assert.NoError(t, err)
+
+	tables := decoded["tables"].([]interface{})
+	assert.Len(t, tables, 2)
+
+	report := tables[0].(map[string]interface{})
+	assert.Equal(t, "report", report["table"])
+	assert.Equal(t, 10.0, report["rows"])
+	assert.Equal(t, 500.0, report["bytes"])
+	assert.Equal(t, 2.0, report["duration_seconds"])
+	assert.Equal(t, 5.0, report["rows_per_second"])
+	assert.Equal(t, 250.0, report["bytes_per_second"])
+	assert.Equal(t, "ok", report["status"])
+
+	total := decoded["total"].(map[string]interface{})
+	assert.Equal(t, 10.0, total["rows"])
+	assert.NotContains(t, total, "table")
+}
+
+// TestPrintSummaryTableNilBuffer check how nil output is handled by
+// PrintSummaryTable function
+func TestPrintSummaryTableNilBuffer(t *testing.T) {
+	err := main.PrintSummaryTable(nil, main.NewExportSummary())
+	assert.Error(t, err, "Buffer is nil")
+}
+
+// TestPrintSummaryTable check printing summary as formatted table
+func TestPrintSummaryTable(t *testing.T) {
+	buffer := new(bytes.Buffer)
+
+	err := main.PrintSummaryTable(buffer, prepareSummary())
+	assert.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSpace(buffer.String()), "\n")
+	assert.Len(t, lines, 4)
+	assert.Equal(t, []string{"Table", "Prefix", "Rows", "Bytes", "Duration",
+		"Rows/s", "Bytes/s", "Status"}, strings.Fields(lines[0]))
+	assert.Equal(t, []string{"report", "org_id=1", "10", "500", "2s",
+		"5.0", "250.0", "ok"}, strings.Fields(lines[1]))
+	assert.Equal(t, []string{"rule_hit", "0", "0", "1s",
+		"0.0", "0.0", "failed"}, strings.Fields(lines[2]))
+	assert.Equal(t, []string{"TOTAL", "10", "500", "3s",
+		"3.3", "166.7"}, strings.Fields(lines[3]))
+}
+
+// TestStoreTableIntoDirectoryStats checks that number of rows and bytes
+// written into file are recorded
+func TestStoreTableIntoDirectoryStats(t *testing.T) {
+	connection := mustCreateSQLiteConnection(t,
+		"CREATE TABLE t (id INTEGER PRIMARY KEY, value TEXT)",
+		"INSERT INTO t VALUES (1, 'a'), (2, 'b')")
+
+	config := testConfig
+	config.EnableOrgIDFiltering = false
+	storage := main.NewFromConnection(connection, main.DBDriverSQLite3, &config)
+
+	directory := t.TempDir()
+	err := storage.StoreTable(context.Background(), main.NewFileSink("", false), directory, "t", NoLimits)
+	assert.NoError(t, err)
+
+	stats := storage.Stats(directory, "t")
+	assert.Equal(t, 2, stats.Rows)
+	assert.Equal(t, int64(len("id,value\n1,a\n2,b\n")), stats.Bytes)
+
+	// nothing has been exported under other prefix
+	assert.Equal(t, main.TableStats{}, storage.Stats("", "t"))
+
+	checkConnectionClose(t, connection)
+}
+
+// TestPerformDataExportSummary checks that summary is stored when -summary
+// flag is used
+func TestPerformDataExportSummary(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:            "file",
+		Limit:             NoLimits,
+		ContinueOnError:   true,
+		PrintSummaryTable: true,
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.Equal(t, main.ExitStatusPartialSuccess, code)
+	assert.NoError(t, err)
+
+	content, err := os.ReadFile(filepath.Join(directory, "_summary.json"))
+	assert.NoError(t, err)
+
+	var summary main.ExportSummary
+	err = json.Unmarshal(content, &summary)
+	assert.NoError(t, err)
+
+	assert.Len(t, summary.Tables, 2)
+	statuses := map[main.TableName]string{}
+	for _, table := range summary.Tables {
+		statuses[table.TableName] = table.Status
+	}
+	assert.Equal(t, map[main.TableName]string{"good": "ok", "bad": "failed"}, statuses)
+	assert.Equal(t, 2, summary.Total.Rows)
+}
+
+// TestPerformDataExportSummaryOnFailure checks that summary is stored when
+// export stops on failed table too
+func TestPerformDataExportSummaryOnFailure(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:            "file",
+		Limit:             NoLimits,
+		PrintSummaryTable: true,
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.Equal(t, main.ExitStatusStorageError, code)
+	assert.Error(t, err)
+
+	content, err := os.ReadFile(filepath.Join(directory, "_summary.json"))
+	assert.NoError(t, err)
+
+	var summary main.ExportSummary
+	err = json.Unmarshal(content, &summary)
+	assert.NoError(t, err)
+
+	assert.NotEmpty(t, summary.Tables)
+	last := summary.Tables[len(summary.Tables)-1]
+	assert.Equal(t, main.TableName("bad"), last.TableName)
+	assert.Equal(t, "failed", last.Status)
+}
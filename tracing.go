@@ -0,0 +1,210 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main
+
+// This source file contains OpenTelemetry tracing of the export pipeline.
+// The whole export, each table export, database queries and S3 uploads are
+// recorded as spans. Spans are exported via OTLP/HTTP into configured
+// endpoint or into local file for offline analysis. Tracing is disabled
+// when no exporter is configured.
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/tracing.html
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"github.com/rs/zerolog/log"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/exporters/stdout/stdouttrace"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Messages
+const (
+	tracingInitialized     = "Tracing initialized"
+	tracingInitFailed      = "Unable to initialize tracing"
+	tracingShutdownFailed  = "Unable to flush traces"
+	unknownTracingExporter = "Unknown tracing exporter: %s"
+	exporterMsg            = "exporter"
+)
+
+// Supported tracing exporters
+const (
+	tracingExporterNone = ""
+	tracingExporterOTLP = "otlp"
+	tracingExporterFile = "file"
+)
+
+// Tracing related constants
+const (
+	tracerName         = "github.com/RedHatInsights/insights-results-aggregator-exporter"
+	defaultServiceName = "insights-results-aggregator-exporter"
+)
+
+// Span names
+const (
+	exportSpan      = "export"
+	exportTableSpan = "export table"
+	uploadSpan      = "upload"
+)
+
+// Span attributes
+const (
+	tableAttribute      = "table"
+	prefixAttribute     = "prefix"
+	rowsAttribute       = "rows"
+	bytesAttribute      = "bytes"
+	retriesAttribute    = "retries"
+	outputAttribute     = "output"
+	exitStatusAttribute = "exit_status"
+	bucketAttribute     = "s3.bucket"
+	objectAttribute     = "s3.object"
+	statementAttribute  = "db.query.text"
+	dbSystemAttribute   = "db.system"
+)
+
+// TracingConfiguration represents configuration of OpenTelemetry tracing
+type TracingConfiguration struct {
+	// Exporter selects where spans are exported: "otlp", "file" or empty
+	// string when tracing is disabled
+	Exporter string `mapstructure:"exporter" toml:"exporter"`
+
+	// Endpoint is URL of OTLP/HTTP endpoint, for example
+	// http://localhost:4318
+	Endpoint string `mapstructure:"endpoint" toml:"endpoint"`
+
+	// File is name of file spans are written into by file exporter
+	File string `mapstructure:"file" toml:"file"`
+
+	// ServiceName is reported as service.name resource attribute
+	ServiceName string `mapstructure:"service_name" toml:"service_name"`
+}
+
+// initTracing function initializes tracer provider according to
+// configuration. Returned function needs to be called at the end of export,
+// so all spans are flushed.
+func initTracing(configuration TracingConfiguration) (func(), error) {
+	noop := func() {}
+
+	var exporter sdktrace.SpanExporter
+	var closeFile func() error
+
+	switch configuration.Exporter {
+	case tracingExporterNone:
+		return noop, nil
+	case tracingExporterOTLP:
+		otlpExporter, err := otlptracehttp.New(context.Background(),
+			otlptracehttp.WithEndpointURL(configuration.Endpoint))
+		if err != nil {
+			return noop, err
+		}
+		exporter = otlpExporter
+	case tracingExporterFile:
+		// disable "G304 (CWE-22): Potential file inclusion via variable"
+		file, err := os.Create(configuration.File) // #nosec G304
+		if err != nil {
+			return noop, err
+		}
+		fileExporter, err := stdouttrace.New(stdouttrace.WithWriter(file))
+		if err != nil {
+			_ = file.Close()
+			return noop, err
+		}
+		exporter = fileExporter
+		closeFile = file.Close
+	default:
+		return noop, fmt.Errorf(unknownTracingExporter, configuration.Exporter)
+	}
+
+	serviceName := configuration.ServiceName
+	if serviceName == "" {
+		serviceName = defaultServiceName
+	}
+
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(resource.NewSchemaless(
+			attribute.String("service.name", serviceName))),
+	)
+	previous := otel.GetTracerProvider()
+	otel.SetTracerProvider(provider)
+
+	log.Info().Str(exporterMsg, configuration.Exporter).Msg(tracingInitialized)
+
+	return func() {
+		err := provider.Shutdown(context.Background())
+		if err != nil {
+			log.Error().Err(err).Msg(tracingShutdownFailed)
+		}
+		if closeFile != nil {
+			err = closeFile()
+			if err != nil {
+				log.Error().Err(err).Msg(tracingShutdownFailed)
+			}
+		}
+		otel.SetTracerProvider(previous)
+	}, nil
+}
+
+// startSpan function starts new span as a child of span stored in context.
+func startSpan(ctx context.Context, name string, attributes ...attribute.KeyValue) (context.Context, trace.Span) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	return otel.Tracer(tracerName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// endSpan function records error (if any) and ends the span.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// setSpanAttributes function sets attributes of span stored in context.
+func setSpanAttributes(ctx context.Context, attributes ...attribute.KeyValue) {
+	trace.SpanFromContext(ctx).SetAttributes(attributes...)
+}
+
+// startTableSpan function starts span for export of one table.
+func startTableSpan(ctx context.Context, prefix string, tableName TableName) (context.Context, trace.Span) {
+	return startSpan(ctx, exportTableSpan,
+		attribute.String(tableAttribute, string(tableName)),
+		attribute.String(prefixAttribute, prefix))
+}
+
+// endTableSpan function records number of exported rows and bytes and ends
+// the span.
+func endTableSpan(span trace.Span, stats TableStats, err error) {
+	span.SetAttributes(
+		attribute.Int(rowsAttribute, stats.Rows),
+		attribute.Int64(bytesAttribute, stats.Bytes))
+	endSpan(span, err)
+}
@@ -0,0 +1,199 @@
+/*
+Copyright © 2026 Red Hat, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package main_test
+
+// Generated documentation is available at:
+// https://pkg.go.dev/github.com/RedHatInsights/insights-results-aggregator-exporter
+//
+// Documentation in literate-programming-style is available at:
+// https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/tracing_test.html
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rs/zerolog/log"
+	"github.com/stretchr/testify/assert"
+
+	main "github.com/RedHatInsights/insights-results-aggregator-exporter"
+)
+
+// recordedSpan represents part of span written by file exporter
+type recordedSpan struct {
+	Name       string `json:"Name"`
+	Attributes []struct {
+		Key   string `json:"Key"`
+		Value struct {
+			Value interface{} `json:"Value"`
+		} `json:"Value"`
+	} `json:"Attributes"`
+}
+
+// attribute method returns value of span attribute with given key
+func (span recordedSpan) attribute(key string) interface{} {
+	for _, attribute := range span.Attributes {
+		if attribute.Key == key {
+			return attribute.Value.Value
+		}
+	}
+	return nil
+}
+
+// mustReadSpans helper function reads all spans written by file exporter
+func mustReadSpans(t *testing.T, fileName string) []recordedSpan {
+	content, err := os.ReadFile(fileName)
+	assert.NoError(t, err)
+
+	var spans []recordedSpan
+	decoder := json.NewDecoder(bytes.NewReader(content))
+	for decoder.More() {
+		var span recordedSpan
+		err := decoder.Decode(&span)
+		assert.NoError(t, err)
+		spans = append(spans, span)
+	}
+	return spans
+}
+
+// TestInitTracingDisabled checks that tracing is disabled when no exporter
+// is configured
+func TestInitTracingDisabled(t *testing.T) {
+	shutdown, err := main.InitTracing(main.TracingConfiguration{})
+	assert.NoError(t, err)
+	shutdown()
+}
+
+// TestInitTracingUnknownExporter checks that unknown exporter is reported
+func TestInitTracingUnknownExporter(t *testing.T) {
+	_, err := main.InitTracing(main.TracingConfiguration{Exporter: "zipkin"})
+	assert.EqualError(t, err, "Unknown tracing exporter: zipkin")
+}
+
+// TestInitTracingWrongFile checks that error is reported when file for
+// spans can't be created
+func TestInitTracingWrongFile(t *testing.T) {
+	_, err := main.InitTracing(main.TracingConfiguration{
+		Exporter: "file",
+		File:     filepath.Join(t.TempDir(), "missing", "spans.json"),
+	})
+	assert.Error(t, err)
+}
+
+// TestPerformDataExportTracingFile checks that export, table exports and
+// queries are written into file as spans
+func TestPerformDataExportTracingFile(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	configuration.Tracing = main.TracingConfiguration{
+		Exporter: "file",
+		File:     filepath.Join(directory, "spans.json"),
+	}
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:          "file",
+		Limit:           NoLimits,
+		ContinueOnError: true,
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.Equal(t, main.ExitStatusPartialSuccess, code)
+	assert.NoError(t, err)
+
+	spans := mustReadSpans(t, configuration.Tracing.File)
+
+	names := map[string]int{}
+	for _, span := range spans {
+		names[span.Name]++
+	}
+	assert.Equal(t, 1, names["export"])
+	assert.Equal(t, 2, names["export table"])
+	// reading of the broken view fails before its content is read
+	assert.Equal(t, 1, names["read table"])
+	assert.Equal(t, 1, names["read list of tables"])
+	// queries performed while statement is constructed are traced too
+	assert.NotZero(t, names["read primary key"])
+
+	for _, span := range spans {
+		switch span.Name {
+		case "export":
+			assert.Equal(t, "file", span.attribute("output"))
+			assert.Equal(t, float64(main.ExitStatusPartialSuccess), span.attribute("exit_status"))
+		case "export table":
+			if span.attribute("table") == "good" {
+				assert.Equal(t, 2.0, span.attribute("rows"))
+				assert.NotZero(t, span.attribute("bytes"))
+			}
+		case "read table", "read primary key":
+			assert.Equal(t, "sqlite", span.attribute("db.system"))
+			assert.NotNil(t, span.attribute("db.query.text"))
+		}
+	}
+}
+
+// TestPerformDataExportTracingOTLP checks that spans are sent into OTLP
+// endpoint
+func TestPerformDataExportTracingOTLP(t *testing.T) {
+	server, requests := mockPushGateway(t, http.StatusOK)
+
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	configuration.Tracing = main.TracingConfiguration{
+		Exporter: "otlp",
+		Endpoint: server.URL,
+	}
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{
+		Output:          "file",
+		Limit:           NoLimits,
+		ContinueOnError: true,
+	}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.Equal(t, main.ExitStatusPartialSuccess, code)
+	assert.NoError(t, err)
+
+	received := requests()
+	assert.NotEmpty(t, received)
+	for _, request := range received {
+		assert.Equal(t, http.MethodPost, request.method)
+		assert.Equal(t, "/v1/traces", request.path)
+	}
+}
+
+// TestPerformDataExportTracingError checks that export is not started when
+// tracing can't be initialized
+func TestPerformDataExportTracingError(t *testing.T) {
+	directory := t.TempDir()
+	configuration := prepareFailingDatabase(t, directory)
+	configuration.Tracing.Exporter = "unknown"
+	t.Chdir(directory)
+
+	cliFlags := main.CliFlags{Output: "file", Limit: NoLimits}
+
+	code, err := main.PerformDataExport(&configuration, cliFlags, &log.Logger, nil)
+	assert.Equal(t, main.ExitStatusConfigurationError, code)
+	assert.Error(t, err)
+
+	_, err = os.Stat(filepath.Join(directory, "good.csv"))
+	assert.True(t, os.IsNotExist(err))
+}
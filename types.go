@@ -22,6 +22,8 @@ package main
 // Documentation in literate-programming-style is available at:
 // https://redhatinsights.github.io/insights-results-aggregator-exporter/packages/types.html
 
+import "time"
+
 // DBDriver type for db driver enum
 type DBDriver int
 
@@ -30,23 +32,58 @@ type TableName string
 
 // DisabledRuleInfo contains information about rules disabled by user
 type DisabledRuleInfo struct {
-	Rule  string
-	Count int
+	Rule                string
+	ErrorKey            string
+	Count               int
+	Orgs                int
+	FirstDisabledAt     string
+	LastDisabledAt      string
+	CountInWindow       int
+	EmptyJustifications int
+	ClusterToggles      int
+	Feedbacks           int
+
+	// PreviousCount is count stored by previous export, nil when rule
+	// was not reported by previous export
+	PreviousCount *int
 }
 
 // CliFlags represents structure holding all command line arguments and flags.
 type CliFlags struct {
-	ShowVersion         bool
-	ShowAuthors         bool
-	ShowConfiguration   bool
-	PrintSummaryTable   bool
-	Output              string
-	CheckS3Connection   bool
-	ExportMetadata      bool
-	ExportDisabledRules bool
-	ExportLog           bool
-	Limit               int
-	IgnoredTables       string
+	ShowVersion               bool
+	ShowAuthors               bool
+	ShowConfiguration         bool
+	PrintSummaryTable         bool
+	Output                    string
+	CheckS3Connection         bool
+	Preflight                 bool
+	DryRun                    bool
+	ExportMetadata            bool
+	ExportDisabledRules       bool
+	ExportRuleHitsSummary     bool
+	ExportFeedbackSummary     bool
+	FeedbackFormat            string
+	FeedbackWithDisabledRules bool
+	FlattenReports            bool
+	ExportLog                 bool
+	ExportSchema              bool
+	ExportSchemaSQL           bool
+	SchemaFormat              string
+	ExportProfile             bool
+	Limit                     int
+	IgnoredTables             string
+	SamplePercent             float64
+	SamplePerOrg              int
+	SampleOrgs                int
+	SampleSeed                int64
+	PartitionByOrg            bool
+	ContinueOnError           bool
+	AcceptSchemaDrift         bool
+	Deadline                  time.Duration
+	DiffFormat                string
+	DiffOutputDir             string
+	OutputDir                 string
+	Force                     bool
 }
 
 // M represents a map with string keys and any value